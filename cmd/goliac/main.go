@@ -2,14 +2,18 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/Alayacare/goliac/internal"
 	"github.com/Alayacare/goliac/internal/config"
+	"github.com/Alayacare/goliac/internal/engine"
 	"github.com/Alayacare/goliac/internal/notification"
+	"github.com/Alayacare/goliac/internal/utils"
 	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/schollz/progressbar/v3"
 	"github.com/sirupsen/logrus"
@@ -23,6 +27,54 @@ var branchParameter string
 var noProgressbar bool
 var goliacAdminTeamnameParameter string
 var usersOnly bool
+var outputParameter string
+var replayParameter string
+var commitParameter string
+var snapshotFileParameter string
+var formatParameter string
+var remoteSnapshotParameter string
+var teamsRepositoryParameter string
+
+/*
+ * planOffline plans a local teams directory against an organization snapshot
+ */
+func planOffline(args []string) {
+	directory := repositoryParameter
+	if len(args) > 0 {
+		directory = args[0]
+	}
+	if directory == "" {
+		logrus.Fatalf("missing the local teams directory. Try --help")
+	}
+	if strings.Contains(directory, "://") || strings.HasPrefix(directory, "git@") {
+		logrus.Fatalf("with --remote-snapshot, the teams repository must be a local directory")
+	}
+	directory, err := filepath.Abs(directory)
+	if err != nil {
+		logrus.Fatalf("invalid directory %s: %s", directory, err)
+	}
+	if outputParameter != "" && outputParameter != "json" && outputParameter != "markdown" {
+		logrus.Fatalf("invalid output format %s (json or markdown)", outputParameter)
+	}
+
+	goliac, err := internal.NewGoliacOfflineImpl(remoteSnapshotParameter, teamsRepositoryParameter)
+	if err != nil {
+		logrus.Fatalf("failed to create goliac: %s", err)
+	}
+	plan, err, _, _ := goliac.Plan(context.Background(), osfs.New("/"), directory, "")
+	if err != nil {
+		logrus.Fatalf("Failed to plan: %v", err)
+	}
+	if outputParameter == "json" {
+		out, err := plan.ToJSON()
+		if err != nil {
+			logrus.Fatalf("Failed to render the plan: %v", err)
+		}
+		fmt.Println(string(out))
+	} else {
+		fmt.Print(plan.ToMarkdown())
+	}
+}
 
 type ProgressBar struct {
 	bar *progressbar.ProgressBar
@@ -76,13 +128,28 @@ func main() {
 	}
 
 	planCmd := &cobra.Command{
-		Use:   "plan [--repository https_team_repository_url] [--branch branch]",
+		Use:   "plan [--repository https_team_repository_url] [--branch branch] [--output json|markdown] [--replay cassette [--commit sha]] [--remote-snapshot snapshot [--teams-repository name] <local_teams_directory>]",
 		Short: "Check the validity of IAC directory structure against a Github organization",
 		Long: `Check the validity of IAC directory structure against a Github organization.
 repository: a remote repository in the form https://github.com/...
 repository can be passed by parameter or by defining GOLIAC_SERVER_GIT_REPOSITORY env variable
-branch can be passed by parameter or by defining GOLIAC_SERVER_GIT_BRANCH env variable`,
+branch can be passed by parameter or by defining GOLIAC_SERVER_GIT_BRANCH env variable
+output: if set ('json' or 'markdown'), the list of planned changes is written on stdout
+replay: a cassette recorded with GOLIAC_RECORD_DIR, to plan offline against the recorded Github answers
+(the repository can then be a local clone in the form file:///path/to/teams)
+commit: with replay, the teams repository commit to plan (the head of the branch by default)
+remote-snapshot: an organization snapshot (exported with 'goliac snapshot export') to plan against,
+without any Github access. The teams repository is then a local directory (and the plan is
+written as markdown on stdout by default)
+teams-repository: with remote-snapshot, the name of the teams repository on Github (by default,
+the one recorded in the snapshot, else the one of GOLIAC_SERVER_GIT_REPOSITORY)`,
+		Args: cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
+			if remoteSnapshotParameter != "" {
+				planOffline(args)
+				return
+			}
+
 			repo := repositoryParameter
 			branch := branchParameter
 
@@ -96,14 +163,31 @@ branch can be passed by parameter or by defining GOLIAC_SERVER_GIT_BRANCH env va
 				logrus.Fatalf("missing arguments. Try --help")
 			}
 
-			if config.Config.LogrusLevel == "debug" || config.Config.LogrusLevel == "info" {
+			if outputParameter != "" && outputParameter != "json" && outputParameter != "markdown" {
+				logrus.Fatalf("invalid output format %s (json or markdown)", outputParameter)
+			}
+			if commitParameter != "" && replayParameter == "" {
+				logrus.Fatalf("--commit can only be used with --replay")
+			}
+			if teamsRepositoryParameter != "" {
+				logrus.Fatalf("--teams-repository can only be used with --remote-snapshot")
+			}
+
+			// stdout is reserved to the plan output
+			if outputParameter == "" && (config.Config.LogrusLevel == "debug" || config.Config.LogrusLevel == "info") {
 				fmt.Println("Please wait, it can take several minutes to load everything. \u2615")
 			}
-			goliac, err := internal.NewGoliacImpl()
+			var goliac internal.Goliac
+			var err error
+			if replayParameter != "" {
+				goliac, err = internal.NewGoliacReplayImpl(replayParameter, commitParameter)
+			} else {
+				goliac, err = internal.NewGoliacImpl()
+			}
 			if err != nil {
 				logrus.Fatalf("failed to create goliac: %s", err)
 			}
-			if !noProgressbar {
+			if !noProgressbar && outputParameter == "" {
 				bar := CreateProgressBar()
 				err := goliac.SetRemoteObservability(bar)
 				if err != nil {
@@ -113,9 +197,26 @@ branch can be passed by parameter or by defining GOLIAC_SERVER_GIT_BRANCH env va
 
 			ctx := context.Background()
 			fs := osfs.New("/")
-			err, _, _, _ = goliac.Apply(ctx, fs, true, repo, branch)
+			if outputParameter == "" {
+				err, _, _, _ = goliac.Apply(ctx, fs, true, repo, branch)
+				if err != nil {
+					logrus.Errorf("Failed to plan: %v", err)
+				}
+				return
+			}
+
+			plan, err, _, _ := goliac.Plan(ctx, fs, repo, branch)
 			if err != nil {
-				logrus.Errorf("Failed to plan: %v", err)
+				logrus.Fatalf("Failed to plan: %v", err)
+			}
+			if outputParameter == "json" {
+				out, err := plan.ToJSON()
+				if err != nil {
+					logrus.Fatalf("Failed to render the plan: %v", err)
+				}
+				fmt.Println(string(out))
+			} else {
+				fmt.Print(plan.ToMarkdown())
 			}
 		},
 	}
@@ -123,6 +224,11 @@ branch can be passed by parameter or by defining GOLIAC_SERVER_GIT_BRANCH env va
 	planCmd.Flags().StringVarP(&repositoryParameter, "repository", "r", config.Config.ServerGitRepository, "repository (default env variable GOLIAC_SERVER_GIT_REPOSITORY)")
 	planCmd.Flags().StringVarP(&branchParameter, "branch", "b", config.Config.ServerGitBranch, "branch (default env variable GOLIAC_SERVER_GIT_BRANCH)")
 	planCmd.Flags().BoolVarP(&noProgressbar, "noprogressbar", "p", false, "display a progress bar")
+	planCmd.Flags().StringVarP(&outputParameter, "output", "o", "", "output the plan as 'json' or 'markdown' on stdout")
+	planCmd.Flags().StringVar(&replayParameter, "replay", "", "plan offline against a cassette recorded with GOLIAC_RECORD_DIR")
+	planCmd.Flags().StringVar(&commitParameter, "commit", "", "with --replay, the teams repository commit to plan")
+	planCmd.Flags().StringVar(&remoteSnapshotParameter, "remote-snapshot", "", "plan a local teams directory against an organization snapshot, without Github access")
+	planCmd.Flags().StringVar(&teamsRepositoryParameter, "teams-repository", "", "with --remote-snapshot, the name of the teams repository on Github")
 
 	applyCmd := &cobra.Command{
 		Use:   "apply [--repository https_team_repository_url] [--branch branch]",
@@ -285,8 +391,16 @@ any changes from the teams Git repository to Github.`,
 				logrus.Fatalf("failed to create goliac: %s", err)
 			}
 			notificationService := notification.NewNullNotificationService()
-			if config.Config.SlackToken != "" && config.Config.SlackChannel != "" {
-				slackService := notification.NewSlackNotificationService(config.Config.SlackToken, config.Config.SlackChannel)
+			slackToken := utils.NewStaticSecret("GOLIAC_SLACK_TOKEN", []byte(config.Config.SlackToken))
+			if config.Config.SlackTokenFile != "" {
+				slackToken, err = utils.NewSecretFile("GOLIAC_SLACK_TOKEN_FILE", config.Config.SlackTokenFile)
+				if err != nil {
+					logrus.Fatalf("failed to read the slack token: %s", err)
+				}
+				utils.DefaultSecretsWatcher.Watch(slackToken)
+			}
+			if len(slackToken.Get()) > 0 && config.Config.SlackChannel != "" {
+				slackService := notification.NewSlackNotificationService(slackToken, config.Config.SlackChannel)
 				notificationService = slackService
 			}
 
@@ -295,6 +409,108 @@ any changes from the teams Git repository to Github.`,
 		},
 	}
 
+	snapshotCmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Export the Github organization state, and compare exports",
+	}
+
+	snapshotExportCmd := &cobra.Command{
+		Use:   "export [--output file] [--format json|yaml]",
+		Short: "Export the Github organization state (users, teams, repositories, rulesets)",
+		Long: `Export everything Goliac knows about the Github organization in a stable (sorted) document:
+users, teams with their members and maintainers, teams permissions on repositories,
+repositories properties and collaborators, and rulesets.
+output: the file to write (stdout by default)
+format: 'json' or 'yaml' (by default, deduced from the output file extension, else json)`,
+		Run: func(cmd *cobra.Command, args []string) {
+			format := formatParameter
+			if format == "" {
+				format = "json"
+				if ext := filepath.Ext(snapshotFileParameter); ext == ".yaml" || ext == ".yml" {
+					format = "yaml"
+				}
+			}
+			if format != "json" && format != "yaml" {
+				logrus.Fatalf("invalid format %s (json or yaml)", format)
+			}
+
+			var bar *ProgressBar
+			if !noProgressbar && snapshotFileParameter != "" {
+				bar = CreateProgressBar()
+			}
+			var snapshot *engine.OrgSnapshot
+			var err error
+			if bar != nil {
+				snapshot, err = internal.ExportOrgSnapshot(context.Background(), bar)
+			} else {
+				snapshot, err = internal.ExportOrgSnapshot(context.Background(), nil)
+			}
+			if err != nil {
+				logrus.Fatalf("failed to export the organization: %s", err)
+			}
+
+			var content []byte
+			if format == "yaml" {
+				content, err = snapshot.ToYAML()
+			} else {
+				content, err = snapshot.ToJSON()
+			}
+			if err != nil {
+				logrus.Fatalf("failed to render the snapshot: %s", err)
+			}
+			if snapshotFileParameter == "" {
+				fmt.Println(string(content))
+				return
+			}
+			if err := os.WriteFile(snapshotFileParameter, content, 0644); err != nil {
+				logrus.Fatalf("failed to write the snapshot: %s", err)
+			}
+		},
+	}
+	snapshotExportCmd.Flags().StringVarP(&snapshotFileParameter, "output", "o", "", "file to write the snapshot to (default stdout)")
+	snapshotExportCmd.Flags().StringVarP(&formatParameter, "format", "f", "", "'json' or 'yaml'")
+	snapshotExportCmd.Flags().BoolVarP(&noProgressbar, "noprogressbar", "p", false, "display a progress bar")
+
+	snapshotDiffCmd := &cobra.Command{
+		Use:   "diff <before> <after> [--format text|json]",
+		Short: "List what changed between 2 exported snapshots",
+		Long: `List what changed between 2 snapshots (exported with 'goliac snapshot export'):
+organization members, teams, repositories, rulesets, and who gained or lost
+access to which repository (and through which team or collaboration)`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			before, err := engine.ReadOrgSnapshot(args[0])
+			if err != nil {
+				logrus.Fatalf("%s", err)
+			}
+			after, err := engine.ReadOrgSnapshot(args[1])
+			if err != nil {
+				logrus.Fatalf("%s", err)
+			}
+			if before.Organization != after.Organization {
+				logrus.Warnf("the snapshots are not from the same organization (%s and %s)", before.Organization, after.Organization)
+			}
+
+			changes := engine.DiffOrgSnapshots(before, after)
+			switch formatParameter {
+			case "", "text":
+				fmt.Print(changes.ToText())
+			case "json":
+				out, err := json.MarshalIndent(changes, "", "  ")
+				if err != nil {
+					logrus.Fatalf("failed to render the changes: %s", err)
+				}
+				fmt.Println(string(out))
+			default:
+				logrus.Fatalf("invalid format %s (text or json)", formatParameter)
+			}
+		},
+	}
+	snapshotDiffCmd.Flags().StringVarP(&formatParameter, "format", "f", "", "'text' (default) or 'json'")
+
+	snapshotCmd.AddCommand(snapshotExportCmd)
+	snapshotCmd.AddCommand(snapshotDiffCmd)
+
 	versioncmd := &cobra.Command{
 		Use:   "version",
 		Short: "Return the version of the goliac CLI",
@@ -317,6 +533,7 @@ Either local directory, or remote git repository`,
 	rootCmd.AddCommand(postSyncUsersCmd)
 	rootCmd.AddCommand(scaffoldcmd)
 	rootCmd.AddCommand(servecmd)
+	rootCmd.AddCommand(snapshotCmd)
 	rootCmd.AddCommand(versioncmd)
 
 	// if the team app is not set, use the app github app settings
@@ -326,6 +543,9 @@ Either local directory, or remote git repository`,
 	if config.Config.GithubTeamAppPrivateKeyFile == "" {
 		config.Config.GithubTeamAppPrivateKeyFile = config.Config.GithubAppPrivateKeyFile
 	}
+	if config.Config.GithubTeamAppPrivateKey == "" {
+		config.Config.GithubTeamAppPrivateKey = config.Config.GithubAppPrivateKey
+	}
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
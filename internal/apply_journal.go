@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	APPLY_JOURNAL_BEGIN = "begin"
+	APPLY_JOURNAL_DONE  = "done"
+)
+
+/*
+ * ApplyJournal is a write-ahead journal (on local disk) of the Github operations
+ * applied during a sync: before a changeset is applied, the planned operations
+ * (and the teams repo commit they come from) are written to the journal, then
+ * each operation is recorded as soon as it completes.
+ * The journal is removed at the end of the sync. If it is still there when
+ * Goliac starts, the previous sync was interrupted before the goliac tag was pushed.
+ */
+type ApplyJournal struct {
+	path  string
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// one line of the journal
+type applyJournalRecord struct {
+	Type     string    `json:"type"` // begin or done
+	Time     time.Time `json:"time"`
+	Commit   string    `json:"commit,omitempty"`   // begin only
+	Commands []string  `json:"commands,omitempty"` // begin only
+	Index    int       `json:"index"`              // done only: index of the command in the begin record
+	Error    string    `json:"error,omitempty"`    // done only: if the command failed
+}
+
+/*
+ * InterruptedApply describes a sync that was interrupted, from the journal it left behind
+ */
+type InterruptedApply struct {
+	Commit    string    // teams repo commit being applied
+	StartedAt time.Time // when the changeset started to be applied
+	Planned   []string  // operations of the changeset
+	Completed int       // operations completed (applied or failed) before the interruption
+	Failed    int       // operations that failed before the interruption
+	Pending   []string  // operations not done before the interruption (in the Planned order)
+}
+
+func NewApplyJournal(path string) *ApplyJournal {
+	return &ApplyJournal{
+		path: path,
+	}
+}
+
+func (j *ApplyJournal) write(record *applyJournalRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if j.file == nil {
+		j.file, err = os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	// the record must be on disk before we go on
+	return j.file.Sync()
+}
+
+/*
+ * Begin records the changeset about to be applied
+ */
+func (j *ApplyJournal) Begin(commit string, commands []string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if err := j.write(&applyJournalRecord{
+		Type:     APPLY_JOURNAL_BEGIN,
+		Time:     time.Now(),
+		Commit:   commit,
+		Commands: commands,
+	}); err != nil {
+		return fmt.Errorf("not able to write the apply journal %s: %v", j.path, err)
+	}
+	return nil
+}
+
+/*
+ * Done records the completion of the command at index (in the changeset passed to Begin)
+ */
+func (j *ApplyJournal) Done(index int, commandErr error) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	record := applyJournalRecord{
+		Type:  APPLY_JOURNAL_DONE,
+		Time:  time.Now(),
+		Index: index,
+	}
+	if commandErr != nil {
+		record.Error = commandErr.Error()
+	}
+	if err := j.write(&record); err != nil {
+		return fmt.Errorf("not able to write the apply journal %s: %v", j.path, err)
+	}
+	return nil
+}
+
+/*
+ * Remove deletes the journal, once the sync is over
+ */
+func (j *ApplyJournal) Remove() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("not able to remove the apply journal %s: %v", j.path, err)
+	}
+	return nil
+}
+
+/*
+ * LoadApplyJournal reads the journal left behind by an interrupted sync.
+ * It returns nil if there is no journal (the previous sync, if any, completed).
+ * A truncated last line (Goliac killed while writing it) is ignored.
+ */
+func LoadApplyJournal(path string) (*InterruptedApply, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("not able to read the apply journal %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var interrupted *InterruptedApply
+	var done map[int]bool
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record applyJournalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		switch record.Type {
+		case APPLY_JOURNAL_BEGIN:
+			// only the last changeset was interrupted (the previous ones, if any, were tagged)
+			interrupted = &InterruptedApply{
+				Commit:    record.Commit,
+				StartedAt: record.Time,
+				Planned:   record.Commands,
+			}
+			done = make(map[int]bool)
+		case APPLY_JOURNAL_DONE:
+			if interrupted != nil && !done[record.Index] {
+				done[record.Index] = true
+				interrupted.Completed++
+				if record.Error != "" {
+					interrupted.Failed++
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("not able to read the apply journal %s: %v", path, err)
+	}
+	if interrupted == nil {
+		// the journal was created, but nothing was recorded
+		return &InterruptedApply{}, nil
+	}
+	for i, command := range interrupted.Planned {
+		if !done[i] {
+			interrupted.Pending = append(interrupted.Pending, command)
+		}
+	}
+	return interrupted, nil
+}
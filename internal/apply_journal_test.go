@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Alayacare/goliac/swagger_gen/restapi/operations/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyJournal(t *testing.T) {
+
+	t.Run("happy path: no journal, nothing to resume", func(t *testing.T) {
+		interrupted, err := LoadApplyJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+		assert.Nil(t, err)
+		assert.Nil(t, interrupted)
+	})
+
+	t.Run("happy path: interrupted apply", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "journal.jsonl")
+		journal := NewApplyJournal(path)
+
+		assert.Nil(t, journal.Begin("1234", []string{"create team team1", "create team team2"}))
+		assert.Nil(t, journal.Done(0, nil))
+		assert.Nil(t, journal.Begin("5678", []string{"create team team3", "create team team4", "delete repository repo1"}))
+		assert.Nil(t, journal.Done(1, nil))
+		assert.Nil(t, journal.Done(0, fmt.Errorf("unexpected status: 500 Internal Server Error")))
+
+		// killed in the middle of writing a record
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+		assert.Nil(t, err)
+		f.WriteString(`{"type":"done","ti`)
+		f.Close()
+
+		interrupted, err := LoadApplyJournal(path)
+		assert.Nil(t, err)
+		assert.NotNil(t, interrupted)
+		assert.Equal(t, "5678", interrupted.Commit)
+		assert.Equal(t, 3, len(interrupted.Planned))
+		assert.Equal(t, 2, interrupted.Completed)
+		assert.Equal(t, 1, interrupted.Failed)
+		assert.Equal(t, []string{"delete repository repo1"}, interrupted.Pending)
+	})
+
+	t.Run("happy path: the journal is removed at the end of the apply", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "journal.jsonl")
+		journal := NewApplyJournal(path)
+
+		assert.Nil(t, journal.Begin("1234", []string{"create team team1"}))
+		assert.Nil(t, journal.Remove())
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+
+		// nothing to remove
+		assert.Nil(t, journal.Remove())
+	})
+
+	t.Run("happy path: the batch executor journals each command", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "journal.jsonl")
+		remote := &GoliacRemoteExecutorOrderMock{
+			GoliacRemoteExecutorMock: NewGoliacRemoteExecutorMock().(*GoliacRemoteExecutorMock),
+			fail:                     map[string]bool{"add_user:user2": true},
+		}
+		executor := NewGithubBatchExecutor(remote, 50, 4, false)
+		executor.SetJournal(NewApplyJournal(path), "1234")
+		ctx := context.TODO()
+
+		// nothing is journaled in dryrun
+		executor.Begin(true)
+		executor.CreateTeam(ctx, true, "team3", "", nil, []string{})
+		executor.Commit(ctx, true)
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+
+		executor.Begin(false)
+		executor.CreateTeam(ctx, false, "team3", "", nil, []string{})
+		executor.AddUserToOrg(ctx, false, "user2")
+		executor.CreateRepository(ctx, false, "repo5", "", []string{}, []string{}, map[string]bool{})
+		err = executor.Commit(ctx, false)
+		assert.NotNil(t, err)
+
+		interrupted, err := LoadApplyJournal(path)
+		assert.Nil(t, err)
+		assert.Equal(t, "1234", interrupted.Commit)
+		assert.Equal(t, []string{"create team team3", "add user user2 to the organization", "create repository repo5"}, interrupted.Planned)
+		assert.Equal(t, 3, interrupted.Completed)
+		assert.Equal(t, 1, interrupted.Failed)
+	})
+
+	t.Run("happy path: the resumed apply is exposed in the status", func(t *testing.T) {
+		localfixture, remotefixture := fixtureGoliacLocal()
+		resumedAt := time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+		server := GoliacServerImpl{
+			goliac: NewGoliacMock(localfixture, remotefixture),
+			resumedApply: &InterruptedApply{
+				Commit:    "1234",
+				StartedAt: time.Date(2024, 5, 2, 9, 58, 0, 0, time.UTC),
+				Planned:   []string{"create team team3", "create repository repo5"},
+				Completed: 1,
+				Pending:   []string{"create repository repo5"},
+			},
+			resumedApplyTime: &resumedAt,
+		}
+
+		res := server.GetStatus(app.GetStatusParams{})
+		payload := res.(*app.GetStatusOK)
+		assert.Equal(t, "apply of commit 1234 interrupted after 1/2 operation(s) (started at 2024-05-02T09:58:00), resumed at 2024-05-02T10:00:00", payload.Payload.ResumedRun)
+		assert.Equal(t, []string{"create repository repo5"}, payload.Payload.ResumedPendingOperations)
+	})
+
+	t.Run("happy path: the notification lists the operations not done", func(t *testing.T) {
+		message := interruptedApplyMessage(&InterruptedApply{
+			Commit:    "1234",
+			Planned:   []string{"create team team3", "create repository repo5", "delete repository repo1"},
+			Completed: 1,
+			Pending:   []string{"create repository repo5", "delete repository repo1"},
+		})
+		assert.Equal(t, "Goliac was restarted in the middle of applying commit 1234 (1/3 operation(s) done): resuming it. Operations not done:\n- create repository repo5\n- delete repository repo1\n", message)
+
+		pending := make([]string, MAX_NOTIFIED_PENDING_OPERATIONS+5)
+		for i := range pending {
+			pending[i] = fmt.Sprintf("create team team%d", i)
+		}
+		message = interruptedApplyMessage(&InterruptedApply{Commit: "1234", Planned: pending, Pending: pending})
+		assert.Contains(t, message, "- create team team19\n- ... and 5 more\n")
+		assert.NotContains(t, message, "team20")
+	})
+}
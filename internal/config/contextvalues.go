@@ -8,6 +8,10 @@ const (
 )
 
 type GoliacStatistics struct {
-	GithubApiCalls  int
-	GithubThrottled int
+	GithubApiCalls    int
+	GithubThrottled   int            // calls rate limited by Github (and retried)
+	GithubRetries     int            // calls retried after a transient error (network error, 5xx)
+	GithubCacheHits   int            // conditional GET calls answered by Github with a 304 (not counted in the rate limit)
+	GithubCacheMisses int            // GET calls that returned (new) data, to be cached
+	EntitiesFetched   map[string]int // number of entities (re)fetched from Github, per kind (users, teams, teams_members, repositories, teams_repos, rulesets)
 }
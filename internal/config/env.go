@@ -18,8 +18,38 @@ var Config = struct {
 	GoliacEmail                 string `env:"GOLIAC_EMAIL" envDefault:"goliac@alayacare.com"`
 	GoliacTeamOwnerSuffix       string `env:"GOLIAC_TEAM_OWNER_SUFFIX" envDefault:"-goliac-owners"`
 
+	// GithubAppPrivateKey - the Github App private key (PEM) itself, instead of a file (takes precedence over GithubAppPrivateKeyFile)
+	GithubAppPrivateKey     string `env:"GOLIAC_GITHUB_APP_PRIVATE_KEY"`
+	GithubTeamAppPrivateKey string `env:"GOLIAC_GITHUB_TEAM_APP_PRIVATE_KEY"`
+	// GithubAuthMode - how to authenticate to Github
+	// Possible values: app (Github App), pat (personal access token), actions (GITHUB_TOKEN of a Github Actions workflow)
+	GithubAuthMode string `env:"GOLIAC_GITHUB_AUTH_MODE" envDefault:"app"`
+	// GithubToken - the token used in pat (and actions) mode
+	GithubToken string `env:"GOLIAC_GITHUB_TOKEN"`
+	// GithubActionsToken - the token provided by Github Actions (used in actions mode if GithubToken is not set)
+	GithubActionsToken string `env:"GITHUB_TOKEN"`
+
 	GithubConcurrentThreads int64 `env:"GOLIAC_GITHUB_CONCURRENT_THREADS" envDefault:"5"`
 	GithubCacheTTL          int64 `env:"GOLIAC_GITHUB_CACHE_TTL" envDefault:"86400"`
+	// GithubCacheEntityTTL - how long (in seconds) a team's members or a repository's teams are kept
+	// when the entity didn't change on Github (0 means GithubCacheTTL: everything is reloaded).
+	// Github doesn't bump updatedAt on membership or team access changes: a missed webhook event
+	// leaves the drift unseen up to this TTL
+	GithubCacheEntityTTL int64 `env:"GOLIAC_GITHUB_CACHE_ENTITY_TTL" envDefault:"0"`
+	// GithubCacheSnapshotFile - where to persist the remote cache, to restart without reloading everything from Github (disabled if empty)
+	GithubCacheSnapshotFile string `env:"GOLIAC_GITHUB_CACHE_SNAPSHOT_FILE" envDefault:""`
+	// ApplyJournalFile - where to journal the Github operations being applied, to resume an interrupted apply (disabled if empty)
+	ApplyJournalFile string `env:"GOLIAC_APPLY_JOURNAL_FILE" envDefault:""`
+	// GithubMaxRetries - how many times a Github call is retried when rate limited, or after a transient error (network error, 5xx)
+	GithubMaxRetries int64 `env:"GOLIAC_GITHUB_MAX_RETRIES" envDefault:"5"`
+	// GithubApiReserve - API budget (REST calls, GraphQL points) kept for the mutations: when the budget left is lower,
+	// the non-critical loads (teams repos, rulesets) are deferred until the budget is reset (if they were loaded once)
+	GithubApiReserve int64 `env:"GOLIAC_GITHUB_API_RESERVE" envDefault:"500"`
+	// GithubHttpCacheDir - where to persist the responses of the Github REST GET calls (with their ETag), to send conditional requests after a restart (kept in memory only if empty)
+	GithubHttpCacheDir string `env:"GOLIAC_GITHUB_HTTP_CACHE_DIR" envDefault:""`
+
+	// GithubRecordDir - where to record the Github API calls (with the secrets redacted), to replay them with 'goliac plan --replay'
+	GithubRecordDir string `env:"GOLIAC_RECORD_DIR" envDefault:""`
 
 	ServerApplyInterval int64  `env:"GOLIAC_SERVER_APPLY_INTERVAL" envDefault:"600"`
 	ServerGitRepository string `env:"GOLIAC_SERVER_GIT_REPOSITORY" envDefault:""`
@@ -33,6 +63,9 @@ var Config = struct {
 	// SyncUsersBeforeApply - to sync users before applying the commits
 	SyncUsersBeforeApply bool `env:"GOLIAC_SYNC_USERS_BEFORE_APPLY" envDefault:"true"`
 
+	// ApplyCommitByCommit - to replay (and tag) each teams repo commit since the last goliac tag, instead of applying only HEAD
+	ApplyCommitByCommit bool `env:"GOLIAC_APPLY_COMMIT_BY_COMMIT" envDefault:"false"`
+
 	// Host - golang-skeleton server host
 	SwaggerHost string `env:"GOLIAC_SERVER_HOST" envDefault:"localhost"`
 	// Port - golang-skeleton server port
@@ -62,12 +95,21 @@ var Config = struct {
 	// to receive slack notifications on errors
 	SlackToken   string `env:"GOLIAC_SLACK_TOKEN" envDefault:""`
 	SlackChannel string `env:"GOLIAC_SLACK_CHANNEL" envDefault:""`
+	// SlackTokenFile - file containing the slack token (reloaded when rotated, takes precedence over SlackToken)
+	SlackTokenFile string `env:"GOLIAC_SLACK_TOKEN_FILE" envDefault:""`
 
 	// to receive Github main branch merge webhook events on the /webhook endpoint
 	GithubWebhookSecret        string `env:"GOLIAC_GITHUB_WEBHOOK_SECRET" envDefault:""`
 	GithubWebhookDedicatedHost string `env:"GOLIAC_GITHUB_WEBHOOK_HOST" envDefault:"localhost"`
 	GithubWebhookDedicatedPort int    `env:"GOLIAC_GITHUB_WEBHOOK_PORT" envDefault:"18001"`
 	GithubWebhookPath          string `env:"GOLIAC_GITHUB_WEBHOOK_PATH" envDefault:"/webhook"`
+	// GithubWebhookSecretFile - file containing the webhook secret (reloaded when rotated, takes precedence over GithubWebhookSecret)
+	GithubWebhookSecretFile string `env:"GOLIAC_GITHUB_WEBHOOK_SECRET_FILE" envDefault:""`
+	// GithubWebhookSecretGracePeriod - how long (in seconds) the previous webhook secret is still accepted after a rotation
+	GithubWebhookSecretGracePeriod int64 `env:"GOLIAC_GITHUB_WEBHOOK_SECRET_GRACE_PERIOD" envDefault:"3600"`
+
+	// SecretsReloadInterval - how often (in seconds) the server reloads the secret files (Github App private keys, webhook secret, slack token)
+	SecretsReloadInterval int64 `env:"GOLIAC_SECRETS_RELOAD_INTERVAL" envDefault:"60"`
 }{}
 
 // to be overrided at build time with
@@ -12,19 +12,32 @@ type RepositoryConfig struct {
 		Pattern string
 		Ruleset string
 	}
-	MaxChangesets           int `yaml:"max_changesets"`
-	GithubConcurrentThreads int `yaml:"github_concurrent_threads"`
+	MaxChangesets           int  `yaml:"max_changesets"`
+	GithubConcurrentThreads int  `yaml:"github_concurrent_threads"`
+	TransactionalApply      bool `yaml:"transactional_apply"`
 	UserSync                struct {
 		Plugin string `yaml:"plugin"`
 		Path   string `yaml:"path"`
 	}
 	ArchiveOnDelete       bool `yaml:"archive_on_delete"`
 	DestructiveOperations struct {
-		AllowDestructiveRepositories bool `yaml:"repositories"`
-		AllowDestructiveTeams        bool `yaml:"teams"`
-		AllowDestructiveUsers        bool `yaml:"users"`
-		AllowDestructiveRulesets     bool `yaml:"rulesets"`
+		AllowDestructiveRepositories     bool `yaml:"repositories"`
+		AllowDestructiveTeams            bool `yaml:"teams"`
+		AllowDestructiveUsers            bool `yaml:"users"`
+		AllowDestructiveRulesets         bool `yaml:"rulesets"`
+		AllowDestructiveCustomProperties bool `yaml:"custom_properties"`
 	} `yaml:"destructive_operations"`
+	RepositoryDefaults struct {
+		AllowMergeCommit         *bool `yaml:"allow_merge_commit"`
+		AllowRebaseMerge         *bool `yaml:"allow_rebase_merge"`
+		AllowSquashMerge         *bool `yaml:"allow_squash_merge"`
+		AllowForking             *bool `yaml:"allow_forking"`
+		WebCommitSignoffRequired *bool `yaml:"web_commit_signoff_required"`
+		HasIssues                *bool `yaml:"has_issues"`
+		HasWiki                  *bool `yaml:"has_wiki"`
+		HasProjects              *bool `yaml:"has_projects"`
+		HasDiscussions           *bool `yaml:"has_discussions"`
+	} `yaml:"repository_defaults"` // used when a repository doesn't set them
 }
 
 // set default values
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/sirupsen/logrus"
+)
+
+type auditContextKey string
+
+const (
+	// KeyCommitAudit is the context key used to attach the teams repo commit being reconciled
+	KeyCommitAudit auditContextKey = "commitAudit"
+)
+
+// squash and merge commits are titled "<PR title> (#<PR number>)"
+var pullRequestNumberRegexp = regexp.MustCompile(`\(#(\d+)\)\s*$`)
+
+/*
+ * CommitAudit identifies the teams repo commit (and the PR that produced it)
+ * responsible for a set of Github mutations
+ */
+type CommitAudit struct {
+	CommitHash  string
+	Author      string // PR author when the commit was squashed and merged
+	PullRequest int    // 0 if the commit doesn't come from a PR
+}
+
+func NewCommitAudit(commit *object.Commit) *CommitAudit {
+	audit := &CommitAudit{
+		CommitHash: commit.Hash.String(),
+		Author:     commit.Author.Name,
+	}
+	if commit.Author.Email != "" {
+		audit.Author += " <" + commit.Author.Email + ">"
+	}
+
+	title := strings.SplitN(commit.Message, "\n", 2)[0]
+	if match := pullRequestNumberRegexp.FindStringSubmatch(title); match != nil {
+		audit.PullRequest, _ = strconv.Atoi(match[1])
+	}
+	return audit
+}
+
+/*
+ * GetCommitAudit returns the commit being reconciled (if any)
+ */
+func GetCommitAudit(ctx context.Context) *CommitAudit {
+	if audit, ok := ctx.Value(KeyCommitAudit).(*CommitAudit); ok {
+		return audit
+	}
+	return nil
+}
+
+/*
+ * logCommand returns a logger for a reconciliation command,
+ * with the commit/author fields when we are replaying the teams repo commit by commit
+ */
+func logCommand(ctx context.Context, dryrun bool, command string) *logrus.Entry {
+	fields := map[string]interface{}{"dryrun": dryrun, "command": command}
+	if audit := GetCommitAudit(ctx); audit != nil {
+		fields["commit"] = audit.CommitHash
+		fields["author"] = audit.Author
+		if audit.PullRequest != 0 {
+			fields["pr"] = audit.PullRequest
+		}
+	}
+	return logrus.WithFields(fields)
+}
@@ -5,6 +5,8 @@ import (
 	"regexp"
 	"testing"
 
+	"github.com/Alayacare/goliac/internal/github"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -104,6 +106,10 @@ func (c *GithubSamlGitHubClient) GetAppSlug() string {
 	return "foobar"
 }
 
+func (c *GithubSamlGitHubClient) GetRateLimits() github.RateLimits {
+	return github.RateLimits{}
+}
+
 func TestLoadUsersFromGithubOrgSaml(t *testing.T) {
 
 	// happy path
@@ -19,6 +19,7 @@ type UnmanagedResources struct {
 	Teams                  map[string]bool
 	Repositories           map[string]bool
 	RuleSets               map[string]bool
+	CustomProperties       map[string]bool
 }
 
 /*
@@ -51,6 +52,7 @@ func (r *GoliacReconciliatorImpl) Reconciliate(ctx context.Context, local Goliac
 		Teams:                  make(map[string]bool),
 		Repositories:           make(map[string]bool),
 		RuleSets:               make(map[string]bool),
+		CustomProperties:       make(map[string]bool),
 	}
 	r.unmanaged = unmanaged
 
@@ -66,6 +68,13 @@ func (r *GoliacReconciliatorImpl) Reconciliate(ctx context.Context, local Goliac
 		return nil, err
 	}
 
+	// the custom properties must be defined before the repositories values are set
+	err = r.reconciliateCustomProperties(ctx, local, rremote, dryrun)
+	if err != nil {
+		r.Rollback(ctx, dryrun, err)
+		return nil, err
+	}
+
 	err = r.reconciliateRepositories(ctx, local, rremote, teamsreponame, dryrun, reposToArchive, reposToRename)
 	if err != nil {
 		r.Rollback(ctx, dryrun, err)
@@ -350,6 +359,9 @@ func (r *GoliacReconciliatorImpl) reconciliateTeams(ctx context.Context, local G
 
 type GithubRepoComparable struct {
 	BoolProperties      map[string]bool
+	StringProperties    map[string]string   // only the properties managed by the teams repo (for the local repos)
+	Topics              []string            // nil if not managed (for the local repos)
+	CustomProperties    map[string][]string // only the values managed by the teams repo (for the local repos)
 	Writers             []string
 	Readers             []string
 	ExternalUserReaders []string // githubids
@@ -364,6 +376,12 @@ type GithubRepoComparable struct {
  */
 func (r *GoliacReconciliatorImpl) reconciliateRepositories(ctx context.Context, local GoliacLocal, remote *MutableGoliacRemoteImpl, teamsreponame string, dryrun bool, toArchive map[string]*GithubRepoComparable, reposToRename map[string]*entity.Repository) error {
 
+	// we don't know the custom properties values on Github: we don't touch them
+	propertiesErr := remote.CustomPropertiesError()
+	if propertiesErr != nil {
+		logrus.Warnf("the repositories custom properties are not reconciled: %v", propertiesErr)
+	}
+
 	// let's start with the local cloned github-teams repo
 	lRepos := make(map[string]*GithubRepoComparable)
 
@@ -377,7 +395,10 @@ func (r *GoliacReconciliatorImpl) reconciliateRepositories(ctx context.Context,
 			renamedRepo.RenameTo = ""
 			reponame = repo.RenameTo
 
-			r.RenameRepository(ctx, dryrun, remote, repo.Name, repo.RenameTo)
+			// (it may have already been renamed by a previous commit)
+			if _, alreadyRenamed := remote.Repositories()[repo.RenameTo]; !alreadyRenamed {
+				r.RenameRepository(ctx, dryrun, remote, repo.Name, repo.RenameTo)
+			}
 
 			// in the post action we have to also update the git repository
 			reposToRename[repo.DirectoryPath] = repo
@@ -394,6 +415,9 @@ func (r *GoliacReconciliatorImpl) reconciliateRepositories(ctx context.Context,
 	for k, v := range ghRepos {
 		repo := &GithubRepoComparable{
 			BoolProperties:      map[string]bool{},
+			StringProperties:    copyMap(v.StringProperties),
+			Topics:              append([]string{}, v.Topics...),
+			CustomProperties:    copyMap(v.CustomProperties),
 			Writers:             []string{},
 			Readers:             []string{},
 			ExternalUserReaders: []string{},
@@ -404,6 +428,10 @@ func (r *GoliacReconciliatorImpl) reconciliateRepositories(ctx context.Context,
 		for pk, pv := range v.BoolProperties {
 			repo.BoolProperties[pk] = pv
 		}
+		// a remote loaded without the visibility (like an older cache snapshot) is public or private
+		if private, ok := v.BoolProperties["private"]; ok && repo.StringProperties["visibility"] == "" {
+			repo.StringProperties["visibility"] = visibilityFromPrivate(private)
+		}
 
 		for cGithubid, cPermission := range v.ExternalUsers {
 			if cPermission == "WRITE" {
@@ -441,7 +469,7 @@ func (r *GoliacReconciliatorImpl) reconciliateRepositories(ctx context.Context,
 	teamsRepo.Name = teamsreponame
 	teamsRepo.Spec.Writers = []string{r.repoconfig.AdminTeam}
 	teamsRepo.Spec.Readers = []string{}
-	teamsRepo.Spec.IsPublic = false
+	teamsRepo.Spec.Visibility = "private"
 	teamsRepo.Spec.DeleteBranchOnMerge = true
 	localRepositories[teamsreponame] = teamsRepo
 
@@ -505,14 +533,65 @@ func (r *GoliacReconciliatorImpl) reconciliateRepositories(ctx context.Context,
 			rulesets[rs.Name] = &ruleset
 		}
 
+		// string properties are only managed when they are set
+		stringProperties := map[string]string{}
+		for k, v := range map[string]string{
+			"description":                 lRepo.Spec.Description,
+			"homepage":                    lRepo.Spec.Homepage,
+			"default_branch":              lRepo.Spec.DefaultBranch,
+			"squash_merge_commit_title":   lRepo.Spec.SquashMergeCommitTitle,
+			"squash_merge_commit_message": lRepo.Spec.SquashMergeCommitMessage,
+			"merge_commit_title":          lRepo.Spec.MergeCommitTitle,
+			"merge_commit_message":        lRepo.Spec.MergeCommitMessage,
+			"visibility":                  lRepo.Visibility(), // always set
+		} {
+			if v != "" {
+				stringProperties[k] = v
+			}
+		}
+
+		customProperties := map[string][]string{}
+		if propertiesErr == nil {
+			for k, v := range lRepo.Spec.Properties {
+				customProperties[k] = []string(v)
+			}
+		}
+
+		boolProperties := map[string]bool{
+			"archived":               lRepo.Archived,
+			"allow_auto_merge":       lRepo.Spec.AllowAutoMerge,
+			"delete_branch_on_merge": lRepo.Spec.DeleteBranchOnMerge,
+			"allow_update_branch":    lRepo.Spec.AllowUpdateBranch,
+		}
+		// the optional ones fallback on the goliac.yaml repository_defaults
+		// (but not for the teams repo, that must stay squash merge only)
+		defaults := r.repoconfig.RepositoryDefaults
+		if reponame == teamsreponame {
+			defaults = config.RepositoryConfig{}.RepositoryDefaults
+		}
+		for k, v := range map[string][2]*bool{
+			"allow_merge_commit":          {lRepo.Spec.AllowMergeCommit, defaults.AllowMergeCommit},
+			"allow_rebase_merge":          {lRepo.Spec.AllowRebaseMerge, defaults.AllowRebaseMerge},
+			"allow_squash_merge":          {lRepo.Spec.AllowSquashMerge, defaults.AllowSquashMerge},
+			"allow_forking":               {lRepo.Spec.AllowForking, defaults.AllowForking},
+			"web_commit_signoff_required": {lRepo.Spec.WebCommitSignoffRequired, defaults.WebCommitSignoffRequired},
+			"has_issues":                  {lRepo.Spec.HasIssues, defaults.HasIssues},
+			"has_wiki":                    {lRepo.Spec.HasWiki, defaults.HasWiki},
+			"has_projects":                {lRepo.Spec.HasProjects, defaults.HasProjects},
+			"has_discussions":             {lRepo.Spec.HasDiscussions, defaults.HasDiscussions},
+		} {
+			if v[0] != nil {
+				boolProperties[k] = *v[0]
+			} else if v[1] != nil {
+				boolProperties[k] = *v[1]
+			}
+		}
+
 		lRepos[utils.GithubAnsiString(reponame)] = &GithubRepoComparable{
-			BoolProperties: map[string]bool{
-				"private":                !lRepo.Spec.IsPublic,
-				"archived":               lRepo.Archived,
-				"allow_auto_merge":       lRepo.Spec.AllowAutoMerge,
-				"delete_branch_on_merge": lRepo.Spec.DeleteBranchOnMerge,
-				"allow_update_branch":    lRepo.Spec.AllowUpdateBranch,
-			},
+			BoolProperties:      boolProperties,
+			StringProperties:    stringProperties,
+			Topics:              lRepo.Spec.Topics,
+			CustomProperties:    customProperties,
 			Readers:             readers,
 			Writers:             writers,
 			ExternalUserReaders: eReaders,
@@ -552,6 +631,20 @@ func (r *GoliacReconciliatorImpl) reconciliateRepositories(ctx context.Context,
 			}
 		}
 
+		if len(changedStringProperties(lRepo, rRepo)) != 0 {
+			return false
+		}
+
+		if lRepo.Topics != nil {
+			if res, _, _ := entity.StringArrayEquivalent(lRepo.Topics, rRepo.Topics); !res {
+				return false
+			}
+		}
+
+		if len(changedCustomProperties(lRepo, rRepo)) != 0 {
+			return false
+		}
+
 		if res, _, _ := entity.StringArrayEquivalent(lRepo.Readers, rRepo.Readers); !res {
 			return false
 		}
@@ -583,6 +676,23 @@ func (r *GoliacReconciliatorImpl) reconciliateRepositories(ctx context.Context,
 			}
 		}
 
+		// reconciliate repositories string properties
+		if changed := changedStringProperties(lRepo, rRepo); len(changed) != 0 {
+			r.UpdateRepositoryUpdateStringProperties(ctx, dryrun, remote, reponame, changed)
+		}
+
+		// reconciliate repositories topics
+		if lRepo.Topics != nil {
+			if res, _, _ := entity.StringArrayEquivalent(lRepo.Topics, rRepo.Topics); !res {
+				r.UpdateRepositorySetTopics(ctx, dryrun, remote, reponame, lRepo.Topics)
+			}
+		}
+
+		// reconciliate repositories custom properties values
+		if changed := changedCustomProperties(lRepo, rRepo); len(changed) != 0 {
+			r.UpdateRepositorySetCustomProperties(ctx, dryrun, remote, reponame, changed)
+		}
+
 		if res, readToRemove, readToAdd := entity.StringArrayEquivalent(lRepo.Readers, rRepo.Readers); !res {
 			for _, teamSlug := range readToAdd {
 				r.UpdateRepositoryAddTeamAccess(ctx, dryrun, remote, reponame, teamSlug, "pull")
@@ -660,7 +770,35 @@ func (r *GoliacReconciliatorImpl) reconciliateRepositories(ctx context.Context,
 			// calling onChanged to update the repository permissions
 			onChanged(reponame, aRepo, rRepo)
 		} else {
-			r.CreateRepository(ctx, dryrun, remote, reponame, reponame, lRepo.Writers, lRepo.Readers, lRepo.BoolProperties)
+			description := reponame
+			if d, ok := lRepo.StringProperties["description"]; ok {
+				description = d
+			}
+			// the repository is created public or private, an internal repository is then updated
+			boolProperties := copyMap(lRepo.BoolProperties)
+			boolProperties["private"] = lRepo.StringProperties["visibility"] != "public"
+			r.CreateRepository(ctx, dryrun, remote, reponame, description, lRepo.Writers, lRepo.Readers, boolProperties)
+
+			// the default branch only exists after the first push
+			properties := map[string]string{}
+			for k, v := range lRepo.StringProperties {
+				if k == "description" || k == "default_branch" {
+					continue
+				}
+				if k == "visibility" && v != "internal" {
+					continue
+				}
+				properties[k] = v
+			}
+			if len(properties) != 0 {
+				r.UpdateRepositoryUpdateStringProperties(ctx, dryrun, remote, reponame, properties)
+			}
+			if len(lRepo.Topics) != 0 {
+				r.UpdateRepositorySetTopics(ctx, dryrun, remote, reponame, lRepo.Topics)
+			}
+			if changed := changedCustomProperties(lRepo, &GithubRepoComparable{}); len(changed) != 0 {
+				r.UpdateRepositorySetCustomProperties(ctx, dryrun, remote, reponame, changed)
+			}
 		}
 	}
 
@@ -685,6 +823,113 @@ func (r *GoliacReconciliatorImpl) reconciliateRepositories(ctx context.Context,
 	return nil
 }
 
+/*
+changedStringProperties returns the local string properties that differ from Github.
+A merge commit message is always sent with its title (as Github requires)
+*/
+func changedStringProperties(lRepo *GithubRepoComparable, rRepo *GithubRepoComparable) map[string]string {
+	changed := map[string]string{}
+	for lk, lv := range lRepo.StringProperties {
+		rv := rRepo.StringProperties[lk]
+		// an empty repository has no default branch yet
+		if lk == "default_branch" && rv == "" {
+			continue
+		}
+		// the visibility is unknown (not loaded from Github)
+		if lk == "visibility" && rv == "" {
+			continue
+		}
+		if rv != lv {
+			changed[lk] = lv
+		}
+	}
+	for message, title := range map[string]string{
+		"squash_merge_commit_message": "squash_merge_commit_title",
+		"merge_commit_message":        "merge_commit_title",
+	} {
+		if _, ok := changed[message]; ok {
+			changed[title] = lRepo.StringProperties[title]
+		}
+	}
+	return changed
+}
+
+/*
+changedCustomProperties returns the local custom properties values that differ from Github
+(an empty value unsets the property)
+*/
+func changedCustomProperties(lRepo *GithubRepoComparable, rRepo *GithubRepoComparable) map[string][]string {
+	changed := map[string][]string{}
+	for lk, lv := range lRepo.CustomProperties {
+		if res, _, _ := entity.StringArrayEquivalent(lv, rRepo.CustomProperties[lk]); !res {
+			changed[lk] = lv
+		}
+	}
+	return changed
+}
+
+func compareCustomProperties(propertyname string, lcp *GithubCustomProperty, rcp *GithubCustomProperty) bool {
+	if lcp.ValueType != rcp.ValueType {
+		return false
+	}
+	if lcp.Required != rcp.Required {
+		return false
+	}
+	if lcp.Description != rcp.Description {
+		return false
+	}
+	if res, _, _ := entity.StringArrayEquivalent(lcp.DefaultValue, rcp.DefaultValue); !res {
+		return false
+	}
+	if res, _, _ := entity.StringArrayEquivalent(lcp.AllowedValues, rcp.AllowedValues); !res {
+		return false
+	}
+	return true
+}
+
+/*
+This function sync the organization custom properties definitions
+(the values are reconciliated with the repositories)
+*/
+func (r *GoliacReconciliatorImpl) reconciliateCustomProperties(ctx context.Context, local GoliacLocal, remote *MutableGoliacRemoteImpl, dryrun bool) error {
+	// we don't know the custom properties defined on Github: we don't touch them
+	if err := remote.CustomPropertiesError(); err != nil {
+		logrus.Warnf("the custom properties are not reconciled: %v", err)
+		return nil
+	}
+
+	lcps := make(map[string]*GithubCustomProperty)
+	for name, cp := range local.CustomProperties() {
+		lcps[name] = &GithubCustomProperty{
+			Name:          name,
+			ValueType:     cp.Spec.ValueType,
+			Required:      cp.Spec.Required,
+			DefaultValue:  []string(cp.Spec.DefaultValue),
+			AllowedValues: cp.Spec.AllowedValues,
+			Description:   cp.Spec.Description,
+		}
+	}
+
+	onAdded := func(propertyname string, lProperty *GithubCustomProperty, rProperty *GithubCustomProperty) {
+		// CREATE custom property
+		r.AddCustomProperty(ctx, dryrun, remote, lProperty)
+	}
+
+	onRemoved := func(propertyname string, lProperty *GithubCustomProperty, rProperty *GithubCustomProperty) {
+		// DELETE custom property
+		r.DeleteCustomProperty(ctx, dryrun, remote, rProperty)
+	}
+
+	onChanged := func(propertyname string, lProperty *GithubCustomProperty, rProperty *GithubCustomProperty) {
+		// UPDATE custom property
+		r.UpdateCustomProperty(ctx, dryrun, remote, lProperty)
+	}
+
+	CompareEntities(lcps, remote.CustomProperties(), compareCustomProperties, onAdded, onRemoved, onChanged)
+
+	return nil
+}
+
 /*
 used to compare org rulesets but also repo rulesets
 */
@@ -789,7 +1034,7 @@ func (r *GoliacReconciliatorImpl) reconciliateRulesets(ctx context.Context, loca
 }
 
 func (r *GoliacReconciliatorImpl) AddUserToOrg(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, ghuserid string) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "add_user_to_org"}).Infof("ghuserid: %s", ghuserid)
+	logCommand(ctx, dryrun, "add_user_to_org").Infof("ghuserid: %s", ghuserid)
 	remote.AddUserToOrg(ghuserid)
 	if r.executor != nil {
 		r.executor.AddUserToOrg(ctx, dryrun, ghuserid)
@@ -798,7 +1043,7 @@ func (r *GoliacReconciliatorImpl) AddUserToOrg(ctx context.Context, dryrun bool,
 
 func (r *GoliacReconciliatorImpl) RemoveUserFromOrg(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, ghuserid string) {
 	if r.repoconfig.DestructiveOperations.AllowDestructiveUsers {
-		logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "remove_user_from_org"}).Infof("ghuserid: %s", ghuserid)
+		logCommand(ctx, dryrun, "remove_user_from_org").Infof("ghuserid: %s", ghuserid)
 		remote.RemoveUserFromOrg(ghuserid)
 		if r.executor != nil {
 			r.executor.RemoveUserFromOrg(ctx, dryrun, ghuserid)
@@ -814,28 +1059,28 @@ func (r *GoliacReconciliatorImpl) CreateTeam(ctx context.Context, dryrun bool, r
 		parenTeamId = fmt.Sprintf("%d", *parentTeam)
 	}
 
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "create_team"}).Infof("teamname: %s, parentTeam: %s, members: %s", teamname, parenTeamId, strings.Join(members, ","))
+	logCommand(ctx, dryrun, "create_team").Infof("teamname: %s, parentTeam: %s, members: %s", teamname, parenTeamId, strings.Join(members, ","))
 	remote.CreateTeam(teamname, description, members)
 	if r.executor != nil {
 		r.executor.CreateTeam(ctx, dryrun, teamname, description, parentTeam, members)
 	}
 }
 func (r *GoliacReconciliatorImpl) UpdateTeamAddMember(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, teamslug string, ghuserid string, role string) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "update_team_add_member"}).Infof("teamslug: %s, ghuserid: %s, role: %s", teamslug, ghuserid, role)
+	logCommand(ctx, dryrun, "update_team_add_member").Infof("teamslug: %s, ghuserid: %s, role: %s", teamslug, ghuserid, role)
 	remote.UpdateTeamAddMember(teamslug, ghuserid, "member")
 	if r.executor != nil {
 		r.executor.UpdateTeamAddMember(ctx, dryrun, teamslug, ghuserid, "member")
 	}
 }
 func (r *GoliacReconciliatorImpl) UpdateTeamRemoveMember(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, teamslug string, ghuserid string) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "update_team_remove_member"}).Infof("teamslug: %s, ghuserid: %s", teamslug, ghuserid)
+	logCommand(ctx, dryrun, "update_team_remove_member").Infof("teamslug: %s, ghuserid: %s", teamslug, ghuserid)
 	remote.UpdateTeamRemoveMember(teamslug, ghuserid)
 	if r.executor != nil {
 		r.executor.UpdateTeamRemoveMember(ctx, dryrun, teamslug, ghuserid)
 	}
 }
 func (r *GoliacReconciliatorImpl) UpdateTeamChangeMaintainerToMember(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, teamslug string, ghuserid string) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "update_team_change_maintainer_to_member"}).Infof("teamslug: %s, ghuserid: %s", teamslug, ghuserid)
+	logCommand(ctx, dryrun, "update_team_change_maintainer_to_member").Infof("teamslug: %s, ghuserid: %s", teamslug, ghuserid)
 	remote.UpdateTeamUpdateMember(teamslug, ghuserid, "member")
 	if r.executor != nil {
 		r.executor.UpdateTeamUpdateMember(ctx, dryrun, teamslug, ghuserid, "member")
@@ -847,7 +1092,7 @@ func (r *GoliacReconciliatorImpl) UpdateTeamSetParent(ctx context.Context, dryru
 		parenTeamId = fmt.Sprintf("%d", *parentTeam)
 	}
 
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "update_team_parentteam"}).Infof("teamslug: %s, parentteam: %s (%s)", teamslug, parenTeamId, parentTeamName)
+	logCommand(ctx, dryrun, "update_team_parentteam").Infof("teamslug: %s, parentteam: %s (%s)", teamslug, parenTeamId, parentTeamName)
 	remote.UpdateTeamSetParent(ctx, dryrun, teamslug, parentTeam)
 	if r.executor != nil {
 		r.executor.UpdateTeamSetParent(ctx, dryrun, teamslug, parentTeam)
@@ -855,7 +1100,7 @@ func (r *GoliacReconciliatorImpl) UpdateTeamSetParent(ctx context.Context, dryru
 }
 func (r *GoliacReconciliatorImpl) DeleteTeam(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, teamslug string) {
 	if r.repoconfig.DestructiveOperations.AllowDestructiveTeams {
-		logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "delete_team"}).Infof("teamslug: %s", teamslug)
+		logCommand(ctx, dryrun, "delete_team").Infof("teamslug: %s", teamslug)
 		remote.DeleteTeam(teamslug)
 		if r.executor != nil {
 			r.executor.DeleteTeam(ctx, dryrun, teamslug)
@@ -865,14 +1110,14 @@ func (r *GoliacReconciliatorImpl) DeleteTeam(ctx context.Context, dryrun bool, r
 	}
 }
 func (r *GoliacReconciliatorImpl) CreateRepository(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, reponame string, descrition string, writers []string, readers []string, boolProperties map[string]bool) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "create_repository"}).Infof("repositoryname: %s, readers: %s, writers: %s, boolProperties: %v", reponame, strings.Join(readers, ","), strings.Join(writers, ","), boolProperties)
-	remote.CreateRepository(reponame, reponame, writers, readers, boolProperties)
+	logCommand(ctx, dryrun, "create_repository").Infof("repositoryname: %s, readers: %s, writers: %s, boolProperties: %v", reponame, strings.Join(readers, ","), strings.Join(writers, ","), boolProperties)
+	remote.CreateRepository(reponame, descrition, writers, readers, boolProperties)
 	if r.executor != nil {
-		r.executor.CreateRepository(ctx, dryrun, reponame, reponame, writers, readers, boolProperties)
+		r.executor.CreateRepository(ctx, dryrun, reponame, descrition, writers, readers, boolProperties)
 	}
 }
 func (r *GoliacReconciliatorImpl) UpdateRepositoryAddTeamAccess(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, reponame string, teamslug string, permission string) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "update_repository_add_team"}).Infof("repositoryname: %s, teamslug: %s, permission: %s", reponame, teamslug, permission)
+	logCommand(ctx, dryrun, "update_repository_add_team").Infof("repositoryname: %s, teamslug: %s, permission: %s", reponame, teamslug, permission)
 	remote.UpdateRepositoryAddTeamAccess(reponame, teamslug, permission)
 	if r.executor != nil {
 		r.executor.UpdateRepositoryAddTeamAccess(ctx, dryrun, reponame, teamslug, permission)
@@ -880,14 +1125,14 @@ func (r *GoliacReconciliatorImpl) UpdateRepositoryAddTeamAccess(ctx context.Cont
 }
 
 func (r *GoliacReconciliatorImpl) UpdateRepositoryUpdateTeamAccess(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, reponame string, teamslug string, permission string) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "update_repository_update_team"}).Infof("repositoryname: %s, teamslug:%s, permission: %s", reponame, teamslug, permission)
+	logCommand(ctx, dryrun, "update_repository_update_team").Infof("repositoryname: %s, teamslug:%s, permission: %s", reponame, teamslug, permission)
 	remote.UpdateRepositoryUpdateTeamAccess(reponame, teamslug, permission)
 	if r.executor != nil {
 		r.executor.UpdateRepositoryUpdateTeamAccess(ctx, dryrun, reponame, teamslug, permission)
 	}
 }
 func (r *GoliacReconciliatorImpl) UpdateRepositoryRemoveTeamAccess(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, reponame string, teamslug string) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "update_repository_remove_team"}).Infof("repositoryname: %s, teamslug:%s", reponame, teamslug)
+	logCommand(ctx, dryrun, "update_repository_remove_team").Infof("repositoryname: %s, teamslug:%s", reponame, teamslug)
 	remote.UpdateRepositoryRemoveTeamAccess(reponame, teamslug)
 	if r.executor != nil {
 		r.executor.UpdateRepositoryRemoveTeamAccess(ctx, dryrun, reponame, teamslug)
@@ -896,7 +1141,7 @@ func (r *GoliacReconciliatorImpl) UpdateRepositoryRemoveTeamAccess(ctx context.C
 
 func (r *GoliacReconciliatorImpl) DeleteRepository(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, reponame string) {
 	if r.repoconfig.DestructiveOperations.AllowDestructiveRepositories {
-		logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "delete_repository"}).Infof("repositoryname: %s", reponame)
+		logCommand(ctx, dryrun, "delete_repository").Infof("repositoryname: %s", reponame)
 		remote.DeleteRepository(reponame)
 		if r.executor != nil {
 			r.executor.DeleteRepository(ctx, dryrun, reponame)
@@ -907,7 +1152,7 @@ func (r *GoliacReconciliatorImpl) DeleteRepository(ctx context.Context, dryrun b
 }
 
 func (r *GoliacReconciliatorImpl) RenameRepository(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, reponame string, newname string) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "rename_repository"}).Infof("repositoryname: %s newname: %s", reponame, newname)
+	logCommand(ctx, dryrun, "rename_repository").Infof("repositoryname: %s newname: %s", reponame, newname)
 	remote.RenameRepository(reponame, newname)
 	if r.executor != nil {
 		r.executor.RenameRepository(ctx, dryrun, reponame, newname)
@@ -915,27 +1160,82 @@ func (r *GoliacReconciliatorImpl) RenameRepository(ctx context.Context, dryrun b
 }
 
 func (r *GoliacReconciliatorImpl) UpdateRepositoryUpdateBoolProperty(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, reponame string, propertyName string, propertyValue bool) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "update_repository_update_bool_property"}).Infof("repositoryname: %s %s:%v", reponame, propertyName, propertyValue)
+	logCommand(ctx, dryrun, "update_repository_update_bool_property").Infof("repositoryname: %s %s:%v", reponame, propertyName, propertyValue)
 	remote.UpdateRepositoryUpdateBoolProperty(reponame, propertyName, propertyValue)
 	if r.executor != nil {
 		r.executor.UpdateRepositoryUpdateBoolProperty(ctx, dryrun, reponame, propertyName, propertyValue)
 	}
 }
+func (r *GoliacReconciliatorImpl) UpdateRepositoryUpdateStringProperties(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, reponame string, properties map[string]string) {
+	logCommand(ctx, dryrun, "update_repository_update_string_properties").Infof("repositoryname: %s %v", reponame, properties)
+	remote.UpdateRepositoryUpdateStringProperties(reponame, properties)
+	if r.executor != nil {
+		r.executor.UpdateRepositoryUpdateStringProperties(ctx, dryrun, reponame, properties)
+	}
+}
+func (r *GoliacReconciliatorImpl) UpdateRepositorySetTopics(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, reponame string, topics []string) {
+	logCommand(ctx, dryrun, "update_repository_set_topics").Infof("repositoryname: %s topics: %s", reponame, strings.Join(topics, ","))
+	remote.UpdateRepositorySetTopics(reponame, topics)
+	if r.executor != nil {
+		r.executor.UpdateRepositorySetTopics(ctx, dryrun, reponame, topics)
+	}
+}
+func (r *GoliacReconciliatorImpl) UpdateRepositorySetCustomProperties(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, reponame string, properties map[string][]string) {
+	logCommand(ctx, dryrun, "update_repository_set_custom_properties").Infof("repositoryname: %s properties: %v", reponame, properties)
+	remote.UpdateRepositorySetCustomProperties(reponame, properties)
+	if r.executor != nil {
+		// the value types are resolved here: the executor commands run concurrently,
+		// and a property definition may be changed in the same apply
+		valueTypes := make(map[string]string)
+		definitions := remote.CustomProperties()
+		for name := range properties {
+			if property, ok := definitions[name]; ok {
+				valueTypes[name] = property.ValueType
+			}
+		}
+		r.executor.UpdateRepositorySetCustomProperties(ctx, dryrun, reponame, properties, valueTypes)
+	}
+}
+func (r *GoliacReconciliatorImpl) AddCustomProperty(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, property *GithubCustomProperty) {
+	logCommand(ctx, dryrun, "add_custom_property").Infof("custom property: %s value_type: %s", property.Name, property.ValueType)
+	remote.SetCustomProperty(property)
+	if r.executor != nil {
+		r.executor.AddCustomProperty(ctx, dryrun, property)
+	}
+}
+func (r *GoliacReconciliatorImpl) UpdateCustomProperty(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, property *GithubCustomProperty) {
+	logCommand(ctx, dryrun, "update_custom_property").Infof("custom property: %s value_type: %s", property.Name, property.ValueType)
+	remote.SetCustomProperty(property)
+	if r.executor != nil {
+		r.executor.UpdateCustomProperty(ctx, dryrun, property)
+	}
+}
+func (r *GoliacReconciliatorImpl) DeleteCustomProperty(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, property *GithubCustomProperty) {
+	if r.repoconfig.DestructiveOperations.AllowDestructiveCustomProperties {
+		logCommand(ctx, dryrun, "delete_custom_property").Infof("custom property: %s", property.Name)
+		remote.DeleteCustomProperty(property.Name)
+		if r.executor != nil {
+			r.executor.DeleteCustomProperty(ctx, dryrun, property.Name)
+		}
+	} else {
+		r.unmanaged.CustomProperties[property.Name] = true
+	}
+}
 func (r *GoliacReconciliatorImpl) AddRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "add_ruleset"}).Infof("ruleset: %s (id: %d) enforcement: %s", ruleset.Name, ruleset.Id, ruleset.Enforcement)
+	logCommand(ctx, dryrun, "add_ruleset").Infof("ruleset: %s (id: %d) enforcement: %s", ruleset.Name, ruleset.Id, ruleset.Enforcement)
 	if r.executor != nil {
 		r.executor.AddRuleset(ctx, dryrun, ruleset)
 	}
 }
 func (r *GoliacReconciliatorImpl) UpdateRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "update_ruleset"}).Infof("ruleset: %s (id: %d) enforcement: %s", ruleset.Name, ruleset.Id, ruleset.Enforcement)
+	logCommand(ctx, dryrun, "update_ruleset").Infof("ruleset: %s (id: %d) enforcement: %s", ruleset.Name, ruleset.Id, ruleset.Enforcement)
 	if r.executor != nil {
 		r.executor.UpdateRuleset(ctx, dryrun, ruleset)
 	}
 }
 func (r *GoliacReconciliatorImpl) DeleteRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) {
 	if r.repoconfig.DestructiveOperations.AllowDestructiveRulesets {
-		logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "delete_ruleset"}).Infof("ruleset id:%d", ruleset.Id)
+		logCommand(ctx, dryrun, "delete_ruleset").Infof("ruleset id:%d", ruleset.Id)
 		if r.executor != nil {
 			r.executor.DeleteRuleset(ctx, dryrun, ruleset.Id)
 		}
@@ -944,39 +1244,39 @@ func (r *GoliacReconciliatorImpl) DeleteRuleset(ctx context.Context, dryrun bool
 	}
 }
 func (r *GoliacReconciliatorImpl) AddRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "add_repository_ruleset"}).Infof("repository: %s, ruleset: %s (id: %d) enforcement: %s", reponame, ruleset.Name, ruleset.Id, ruleset.Enforcement)
+	logCommand(ctx, dryrun, "add_repository_ruleset").Infof("repository: %s, ruleset: %s (id: %d) enforcement: %s", reponame, ruleset.Name, ruleset.Id, ruleset.Enforcement)
 	if r.executor != nil {
 		r.executor.AddRepositoryRuleset(ctx, dryrun, reponame, ruleset)
 	}
 }
 func (r *GoliacReconciliatorImpl) UpdateRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "update_repository_ruleset"}).Infof("repository: %s, ruleset: %s (id: %d) enforcement: %s", reponame, ruleset.Name, ruleset.Id, ruleset.Enforcement)
+	logCommand(ctx, dryrun, "update_repository_ruleset").Infof("repository: %s, ruleset: %s (id: %d) enforcement: %s", reponame, ruleset.Name, ruleset.Id, ruleset.Enforcement)
 	if r.executor != nil {
 		r.executor.UpdateRepositoryRuleset(ctx, dryrun, reponame, ruleset)
 	}
 }
 func (r *GoliacReconciliatorImpl) DeleteRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "delete_repository_ruleset"}).Infof("repository: %s, ruleset id:%d", reponame, ruleset.Id)
+	logCommand(ctx, dryrun, "delete_repository_ruleset").Infof("repository: %s, ruleset id:%d", reponame, ruleset.Id)
 	if r.executor != nil {
 		r.executor.DeleteRepositoryRuleset(ctx, dryrun, reponame, ruleset.Id)
 	}
 }
 func (r *GoliacReconciliatorImpl) UpdateRepositorySetExternalUser(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, reponame string, collaboatorGithubId string, permission string) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "update_repository_set_external_user"}).Infof("repositoryname: %s collaborator:%s permission:%s", reponame, collaboatorGithubId, permission)
+	logCommand(ctx, dryrun, "update_repository_set_external_user").Infof("repositoryname: %s collaborator:%s permission:%s", reponame, collaboatorGithubId, permission)
 	remote.UpdateRepositorySetExternalUser(reponame, collaboatorGithubId, permission)
 	if r.executor != nil {
 		r.executor.UpdateRepositorySetExternalUser(ctx, dryrun, reponame, collaboatorGithubId, permission)
 	}
 }
 func (r *GoliacReconciliatorImpl) UpdateRepositoryRemoveInternalUser(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, reponame string, collaboatorGithubId string) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "update_repository_remove_internal_user"}).Infof("repositoryname: %s collaborator:%s", reponame, collaboatorGithubId)
+	logCommand(ctx, dryrun, "update_repository_remove_internal_user").Infof("repositoryname: %s collaborator:%s", reponame, collaboatorGithubId)
 	remote.UpdateRepositoryRemoveInternalUser(reponame, collaboatorGithubId)
 	if r.executor != nil {
 		r.executor.UpdateRepositoryRemoveInternalUser(ctx, dryrun, reponame, collaboatorGithubId)
 	}
 }
 func (r *GoliacReconciliatorImpl) UpdateRepositoryRemoveExternalUser(ctx context.Context, dryrun bool, remote *MutableGoliacRemoteImpl, reponame string, collaboatorGithubId string) {
-	logrus.WithFields(map[string]interface{}{"dryrun": dryrun, "command": "update_repository_remove_external_user"}).Infof("repositoryname: %s collaborator:%s", reponame, collaboatorGithubId)
+	logCommand(ctx, dryrun, "update_repository_remove_external_user").Infof("repositoryname: %s collaborator:%s", reponame, collaboatorGithubId)
 	remote.UpdateRepositoryRemoveExternalUser(reponame, collaboatorGithubId)
 	if r.executor != nil {
 		r.executor.UpdateRepositoryRemoveExternalUser(ctx, dryrun, reponame, collaboatorGithubId)
@@ -16,11 +16,12 @@ import (
 )
 
 type GoliacLocalMock struct {
-	users     map[string]*entity.User
-	externals map[string]*entity.User
-	teams     map[string]*entity.Team
-	repos     map[string]*entity.Repository
-	rulesets  map[string]*entity.RuleSet
+	users      map[string]*entity.User
+	externals  map[string]*entity.User
+	teams      map[string]*entity.Team
+	repos      map[string]*entity.Repository
+	rulesets   map[string]*entity.RuleSet
+	properties map[string]*entity.CustomProperty
 }
 
 func (m *GoliacLocalMock) Clone(fs billy.Filesystem, accesstoken, repositoryUrl, branch string) error {
@@ -62,6 +63,9 @@ func (m *GoliacLocalMock) ExternalUsers() map[string]*entity.User {
 func (m *GoliacLocalMock) RuleSets() map[string]*entity.RuleSet {
 	return m.rulesets
 }
+func (m *GoliacLocalMock) CustomProperties() map[string]*entity.CustomProperty {
+	return m.properties
+}
 func (m *GoliacLocalMock) UpdateAndCommitCodeOwners(repoconfig *config.RepositoryConfig, dryrun bool, accesstoken string, branch string, tagname string, githubOrganization string) error {
 	return nil
 }
@@ -76,12 +80,14 @@ func (m *GoliacLocalMock) Close(fs billy.Filesystem) {
 }
 
 type GoliacRemoteMock struct {
-	users      map[string]string
-	teams      map[string]*GithubTeam // key is the slug team
-	repos      map[string]*GithubRepository
-	teamsrepos map[string]map[string]*GithubTeamRepo // key is the slug team
-	rulesets   map[string]*GithubRuleSet
-	appids     map[string]int
+	users         map[string]string
+	teams         map[string]*GithubTeam // key is the slug team
+	repos         map[string]*GithubRepository
+	teamsrepos    map[string]map[string]*GithubTeamRepo // key is the slug team
+	rulesets      map[string]*GithubRuleSet
+	appids        map[string]int
+	properties    map[string]*GithubCustomProperty
+	propertiesErr error
 }
 
 func (m *GoliacRemoteMock) Load(ctx context.Context, continueOnError bool) error {
@@ -94,6 +100,18 @@ func (m *GoliacRemoteMock) FlushCache() {
 }
 func (m *GoliacRemoteMock) FlushCacheUsersTeamsOnly() {
 }
+func (m *GoliacRemoteMock) RefreshUser(ctx context.Context, login string) error {
+	return nil
+}
+func (m *GoliacRemoteMock) RefreshTeam(ctx context.Context, teamslug string) error {
+	return nil
+}
+func (m *GoliacRemoteMock) RefreshRepository(ctx context.Context, reponame string) error {
+	return nil
+}
+func (m *GoliacRemoteMock) RefreshRulesets(ctx context.Context) error {
+	return nil
+}
 func (m *GoliacRemoteMock) RuleSets(ctx context.Context) map[string]*GithubRuleSet {
 	return m.rulesets
 }
@@ -123,6 +141,12 @@ func (m *GoliacRemoteMock) TeamRepositories(ctx context.Context) map[string]map[
 func (m *GoliacRemoteMock) AppIds(ctx context.Context) map[string]int {
 	return m.appids
 }
+func (m *GoliacRemoteMock) CustomProperties(ctx context.Context) map[string]*GithubCustomProperty {
+	return m.properties
+}
+func (m *GoliacRemoteMock) CustomPropertiesError() error {
+	return m.propertiesErr
+}
 func (m *GoliacRemoteMock) CountAssets(ctx context.Context) (int, error) {
 	return 3, nil
 }
@@ -148,6 +172,10 @@ type ReconciliatorListenerRecorder struct {
 	RepositoriesRenamed            map[string]bool
 	RepositoriesUpdatePrivate      map[string]bool
 	RepositoriesUpdateArchived     map[string]bool
+	RepositoriesUpdateString       map[string]map[string]string
+	RepositoriesSetTopics          map[string][]string
+	RepositoriesSetProperties      map[string]map[string][]string
+	RepositoriesSetPropertyTypes   map[string]map[string]string
 	RepositoriesSetExternalUser    map[string]string
 	RepositoriesRemoveExternalUser map[string]bool
 	RepositoriesRemoveInternalUser map[string]bool
@@ -158,6 +186,10 @@ type ReconciliatorListenerRecorder struct {
 	RuleSetCreated map[string]*GithubRuleSet
 	RuleSetUpdated map[string]*GithubRuleSet
 	RuleSetDeleted []int
+
+	CustomPropertyCreated map[string]*GithubCustomProperty
+	CustomPropertyUpdated map[string]*GithubCustomProperty
+	CustomPropertyDeleted []string
 }
 
 func NewReconciliatorListenerRecorder() *ReconciliatorListenerRecorder {
@@ -178,6 +210,10 @@ func NewReconciliatorListenerRecorder() *ReconciliatorListenerRecorder {
 		RepositoriesRenamed:            make(map[string]bool),
 		RepositoriesUpdatePrivate:      make(map[string]bool),
 		RepositoriesUpdateArchived:     make(map[string]bool),
+		RepositoriesUpdateString:       make(map[string]map[string]string),
+		RepositoriesSetTopics:          make(map[string][]string),
+		RepositoriesSetProperties:      make(map[string]map[string][]string),
+		RepositoriesSetPropertyTypes:   make(map[string]map[string]string),
 		RepositoriesSetExternalUser:    make(map[string]string),
 		RepositoriesRemoveExternalUser: make(map[string]bool),
 		RepositoriesRemoveInternalUser: make(map[string]bool),
@@ -187,95 +223,147 @@ func NewReconciliatorListenerRecorder() *ReconciliatorListenerRecorder {
 		RuleSetCreated:                 make(map[string]*GithubRuleSet),
 		RuleSetUpdated:                 make(map[string]*GithubRuleSet),
 		RuleSetDeleted:                 make([]int, 0),
+		CustomPropertyCreated:          make(map[string]*GithubCustomProperty),
+		CustomPropertyUpdated:          make(map[string]*GithubCustomProperty),
+		CustomPropertyDeleted:          make([]string, 0),
 	}
 	return &r
 }
-func (r *ReconciliatorListenerRecorder) AddUserToOrg(ctx context.Context, dryrun bool, ghuserid string) {
+func (r *ReconciliatorListenerRecorder) AddUserToOrg(ctx context.Context, dryrun bool, ghuserid string) error {
 	r.UsersCreated[ghuserid] = ghuserid
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) RemoveUserFromOrg(ctx context.Context, dryrun bool, ghuserid string) {
+func (r *ReconciliatorListenerRecorder) RemoveUserFromOrg(ctx context.Context, dryrun bool, ghuserid string) error {
 	r.UsersRemoved[ghuserid] = ghuserid
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) CreateTeam(ctx context.Context, dryrun bool, teamname string, description string, parentTeam *int, members []string) {
+func (r *ReconciliatorListenerRecorder) CreateTeam(ctx context.Context, dryrun bool, teamname string, description string, parentTeam *int, members []string) error {
 	r.TeamsCreated[teamname] = append(r.TeamsCreated[teamname], members...)
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) UpdateTeamAddMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) {
+func (r *ReconciliatorListenerRecorder) UpdateTeamAddMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error {
 	r.TeamMemberAdded[teamslug] = append(r.TeamMemberAdded[teamslug], username)
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) UpdateTeamRemoveMember(ctx context.Context, dryrun bool, teamslug string, username string) {
+func (r *ReconciliatorListenerRecorder) UpdateTeamRemoveMember(ctx context.Context, dryrun bool, teamslug string, username string) error {
 	r.TeamMemberRemoved[teamslug] = append(r.TeamMemberRemoved[teamslug], username)
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) UpdateTeamUpdateMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) {
+func (r *ReconciliatorListenerRecorder) UpdateTeamUpdateMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error {
 	r.TeamMemberUpdated[teamslug] = append(r.TeamMemberUpdated[teamslug], username)
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) UpdateTeamSetParent(ctx context.Context, dryrun bool, teamslug string, parentTeam *int) {
+func (r *ReconciliatorListenerRecorder) UpdateTeamSetParent(ctx context.Context, dryrun bool, teamslug string, parentTeam *int) error {
 	r.TeamParentUpdated[teamslug] = parentTeam
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) DeleteTeam(ctx context.Context, dryrun bool, teamslug string) {
+func (r *ReconciliatorListenerRecorder) DeleteTeam(ctx context.Context, dryrun bool, teamslug string) error {
 	r.TeamDeleted[teamslug] = true
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) CreateRepository(ctx context.Context, dryrun bool, reponame string, descrition string, writers []string, readers []string, boolProperties map[string]bool) {
+func (r *ReconciliatorListenerRecorder) CreateRepository(ctx context.Context, dryrun bool, reponame string, descrition string, writers []string, readers []string, boolProperties map[string]bool) error {
 	r.RepositoryCreated[reponame] = true
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) UpdateRepositoryAddTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) {
+func (r *ReconciliatorListenerRecorder) UpdateRepositoryAddTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
 	r.RepositoryTeamAdded[reponame] = append(r.RepositoryTeamAdded[reponame], teamslug)
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) UpdateRepositoryUpdateTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) {
+func (r *ReconciliatorListenerRecorder) UpdateRepositoryUpdateTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
 	r.RepositoryTeamUpdated[reponame] = append(r.RepositoryTeamUpdated[reponame], teamslug)
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) UpdateRepositoryRemoveTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string) {
+func (r *ReconciliatorListenerRecorder) UpdateRepositoryRemoveTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string) error {
 	r.RepositoryTeamRemoved[reponame] = append(r.RepositoryTeamRemoved[reponame], teamslug)
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) DeleteRepository(ctx context.Context, dryrun bool, reponame string) {
+func (r *ReconciliatorListenerRecorder) DeleteRepository(ctx context.Context, dryrun bool, reponame string) error {
 	r.RepositoriesDeleted[reponame] = true
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) RenameRepository(ctx context.Context, dryrun bool, reponame string, newname string) {
+func (r *ReconciliatorListenerRecorder) RenameRepository(ctx context.Context, dryrun bool, reponame string, newname string) error {
 	r.RepositoriesRenamed[reponame] = true
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) UpdateRepositoryUpdateBoolProperty(ctx context.Context, dryrun bool, reponame string, propertyName string, propertyValue bool) {
+func (r *ReconciliatorListenerRecorder) UpdateRepositoryUpdateBoolProperty(ctx context.Context, dryrun bool, reponame string, propertyName string, propertyValue bool) error {
 	r.RepositoriesUpdatePrivate[reponame] = true
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) UpdateRepositorySetExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string, permission string) {
+func (r *ReconciliatorListenerRecorder) UpdateRepositoryUpdateStringProperties(ctx context.Context, dryrun bool, reponame string, properties map[string]string) error {
+	r.RepositoriesUpdateString[reponame] = properties
+	return nil
+}
+func (r *ReconciliatorListenerRecorder) UpdateRepositorySetTopics(ctx context.Context, dryrun bool, reponame string, topics []string) error {
+	r.RepositoriesSetTopics[reponame] = topics
+	return nil
+}
+func (r *ReconciliatorListenerRecorder) UpdateRepositorySetCustomProperties(ctx context.Context, dryrun bool, reponame string, properties map[string][]string, valueTypes map[string]string) error {
+	r.RepositoriesSetProperties[reponame] = properties
+	r.RepositoriesSetPropertyTypes[reponame] = valueTypes
+	return nil
+}
+func (r *ReconciliatorListenerRecorder) UpdateRepositorySetExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string, permission string) error {
 	r.RepositoriesSetExternalUser[githubid] = permission
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) UpdateRepositoryRemoveExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) {
+func (r *ReconciliatorListenerRecorder) UpdateRepositoryRemoveExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error {
 	r.RepositoriesRemoveExternalUser[githubid] = true
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) UpdateRepositoryRemoveInternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) {
+func (r *ReconciliatorListenerRecorder) UpdateRepositoryRemoveInternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error {
 	r.RepositoriesRemoveInternalUser[githubid] = true
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) AddRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) {
+func (r *ReconciliatorListenerRecorder) AddRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) error {
 	repo := r.RepositoryRuleSetCreated[reponame]
 	if repo == nil {
 		repo = make(map[string]*GithubRuleSet)
 		r.RepositoryRuleSetCreated[reponame] = repo
 	}
 	repo[ruleset.Name] = ruleset
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) UpdateRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) {
+func (r *ReconciliatorListenerRecorder) UpdateRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) error {
 	repo := r.RepositoryRuleSetUpdated[reponame]
 	if repo == nil {
 		repo = make(map[string]*GithubRuleSet)
 		r.RepositoryRuleSetUpdated[reponame] = repo
 	}
 	repo[ruleset.Name] = ruleset
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) DeleteRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, rulesetid int) {
+func (r *ReconciliatorListenerRecorder) DeleteRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, rulesetid int) error {
 	repo := r.RepositoryRuleSetDeleted[reponame]
 	if repo == nil {
 		repo = make([]int, 0)
 	}
 	repo = append(repo, rulesetid)
 	r.RepositoryRuleSetDeleted[reponame] = repo
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) AddRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) {
+func (r *ReconciliatorListenerRecorder) AddRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) error {
 	r.RuleSetCreated[ruleset.Name] = ruleset
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) UpdateRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) {
+func (r *ReconciliatorListenerRecorder) UpdateRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) error {
 	r.RuleSetUpdated[ruleset.Name] = ruleset
+	return nil
 }
-func (r *ReconciliatorListenerRecorder) DeleteRuleset(ctx context.Context, dryrun bool, rulesetid int) {
+func (r *ReconciliatorListenerRecorder) DeleteRuleset(ctx context.Context, dryrun bool, rulesetid int) error {
 	r.RuleSetDeleted = append(r.RuleSetDeleted, rulesetid)
+	return nil
+}
+func (r *ReconciliatorListenerRecorder) AddCustomProperty(ctx context.Context, dryrun bool, property *GithubCustomProperty) error {
+	r.CustomPropertyCreated[property.Name] = property
+	return nil
+}
+func (r *ReconciliatorListenerRecorder) UpdateCustomProperty(ctx context.Context, dryrun bool, property *GithubCustomProperty) error {
+	r.CustomPropertyUpdated[property.Name] = property
+	return nil
+}
+func (r *ReconciliatorListenerRecorder) DeleteCustomProperty(ctx context.Context, dryrun bool, propertyname string) error {
+	r.CustomPropertyDeleted = append(r.CustomPropertyDeleted, propertyname)
+	return nil
 }
 func (r *ReconciliatorListenerRecorder) Begin(dryrun bool) {
 }
@@ -860,6 +948,435 @@ func TestReconciliation(t *testing.T) {
 		assert.Equal(t, 1, len(recorder.RepositoryCreated))
 	})
 
+	t.Run("happy path: new repo with string settings", func(t *testing.T) {
+		recorder := NewReconciliatorListenerRecorder()
+		repoconf := config.RepositoryConfig{}
+
+		r := NewGoliacReconciliatorImpl(recorder, &repoconf)
+
+		local := GoliacLocalMock{
+			users: make(map[string]*entity.User),
+			teams: make(map[string]*entity.Team),
+			repos: make(map[string]*entity.Repository),
+		}
+		newRepo := &entity.Repository{}
+		newRepo.Name = "new"
+		newRepo.Spec.Description = "a new repository"
+		newRepo.Spec.DefaultBranch = "main"
+		newRepo.Spec.MergeCommitTitle = "PR_TITLE"
+		local.repos["new"] = newRepo
+
+		remote := GoliacRemoteMock{
+			users:      make(map[string]string),
+			teams:      make(map[string]*GithubTeam),
+			repos:      make(map[string]*GithubRepository),
+			teamsrepos: make(map[string]map[string]*GithubTeamRepo),
+			rulesets:   make(map[string]*GithubRuleSet),
+			appids:     make(map[string]int),
+		}
+		remote.repos["teams"] = &GithubRepository{
+			Name:           "teams",
+			ExternalUsers:  map[string]string{},
+			BoolProperties: map[string]bool{},
+		}
+
+		toArchive := make(map[string]*GithubRepoComparable)
+		r.Reconciliate(context.TODO(), &local, &remote, "teams", false, "goliac-admin", toArchive, map[string]*entity.Repository{})
+
+		// 1 repo created, and its merge commit title set (the default branch doesn't exist yet)
+		assert.Equal(t, 1, len(recorder.RepositoryCreated))
+		assert.Equal(t, map[string]string{"merge_commit_title": "PR_TITLE"}, recorder.RepositoriesUpdateString["new"])
+	})
+
+	t.Run("happy path: existing repo with new string settings", func(t *testing.T) {
+		recorder := NewReconciliatorListenerRecorder()
+		repoconf := config.RepositoryConfig{}
+
+		r := NewGoliacReconciliatorImpl(recorder, &repoconf)
+
+		local := GoliacLocalMock{
+			users: make(map[string]*entity.User),
+			teams: make(map[string]*entity.Team),
+			repos: make(map[string]*entity.Repository),
+		}
+		lRepo := &entity.Repository{}
+		lRepo.Name = "myrepo"
+		lRepo.Spec.Description = "my repository"
+		lRepo.Spec.Homepage = "https://example.com"
+		lRepo.Spec.SquashMergeCommitTitle = "PR_TITLE"
+		lRepo.Spec.SquashMergeCommitMessage = "PR_BODY"
+		local.repos["myrepo"] = lRepo
+
+		remote := GoliacRemoteMock{
+			users:      make(map[string]string),
+			teams:      make(map[string]*GithubTeam),
+			repos:      make(map[string]*GithubRepository),
+			teamsrepos: make(map[string]map[string]*GithubTeamRepo),
+			rulesets:   make(map[string]*GithubRuleSet),
+			appids:     make(map[string]int),
+		}
+		remote.repos["teams"] = &GithubRepository{
+			Name:           "teams",
+			ExternalUsers:  map[string]string{},
+			BoolProperties: map[string]bool{},
+		}
+		remote.repos["myrepo"] = &GithubRepository{
+			Name:           "myrepo",
+			ExternalUsers:  map[string]string{},
+			BoolProperties: map[string]bool{"private": true},
+			StringProperties: map[string]string{
+				"description":                 "my repository",
+				"homepage":                    "",
+				"default_branch":              "master",
+				"squash_merge_commit_title":   "PR_TITLE",
+				"squash_merge_commit_message": "COMMIT_MESSAGES",
+			},
+		}
+
+		toArchive := make(map[string]*GithubRepoComparable)
+		r.Reconciliate(context.TODO(), &local, &remote, "teams", false, "goliac-admin", toArchive, map[string]*entity.Repository{})
+
+		// the changed settings are updated together, the message with its title
+		assert.Equal(t, 0, len(recorder.RepositoryCreated))
+		assert.Equal(t, map[string]string{
+			"homepage":                    "https://example.com",
+			"squash_merge_commit_title":   "PR_TITLE",
+			"squash_merge_commit_message": "PR_BODY",
+		}, recorder.RepositoriesUpdateString["myrepo"])
+		// the default branch is not managed
+		assert.Equal(t, 1, len(recorder.RepositoriesUpdateString))
+	})
+
+	t.Run("happy path: internal visibility", func(t *testing.T) {
+		recorder := NewReconciliatorListenerRecorder()
+		repoconf := config.RepositoryConfig{}
+
+		r := NewGoliacReconciliatorImpl(recorder, &repoconf)
+
+		local := GoliacLocalMock{
+			users: make(map[string]*entity.User),
+			teams: make(map[string]*entity.Team),
+			repos: make(map[string]*entity.Repository),
+		}
+		for _, name := range []string{"internalrepo", "privaterepo", "newrepo"} {
+			lRepo := &entity.Repository{}
+			lRepo.Name = name
+			lRepo.Spec.Visibility = "internal"
+			local.repos[name] = lRepo
+		}
+		oldRepo := &entity.Repository{}
+		oldRepo.Name = "oldrepo"
+		oldRepo.Spec.IsPublic = true
+		local.repos["oldrepo"] = oldRepo
+
+		remote := GoliacRemoteMock{
+			users:      make(map[string]string),
+			teams:      make(map[string]*GithubTeam),
+			repos:      make(map[string]*GithubRepository),
+			teamsrepos: make(map[string]map[string]*GithubTeamRepo),
+			rulesets:   make(map[string]*GithubRuleSet),
+			appids:     make(map[string]int),
+		}
+		remote.repos["teams"] = &GithubRepository{
+			Name:           "teams",
+			ExternalUsers:  map[string]string{},
+			BoolProperties: map[string]bool{},
+		}
+		// an internal repository is private too
+		remote.repos["internalrepo"] = &GithubRepository{
+			Name:             "internalrepo",
+			ExternalUsers:    map[string]string{},
+			BoolProperties:   map[string]bool{"private": true, "archived": false, "allow_auto_merge": false, "delete_branch_on_merge": false, "allow_update_branch": false},
+			StringProperties: map[string]string{"visibility": "internal"},
+		}
+		remote.repos["privaterepo"] = &GithubRepository{
+			Name:             "privaterepo",
+			ExternalUsers:    map[string]string{},
+			BoolProperties:   map[string]bool{"private": true, "archived": false, "allow_auto_merge": false, "delete_branch_on_merge": false, "allow_update_branch": false},
+			StringProperties: map[string]string{"visibility": "private"},
+		}
+		// loaded without the visibility (like from an older cache)
+		remote.repos["oldrepo"] = &GithubRepository{
+			Name:           "oldrepo",
+			ExternalUsers:  map[string]string{},
+			BoolProperties: map[string]bool{"private": false, "archived": false, "allow_auto_merge": false, "delete_branch_on_merge": false, "allow_update_branch": false},
+		}
+
+		toArchive := make(map[string]*GithubRepoComparable)
+		r.Reconciliate(context.TODO(), &local, &remote, "teams", false, "goliac-admin", toArchive, map[string]*entity.Repository{})
+
+		// the new repository is created private, and then made internal
+		assert.Equal(t, 1, len(recorder.RepositoryCreated))
+		assert.Equal(t, map[string]string{"visibility": "internal"}, recorder.RepositoriesUpdateString["newrepo"])
+		assert.Equal(t, map[string]string{"visibility": "internal"}, recorder.RepositoriesUpdateString["privaterepo"])
+		assert.Equal(t, 2, len(recorder.RepositoriesUpdateString))
+		assert.Equal(t, false, recorder.RepositoriesUpdatePrivate["internalrepo"])
+		assert.Equal(t, false, recorder.RepositoriesUpdatePrivate["oldrepo"])
+	})
+
+	t.Run("happy path: existing repos with topics", func(t *testing.T) {
+		recorder := NewReconciliatorListenerRecorder()
+		repoconf := config.RepositoryConfig{}
+
+		r := NewGoliacReconciliatorImpl(recorder, &repoconf)
+
+		local := GoliacLocalMock{
+			users: make(map[string]*entity.User),
+			teams: make(map[string]*entity.Team),
+			repos: make(map[string]*entity.Repository),
+		}
+		remote := GoliacRemoteMock{
+			users:      make(map[string]string),
+			teams:      make(map[string]*GithubTeam),
+			repos:      make(map[string]*GithubRepository),
+			teamsrepos: make(map[string]map[string]*GithubTeamRepo),
+			rulesets:   make(map[string]*GithubRuleSet),
+			appids:     make(map[string]int),
+		}
+		remote.repos["teams"] = &GithubRepository{
+			Name:           "teams",
+			ExternalUsers:  map[string]string{},
+			BoolProperties: map[string]bool{},
+		}
+
+		// topics: changed (repo1), the same (repo2), not managed (repo3), removed (repo4)
+		for name, topics := range map[string][][]string{
+			"repo1": {{"backend", "go"}, {"backend"}},
+			"repo2": {{"go", "backend"}, {"backend", "go"}},
+			"repo3": {nil, {"backend"}},
+			"repo4": {{}, {"backend"}},
+		} {
+			lRepo := &entity.Repository{}
+			lRepo.Name = name
+			lRepo.Spec.Topics = topics[0]
+			local.repos[name] = lRepo
+			remote.repos[name] = &GithubRepository{
+				Name:           name,
+				ExternalUsers:  map[string]string{},
+				BoolProperties: map[string]bool{},
+				Topics:         topics[1],
+			}
+		}
+
+		toArchive := make(map[string]*GithubRepoComparable)
+		r.Reconciliate(context.TODO(), &local, &remote, "teams", false, "goliac-admin", toArchive, map[string]*entity.Repository{})
+
+		assert.Equal(t, map[string][]string{
+			"repo1": {"backend", "go"},
+			"repo4": {},
+		}, recorder.RepositoriesSetTopics)
+	})
+
+	t.Run("happy path: custom properties definitions and values", func(t *testing.T) {
+		recorder := NewReconciliatorListenerRecorder()
+		repoconf := config.RepositoryConfig{}
+
+		r := NewGoliacReconciliatorImpl(recorder, &repoconf)
+
+		local := GoliacLocalMock{
+			users:      make(map[string]*entity.User),
+			teams:      make(map[string]*entity.Team),
+			repos:      make(map[string]*entity.Repository),
+			properties: make(map[string]*entity.CustomProperty),
+		}
+		tier := &entity.CustomProperty{}
+		tier.Name = "tier"
+		tier.Spec.ValueType = "single_select"
+		tier.Spec.AllowedValues = []string{"gold", "silver", "bronze"}
+		local.properties["tier"] = tier
+		owner := &entity.CustomProperty{}
+		owner.Name = "owner"
+		owner.Spec.ValueType = "string"
+		local.properties["owner"] = owner
+
+		remote := GoliacRemoteMock{
+			users:      make(map[string]string),
+			teams:      make(map[string]*GithubTeam),
+			repos:      make(map[string]*GithubRepository),
+			teamsrepos: make(map[string]map[string]*GithubTeamRepo),
+			rulesets:   make(map[string]*GithubRuleSet),
+			appids:     make(map[string]int),
+			properties: map[string]*GithubCustomProperty{
+				"tier":   {Name: "tier", ValueType: "single_select", AllowedValues: []string{"gold", "silver"}},
+				"legacy": {Name: "legacy", ValueType: "string"},
+			},
+		}
+		remote.repos["teams"] = &GithubRepository{
+			Name:             "teams",
+			ExternalUsers:    map[string]string{},
+			BoolProperties:   map[string]bool{},
+			CustomProperties: map[string][]string{"legacy": {"yes"}},
+		}
+
+		// values: changed (repo1), the same (repo2), not managed (repo3), unset (repo4)
+		for name, values := range map[string][]map[string][]string{
+			"repo1": {{"tier": {"bronze"}, "owner": {"team1"}}, {"tier": {"gold"}}},
+			"repo2": {{"tier": {"gold"}}, {"tier": {"gold"}, "legacy": {"yes"}}},
+			"repo3": {nil, {"tier": {"gold"}}},
+			"repo4": {{"tier": {}}, {"tier": {"gold"}}},
+		} {
+			lRepo := &entity.Repository{}
+			lRepo.Name = name
+			if values[0] != nil {
+				lRepo.Spec.Properties = make(map[string]entity.CustomPropertyValue)
+				for k, v := range values[0] {
+					lRepo.Spec.Properties[k] = v
+				}
+			}
+			local.repos[name] = lRepo
+			remote.repos[name] = &GithubRepository{
+				Name:             name,
+				ExternalUsers:    map[string]string{},
+				BoolProperties:   map[string]bool{},
+				CustomProperties: values[1],
+			}
+		}
+
+		toArchive := make(map[string]*GithubRepoComparable)
+		unmanaged, err := r.Reconciliate(context.TODO(), &local, &remote, "teams", false, "goliac-admin", toArchive, map[string]*entity.Repository{})
+		assert.Nil(t, err)
+
+		assert.Equal(t, 1, len(recorder.CustomPropertyCreated))
+		assert.NotNil(t, recorder.CustomPropertyCreated["owner"])
+		assert.Equal(t, 1, len(recorder.CustomPropertyUpdated))
+		assert.Equal(t, []string{"gold", "silver", "bronze"}, recorder.CustomPropertyUpdated["tier"].AllowedValues)
+		// custom properties deletion is not allowed by default
+		assert.Equal(t, 0, len(recorder.CustomPropertyDeleted))
+		assert.True(t, unmanaged.CustomProperties["legacy"])
+
+		assert.Equal(t, map[string]map[string][]string{
+			"repo1": {"tier": {"bronze"}, "owner": {"team1"}},
+			"repo4": {"tier": {}},
+		}, recorder.RepositoriesSetProperties)
+		// the value types are resolved by the reconciliator (owner is created in the same apply)
+		assert.Equal(t, map[string]string{"tier": "single_select", "owner": "string"}, recorder.RepositoriesSetPropertyTypes["repo1"])
+	})
+
+	t.Run("not happy path: custom properties are not reconciled when they could not be loaded", func(t *testing.T) {
+		recorder := NewReconciliatorListenerRecorder()
+		repoconf := config.RepositoryConfig{}
+
+		r := NewGoliacReconciliatorImpl(recorder, &repoconf)
+
+		local := GoliacLocalMock{
+			users:      make(map[string]*entity.User),
+			teams:      make(map[string]*entity.Team),
+			repos:      make(map[string]*entity.Repository),
+			properties: make(map[string]*entity.CustomProperty),
+		}
+		tier := &entity.CustomProperty{}
+		tier.Name = "tier"
+		tier.Spec.ValueType = "single_select"
+		tier.Spec.AllowedValues = []string{"gold", "silver", "bronze"}
+		local.properties["tier"] = tier
+		lRepo := &entity.Repository{}
+		lRepo.Name = "repo1"
+		lRepo.Spec.Properties = map[string]entity.CustomPropertyValue{"tier": {"gold"}}
+		local.repos["repo1"] = lRepo
+
+		// Github didn't return the custom properties: they look empty
+		remote := GoliacRemoteMock{
+			users:         make(map[string]string),
+			teams:         make(map[string]*GithubTeam),
+			repos:         make(map[string]*GithubRepository),
+			teamsrepos:    make(map[string]map[string]*GithubTeamRepo),
+			rulesets:      make(map[string]*GithubRuleSet),
+			appids:        make(map[string]int),
+			properties:    make(map[string]*GithubCustomProperty),
+			propertiesErr: fmt.Errorf("unexpected status: 403 Forbidden"),
+		}
+		remote.repos["teams"] = &GithubRepository{
+			Name:           "teams",
+			ExternalUsers:  map[string]string{},
+			BoolProperties: map[string]bool{},
+		}
+		remote.repos["repo1"] = &GithubRepository{
+			Name:           "repo1",
+			ExternalUsers:  map[string]string{},
+			BoolProperties: map[string]bool{},
+		}
+
+		toArchive := make(map[string]*GithubRepoComparable)
+		_, err := r.Reconciliate(context.TODO(), &local, &remote, "teams", false, "goliac-admin", toArchive, map[string]*entity.Repository{})
+		assert.Nil(t, err)
+
+		assert.Equal(t, 0, len(recorder.CustomPropertyCreated))
+		assert.Equal(t, 0, len(recorder.CustomPropertyUpdated))
+		assert.Equal(t, 0, len(recorder.RepositoriesSetProperties))
+	})
+
+	t.Run("happy path: repository features with goliac.yaml defaults", func(t *testing.T) {
+		recorder := NewReconciliatorListenerRecorder()
+		repoconf := config.RepositoryConfig{}
+		noWiki, noForking := false, false
+		repoconf.RepositoryDefaults.HasWiki = &noWiki
+		repoconf.RepositoryDefaults.AllowForking = &noForking
+
+		r := NewGoliacReconciliatorImpl(recorder, &repoconf)
+
+		local := GoliacLocalMock{
+			users: make(map[string]*entity.User),
+			teams: make(map[string]*entity.Team),
+			repos: make(map[string]*entity.Repository),
+		}
+		lRepo := &entity.Repository{}
+		lRepo.Name = "myrepo"
+		forking := true
+		lRepo.Spec.AllowForking = &forking
+		local.repos["myrepo"] = lRepo
+
+		remote := GoliacRemoteMock{
+			users:      make(map[string]string),
+			teams:      make(map[string]*GithubTeam),
+			repos:      make(map[string]*GithubRepository),
+			teamsrepos: make(map[string]map[string]*GithubTeamRepo),
+			rulesets:   make(map[string]*GithubRuleSet),
+			appids:     make(map[string]int),
+		}
+		remote.repos["teams"] = &GithubRepository{
+			Name:          "teams",
+			ExternalUsers: map[string]string{},
+			BoolProperties: map[string]bool{
+				"private":                true,
+				"archived":               false,
+				"allow_auto_merge":       false,
+				"delete_branch_on_merge": true,
+				"allow_update_branch":    false,
+				"has_wiki":               true,
+				"allow_forking":          true,
+			},
+		}
+		remote.repos["myrepo"] = &GithubRepository{
+			Name:          "myrepo",
+			ExternalUsers: map[string]string{},
+			BoolProperties: map[string]bool{
+				"private":                true,
+				"archived":               false,
+				"allow_auto_merge":       false,
+				"delete_branch_on_merge": false,
+				"allow_update_branch":    false,
+				"has_wiki":               true,
+				"has_issues":             false,
+				"allow_forking":          false,
+			},
+		}
+
+		toArchive := make(map[string]*GithubRepoComparable)
+		r.Reconciliate(context.TODO(), &local, &remote, "teams", false, "goliac-admin", toArchive, map[string]*entity.Repository{})
+
+		// has_wiki comes from the defaults, allow_forking from the repository,
+		// has_issues is not managed, and the teams repo doesn't get the defaults
+		assert.Equal(t, map[string]bool{"myrepo": true}, recorder.RepositoriesUpdatePrivate)
+
+		// once applied, nothing left to do
+		remote.repos["myrepo"].BoolProperties["has_wiki"] = false
+		remote.repos["myrepo"].BoolProperties["allow_forking"] = true
+		recorder = NewReconciliatorListenerRecorder()
+		r = NewGoliacReconciliatorImpl(recorder, &repoconf)
+		r.Reconciliate(context.TODO(), &local, &remote, "teams", false, "goliac-admin", toArchive, map[string]*entity.Repository{})
+		assert.Equal(t, 0, len(recorder.RepositoriesUpdatePrivate))
+	})
+
 	t.Run("happy path: existing repo with new owner (from read to write)", func(t *testing.T) {
 		recorder := NewReconciliatorListenerRecorder()
 
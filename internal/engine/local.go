@@ -68,6 +68,7 @@ type GoliacLocalResources interface {
 	Users() map[string]*entity.User              // github username, user definition
 	ExternalUsers() map[string]*entity.User
 	RuleSets() map[string]*entity.RuleSet
+	CustomProperties() map[string]*entity.CustomProperty // property name, property definition
 }
 
 type GoliacLocalImpl struct {
@@ -76,6 +77,7 @@ type GoliacLocalImpl struct {
 	users         map[string]*entity.User
 	externalUsers map[string]*entity.User
 	rulesets      map[string]*entity.RuleSet
+	properties    map[string]*entity.CustomProperty
 	repo          *git.Repository
 }
 
@@ -86,6 +88,7 @@ func NewGoliacLocalImpl() GoliacLocal {
 		users:         map[string]*entity.User{},
 		externalUsers: map[string]*entity.User{},
 		rulesets:      map[string]*entity.RuleSet{},
+		properties:    map[string]*entity.CustomProperty{},
 		repo:          nil,
 	}
 }
@@ -98,6 +101,7 @@ func NewGoliacLocalImplWithRepo(repo *git.Repository) GoliacLocal {
 		users:         map[string]*entity.User{},
 		externalUsers: map[string]*entity.User{},
 		rulesets:      map[string]*entity.RuleSet{},
+		properties:    map[string]*entity.CustomProperty{},
 		repo:          repo,
 	}
 }
@@ -122,6 +126,10 @@ func (g *GoliacLocalImpl) RuleSets() map[string]*entity.RuleSet {
 	return g.rulesets
 }
 
+func (g *GoliacLocalImpl) CustomProperties() map[string]*entity.CustomProperty {
+	return g.properties
+}
+
 func (g *GoliacLocalImpl) Clone(fs billy.Filesystem, accesstoken, repositoryUrl, branch string) error {
 	if g.repo != nil {
 		g.Close(fs)
@@ -139,7 +147,7 @@ func (g *GoliacLocalImpl) Clone(fs billy.Filesystem, accesstoken, repositoryUrl,
 			Username: "x-access-token", // This can be anything except an empty string
 			Password: accesstoken,
 		}
-	} else if strings.HasPrefix(repositoryUrl, "inmemory:///") {
+	} else if strings.HasPrefix(repositoryUrl, "inmemory:///") || strings.HasPrefix(repositoryUrl, "file://") {
 		auth = nil
 	} else {
 		// ssh clone not supported yet
@@ -289,9 +297,16 @@ func (g *GoliacLocalImpl) LoadRepoConfig() (*config.RepositoryConfig, error) {
 		return nil, err
 	}
 
+	return ReadRepoConfig(w.Filesystem)
+}
+
+/*
+ * ReadRepoConfig reads the goliac.yaml configuration file of a teams repository directory
+ */
+func ReadRepoConfig(fs billy.Filesystem) (*config.RepositoryConfig, error) {
 	var repoconfig config.RepositoryConfig
 
-	content, err := utils.ReadFile(w.Filesystem, "goliac.yaml")
+	content, err := utils.ReadFile(fs, "goliac.yaml")
 	if err != nil {
 		return nil, fmt.Errorf("not able to find the /goliac.yaml configuration file: %v", err)
 	}
@@ -870,6 +885,18 @@ func (g *GoliacLocalImpl) LoadAndValidateLocal(fs billy.Filesystem) ([]error, []
 	warnings = append(warnings, warns...)
 	g.rulesets = rulesets
 
+	// Parse all the custom properties definitions, and check the repositories values against them
+	properties, errs, warns := entity.ReadCustomPropertyDirectory(fs, "custom_properties")
+	errors = append(errors, errs...)
+	warnings = append(warnings, warns...)
+	g.properties = properties
+
+	for _, repo := range g.repositories {
+		if err := repo.ValidateProperties(g.properties); err != nil {
+			errors = append(errors, err)
+		}
+	}
+
 	logrus.Debugf("Nb local users: %d", len(g.users))
 	logrus.Debugf("Nb local external users: %d", len(g.externalUsers))
 	logrus.Debugf("Nb local teams: %d", len(g.teams))
@@ -19,6 +19,8 @@ type MutableGoliacRemoteImpl struct {
 	teamSlugByName map[string]string
 	rulesets       map[string]*GithubRuleSet
 	appIds         map[string]int
+	properties     map[string]*GithubCustomProperty
+	propertiesErr  error // cf GoliacRemote.CustomPropertiesError
 }
 
 func NewMutableGoliacRemoteImpl(ctx context.Context, remote GoliacRemote) *MutableGoliacRemoteImpl {
@@ -30,15 +32,29 @@ func NewMutableGoliacRemoteImpl(ctx context.Context, remote GoliacRemote) *Mutab
 	for k, v := range remote.TeamSlugByName(ctx) {
 		rTeamSlugByName[k] = v
 	}
+	// the members and properties are copied too: the reconciliation must not
+	// change the remote cache (for example during a plan)
 	rTeams := make(map[string]*GithubTeam)
 	for k, v := range remote.Teams(ctx, false) {
 		ght := *v
+		ght.Members = append([]string{}, v.Members...)
+		ght.Maintainers = append([]string{}, v.Maintainers...)
 		rTeams[k] = &ght
 	}
 
 	rRepositories := make(map[string]*GithubRepository)
 	for k, v := range remote.Repositories(ctx) {
 		ghr := *v
+		ghr.BoolProperties = copyMap(v.BoolProperties)
+		ghr.StringProperties = copyMap(v.StringProperties)
+		ghr.Topics = append([]string{}, v.Topics...)
+		ghr.ExternalUsers = copyMap(v.ExternalUsers)
+		ghr.InternalUsers = copyMap(v.InternalUsers)
+		ghr.RuleSets = copyMap(v.RuleSets)
+		ghr.CustomProperties = make(map[string][]string)
+		for pk, pv := range v.CustomProperties {
+			ghr.CustomProperties[pk] = append([]string{}, pv...)
+		}
 		rRepositories[k] = &ghr
 	}
 
@@ -62,6 +78,11 @@ func NewMutableGoliacRemoteImpl(ctx context.Context, remote GoliacRemote) *Mutab
 		appids[k] = v
 	}
 
+	properties := make(map[string]*GithubCustomProperty)
+	for k, v := range remote.CustomProperties(ctx) {
+		properties[k] = v
+	}
+
 	return &MutableGoliacRemoteImpl{
 		users:          rUsers,
 		repositories:   rRepositories,
@@ -70,6 +91,8 @@ func NewMutableGoliacRemoteImpl(ctx context.Context, remote GoliacRemote) *Mutab
 		teamSlugByName: rTeamSlugByName,
 		rulesets:       rulesets,
 		appIds:         appids,
+		properties:     properties,
+		propertiesErr:  remote.CustomPropertiesError(),
 	}
 }
 
@@ -96,6 +119,12 @@ func (m *MutableGoliacRemoteImpl) RuleSets() map[string]*GithubRuleSet {
 func (g *MutableGoliacRemoteImpl) AppIds() map[string]int {
 	return g.appIds
 }
+func (m *MutableGoliacRemoteImpl) CustomProperties() map[string]*GithubCustomProperty {
+	return m.properties
+}
+func (m *MutableGoliacRemoteImpl) CustomPropertiesError() error {
+	return m.propertiesErr
+}
 
 // LISTENER
 
@@ -171,9 +200,10 @@ func (m *MutableGoliacRemoteImpl) DeleteTeam(teamslug string) {
 }
 func (m *MutableGoliacRemoteImpl) CreateRepository(reponame string, descrition string, writers []string, readers []string, boolProperties map[string]bool) {
 	r := GithubRepository{
-		Name:           reponame,
-		BoolProperties: boolProperties,
-		ExternalUsers:  map[string]string{},
+		Name:             reponame,
+		BoolProperties:   boolProperties,
+		StringProperties: map[string]string{"description": descrition, "visibility": visibilityFromPrivate(boolProperties["private"])},
+		ExternalUsers:    map[string]string{},
 	}
 	m.repositories[reponame] = &r
 }
@@ -231,12 +261,54 @@ UpdateRepositoryUpdateBoolProperty is used for
 - allow_auto_merge
 - delete_branch_on_merge
 - allow_update_branch
+- allow_merge_commit, allow_rebase_merge, allow_squash_merge
+- allow_forking, web_commit_signoff_required
+- has_issues, has_wiki, has_projects, has_discussions
 */
 func (m *MutableGoliacRemoteImpl) UpdateRepositoryUpdateBoolProperty(reponame string, propertyName string, propertyValue bool) {
 	if r, ok := m.repositories[reponame]; ok {
 		r.BoolProperties[propertyName] = propertyValue
 	}
 }
+
+/*
+UpdateRepositoryUpdateStringProperties is used for
+- description
+- homepage
+- default_branch
+- squash_merge_commit_title, squash_merge_commit_message
+- merge_commit_title, merge_commit_message
+- visibility (public, private or internal)
+*/
+func (m *MutableGoliacRemoteImpl) UpdateRepositoryUpdateStringProperties(reponame string, properties map[string]string) {
+	if r, ok := m.repositories[reponame]; ok {
+		for k, v := range properties {
+			r.StringProperties[k] = v
+		}
+		if visibility, ok := properties["visibility"]; ok && r.BoolProperties != nil {
+			r.BoolProperties["private"] = visibility != "public"
+		}
+	}
+}
+func (m *MutableGoliacRemoteImpl) UpdateRepositorySetTopics(reponame string, topics []string) {
+	if r, ok := m.repositories[reponame]; ok {
+		r.Topics = append([]string{}, topics...)
+	}
+}
+func (m *MutableGoliacRemoteImpl) UpdateRepositorySetCustomProperties(reponame string, properties map[string][]string) {
+	if r, ok := m.repositories[reponame]; ok {
+		if r.CustomProperties == nil {
+			r.CustomProperties = make(map[string][]string)
+		}
+		for k, v := range properties {
+			if len(v) == 0 {
+				delete(r.CustomProperties, k)
+			} else {
+				r.CustomProperties[k] = append([]string{}, v...)
+			}
+		}
+	}
+}
 func (m *MutableGoliacRemoteImpl) UpdateRepositorySetExternalUser(reponame string, collaboatorGithubId string, permission string) {
 	if r, ok := m.repositories[reponame]; ok {
 		r.ExternalUsers[collaboatorGithubId] = permission
@@ -273,6 +345,15 @@ func (m *MutableGoliacRemoteImpl) DeleteRepositoryRuleset(reponame string, rules
 	}
 }
 
+func (m *MutableGoliacRemoteImpl) SetCustomProperty(property *GithubCustomProperty) {
+	m.properties[property.Name] = property
+}
+func (m *MutableGoliacRemoteImpl) DeleteCustomProperty(propertyname string) {
+	delete(m.properties, propertyname)
+	for _, r := range m.repositories {
+		delete(r.CustomProperties, propertyname)
+	}
+}
 func (m *MutableGoliacRemoteImpl) AddRuleset(ruleset *GithubRuleSet) {
 
 }
@@ -282,3 +363,11 @@ func (m *MutableGoliacRemoteImpl) UpdateRuleset(ruleset *GithubRuleSet) {
 func (m *MutableGoliacRemoteImpl) DeleteRuleset(rulesetid int) {
 
 }
+
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	c := make(map[K]V, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutableGoliacRemote(t *testing.T) {
+
+	t.Run("happy path: the reconciliation doesn't change the remote cache", func(t *testing.T) {
+		members := make([]string, 1, 4) // room to append in place
+		members[0] = "user1"
+		remote := GoliacRemoteMock{
+			users:      map[string]string{"user1": "member"},
+			teams:      map[string]*GithubTeam{"team1": {Name: "team1", Slug: "team1", Members: members, Maintainers: []string{"user2"}}},
+			repos:      make(map[string]*GithubRepository),
+			teamsrepos: make(map[string]map[string]*GithubTeamRepo),
+			rulesets:   make(map[string]*GithubRuleSet),
+			appids:     make(map[string]int),
+			properties: make(map[string]*GithubCustomProperty),
+		}
+		remote.repos["repo1"] = &GithubRepository{
+			Name:             "repo1",
+			BoolProperties:   map[string]bool{"archived": false},
+			StringProperties: map[string]string{"description": "repo1"},
+			Topics:           []string{"go"},
+			ExternalUsers:    map[string]string{"outside1": "pull"},
+			InternalUsers:    map[string]string{"user1": "push"},
+			RuleSets:         map[string]*GithubRuleSet{"ruleset1": {Name: "ruleset1", Id: 1}},
+			CustomProperties: map[string][]string{"tier": {"gold"}},
+		}
+
+		mutable := NewMutableGoliacRemoteImpl(context.TODO(), &remote)
+		mutable.UpdateTeamAddMember("team1", "user3", "member")
+		mutable.UpdateTeamRemoveMember("team1", "user1")
+		mutable.UpdateTeamUpdateMember("team1", "user2", "member")
+		mutable.UpdateRepositoryUpdateBoolProperty("repo1", "archived", true)
+		mutable.UpdateRepositoryUpdateStringProperties("repo1", map[string]string{"description": "changed"})
+		mutable.UpdateRepositorySetTopics("repo1", []string{"rust"})
+		mutable.UpdateRepositorySetExternalUser("repo1", "outside2", "push")
+		mutable.UpdateRepositoryRemoveInternalUser("repo1", "user1")
+		mutable.DeleteRepositoryRuleset("repo1", 1)
+		mutable.UpdateRepositorySetCustomProperties("repo1", map[string][]string{"tier": {"silver"}})
+
+		assert.Equal(t, []string{"user1"}, remote.teams["team1"].Members)
+		// nothing was appended in the cache backing array
+		assert.Equal(t, []string{"user1", ""}, members[:2])
+		assert.Equal(t, []string{"user2"}, remote.teams["team1"].Maintainers)
+
+		repo := remote.repos["repo1"]
+		assert.Equal(t, map[string]bool{"archived": false}, repo.BoolProperties)
+		assert.Equal(t, map[string]string{"description": "repo1"}, repo.StringProperties)
+		assert.Equal(t, []string{"go"}, repo.Topics)
+		assert.Equal(t, map[string]string{"outside1": "pull"}, repo.ExternalUsers)
+		assert.Equal(t, map[string]string{"user1": "push"}, repo.InternalUsers)
+		assert.Equal(t, 1, len(repo.RuleSets))
+		assert.Equal(t, map[string][]string{"tier": {"gold"}}, repo.CustomProperties)
+	})
+}
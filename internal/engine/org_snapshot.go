@@ -0,0 +1,313 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Alayacare/goliac/internal/entity"
+	"gopkg.in/yaml.v3"
+)
+
+// to be increased each time the exported snapshot format changes
+const ORG_SNAPSHOT_VERSION = 1
+
+/*
+ * OrgSnapshot is a stable (sorted) export of everything Goliac knows about a
+ * Github organization (goliac snapshot export), to be kept for audit purposes
+ * and compared later (goliac snapshot diff).
+ * Unlike the remote cache snapshot, it is meant to be read by humans
+ */
+type OrgSnapshot struct {
+	Version      int    `json:"version" yaml:"version"`
+	Organization string `json:"organization" yaml:"organization"`
+	ExportedAt   string `json:"exported_at" yaml:"exported_at"`
+	// the name of the teams repository (if known at export), to plan a local teams directory
+	TeamsRepository string                  `json:"teams_repository,omitempty" yaml:"teams_repository,omitempty"`
+	Enterprise      bool                    `json:"enterprise" yaml:"enterprise"`
+	Users           []OrgSnapshotUser       `json:"users" yaml:"users"`
+	Teams           []OrgSnapshotTeam       `json:"teams" yaml:"teams"`
+	Repositories    []OrgSnapshotRepository `json:"repositories" yaml:"repositories"`
+	Rulesets        []OrgSnapshotRuleset    `json:"rulesets" yaml:"rulesets"` // organization rulesets
+	Apps            map[string]int          `json:"apps,omitempty" yaml:"apps,omitempty"`
+	// organization custom properties definitions
+	CustomProperties []OrgSnapshotCustomProperty `json:"custom_properties,omitempty" yaml:"custom_properties,omitempty"`
+}
+
+type OrgSnapshotCustomProperty struct {
+	Name          string   `json:"name" yaml:"name"`
+	ValueType     string   `json:"value_type" yaml:"value_type"`
+	Required      bool     `json:"required,omitempty" yaml:"required,omitempty"`
+	DefaultValue  []string `json:"default_value,omitempty" yaml:"default_value,omitempty"`
+	AllowedValues []string `json:"allowed_values,omitempty" yaml:"allowed_values,omitempty"`
+	Description   string   `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+type OrgSnapshotUser struct {
+	Login string `json:"login" yaml:"login"`
+	Role  string `json:"role" yaml:"role"` // ADMIN, MEMBER
+}
+
+type OrgSnapshotTeam struct {
+	Name         string                  `json:"name" yaml:"name"`
+	Slug         string                  `json:"slug" yaml:"slug"`
+	Id           int                     `json:"id" yaml:"id"`
+	Parent       string                  `json:"parent,omitempty" yaml:"parent,omitempty"` // parent team slug
+	Maintainers  []string                `json:"maintainers" yaml:"maintainers"`
+	Members      []string                `json:"members" yaml:"members"`
+	Repositories []OrgSnapshotPermission `json:"repositories" yaml:"repositories"`
+}
+
+type OrgSnapshotPermission struct {
+	Repository string `json:"repository" yaml:"repository"`
+	Permission string `json:"permission" yaml:"permission"` // ADMIN, MAINTAIN, WRITE, TRIAGE, READ
+}
+
+type OrgSnapshotRepository struct {
+	Name       string            `json:"name" yaml:"name"`
+	Id         int               `json:"id" yaml:"id"`
+	RefId      string            `json:"ref_id,omitempty" yaml:"ref_id,omitempty"`
+	Properties map[string]bool   `json:"properties" yaml:"properties"`
+	Settings   map[string]string `json:"settings,omitempty" yaml:"settings,omitempty"` // description, homepage, default_branch, ...
+	Topics     []string          `json:"topics,omitempty" yaml:"topics,omitempty"`
+	// custom properties values
+	CustomProperties map[string][]string       `json:"custom_properties,omitempty" yaml:"custom_properties,omitempty"`
+	Collaborators    []OrgSnapshotCollaborator `json:"collaborators" yaml:"collaborators"`
+	Rulesets         []OrgSnapshotRuleset      `json:"rulesets,omitempty" yaml:"rulesets,omitempty"`
+}
+
+type OrgSnapshotCollaborator struct {
+	Login      string `json:"login" yaml:"login"`
+	Permission string `json:"permission" yaml:"permission"`
+	Outside    bool   `json:"outside" yaml:"outside"` // an outside collaborator (not a member of the organization)
+}
+
+type OrgSnapshotRuleset struct {
+	Name         string                               `json:"name" yaml:"name"`
+	Id           int                                  `json:"id" yaml:"id"`
+	Enforcement  string                               `json:"enforcement" yaml:"enforcement"`
+	BypassApps   map[string]string                    `json:"bypass_apps,omitempty" yaml:"bypass_apps,omitempty"`
+	Include      []string                             `json:"include" yaml:"include"`
+	Exclude      []string                             `json:"exclude" yaml:"exclude"`
+	Rules        map[string]OrgSnapshotRuleParameters `json:"rules" yaml:"rules"`
+	Repositories []string                             `json:"repositories,omitempty" yaml:"repositories,omitempty"`
+}
+
+// same fields (and names) than the rulesets of the teams repository
+type OrgSnapshotRuleParameters struct {
+	DismissStaleReviewsOnPush        bool     `json:"dismissStaleReviewsOnPush,omitempty" yaml:"dismissStaleReviewsOnPush,omitempty"`
+	RequireCodeOwnerReview           bool     `json:"requireCodeOwnerReview,omitempty" yaml:"requireCodeOwnerReview,omitempty"`
+	RequiredApprovingReviewCount     int      `json:"requiredApprovingReviewCount,omitempty" yaml:"requiredApprovingReviewCount,omitempty"`
+	RequiredReviewThreadResolution   bool     `json:"requiredReviewThreadResolution,omitempty" yaml:"requiredReviewThreadResolution,omitempty"`
+	RequireLastPushApproval          bool     `json:"requireLastPushApproval,omitempty" yaml:"requireLastPushApproval,omitempty"`
+	RequiredStatusChecks             []string `json:"requiredStatusChecks,omitempty" yaml:"requiredStatusChecks,omitempty"`
+	StrictRequiredStatusChecksPolicy bool     `json:"strictRequiredStatusChecksPolicy,omitempty" yaml:"strictRequiredStatusChecksPolicy,omitempty"`
+}
+
+/*
+ * NewOrgSnapshot exports the (loaded) remote state
+ */
+func NewOrgSnapshot(ctx context.Context, remote GoliacRemote, organization string) *OrgSnapshot {
+	snapshot := &OrgSnapshot{
+		Version:      ORG_SNAPSHOT_VERSION,
+		Organization: organization,
+		ExportedAt:   time.Now().UTC().Format(time.RFC3339),
+		Enterprise:   remote.IsEnterprise(),
+		Users:        []OrgSnapshotUser{},
+		Teams:        []OrgSnapshotTeam{},
+		Repositories: []OrgSnapshotRepository{},
+		Rulesets:     []OrgSnapshotRuleset{},
+		Apps:         remote.AppIds(ctx),
+	}
+
+	for login, role := range remote.Users(ctx) {
+		snapshot.Users = append(snapshot.Users, OrgSnapshotUser{Login: login, Role: role})
+	}
+	sort.Slice(snapshot.Users, func(i, j int) bool { return snapshot.Users[i].Login < snapshot.Users[j].Login })
+
+	teams := remote.Teams(ctx, true)
+	slugById := make(map[int]string)
+	for slug, team := range teams {
+		slugById[team.Id] = slug
+	}
+	teamsRepos := remote.TeamRepositories(ctx)
+	for slug, team := range teams {
+		t := OrgSnapshotTeam{
+			Name:         team.Name,
+			Slug:         slug,
+			Id:           team.Id,
+			Maintainers:  sortedStrings(team.Maintainers),
+			Members:      sortedStrings(team.Members),
+			Repositories: []OrgSnapshotPermission{},
+		}
+		if team.ParentTeam != nil {
+			t.Parent = slugById[*team.ParentTeam]
+		}
+		for reponame, repo := range teamsRepos[slug] {
+			t.Repositories = append(t.Repositories, OrgSnapshotPermission{Repository: reponame, Permission: repo.Permission})
+		}
+		sort.Slice(t.Repositories, func(i, j int) bool { return t.Repositories[i].Repository < t.Repositories[j].Repository })
+		snapshot.Teams = append(snapshot.Teams, t)
+	}
+	sort.Slice(snapshot.Teams, func(i, j int) bool { return snapshot.Teams[i].Slug < snapshot.Teams[j].Slug })
+
+	for reponame, repo := range remote.Repositories(ctx) {
+		r := OrgSnapshotRepository{
+			Name:          reponame,
+			Id:            repo.Id,
+			RefId:         repo.RefId,
+			Properties:    copyMap(repo.BoolProperties),
+			Collaborators: []OrgSnapshotCollaborator{},
+		}
+		if len(repo.StringProperties) != 0 {
+			r.Settings = copyMap(repo.StringProperties)
+		}
+		if len(repo.Topics) != 0 {
+			r.Topics = sortedStrings(repo.Topics)
+		}
+		if len(repo.CustomProperties) != 0 {
+			r.CustomProperties = make(map[string][]string)
+			for name, value := range repo.CustomProperties {
+				r.CustomProperties[name] = append([]string{}, value...)
+			}
+		}
+		if r.Properties == nil {
+			r.Properties = map[string]bool{}
+		}
+		for login, permission := range repo.InternalUsers {
+			r.Collaborators = append(r.Collaborators, OrgSnapshotCollaborator{Login: login, Permission: permission})
+		}
+		for login, permission := range repo.ExternalUsers {
+			r.Collaborators = append(r.Collaborators, OrgSnapshotCollaborator{Login: login, Permission: permission, Outside: true})
+		}
+		sort.Slice(r.Collaborators, func(i, j int) bool { return r.Collaborators[i].Login < r.Collaborators[j].Login })
+		for _, rs := range repo.RuleSets {
+			r.Rulesets = append(r.Rulesets, newOrgSnapshotRuleset(rs))
+		}
+		sort.Slice(r.Rulesets, func(i, j int) bool { return r.Rulesets[i].Name < r.Rulesets[j].Name })
+		snapshot.Repositories = append(snapshot.Repositories, r)
+	}
+	sort.Slice(snapshot.Repositories, func(i, j int) bool { return snapshot.Repositories[i].Name < snapshot.Repositories[j].Name })
+
+	for _, rs := range remote.RuleSets(ctx) {
+		snapshot.Rulesets = append(snapshot.Rulesets, newOrgSnapshotRuleset(rs))
+	}
+	sort.Slice(snapshot.Rulesets, func(i, j int) bool { return snapshot.Rulesets[i].Name < snapshot.Rulesets[j].Name })
+
+	for _, cp := range remote.CustomProperties(ctx) {
+		snapshot.CustomProperties = append(snapshot.CustomProperties, OrgSnapshotCustomProperty{
+			Name:          cp.Name,
+			ValueType:     cp.ValueType,
+			Required:      cp.Required,
+			DefaultValue:  append([]string(nil), cp.DefaultValue...),
+			AllowedValues: append([]string(nil), cp.AllowedValues...),
+			Description:   cp.Description,
+		})
+	}
+	sort.Slice(snapshot.CustomProperties, func(i, j int) bool { return snapshot.CustomProperties[i].Name < snapshot.CustomProperties[j].Name })
+
+	return snapshot
+}
+
+func newOrgSnapshotRuleset(rs *GithubRuleSet) OrgSnapshotRuleset {
+	ruleset := OrgSnapshotRuleset{
+		Name:         rs.Name,
+		Id:           rs.Id,
+		Enforcement:  rs.Enforcement,
+		BypassApps:   copyMap(rs.BypassApps),
+		Include:      sortedStrings(rs.OnInclude),
+		Exclude:      sortedStrings(rs.OnExclude),
+		Rules:        make(map[string]OrgSnapshotRuleParameters),
+		Repositories: sortedStrings(rs.Repositories),
+	}
+	for ruletype, parameters := range rs.Rules {
+		var statusChecks []string // omitted when empty
+		if len(parameters.RequiredStatusChecks) > 0 {
+			statusChecks = sortedStrings(parameters.RequiredStatusChecks)
+		}
+		ruleset.Rules[ruletype] = OrgSnapshotRuleParameters{
+			DismissStaleReviewsOnPush:        parameters.DismissStaleReviewsOnPush,
+			RequireCodeOwnerReview:           parameters.RequireCodeOwnerReview,
+			RequiredApprovingReviewCount:     parameters.RequiredApprovingReviewCount,
+			RequiredReviewThreadResolution:   parameters.RequiredReviewThreadResolution,
+			RequireLastPushApproval:          parameters.RequireLastPushApproval,
+			RequiredStatusChecks:             statusChecks,
+			StrictRequiredStatusChecksPolicy: parameters.StrictRequiredStatusChecksPolicy,
+		}
+	}
+	return ruleset
+}
+
+/*
+ * toGithubRuleSet is the reverse of newOrgSnapshotRuleset
+ */
+func (rs OrgSnapshotRuleset) toGithubRuleSet() *GithubRuleSet {
+	ruleset := &GithubRuleSet{
+		Name:         rs.Name,
+		Id:           rs.Id,
+		Enforcement:  rs.Enforcement,
+		BypassApps:   copyMap(rs.BypassApps),
+		OnInclude:    append([]string{}, rs.Include...),
+		OnExclude:    append([]string{}, rs.Exclude...),
+		Rules:        make(map[string]entity.RuleSetParameters),
+		Repositories: append([]string{}, rs.Repositories...),
+	}
+	if ruleset.BypassApps == nil {
+		ruleset.BypassApps = make(map[string]string)
+	}
+	for ruletype, parameters := range rs.Rules {
+		ruleset.Rules[ruletype] = entity.RuleSetParameters{
+			DismissStaleReviewsOnPush:        parameters.DismissStaleReviewsOnPush,
+			RequireCodeOwnerReview:           parameters.RequireCodeOwnerReview,
+			RequiredApprovingReviewCount:     parameters.RequiredApprovingReviewCount,
+			RequiredReviewThreadResolution:   parameters.RequiredReviewThreadResolution,
+			RequireLastPushApproval:          parameters.RequireLastPushApproval,
+			RequiredStatusChecks:             append([]string{}, parameters.RequiredStatusChecks...),
+			StrictRequiredStatusChecksPolicy: parameters.StrictRequiredStatusChecksPolicy,
+		}
+	}
+	return ruleset
+}
+
+func sortedStrings(s []string) []string {
+	sorted := append([]string{}, s...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func (s *OrgSnapshot) ToJSON() ([]byte, error) {
+	return json.MarshalIndent(s, "", "  ")
+}
+
+func (s *OrgSnapshot) ToYAML() ([]byte, error) {
+	return yaml.Marshal(s)
+}
+
+/*
+ * ReadOrgSnapshot loads an exported snapshot (YAML if the file has a .yaml/.yml extension, JSON otherwise)
+ */
+func ReadOrgSnapshot(path string) (*OrgSnapshot, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("not able to read the snapshot %s: %v", path, err)
+	}
+	var snapshot OrgSnapshot
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".yaml" || ext == ".yml" {
+		err = yaml.Unmarshal(content, &snapshot)
+	} else {
+		err = json.Unmarshal(content, &snapshot)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("not able to parse the snapshot %s: %v", path, err)
+	}
+	if snapshot.Version != ORG_SNAPSHOT_VERSION {
+		return nil, fmt.Errorf("snapshot %s: version %d is not supported (expected %d)", path, snapshot.Version, ORG_SNAPSHOT_VERSION)
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,403 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/*
+ * OrgSnapshotChanges is the semantic difference between 2 exported snapshots,
+ * grouped like a plan (users, teams, repositories, rulesets, custom properties) plus the resulting
+ * access changes (who can access which repository, and why)
+ */
+type OrgSnapshotChanges struct {
+	Users            []string `json:"users"`
+	Teams            []string `json:"teams"`
+	Repositories     []string `json:"repositories"`
+	Rulesets         []string `json:"rulesets"`
+	CustomProperties []string `json:"custom_properties"`
+	Access           []string `json:"access"`
+}
+
+func (c *OrgSnapshotChanges) Count() int {
+	return len(c.Users) + len(c.Teams) + len(c.Repositories) + len(c.Rulesets) + len(c.CustomProperties) + len(c.Access)
+}
+
+/*
+ * DiffOrgSnapshots compares 2 snapshots (before is usually the older one)
+ */
+func DiffOrgSnapshots(before *OrgSnapshot, after *OrgSnapshot) *OrgSnapshotChanges {
+	changes := &OrgSnapshotChanges{
+		Users:            diffSnapshotUsers(before, after),
+		Teams:            diffSnapshotTeams(before, after),
+		Repositories:     diffSnapshotRepositories(before, after),
+		Rulesets:         diffSnapshotRulesets("", before.Rulesets, after.Rulesets),
+		CustomProperties: diffSnapshotCustomProperties(before, after),
+		Access:           diffSnapshotAccess(before, after),
+	}
+	beforeRepos := make(map[string]OrgSnapshotRepository)
+	for _, r := range before.Repositories {
+		beforeRepos[r.Name] = r
+	}
+	for _, r := range after.Repositories {
+		if b, ok := beforeRepos[r.Name]; ok {
+			changes.Rulesets = append(changes.Rulesets, diffSnapshotRulesets(r.Name, b.Rulesets, r.Rulesets)...)
+		}
+	}
+	return changes
+}
+
+func diffSnapshotUsers(before *OrgSnapshot, after *OrgSnapshot) []string {
+	changes := []string{}
+	beforeUsers := make(map[string]string)
+	for _, u := range before.Users {
+		beforeUsers[u.Login] = u.Role
+	}
+	afterUsers := make(map[string]string)
+	for _, u := range after.Users {
+		afterUsers[u.Login] = u.Role
+		role, ok := beforeUsers[u.Login]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("user %s joined the organization (%s)", u.Login, u.Role))
+		} else if role != u.Role {
+			changes = append(changes, fmt.Sprintf("user %s is now %s of the organization (was %s)", u.Login, u.Role, role))
+		}
+	}
+	for _, u := range before.Users {
+		if _, ok := afterUsers[u.Login]; !ok {
+			changes = append(changes, fmt.Sprintf("user %s left the organization", u.Login))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+func snapshotTeamRoles(team OrgSnapshotTeam) map[string]string {
+	roles := make(map[string]string)
+	for _, m := range team.Members {
+		roles[m] = "member"
+	}
+	for _, m := range team.Maintainers {
+		roles[m] = "maintainer"
+	}
+	return roles
+}
+
+func diffSnapshotTeams(before *OrgSnapshot, after *OrgSnapshot) []string {
+	changes := []string{}
+	beforeTeams := make(map[string]OrgSnapshotTeam)
+	for _, t := range before.Teams {
+		beforeTeams[t.Slug] = t
+	}
+	afterTeams := make(map[string]OrgSnapshotTeam)
+	for _, t := range after.Teams {
+		afterTeams[t.Slug] = t
+		b, ok := beforeTeams[t.Slug]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("team %s was created", t.Slug))
+			b = OrgSnapshotTeam{Slug: t.Slug}
+		} else if b.Parent != t.Parent {
+			changes = append(changes, fmt.Sprintf("team %s parent changed from '%s' to '%s'", t.Slug, b.Parent, t.Parent))
+		}
+
+		beforeRoles := snapshotTeamRoles(b)
+		afterRoles := snapshotTeamRoles(t)
+		for login, role := range afterRoles {
+			if previous, ok := beforeRoles[login]; !ok {
+				changes = append(changes, fmt.Sprintf("user %s joined team %s (%s)", login, t.Slug, role))
+			} else if previous != role {
+				changes = append(changes, fmt.Sprintf("user %s is now %s of team %s (was %s)", login, role, t.Slug, previous))
+			}
+		}
+		for login := range beforeRoles {
+			if _, ok := afterRoles[login]; !ok {
+				changes = append(changes, fmt.Sprintf("user %s left team %s", login, t.Slug))
+			}
+		}
+
+		beforeRepos := make(map[string]string)
+		for _, r := range b.Repositories {
+			beforeRepos[r.Repository] = r.Permission
+		}
+		afterRepos := make(map[string]string)
+		for _, r := range t.Repositories {
+			afterRepos[r.Repository] = r.Permission
+			if previous, ok := beforeRepos[r.Repository]; !ok {
+				changes = append(changes, fmt.Sprintf("team %s gained %s on repository %s", t.Slug, r.Permission, r.Repository))
+			} else if previous != r.Permission {
+				changes = append(changes, fmt.Sprintf("team %s has now %s on repository %s (was %s)", t.Slug, r.Permission, r.Repository, previous))
+			}
+		}
+		for _, r := range b.Repositories {
+			if _, ok := afterRepos[r.Repository]; !ok {
+				changes = append(changes, fmt.Sprintf("team %s lost %s on repository %s", t.Slug, r.Permission, r.Repository))
+			}
+		}
+	}
+	for _, t := range before.Teams {
+		if _, ok := afterTeams[t.Slug]; !ok {
+			changes = append(changes, fmt.Sprintf("team %s was deleted", t.Slug))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+func diffSnapshotRepositories(before *OrgSnapshot, after *OrgSnapshot) []string {
+	changes := []string{}
+	beforeRepos := make(map[string]OrgSnapshotRepository)
+	for _, r := range before.Repositories {
+		beforeRepos[r.Name] = r
+	}
+	afterRepos := make(map[string]OrgSnapshotRepository)
+	for _, r := range after.Repositories {
+		afterRepos[r.Name] = r
+		b, ok := beforeRepos[r.Name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("repository %s was created", r.Name))
+			continue
+		}
+		for property, value := range r.Properties {
+			if previous, ok := b.Properties[property]; !ok || previous != value {
+				changes = append(changes, fmt.Sprintf("repository %s: %s is now %v", r.Name, property, value))
+			}
+		}
+		for property := range b.Properties {
+			if _, ok := r.Properties[property]; !ok {
+				changes = append(changes, fmt.Sprintf("repository %s: %s is not set anymore", r.Name, property))
+			}
+		}
+		if added, removed := diffStrings(b.Topics, r.Topics); len(added)+len(removed) != 0 {
+			changes = append(changes, fmt.Sprintf("repository %s: topics are now [%s] (were [%s])", r.Name, strings.Join(r.Topics, ","), strings.Join(b.Topics, ",")))
+		}
+		for name, value := range r.CustomProperties {
+			if previous := b.CustomProperties[name]; !reflect.DeepEqual(previous, value) {
+				changes = append(changes, fmt.Sprintf("repository %s: custom property %s is now [%s] (was [%s])", r.Name, name, strings.Join(value, ","), strings.Join(previous, ",")))
+			}
+		}
+		for name, previous := range b.CustomProperties {
+			if _, ok := r.CustomProperties[name]; !ok {
+				changes = append(changes, fmt.Sprintf("repository %s: custom property %s is not set anymore (was [%s])", r.Name, name, strings.Join(previous, ",")))
+			}
+		}
+		// (snapshots exported by older versions have no settings)
+		if len(b.Settings) != 0 {
+			for setting, value := range r.Settings {
+				if previous := b.Settings[setting]; previous != value {
+					changes = append(changes, fmt.Sprintf("repository %s: %s is now '%s' (was '%s')", r.Name, setting, value, previous))
+				}
+			}
+		}
+	}
+	for _, r := range before.Repositories {
+		if _, ok := afterRepos[r.Name]; !ok {
+			changes = append(changes, fmt.Sprintf("repository %s was deleted", r.Name))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+func diffSnapshotRulesets(reponame string, before []OrgSnapshotRuleset, after []OrgSnapshotRuleset) []string {
+	prefix := "ruleset"
+	if reponame != "" {
+		prefix = fmt.Sprintf("repository %s ruleset", reponame)
+	}
+
+	changes := []string{}
+	beforeRulesets := make(map[string]OrgSnapshotRuleset)
+	for _, rs := range before {
+		beforeRulesets[rs.Name] = rs
+	}
+	afterRulesets := make(map[string]OrgSnapshotRuleset)
+	for _, rs := range after {
+		afterRulesets[rs.Name] = rs
+		b, ok := beforeRulesets[rs.Name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("%s %s was created (%s)", prefix, rs.Name, rs.Enforcement))
+			continue
+		}
+		updated := []string{}
+		if b.Enforcement != rs.Enforcement {
+			updated = append(updated, fmt.Sprintf("enforcement %s -> %s", b.Enforcement, rs.Enforcement))
+		}
+		if len(b.BypassApps)+len(rs.BypassApps) > 0 && !reflect.DeepEqual(b.BypassApps, rs.BypassApps) {
+			updated = append(updated, "bypass apps")
+		}
+		if !reflect.DeepEqual(b.Include, rs.Include) || !reflect.DeepEqual(b.Exclude, rs.Exclude) {
+			updated = append(updated, "branches")
+		}
+		if !reflect.DeepEqual(b.Rules, rs.Rules) {
+			updated = append(updated, "rules")
+		}
+		added, removed := diffStrings(b.Repositories, rs.Repositories)
+		if len(added) > 0 {
+			updated = append(updated, "now applies to "+strings.Join(added, ", "))
+		}
+		if len(removed) > 0 {
+			updated = append(updated, "doesn't apply anymore to "+strings.Join(removed, ", "))
+		}
+		if len(updated) > 0 {
+			changes = append(changes, fmt.Sprintf("%s %s was changed: %s", prefix, rs.Name, strings.Join(updated, "; ")))
+		}
+	}
+	for _, rs := range before {
+		if _, ok := afterRulesets[rs.Name]; !ok {
+			changes = append(changes, fmt.Sprintf("%s %s was deleted", prefix, rs.Name))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+func diffSnapshotCustomProperties(before *OrgSnapshot, after *OrgSnapshot) []string {
+	changes := []string{}
+	beforeProperties := make(map[string]OrgSnapshotCustomProperty)
+	for _, cp := range before.CustomProperties {
+		beforeProperties[cp.Name] = cp
+	}
+	afterProperties := make(map[string]bool)
+	for _, cp := range after.CustomProperties {
+		afterProperties[cp.Name] = true
+		b, ok := beforeProperties[cp.Name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("custom property %s was created (%s)", cp.Name, cp.ValueType))
+			continue
+		}
+		if !reflect.DeepEqual(b, cp) {
+			changes = append(changes, fmt.Sprintf("custom property %s was changed", cp.Name))
+		}
+	}
+	for _, cp := range before.CustomProperties {
+		if !afterProperties[cp.Name] {
+			changes = append(changes, fmt.Sprintf("custom property %s was deleted", cp.Name))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// diffStrings returns the strings that are only in after (added), and only in before (removed)
+func diffStrings(before []string, after []string) ([]string, []string) {
+	inBefore := make(map[string]bool)
+	for _, s := range before {
+		inBefore[s] = true
+	}
+	inAfter := make(map[string]bool)
+	added := []string{}
+	for _, s := range after {
+		inAfter[s] = true
+		if !inBefore[s] {
+			added = append(added, s)
+		}
+	}
+	removed := []string{}
+	for _, s := range before {
+		if !inAfter[s] {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+type snapshotAccessKey struct {
+	login      string
+	repository string
+	via        string // how the user gets the access
+}
+
+/*
+ * snapshotAccess returns all the ways each user can access a repository:
+ * via a team (or one of its parent teams, whose access is inherited),
+ * or as a collaborator
+ */
+func snapshotAccess(snapshot *OrgSnapshot) map[snapshotAccessKey]string {
+	access := make(map[snapshotAccessKey]string)
+
+	teams := make(map[string]OrgSnapshotTeam)
+	for _, t := range snapshot.Teams {
+		teams[t.Slug] = t
+	}
+	for _, t := range snapshot.Teams {
+		members := append(append([]string{}, t.Members...), t.Maintainers...)
+
+		// the team itself, then its ancestors (a loop can't exist on Github, but better be safe)
+		visited := map[string]bool{}
+		for current, ok := t, true; ok && !visited[current.Slug]; current, ok = teams[current.Parent] {
+			visited[current.Slug] = true
+			via := "via team " + t.Slug
+			if current.Slug != t.Slug {
+				via = fmt.Sprintf("via team %s (inherited from team %s)", t.Slug, current.Slug)
+			}
+			for _, r := range current.Repositories {
+				for _, login := range members {
+					access[snapshotAccessKey{login: login, repository: r.Repository, via: via}] = r.Permission
+				}
+			}
+		}
+	}
+
+	for _, r := range snapshot.Repositories {
+		for _, c := range r.Collaborators {
+			via := "as collaborator"
+			if c.Outside {
+				via = "as outside collaborator"
+			}
+			access[snapshotAccessKey{login: c.Login, repository: r.Name, via: via}] = c.Permission
+		}
+	}
+	return access
+}
+
+func diffSnapshotAccess(before *OrgSnapshot, after *OrgSnapshot) []string {
+	changes := []string{}
+	beforeAccess := snapshotAccess(before)
+	afterAccess := snapshotAccess(after)
+	for key, permission := range afterAccess {
+		if previous, ok := beforeAccess[key]; !ok {
+			changes = append(changes, fmt.Sprintf("user %s gained %s on repository %s %s", key.login, permission, key.repository, key.via))
+		} else if previous != permission {
+			changes = append(changes, fmt.Sprintf("user %s has now %s (was %s) on repository %s %s", key.login, permission, previous, key.repository, key.via))
+		}
+	}
+	for key, permission := range beforeAccess {
+		if _, ok := afterAccess[key]; !ok {
+			changes = append(changes, fmt.Sprintf("user %s lost %s on repository %s %s", key.login, permission, key.repository, key.via))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+/*
+ * ToText renders the changes as a list, one change per line
+ */
+func (c *OrgSnapshotChanges) ToText() string {
+	var sb strings.Builder
+	groups := []struct {
+		title   string
+		changes []string
+	}{
+		{"Users", c.Users},
+		{"Teams", c.Teams},
+		{"Repositories", c.Repositories},
+		{"Rulesets", c.Rulesets},
+		{"Custom properties", c.CustomProperties},
+		{"Access", c.Access},
+	}
+	for _, group := range groups {
+		if len(group.changes) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%s:\n", group.title))
+		for _, change := range group.changes {
+			sb.WriteString(fmt.Sprintf("- %s\n", change))
+		}
+	}
+	if c.Count() == 0 {
+		sb.WriteString("no change\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Alayacare/goliac/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func fixtureSnapshotRemote() *GoliacRemoteMock {
+	parentId := 1
+	return &GoliacRemoteMock{
+		users: map[string]string{"user2": "MEMBER", "user1": "ADMIN", "user3": "MEMBER"},
+		teams: map[string]*GithubTeam{
+			"parent": {Name: "parent", Slug: "parent", Id: 1, Members: []string{"user1"}},
+			"team1":  {Name: "team1", Slug: "team1", Id: 2, ParentTeam: &parentId, Members: []string{"user3", "user2"}},
+		},
+		repos: map[string]*GithubRepository{
+			"repo1": {
+				Name:             "repo1",
+				Id:               10,
+				BoolProperties:   map[string]bool{"private": true, "archived": false},
+				CustomProperties: map[string][]string{"tier": {"gold"}},
+				ExternalUsers:    map[string]string{"outside1": "READ"},
+				InternalUsers:    map[string]string{},
+				RuleSets:         map[string]*GithubRuleSet{},
+			},
+			"repo2": {
+				Name:           "repo2",
+				Id:             11,
+				BoolProperties: map[string]bool{"private": true},
+				ExternalUsers:  map[string]string{},
+				InternalUsers:  map[string]string{},
+				RuleSets:       map[string]*GithubRuleSet{},
+			},
+		},
+		teamsrepos: map[string]map[string]*GithubTeamRepo{
+			"parent": {"repo2": {Name: "repo2", Permission: "READ"}},
+			"team1":  {"repo1": {Name: "repo1", Permission: "WRITE"}},
+		},
+		rulesets: map[string]*GithubRuleSet{
+			"default": {
+				Name:         "default",
+				Id:           100,
+				Enforcement:  "active",
+				BypassApps:   map[string]string{"goliac-app": "always"},
+				OnInclude:    []string{"~DEFAULT_BRANCH"},
+				OnExclude:    []string{},
+				Rules:        map[string]entity.RuleSetParameters{"pull_request": {RequiredApprovingReviewCount: 1}},
+				Repositories: []string{"repo2", "repo1"},
+			},
+		},
+		appids: map[string]int{"goliac-app": 42},
+		properties: map[string]*GithubCustomProperty{
+			"tier": {Name: "tier", ValueType: "single_select", Required: true, DefaultValue: []string{"bronze"}, AllowedValues: []string{"gold", "silver", "bronze"}},
+		},
+	}
+}
+
+func TestOrgSnapshot(t *testing.T) {
+
+	t.Run("happy path: export is sorted and complete", func(t *testing.T) {
+		snapshot := NewOrgSnapshot(context.TODO(), fixtureSnapshotRemote(), "myorg")
+
+		assert.Equal(t, ORG_SNAPSHOT_VERSION, snapshot.Version)
+		assert.Equal(t, "myorg", snapshot.Organization)
+		assert.Equal(t, []OrgSnapshotUser{{"user1", "ADMIN"}, {"user2", "MEMBER"}, {"user3", "MEMBER"}}, snapshot.Users)
+		assert.Equal(t, 2, len(snapshot.Teams))
+		assert.Equal(t, "team1", snapshot.Teams[1].Slug)
+		assert.Equal(t, "parent", snapshot.Teams[1].Parent)
+		assert.Equal(t, []string{"user2", "user3"}, snapshot.Teams[1].Members)
+		assert.Equal(t, []OrgSnapshotPermission{{"repo1", "WRITE"}}, snapshot.Teams[1].Repositories)
+		assert.Equal(t, "repo1", snapshot.Repositories[0].Name)
+		assert.Equal(t, []OrgSnapshotCollaborator{{"outside1", "READ", true}}, snapshot.Repositories[0].Collaborators)
+		assert.Equal(t, []string{"repo1", "repo2"}, snapshot.Rulesets[0].Repositories)
+		assert.Equal(t, 1, snapshot.Rulesets[0].Rules["pull_request"].RequiredApprovingReviewCount)
+	})
+
+	t.Run("happy path: export and read back in JSON and YAML", func(t *testing.T) {
+		snapshot := NewOrgSnapshot(context.TODO(), fixtureSnapshotRemote(), "myorg")
+		dir := t.TempDir()
+
+		content, err := snapshot.ToJSON()
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "snapshot.json"), content, 0644))
+		fromJSON, err := ReadOrgSnapshot(filepath.Join(dir, "snapshot.json"))
+		assert.Nil(t, err)
+		assert.Equal(t, snapshot, fromJSON)
+
+		content, err = snapshot.ToYAML()
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "snapshot.yaml"), content, 0644))
+		fromYAML, err := ReadOrgSnapshot(filepath.Join(dir, "snapshot.yaml"))
+		assert.Nil(t, err)
+		assert.Equal(t, snapshot, fromYAML)
+
+		// the same state gives the same document
+		again, _ := NewOrgSnapshot(context.TODO(), fixtureSnapshotRemote(), "myorg").ToYAML()
+		assert.Equal(t, len(content), len(again))
+	})
+
+	t.Run("not happy path: unsupported snapshot version", func(t *testing.T) {
+		dir := t.TempDir()
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "snapshot.json"), []byte(`{"version": 99}`), 0644))
+		_, err := ReadOrgSnapshot(filepath.Join(dir, "snapshot.json"))
+		assert.NotNil(t, err)
+	})
+}
+
+func TestDiffOrgSnapshots(t *testing.T) {
+
+	t.Run("happy path: no change", func(t *testing.T) {
+		// an exported (and read back) snapshot
+		content, _ := NewOrgSnapshot(context.TODO(), fixtureSnapshotRemote(), "myorg").ToJSON()
+		path := filepath.Join(t.TempDir(), "snapshot.json")
+		assert.Nil(t, os.WriteFile(path, content, 0644))
+		before, err := ReadOrgSnapshot(path)
+		assert.Nil(t, err)
+
+		after := NewOrgSnapshot(context.TODO(), fixtureSnapshotRemote(), "myorg")
+		changes := DiffOrgSnapshots(before, after)
+		assert.Equal(t, 0, changes.Count())
+		assert.Equal(t, "no change\n", changes.ToText())
+	})
+
+	t.Run("happy path: access changes are explained", func(t *testing.T) {
+		before := NewOrgSnapshot(context.TODO(), fixtureSnapshotRemote(), "myorg")
+
+		remote := fixtureSnapshotRemote()
+		remote.users["user4"] = "MEMBER"
+		delete(remote.users, "user3")
+		remote.teams["team1"].Members = []string{"user2", "user4"}
+		remote.teamsrepos["team1"]["repo1"].Permission = "ADMIN"
+		remote.teamsrepos["parent"]["repo3"] = &GithubTeamRepo{Name: "repo3", Permission: "READ"}
+		remote.repos["repo1"].BoolProperties["private"] = false
+		remote.repos["repo3"] = &GithubRepository{Name: "repo3", BoolProperties: map[string]bool{}}
+		remote.rulesets["default"].Enforcement = "evaluate"
+		remote.rulesets["default"].Repositories = []string{"repo1", "repo3"}
+		remote.repos["repo1"].CustomProperties["tier"] = []string{"silver"}
+		remote.properties["owner"] = &GithubCustomProperty{Name: "owner", ValueType: "string"}
+		after := NewOrgSnapshot(context.TODO(), remote, "myorg")
+
+		changes := DiffOrgSnapshots(before, after)
+		assert.Equal(t, []string{
+			"user user3 left the organization",
+			"user user4 joined the organization (MEMBER)",
+		}, changes.Users)
+		assert.Equal(t, []string{
+			"team parent gained READ on repository repo3",
+			"team team1 has now ADMIN on repository repo1 (was WRITE)",
+			"user user3 left team team1",
+			"user user4 joined team team1 (member)",
+		}, changes.Teams)
+		assert.Equal(t, []string{
+			"repository repo1: custom property tier is now [silver] (was [gold])",
+			"repository repo1: private is now false",
+			"repository repo3 was created",
+		}, changes.Repositories)
+		assert.Equal(t, []string{
+			"ruleset default was changed: enforcement active -> evaluate; now applies to repo3; doesn't apply anymore to repo2",
+		}, changes.Rulesets)
+		assert.Equal(t, []string{"custom property owner was created (string)"}, changes.CustomProperties)
+		assert.Contains(t, changes.Access, "user user2 has now ADMIN (was WRITE) on repository repo1 via team team1")
+		assert.Contains(t, changes.Access, "user user4 gained ADMIN on repository repo1 via team team1")
+		assert.Contains(t, changes.Access, "user user4 gained READ on repository repo2 via team team1 (inherited from team parent)")
+		assert.Contains(t, changes.Access, "user user1 gained READ on repository repo3 via team parent")
+		assert.Contains(t, changes.Access, "user user3 lost WRITE on repository repo1 via team team1")
+		assert.NotContains(t, changes.Access, "user user1 gained READ on repository repo2 via team parent")
+	})
+}
@@ -0,0 +1,544 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	PlanGroupUsers            = "users"
+	PlanGroupTeams            = "teams"
+	PlanGroupRepositories     = "repositories"
+	PlanGroupRulesets         = "rulesets"
+	PlanGroupCustomProperties = "custom_properties"
+)
+
+/*
+ * PlanRecord is a single planned Github operation
+ * Operation uses the same naming as the reconciliator logs (add_user_to_org, create_team, ...)
+ * Destructive operations delete something, or revoke an access (team member, team or collaborator access)
+ */
+type PlanRecord struct {
+	Operation   string      `json:"operation"`
+	Resource    string      `json:"resource"`
+	Destructive bool        `json:"destructive"`
+	Before      interface{} `json:"before"`
+	After       interface{} `json:"after"`
+}
+
+type PlanGroupSummary struct {
+	Changes     int `json:"changes"`
+	Destructive int `json:"destructive"`
+}
+
+type PlanSummary struct {
+	Changes     int                         `json:"changes"`
+	Destructive int                         `json:"destructive"`
+	ByGroup     map[string]PlanGroupSummary `json:"by_group"`
+}
+
+/*
+ * Plan is the list of Github operations that a reconciliation would do,
+ * grouped by users/teams/repositories/rulesets/custom_properties
+ */
+type Plan struct {
+	Users            []PlanRecord `json:"users"`
+	Teams            []PlanRecord `json:"teams"`
+	Repositories     []PlanRecord `json:"repositories"`
+	Rulesets         []PlanRecord `json:"rulesets"`
+	CustomProperties []PlanRecord `json:"custom_properties"`
+}
+
+func NewPlan() *Plan {
+	return &Plan{
+		Users:            []PlanRecord{},
+		Teams:            []PlanRecord{},
+		Repositories:     []PlanRecord{},
+		Rulesets:         []PlanRecord{},
+		CustomProperties: []PlanRecord{},
+	}
+}
+
+func (p *Plan) add(group string, record PlanRecord) {
+	switch group {
+	case PlanGroupUsers:
+		p.Users = append(p.Users, record)
+	case PlanGroupTeams:
+		p.Teams = append(p.Teams, record)
+	case PlanGroupRepositories:
+		p.Repositories = append(p.Repositories, record)
+	case PlanGroupRulesets:
+		p.Rulesets = append(p.Rulesets, record)
+	case PlanGroupCustomProperties:
+		p.CustomProperties = append(p.CustomProperties, record)
+	}
+}
+
+type planGroup struct {
+	name    string
+	records []PlanRecord
+}
+
+func (p *Plan) groups() []planGroup {
+	return []planGroup{
+		{PlanGroupUsers, p.Users},
+		{PlanGroupTeams, p.Teams},
+		{PlanGroupRepositories, p.Repositories},
+		{PlanGroupRulesets, p.Rulesets},
+		{PlanGroupCustomProperties, p.CustomProperties},
+	}
+}
+
+func (p *Plan) Summary() PlanSummary {
+	summary := PlanSummary{
+		ByGroup: map[string]PlanGroupSummary{},
+	}
+	for _, g := range p.groups() {
+		gs := PlanGroupSummary{}
+		for _, r := range g.records {
+			gs.Changes++
+			if r.Destructive {
+				gs.Destructive++
+			}
+		}
+		summary.ByGroup[g.name] = gs
+		summary.Changes += gs.Changes
+		summary.Destructive += gs.Destructive
+	}
+	return summary
+}
+
+func (p *Plan) ToJSON() ([]byte, error) {
+	return json.MarshalIndent(struct {
+		Summary PlanSummary `json:"summary"`
+		*Plan
+	}{
+		Summary: p.Summary(),
+		Plan:    p,
+	}, "", "  ")
+}
+
+func (p *Plan) ToMarkdown() string {
+	summary := p.Summary()
+	var sb strings.Builder
+
+	sb.WriteString("## Goliac plan\n\n")
+	if summary.Changes == 0 {
+		sb.WriteString("No changes. Github is in sync with the teams repository.\n")
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf("**%d** change(s), including **%d** destructive operation(s)\n\n", summary.Changes, summary.Destructive))
+
+	for _, g := range p.groups() {
+		if len(g.records) == 0 {
+			continue
+		}
+		gs := summary.ByGroup[g.name]
+		sb.WriteString(fmt.Sprintf("### %s (%d change(s), %d destructive)\n\n", g.name, gs.Changes, gs.Destructive))
+		sb.WriteString("| Operation | Resource | Before | After |\n")
+		sb.WriteString("|-----------|----------|--------|-------|\n")
+		for _, r := range g.records {
+			operation := r.Operation
+			if r.Destructive {
+				operation = ":warning: " + operation
+			}
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n", operation, markdownEscape(r.Resource), markdownValue(r.Before), markdownValue(r.After)))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func markdownValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return markdownEscape(fmt.Sprintf("%v", v))
+	}
+	return "`" + markdownEscape(string(b)) + "`"
+}
+
+func markdownEscape(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
+
+/*
+ * PlanRecorder is a ReconciliatorExecutor that records each operation into a Plan.
+ * The "before" values are fetched from the (non mutated) remote.
+ */
+type PlanRecorder struct {
+	remote GoliacRemote
+	plan   *Plan
+}
+
+func NewPlanRecorder(remote GoliacRemote, plan *Plan) ReconciliatorExecutor {
+	return &PlanRecorder{
+		remote: remote,
+		plan:   plan,
+	}
+}
+
+func (p *PlanRecorder) AddUserToOrg(ctx context.Context, dryrun bool, ghuserid string) error {
+	p.plan.add(PlanGroupUsers, PlanRecord{Operation: "add_user_to_org", Resource: ghuserid, After: ghuserid})
+	return nil
+}
+
+func (p *PlanRecorder) RemoveUserFromOrg(ctx context.Context, dryrun bool, ghuserid string) error {
+	p.plan.add(PlanGroupUsers, PlanRecord{Operation: "remove_user_from_org", Resource: ghuserid, Destructive: true, Before: ghuserid})
+	return nil
+}
+
+func (p *PlanRecorder) teamMembers(ctx context.Context, teamslug string) interface{} {
+	team, ok := p.remote.Teams(ctx, true)[teamslug]
+	if !ok {
+		return nil
+	}
+	members := append([]string{}, team.Members...)
+	sort.Strings(members)
+	maintainers := append([]string{}, team.Maintainers...)
+	sort.Strings(maintainers)
+	return map[string]interface{}{"members": members, "maintainers": maintainers}
+}
+
+func (p *PlanRecorder) CreateTeam(ctx context.Context, dryrun bool, teamname string, description string, parentTeam *int, members []string) error {
+	p.plan.add(PlanGroupTeams, PlanRecord{
+		Operation: "create_team",
+		Resource:  teamname,
+		After:     map[string]interface{}{"description": description, "parent_team": parentTeam, "members": members},
+	})
+	return nil
+}
+
+func (p *PlanRecorder) UpdateTeamAddMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error {
+	p.plan.add(PlanGroupTeams, PlanRecord{
+		Operation: "update_team_add_member",
+		Resource:  teamslug,
+		Before:    p.teamMembers(ctx, teamslug),
+		After:     map[string]interface{}{"member": username, "role": role},
+	})
+	return nil
+}
+
+func (p *PlanRecorder) UpdateTeamUpdateMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error {
+	p.plan.add(PlanGroupTeams, PlanRecord{
+		Operation: "update_team_update_member",
+		Resource:  teamslug,
+		Before:    p.teamMembers(ctx, teamslug),
+		After:     map[string]interface{}{"member": username, "role": role},
+	})
+	return nil
+}
+
+func (p *PlanRecorder) UpdateTeamRemoveMember(ctx context.Context, dryrun bool, teamslug string, username string) error {
+	p.plan.add(PlanGroupTeams, PlanRecord{
+		Operation:   "update_team_remove_member",
+		Destructive: true,
+		Resource:    teamslug,
+		Before:      p.teamMembers(ctx, teamslug),
+		After:       map[string]interface{}{"removed_member": username},
+	})
+	return nil
+}
+
+func (p *PlanRecorder) UpdateTeamSetParent(ctx context.Context, dryrun bool, teamslug string, parentTeam *int) error {
+	var before interface{}
+	if team, ok := p.remote.Teams(ctx, true)[teamslug]; ok {
+		before = map[string]interface{}{"parent_team": team.ParentTeam}
+	}
+	p.plan.add(PlanGroupTeams, PlanRecord{
+		Operation: "update_team_parentteam",
+		Resource:  teamslug,
+		Before:    before,
+		After:     map[string]interface{}{"parent_team": parentTeam},
+	})
+	return nil
+}
+
+func (p *PlanRecorder) DeleteTeam(ctx context.Context, dryrun bool, teamslug string) error {
+	p.plan.add(PlanGroupTeams, PlanRecord{
+		Operation:   "delete_team",
+		Resource:    teamslug,
+		Destructive: true,
+		Before:      p.teamMembers(ctx, teamslug),
+	})
+	return nil
+}
+
+func (p *PlanRecorder) CreateRepository(ctx context.Context, dryrun bool, reponame string, descrition string, writers []string, readers []string, boolProperties map[string]bool) error {
+	p.plan.add(PlanGroupRepositories, PlanRecord{
+		Operation: "create_repository",
+		Resource:  reponame,
+		After:     map[string]interface{}{"writers": writers, "readers": readers, "bool_properties": boolProperties},
+	})
+	return nil
+}
+
+func (p *PlanRecorder) UpdateRepositoryUpdateBoolProperty(ctx context.Context, dryrun bool, reponame string, propertyName string, propertyValue bool) error {
+	var before interface{}
+	if repo, ok := p.remote.Repositories(ctx)[reponame]; ok {
+		if value, ok := repo.BoolProperties[propertyName]; ok {
+			before = map[string]interface{}{propertyName: value}
+		}
+	}
+	p.plan.add(PlanGroupRepositories, PlanRecord{
+		Operation: "update_repository_update_bool_property",
+		Resource:  reponame,
+		Before:    before,
+		After:     map[string]interface{}{propertyName: propertyValue},
+	})
+	return nil
+}
+
+func (p *PlanRecorder) UpdateRepositoryUpdateStringProperties(ctx context.Context, dryrun bool, reponame string, properties map[string]string) error {
+	var before interface{}
+	if repo, ok := p.remote.Repositories(ctx)[reponame]; ok {
+		values := map[string]interface{}{}
+		for k := range properties {
+			if value, ok := repo.StringProperties[k]; ok {
+				values[k] = value
+			}
+		}
+		if len(values) > 0 {
+			before = values
+		}
+	}
+	after := map[string]interface{}{}
+	for k, v := range properties {
+		after[k] = v
+	}
+	p.plan.add(PlanGroupRepositories, PlanRecord{
+		Operation: "update_repository_update_string_properties",
+		Resource:  reponame,
+		Before:    before,
+		After:     after,
+	})
+	return nil
+}
+
+func (p *PlanRecorder) UpdateRepositorySetTopics(ctx context.Context, dryrun bool, reponame string, topics []string) error {
+	var before interface{}
+	if repo, ok := p.remote.Repositories(ctx)[reponame]; ok {
+		before = map[string]interface{}{"topics": repo.Topics}
+	}
+	p.plan.add(PlanGroupRepositories, PlanRecord{
+		Operation: "update_repository_set_topics",
+		Resource:  reponame,
+		Before:    before,
+		After:     map[string]interface{}{"topics": topics},
+	})
+	return nil
+}
+
+func (p *PlanRecorder) UpdateRepositorySetCustomProperties(ctx context.Context, dryrun bool, reponame string, properties map[string][]string, valueTypes map[string]string) error {
+	var before interface{}
+	if repo, ok := p.remote.Repositories(ctx)[reponame]; ok {
+		values := make(map[string][]string)
+		for k := range properties {
+			values[k] = repo.CustomProperties[k]
+		}
+		before = values
+	}
+	p.plan.add(PlanGroupRepositories, PlanRecord{
+		Operation: "update_repository_set_custom_properties",
+		Resource:  reponame,
+		Before:    before,
+		After:     properties,
+	})
+	return nil
+}
+
+func (p *PlanRecorder) teamAccess(ctx context.Context, reponame string, teamslug string) interface{} {
+	if repos, ok := p.remote.TeamRepositories(ctx)[teamslug]; ok {
+		if repo, ok := repos[reponame]; ok {
+			return map[string]interface{}{"team": teamslug, "permission": repo.Permission}
+		}
+	}
+	return nil
+}
+
+func (p *PlanRecorder) UpdateRepositoryAddTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
+	p.plan.add(PlanGroupRepositories, PlanRecord{
+		Operation: "update_repository_add_team",
+		Resource:  reponame,
+		After:     map[string]interface{}{"team": teamslug, "permission": permission},
+	})
+	return nil
+}
+
+func (p *PlanRecorder) UpdateRepositoryUpdateTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
+	p.plan.add(PlanGroupRepositories, PlanRecord{
+		Operation: "update_repository_update_team",
+		Resource:  reponame,
+		Before:    p.teamAccess(ctx, reponame, teamslug),
+		After:     map[string]interface{}{"team": teamslug, "permission": permission},
+	})
+	return nil
+}
+
+func (p *PlanRecorder) UpdateRepositoryRemoveTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string) error {
+	p.plan.add(PlanGroupRepositories, PlanRecord{
+		Operation:   "update_repository_remove_team",
+		Destructive: true,
+		Resource:    reponame,
+		Before:      p.teamAccess(ctx, reponame, teamslug),
+	})
+	return nil
+}
+
+func (p *PlanRecorder) rulesetById(ctx context.Context, rulesetid int) *GithubRuleSet {
+	for _, rs := range p.remote.RuleSets(ctx) {
+		if rs.Id == rulesetid {
+			return rs
+		}
+	}
+	return nil
+}
+
+func (p *PlanRecorder) AddRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) error {
+	p.plan.add(PlanGroupRulesets, PlanRecord{Operation: "add_ruleset", Resource: ruleset.Name, After: ruleset})
+	return nil
+}
+
+func (p *PlanRecorder) UpdateRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) error {
+	var before interface{}
+	if rs := p.rulesetById(ctx, ruleset.Id); rs != nil {
+		before = rs
+	}
+	p.plan.add(PlanGroupRulesets, PlanRecord{Operation: "update_ruleset", Resource: ruleset.Name, Before: before, After: ruleset})
+	return nil
+}
+
+func (p *PlanRecorder) DeleteRuleset(ctx context.Context, dryrun bool, rulesetid int) error {
+	record := PlanRecord{Operation: "delete_ruleset", Resource: fmt.Sprintf("%d", rulesetid), Destructive: true}
+	if rs := p.rulesetById(ctx, rulesetid); rs != nil {
+		record.Resource = rs.Name
+		record.Before = rs
+	}
+	p.plan.add(PlanGroupRulesets, record)
+	return nil
+}
+
+func (p *PlanRecorder) repositoryRuleset(ctx context.Context, reponame string, rulesetid int) *GithubRuleSet {
+	if repo, ok := p.remote.Repositories(ctx)[reponame]; ok {
+		for _, rs := range repo.RuleSets {
+			if rs.Id == rulesetid {
+				return rs
+			}
+		}
+	}
+	return nil
+}
+
+func (p *PlanRecorder) AddRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) error {
+	p.plan.add(PlanGroupRepositories, PlanRecord{Operation: "add_repository_ruleset", Resource: reponame, After: ruleset})
+	return nil
+}
+
+func (p *PlanRecorder) UpdateRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) error {
+	var before interface{}
+	if rs := p.repositoryRuleset(ctx, reponame, ruleset.Id); rs != nil {
+		before = rs
+	}
+	p.plan.add(PlanGroupRepositories, PlanRecord{Operation: "update_repository_ruleset", Resource: reponame, Before: before, After: ruleset})
+	return nil
+}
+
+func (p *PlanRecorder) DeleteRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, rulesetid int) error {
+	var before interface{}
+	if rs := p.repositoryRuleset(ctx, reponame, rulesetid); rs != nil {
+		before = rs
+	}
+	p.plan.add(PlanGroupRepositories, PlanRecord{Operation: "delete_repository_ruleset", Resource: reponame, Destructive: true, Before: before})
+	return nil
+}
+
+func (p *PlanRecorder) AddCustomProperty(ctx context.Context, dryrun bool, property *GithubCustomProperty) error {
+	p.plan.add(PlanGroupCustomProperties, PlanRecord{Operation: "add_custom_property", Resource: property.Name, After: property})
+	return nil
+}
+
+func (p *PlanRecorder) UpdateCustomProperty(ctx context.Context, dryrun bool, property *GithubCustomProperty) error {
+	var before interface{}
+	if cp, ok := p.remote.CustomProperties(ctx)[property.Name]; ok {
+		before = cp
+	}
+	p.plan.add(PlanGroupCustomProperties, PlanRecord{Operation: "update_custom_property", Resource: property.Name, Before: before, After: property})
+	return nil
+}
+
+func (p *PlanRecorder) DeleteCustomProperty(ctx context.Context, dryrun bool, propertyname string) error {
+	var before interface{}
+	if cp, ok := p.remote.CustomProperties(ctx)[propertyname]; ok {
+		before = cp
+	}
+	p.plan.add(PlanGroupCustomProperties, PlanRecord{Operation: "delete_custom_property", Resource: propertyname, Destructive: true, Before: before})
+	return nil
+}
+
+func (p *PlanRecorder) collaboratorPermission(ctx context.Context, reponame string, githubid string, external bool) interface{} {
+	if repo, ok := p.remote.Repositories(ctx)[reponame]; ok {
+		users := repo.InternalUsers
+		if external {
+			users = repo.ExternalUsers
+		}
+		if permission, ok := users[githubid]; ok {
+			return map[string]interface{}{"user": githubid, "permission": permission}
+		}
+	}
+	return nil
+}
+
+func (p *PlanRecorder) UpdateRepositorySetExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string, permission string) error {
+	p.plan.add(PlanGroupRepositories, PlanRecord{
+		Operation: "update_repository_set_external_user",
+		Resource:  reponame,
+		Before:    p.collaboratorPermission(ctx, reponame, githubid, true),
+		After:     map[string]interface{}{"user": githubid, "permission": permission},
+	})
+	return nil
+}
+
+func (p *PlanRecorder) UpdateRepositoryRemoveExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error {
+	p.plan.add(PlanGroupRepositories, PlanRecord{
+		Operation:   "update_repository_remove_external_user",
+		Destructive: true,
+		Resource:    reponame,
+		Before:      p.collaboratorPermission(ctx, reponame, githubid, true),
+	})
+	return nil
+}
+
+func (p *PlanRecorder) UpdateRepositoryRemoveInternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error {
+	p.plan.add(PlanGroupRepositories, PlanRecord{
+		Operation:   "update_repository_remove_internal_user",
+		Destructive: true,
+		Resource:    reponame,
+		Before:      p.collaboratorPermission(ctx, reponame, githubid, false),
+	})
+	return nil
+}
+
+func (p *PlanRecorder) DeleteRepository(ctx context.Context, dryrun bool, reponame string) error {
+	p.plan.add(PlanGroupRepositories, PlanRecord{Operation: "delete_repository", Resource: reponame, Destructive: true, Before: reponame})
+	return nil
+}
+
+func (p *PlanRecorder) RenameRepository(ctx context.Context, dryrun bool, reponame string, newname string) error {
+	p.plan.add(PlanGroupRepositories, PlanRecord{Operation: "rename_repository", Resource: reponame, Before: reponame, After: newname})
+	return nil
+}
+
+func (p *PlanRecorder) Begin(dryrun bool) {
+}
+
+func (p *PlanRecorder) Rollback(dryrun bool, err error) {
+}
+
+func (p *PlanRecorder) Commit(ctx context.Context, dryrun bool) error {
+	return nil
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fixturePlanRemote() *GoliacRemoteMock {
+	return &GoliacRemoteMock{
+		users: map[string]string{"user1": "user1", "user2": "user2"},
+		teams: map[string]*GithubTeam{
+			"team1": {Name: "team1", Slug: "team1", Members: []string{"user2", "user1"}},
+		},
+		repos: map[string]*GithubRepository{
+			"repo1": {
+				Name:           "repo1",
+				BoolProperties: map[string]bool{"private": true},
+				ExternalUsers:  map[string]string{},
+				InternalUsers:  map[string]string{},
+				RuleSets:       map[string]*GithubRuleSet{},
+			},
+		},
+		teamsrepos: map[string]map[string]*GithubTeamRepo{
+			"team1": {"repo1": {Name: "repo1", Permission: "READ"}},
+		},
+		rulesets: map[string]*GithubRuleSet{
+			"default": {Name: "default", Id: 12, Enforcement: "active"},
+		},
+		appids: map[string]int{},
+	}
+}
+
+func TestPlanRecorder(t *testing.T) {
+	t.Run("happy path: records grouped with before/after values", func(t *testing.T) {
+		ctx := context.TODO()
+		plan := NewPlan()
+		recorder := NewPlanRecorder(fixturePlanRemote(), plan)
+
+		recorder.AddUserToOrg(ctx, true, "user3")
+		recorder.RemoveUserFromOrg(ctx, true, "user2")
+		recorder.UpdateTeamAddMember(ctx, true, "team1", "user3", "member")
+		recorder.UpdateRepositoryUpdateBoolProperty(ctx, true, "repo1", "private", false)
+		recorder.UpdateRepositoryUpdateTeamAccess(ctx, true, "repo1", "team1", "push")
+		recorder.DeleteRuleset(ctx, true, 12)
+
+		assert.Equal(t, 2, len(plan.Users))
+		assert.Equal(t, 1, len(plan.Teams))
+		assert.Equal(t, 2, len(plan.Repositories))
+		assert.Equal(t, 1, len(plan.Rulesets))
+
+		assert.Equal(t, map[string]interface{}{"members": []string{"user1", "user2"}, "maintainers": []string{}}, plan.Teams[0].Before)
+		assert.Equal(t, map[string]interface{}{"private": true}, plan.Repositories[0].Before)
+		assert.Equal(t, map[string]interface{}{"private": false}, plan.Repositories[0].After)
+		assert.Equal(t, map[string]interface{}{"team": "team1", "permission": "READ"}, plan.Repositories[1].Before)
+		assert.Equal(t, "default", plan.Rulesets[0].Resource)
+
+		summary := plan.Summary()
+		assert.Equal(t, 6, summary.Changes)
+		assert.Equal(t, 2, summary.Destructive)
+		assert.Equal(t, 1, summary.ByGroup[PlanGroupUsers].Destructive)
+		assert.Equal(t, 0, summary.ByGroup[PlanGroupTeams].Destructive)
+		assert.Equal(t, 1, summary.ByGroup[PlanGroupRulesets].Destructive)
+	})
+
+	t.Run("happy path: revoking an access is destructive", func(t *testing.T) {
+		ctx := context.TODO()
+		for name, revoke := range map[string]func(recorder ReconciliatorExecutor){
+			"team member": func(recorder ReconciliatorExecutor) {
+				recorder.UpdateTeamRemoveMember(ctx, true, "team1", "user1")
+			},
+			"team access": func(recorder ReconciliatorExecutor) {
+				recorder.UpdateRepositoryRemoveTeamAccess(ctx, true, "repo1", "team1")
+			},
+			"external user": func(recorder ReconciliatorExecutor) {
+				recorder.UpdateRepositoryRemoveExternalUser(ctx, true, "repo1", "outside1")
+			},
+			"internal user": func(recorder ReconciliatorExecutor) {
+				recorder.UpdateRepositoryRemoveInternalUser(ctx, true, "repo1", "user1")
+			},
+		} {
+			plan := NewPlan()
+			revoke(NewPlanRecorder(fixturePlanRemote(), plan))
+
+			summary := plan.Summary()
+			assert.Equal(t, 1, summary.Changes, name)
+			assert.Equal(t, 1, summary.Destructive, name)
+		}
+	})
+
+	t.Run("happy path: json output", func(t *testing.T) {
+		plan := NewPlan()
+		recorder := NewPlanRecorder(fixturePlanRemote(), plan)
+		recorder.DeleteRepository(context.TODO(), true, "repo1")
+
+		out, err := plan.ToJSON()
+		assert.Nil(t, err)
+
+		var decoded struct {
+			Summary      PlanSummary  `json:"summary"`
+			Repositories []PlanRecord `json:"repositories"`
+			Users        []PlanRecord `json:"users"`
+		}
+		err = json.Unmarshal(out, &decoded)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, decoded.Summary.Destructive)
+		assert.Equal(t, 1, len(decoded.Repositories))
+		assert.Equal(t, "delete_repository", decoded.Repositories[0].Operation)
+		assert.Equal(t, 0, len(decoded.Users))
+	})
+
+	t.Run("happy path: markdown output", func(t *testing.T) {
+		plan := NewPlan()
+		assert.True(t, strings.Contains(plan.ToMarkdown(), "No changes"))
+
+		recorder := NewPlanRecorder(fixturePlanRemote(), plan)
+		recorder.DeleteTeam(context.TODO(), true, "team1")
+		recorder.CreateRepository(context.TODO(), true, "repo2", "repo2", []string{"team1"}, []string{}, map[string]bool{})
+
+		md := plan.ToMarkdown()
+		assert.True(t, strings.Contains(md, "**2** change(s), including **1** destructive operation(s)"))
+		assert.True(t, strings.Contains(md, "### teams (1 change(s), 1 destructive)"))
+		assert.True(t, strings.Contains(md, "| :warning: delete_team | team1 |"))
+		assert.True(t, strings.Contains(md, "| create_repository | repo2 |"))
+		assert.False(t, strings.Contains(md, "### users"))
+	})
+}
@@ -2,33 +2,44 @@ package engine
 
 import "context"
 
+/*
+ * ReconciliatorExecutor receives the mutations computed by the reconciliator.
+ * Each mutation returns an error if it failed on Github (an executor that only
+ * queues the mutation returns nil, and reports the failures on Commit)
+ */
 type ReconciliatorExecutor interface {
-	AddUserToOrg(ctx context.Context, dryrun bool, ghuserid string)
-	RemoveUserFromOrg(ctx context.Context, dryrun bool, ghuserid string)
+	AddUserToOrg(ctx context.Context, dryrun bool, ghuserid string) error
+	RemoveUserFromOrg(ctx context.Context, dryrun bool, ghuserid string) error
 
-	CreateTeam(ctx context.Context, dryrun bool, teamname string, description string, parentTeam *int, members []string)
-	UpdateTeamAddMember(ctx context.Context, dryrun bool, teamslug string, username string, role string)    // role can be 'member' or 'maintainer'
-	UpdateTeamUpdateMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) // role can be 'member' or 'maintainer'
-	UpdateTeamRemoveMember(ctx context.Context, dryrun bool, teamslug string, username string)
-	UpdateTeamSetParent(ctx context.Context, dryrun bool, teamslug string, parentTeam *int)
-	DeleteTeam(ctx context.Context, dryrun bool, teamslug string)
+	CreateTeam(ctx context.Context, dryrun bool, teamname string, description string, parentTeam *int, members []string) error
+	UpdateTeamAddMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error    // role can be 'member' or 'maintainer'
+	UpdateTeamUpdateMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error // role can be 'member' or 'maintainer'
+	UpdateTeamRemoveMember(ctx context.Context, dryrun bool, teamslug string, username string) error
+	UpdateTeamSetParent(ctx context.Context, dryrun bool, teamslug string, parentTeam *int) error
+	DeleteTeam(ctx context.Context, dryrun bool, teamslug string) error
 
-	CreateRepository(ctx context.Context, dryrun bool, reponame string, descrition string, writers []string, readers []string, boolProperties map[string]bool)
-	UpdateRepositoryUpdateBoolProperty(ctx context.Context, dryrun bool, reponame string, propertyName string, propertyValue bool)
-	UpdateRepositoryAddTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string)    // permission can be "pull", "push", or "admin" which correspond to read, write, and admin access.
-	UpdateRepositoryUpdateTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) // permission can be "pull", "push", or "admin" which correspond to read, write, and admin access.
-	UpdateRepositoryRemoveTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string)
-	AddRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet)
-	UpdateRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet)
-	DeleteRuleset(ctx context.Context, dryrun bool, rulesetid int)
-	AddRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet)
-	UpdateRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet)
-	DeleteRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, rulesetid int)
-	UpdateRepositorySetExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string, permission string) // permission can be "pull" or "push"
-	UpdateRepositoryRemoveExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string)
-	UpdateRepositoryRemoveInternalUser(ctx context.Context, dryrun bool, reponame string, githubid string)
-	DeleteRepository(ctx context.Context, dryrun bool, reponame string)
-	RenameRepository(ctx context.Context, dryrun bool, reponame string, newname string)
+	CreateRepository(ctx context.Context, dryrun bool, reponame string, descrition string, writers []string, readers []string, boolProperties map[string]bool) error
+	UpdateRepositoryUpdateBoolProperty(ctx context.Context, dryrun bool, reponame string, propertyName string, propertyValue bool) error
+	UpdateRepositoryUpdateStringProperties(ctx context.Context, dryrun bool, reponame string, properties map[string]string) error                              // properties are updated together (a merge commit message requires its title)
+	UpdateRepositorySetTopics(ctx context.Context, dryrun bool, reponame string, topics []string) error                                                        // replaces all the topics
+	UpdateRepositorySetCustomProperties(ctx context.Context, dryrun bool, reponame string, properties map[string][]string, valueTypes map[string]string) error // an empty value unsets the property, valueTypes is the value type of each property
+	UpdateRepositoryAddTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error                                 // permission can be "pull", "push", or "admin" which correspond to read, write, and admin access.
+	UpdateRepositoryUpdateTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error                              // permission can be "pull", "push", or "admin" which correspond to read, write, and admin access.
+	UpdateRepositoryRemoveTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string) error
+	AddRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) error
+	UpdateRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) error
+	DeleteRuleset(ctx context.Context, dryrun bool, rulesetid int) error
+	AddRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) error
+	UpdateRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) error
+	DeleteRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, rulesetid int) error
+	AddCustomProperty(ctx context.Context, dryrun bool, property *GithubCustomProperty) error
+	UpdateCustomProperty(ctx context.Context, dryrun bool, property *GithubCustomProperty) error
+	DeleteCustomProperty(ctx context.Context, dryrun bool, propertyname string) error
+	UpdateRepositorySetExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string, permission string) error // permission can be "pull" or "push"
+	UpdateRepositoryRemoveExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error
+	UpdateRepositoryRemoveInternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error
+	DeleteRepository(ctx context.Context, dryrun bool, reponame string) error
+	RenameRepository(ctx context.Context, dryrun bool, reponame string, newname string) error
 
 	Begin(dryrun bool)
 	Rollback(dryrun bool, err error)
@@ -3,7 +3,9 @@ package engine
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -45,6 +47,15 @@ type GoliacRemote interface {
 	TeamRepositories(ctx context.Context) map[string]map[string]*GithubTeamRepo // key is team slug, second key is repo name
 	RuleSets(ctx context.Context) map[string]*GithubRuleSet
 	AppIds(ctx context.Context) map[string]int
+	CustomProperties(ctx context.Context) map[string]*GithubCustomProperty // the key is the property name
+	// why the custom properties (definitions or repositories values) could not be loaded, nil if they were
+	CustomPropertiesError() error
+
+	// Refresh a single entity in the cache (for example after a Github webhook event)
+	RefreshUser(ctx context.Context, login string) error
+	RefreshTeam(ctx context.Context, teamslug string) error
+	RefreshRepository(ctx context.Context, reponame string) error
+	RefreshRulesets(ctx context.Context) error
 
 	IsEnterprise() bool // check if we are on an Enterprise version, or if we are on GHES 3.11+
 
@@ -58,13 +69,17 @@ type GoliacRemoteExecutor interface {
 }
 
 type GithubRepository struct {
-	Name           string
-	Id             int
-	RefId          string
-	BoolProperties map[string]bool           // archived, private, allow_auto_merge, delete_branch_on_merge, allow_update_branch
-	ExternalUsers  map[string]string         // [githubid]permission
-	InternalUsers  map[string]string         // [githubid]permission
-	RuleSets       map[string]*GithubRuleSet // [name]ruleset
+	Name             string
+	Id               int
+	RefId            string
+	BoolProperties   map[string]bool           // archived, private, allow_auto_merge, delete_branch_on_merge, allow_update_branch, allow_merge_commit, allow_rebase_merge, allow_squash_merge, allow_forking, web_commit_signoff_required, has_issues, has_wiki, has_projects, has_discussions
+	StringProperties map[string]string         // description, homepage, default_branch, squash_merge_commit_title, squash_merge_commit_message, merge_commit_title, merge_commit_message
+	Topics           []string                  // sorted
+	ExternalUsers    map[string]string         // [githubid]permission
+	InternalUsers    map[string]string         // [githubid]permission
+	RuleSets         map[string]*GithubRuleSet // [name]ruleset
+	UpdatedAt        string                    // last update on Github (used to refresh only what changed)
+	CustomProperties map[string][]string       // [property name]value(s)
 }
 
 type GithubTeam struct {
@@ -74,6 +89,7 @@ type GithubTeam struct {
 	Members     []string // user login, aka githubid
 	Maintainers []string // user login (that are not in the Members array)
 	ParentTeam  *int
+	UpdatedAt   string // last update on Github (used to refresh only what changed)
 }
 
 type GithubTeamRepo struct {
@@ -91,15 +107,64 @@ type GoliacRemoteImpl struct {
 	teamSlugByName        map[string]string
 	rulesets              map[string]*GithubRuleSet
 	appIds                map[string]int
+	customProperties      map[string]*GithubCustomProperty
+	customPropertiesErr   error // set if the custom properties definitions could not be loaded
+	propertyValuesErr     error // set if the repositories custom properties values could not be loaded
 	ttlExpireUsers        time.Time
 	ttlExpireRepositories time.Time
 	ttlExpireTeams        time.Time
 	ttlExpireTeamsRepos   time.Time
 	ttlExpireRulesets     time.Time
 	ttlExpireAppIds       time.Time
+	ttlExpireProperties   time.Time
 	isEnterprise          bool
 	feedback              observability.RemoteObservability
 	loadTeamsMutex        sync.Mutex
+	actionMutex           sync.Mutex                 // protects the cache updates when commands are applied concurrently
+	teamMembersFreshness  map[string]entityFreshness // key is the team slug
+	teamReposFreshness    map[string]entityFreshness // key is the repository name
+	bulkTeamRepos         bool                       // if the teams repos can be loaded with GraphQL (cf supportsBulkTeamRepos)
+	bulkTeamReposLastCost int                        // GraphQL points spent by the last bulk loading of the teams repos
+}
+
+/*
+ * entityFreshness tracks when (and for which version of the entity) a per-entity
+ * resource (a team's members, a repository's teams) was fetched.
+ * It is refetched only if the entity changed on Github, or if it expired (see GithubCacheEntityTTL).
+ * Note that Github doesn't bump the updatedAt of a team when its members change, nor of a repository
+ * when its teams access change: these changes are only seen through the webhook events (RefreshTeam,
+ * RefreshRepository), or when the freshness expires
+ */
+type entityFreshness struct {
+	UpdatedAt string
+	Expire    time.Time
+}
+
+func newEntityFreshness(updatedAt string) entityFreshness {
+	ttl := config.Config.GithubCacheTTL
+	if config.Config.GithubCacheEntityTTL > ttl {
+		ttl = config.Config.GithubCacheEntityTTL
+	}
+	return entityFreshness{
+		UpdatedAt: updatedAt,
+		Expire:    time.Now().Add(time.Duration(ttl) * time.Second),
+	}
+}
+
+func (f entityFreshness) isStale(updatedAt string) bool {
+	return f.UpdatedAt != updatedAt || time.Now().After(f.Expire)
+}
+
+/*
+ * countEntitiesFetched reports (in the statistics) the number of entities fetched from Github
+ */
+func countEntitiesFetched(ctx context.Context, kind string, nb int) {
+	if stats, ok := ctx.Value(config.ContextKeyStatistics).(*config.GoliacStatistics); ok {
+		if stats.EntitiesFetched == nil {
+			stats.EntitiesFetched = make(map[string]int)
+		}
+		stats.EntitiesFetched[kind] += nb
+	}
 }
 
 type GHESInfo struct {
@@ -247,7 +312,7 @@ func isEnterprise(ctx context.Context, orgname string, client github.GitHubClien
 
 func NewGoliacRemoteImpl(client github.GitHubClient) *GoliacRemoteImpl {
 	ctx := context.Background()
-	return &GoliacRemoteImpl{
+	remote := &GoliacRemoteImpl{
 		client:                client,
 		users:                 make(map[string]string),
 		repositories:          make(map[string]*GithubRepository),
@@ -257,15 +322,49 @@ func NewGoliacRemoteImpl(client github.GitHubClient) *GoliacRemoteImpl {
 		teamSlugByName:        make(map[string]string),
 		rulesets:              make(map[string]*GithubRuleSet),
 		appIds:                make(map[string]int),
+		customProperties:      make(map[string]*GithubCustomProperty),
 		ttlExpireUsers:        time.Now(),
 		ttlExpireRepositories: time.Now(),
 		ttlExpireTeams:        time.Now(),
 		ttlExpireTeamsRepos:   time.Now(),
 		ttlExpireRulesets:     time.Now(),
 		ttlExpireAppIds:       time.Now(),
+		ttlExpireProperties:   time.Now(),
 		isEnterprise:          isEnterprise(ctx, config.Config.GithubAppOrganization, client),
+		bulkTeamRepos:         supportsBulkTeamRepos(ctx, client),
 		feedback:              nil,
+		teamMembersFreshness:  make(map[string]entityFreshness),
+		teamReposFreshness:    make(map[string]entityFreshness),
 	}
+
+	// warm restart: we start from the last known state (if any)
+	if path := config.Config.GithubCacheSnapshotFile; path != "" {
+		if _, err := os.Stat(path); err == nil {
+			if err := remote.LoadSnapshot(path); err != nil {
+				logrus.Warnf("ignoring the remote snapshot: %v", err)
+			}
+		}
+	}
+
+	return remote
+}
+
+/*
+ * deferLoad tells if a non-critical load (that would cost about cost calls/points of the api)
+ * must be deferred, to keep the GithubApiReserve budget for the mutations.
+ * A load is never deferred if nothing was loaded yet (cached is false), and is deferred
+ * until Github resets the API budget (returned)
+ */
+func (g *GoliacRemoteImpl) deferLoad(kind string, api string, cost int, cached bool) (time.Time, bool) {
+	if !cached {
+		return time.Time{}, false
+	}
+	budget, known := g.client.GetRateLimits().Get(api)
+	if !known || budget.Remaining-cost >= int(config.Config.GithubApiReserve) {
+		return time.Time{}, false
+	}
+	logrus.Warnf("Github API budget is low (%d left, %d kept for the changes): %s loading deferred until %s", budget.Remaining, config.Config.GithubApiReserve, kind, budget.Reset.Format(time.RFC3339))
+	return budget.Reset, true
 }
 
 func (g *GoliacRemoteImpl) IsEnterprise() bool {
@@ -275,6 +374,7 @@ func (g *GoliacRemoteImpl) IsEnterprise() bool {
 func (g *GoliacRemoteImpl) FlushCacheUsersTeamsOnly() {
 	g.ttlExpireUsers = time.Now()
 	g.ttlExpireTeams = time.Now()
+	g.teamMembersFreshness = make(map[string]entityFreshness)
 }
 
 func (g *GoliacRemoteImpl) FlushCache() {
@@ -284,10 +384,33 @@ func (g *GoliacRemoteImpl) FlushCache() {
 	g.ttlExpireTeamsRepos = time.Now()
 	g.ttlExpireRulesets = time.Now()
 	g.ttlExpireAppIds = time.Now()
+	g.ttlExpireProperties = time.Now()
+	g.teamMembersFreshness = make(map[string]entityFreshness)
+	g.teamReposFreshness = make(map[string]entityFreshness)
+}
+
+type noRemoteLoadKey struct{}
+
+/*
+ * WithoutRemoteLoad returns a context in which the getters (Users, Teams, Repositories, ...)
+ * return what is in the cache, even if its TTL expired: nothing is loaded from Github.
+ * Used to read the state the commands being applied are based on
+ */
+func WithoutRemoteLoad(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRemoteLoadKey{}, true)
+}
+
+func remoteLoadAllowed(ctx context.Context) bool {
+	noLoad, _ := ctx.Value(noRemoteLoadKey{}).(bool)
+	return !noLoad
 }
 
 func (g *GoliacRemoteImpl) RuleSets(ctx context.Context) map[string]*GithubRuleSet {
-	if time.Now().After(g.ttlExpireRulesets) {
+	if time.Now().After(g.ttlExpireRulesets) && remoteLoadAllowed(ctx) {
+		if reset, deferred := g.deferLoad("rulesets", github.RATELIMIT_GRAPHQL, 1, len(g.rulesets) > 0); deferred {
+			g.ttlExpireRulesets = reset
+			return g.rulesets
+		}
 		rulesets, err := g.loadRulesets(ctx)
 		if err == nil {
 			g.rulesets = rulesets
@@ -298,7 +421,7 @@ func (g *GoliacRemoteImpl) RuleSets(ctx context.Context) map[string]*GithubRuleS
 }
 
 func (g *GoliacRemoteImpl) AppIds(ctx context.Context) map[string]int {
-	if time.Now().After(g.ttlExpireAppIds) {
+	if time.Now().After(g.ttlExpireAppIds) && remoteLoadAllowed(ctx) {
 		appIds, err := g.loadAppIds(ctx)
 		if err == nil {
 			g.appIds = appIds
@@ -309,7 +432,7 @@ func (g *GoliacRemoteImpl) AppIds(ctx context.Context) map[string]int {
 }
 
 func (g *GoliacRemoteImpl) Users(ctx context.Context) map[string]string {
-	if time.Now().After(g.ttlExpireUsers) {
+	if time.Now().After(g.ttlExpireUsers) && remoteLoadAllowed(ctx) {
 		users, err := g.loadOrgUsers(ctx)
 		if err == nil {
 			g.users = users
@@ -320,7 +443,7 @@ func (g *GoliacRemoteImpl) Users(ctx context.Context) map[string]string {
 }
 
 func (g *GoliacRemoteImpl) TeamSlugByName(ctx context.Context) map[string]string {
-	if time.Now().After(g.ttlExpireTeams) {
+	if time.Now().After(g.ttlExpireTeams) && remoteLoadAllowed(ctx) {
 		teams, teamSlugByName, err := g.loadTeams(ctx)
 		if err == nil {
 			g.teams = teams
@@ -341,7 +464,7 @@ func (g *GoliacRemoteImpl) Teams(ctx context.Context, current bool) map[string]*
 	}
 	g.loadTeamsMutex.Lock()
 	defer g.loadTeamsMutex.Unlock()
-	if time.Now().After(g.ttlExpireTeams) {
+	if time.Now().After(g.ttlExpireTeams) && remoteLoadAllowed(ctx) {
 		teams, teamSlugByName, err := g.loadTeams(ctx)
 		if err == nil {
 			g.teams = teams
@@ -353,7 +476,7 @@ func (g *GoliacRemoteImpl) Teams(ctx context.Context, current bool) map[string]*
 }
 
 func (g *GoliacRemoteImpl) Repositories(ctx context.Context) map[string]*GithubRepository {
-	if time.Now().After(g.ttlExpireRepositories) {
+	if time.Now().After(g.ttlExpireRepositories) && remoteLoadAllowed(ctx) {
 		repositories, repositoriesByRefIds, err := g.loadRepositories(ctx)
 		if err == nil {
 			g.repositories = repositories
@@ -365,19 +488,16 @@ func (g *GoliacRemoteImpl) Repositories(ctx context.Context) map[string]*GithubR
 }
 
 func (g *GoliacRemoteImpl) TeamRepositories(ctx context.Context) map[string]map[string]*GithubTeamRepo {
-	if time.Now().After(g.ttlExpireTeamsRepos) {
-		if config.Config.GithubConcurrentThreads <= 1 {
-			teamsrepos, err := g.loadTeamReposNonConcurrently(ctx)
-			if err == nil {
-				g.teamRepos = teamsrepos
-				g.ttlExpireTeamsRepos = time.Now().Add(time.Duration(config.Config.GithubCacheTTL) * time.Second)
-			}
-		} else {
-			teamsrepos, err := g.loadTeamReposConcurrently(ctx, config.Config.GithubConcurrentThreads)
-			if err == nil {
-				g.teamRepos = teamsrepos
-				g.ttlExpireTeamsRepos = time.Now().Add(time.Duration(config.Config.GithubCacheTTL) * time.Second)
-			}
+	if time.Now().After(g.ttlExpireTeamsRepos) && remoteLoadAllowed(ctx) {
+		api, cost := g.teamReposLoadCost()
+		if reset, deferred := g.deferLoad("teams repos", api, cost, len(g.teamRepos) > 0); deferred {
+			g.ttlExpireTeamsRepos = reset
+			return g.teamRepos
+		}
+		teamsrepos, err := g.loadTeamReposIncrementally(ctx)
+		if err == nil {
+			g.teamRepos = teamsrepos
+			g.ttlExpireTeamsRepos = time.Now().Add(time.Duration(config.Config.GithubCacheTTL) * time.Second)
 		}
 	}
 	return g.teamRepos
@@ -480,22 +600,56 @@ func (g *GoliacRemoteImpl) loadOrgUsers(ctx context.Context) (map[string]string,
 		}
 	}
 
+	countEntitiesFetched(ctx, "users", len(users))
 	return users, nil
 }
 
 const listAllReposInOrg = `
 query listAllReposInOrg($orgLogin: String!, $endCursor: String) {
+    rateLimit {
+      limit
+      cost
+      remaining
+      resetAt
+    }
     organization(login: $orgLogin) {
       repositories(first: 10, after: $endCursor) {
         nodes {
           name
 		  id
 		  databaseId
+		  updatedAt
           isArchived
           isPrivate
+          visibility
 		  autoMergeAllowed
           deleteBranchOnMerge
           allowUpdateBranch
+          mergeCommitAllowed
+          rebaseMergeAllowed
+          squashMergeAllowed
+          forkingAllowed
+          webCommitSignoffRequired
+          hasIssuesEnabled
+          hasWikiEnabled
+          hasProjectsEnabled
+          hasDiscussionsEnabled
+          description
+          homepageUrl
+          defaultBranchRef {
+            name
+          }
+          squashMergeCommitTitle
+          squashMergeCommitMessage
+          mergeCommitTitle
+          mergeCommitMessage
+          repositoryTopics(first: 20) {
+            nodes {
+              topic {
+                name
+              }
+            }
+          }
           directCollaborators: collaborators(affiliation: DIRECT, first: 100) {
             edges {
               node {
@@ -556,39 +710,68 @@ query listAllReposInOrg($orgLogin: String!, $endCursor: String) {
   }
 `
 
+type GraphQLRepository struct {
+	Name                string
+	Id                  string
+	DatabaseId          int
+	UpdatedAt           string
+	IsArchived          bool
+	IsPrivate           bool
+	Visibility          string // PUBLIC, PRIVATE or INTERNAL
+	AutoMergeAllowed    bool
+	DeleteBranchOnMerge bool
+	AllowUpdateBranch   bool
+	DirectCollaborators struct {
+		Edges []struct {
+			Node struct {
+				Login string
+			}
+			Permission string
+		}
+	}
+	OutsideCollaborators struct {
+		Edges []struct {
+			Node struct {
+				Login string
+			}
+			Permission string
+		}
+	}
+	Rulesets struct {
+		Nodes []GraphQLGithubRuleSet
+	}
+	Description              string
+	HomepageUrl              string
+	SquashMergeCommitTitle   string
+	SquashMergeCommitMessage string
+	MergeCommitTitle         string
+	MergeCommitMessage       string
+	DefaultBranchRef         struct {
+		Name string
+	}
+	MergeCommitAllowed       bool
+	RebaseMergeAllowed       bool
+	SquashMergeAllowed       bool
+	ForkingAllowed           bool
+	WebCommitSignoffRequired bool
+	HasIssuesEnabled         bool
+	HasWikiEnabled           bool
+	HasProjectsEnabled       bool
+	HasDiscussionsEnabled    bool
+	RepositoryTopics         struct {
+		Nodes []struct {
+			Topic struct {
+				Name string
+			}
+		}
+	}
+}
+
 type GraplQLRepositories struct {
 	Data struct {
 		Organization struct {
 			Repositories struct {
-				Nodes []struct {
-					Name                string
-					Id                  string
-					DatabaseId          int
-					IsArchived          bool
-					IsPrivate           bool
-					AutoMergeAllowed    bool
-					DeleteBranchOnMerge bool
-					AllowUpdateBranch   bool
-					DirectCollaborators struct {
-						Edges []struct {
-							Node struct {
-								Login string
-							}
-							Permission string
-						}
-					}
-					OutsideCollaborators struct {
-						Edges []struct {
-							Node struct {
-								Login string
-							}
-							Permission string
-						}
-					}
-					Rulesets struct {
-						Nodes []GraphQLGithubRuleSet
-					}
-				} `json:"nodes"`
+				Nodes    []GraphQLRepository `json:"nodes"`
 				PageInfo struct {
 					HasNextPage bool
 					EndCursor   string
@@ -607,6 +790,85 @@ type GraplQLRepositories struct {
 	} `json:"errors"`
 }
 
+/*
+ * fromGraphQLToGithubRepository converts a listAllReposInOrg/getRepository node
+ */
+func (g *GoliacRemoteImpl) fromGraphQLToGithubRepository(c *GraphQLRepository) *GithubRepository {
+	repo := &GithubRepository{
+		Name:      c.Name,
+		Id:        c.DatabaseId,
+		RefId:     c.Id,
+		UpdatedAt: c.UpdatedAt,
+		BoolProperties: map[string]bool{
+			"archived":               c.IsArchived,
+			"private":                c.IsPrivate,
+			"allow_auto_merge":       c.AutoMergeAllowed,
+			"delete_branch_on_merge": c.DeleteBranchOnMerge,
+			"allow_update_branch":    c.AllowUpdateBranch,
+
+			"allow_merge_commit":          c.MergeCommitAllowed,
+			"allow_rebase_merge":          c.RebaseMergeAllowed,
+			"allow_squash_merge":          c.SquashMergeAllowed,
+			"allow_forking":               c.ForkingAllowed,
+			"web_commit_signoff_required": c.WebCommitSignoffRequired,
+			"has_issues":                  c.HasIssuesEnabled,
+			"has_wiki":                    c.HasWikiEnabled,
+			"has_projects":                c.HasProjectsEnabled,
+			"has_discussions":             c.HasDiscussionsEnabled,
+		},
+		StringProperties: map[string]string{
+			"description":                 c.Description,
+			"homepage":                    c.HomepageUrl,
+			"default_branch":              c.DefaultBranchRef.Name, // empty until the first push
+			"visibility":                  graphQLVisibility(c),
+			"squash_merge_commit_title":   c.SquashMergeCommitTitle,
+			"squash_merge_commit_message": c.SquashMergeCommitMessage,
+			"merge_commit_title":          c.MergeCommitTitle,
+			"merge_commit_message":        c.MergeCommitMessage,
+		},
+		Topics:        []string{},
+		ExternalUsers: make(map[string]string),
+		InternalUsers: make(map[string]string),
+		RuleSets:      make(map[string]*GithubRuleSet),
+	}
+	for _, topic := range c.RepositoryTopics.Nodes {
+		repo.Topics = append(repo.Topics, topic.Topic.Name)
+	}
+	repo.Topics = sortedStrings(repo.Topics)
+	for _, outsideCollaborator := range c.OutsideCollaborators.Edges {
+		repo.ExternalUsers[outsideCollaborator.Node.Login] = outsideCollaborator.Permission
+	}
+	for _, internalCollaborator := range c.DirectCollaborators.Edges {
+		repo.InternalUsers[internalCollaborator.Node.Login] = internalCollaborator.Permission
+	}
+	for _, ruleset := range c.Rulesets.Nodes {
+		// if the source is the repository itself, it is not a organization ruleset
+		// we add the ruleset
+		if ruleset.Source.Name == c.Name {
+			repo.RuleSets[ruleset.Name] = g.fromGraphQLToGithubRuleset(&ruleset)
+		}
+	}
+	return repo
+}
+
+/*
+ * graphQLVisibility returns the repository visibility (public, private or internal).
+ * An internal repository is private too: the visibility can't be inferred from isPrivate
+ */
+func graphQLVisibility(c *GraphQLRepository) string {
+	if c.Visibility != "" {
+		return strings.ToLower(c.Visibility)
+	}
+	return visibilityFromPrivate(c.IsPrivate)
+}
+
+func visibilityFromPrivate(private bool) string {
+	if private {
+		return "private"
+	}
+	return "public"
+}
+
 func (g *GoliacRemoteImpl) loadRepositories(ctx context.Context) (map[string]*GithubRepository, map[string]*GithubRepository, error) {
 	logrus.Debug("loading repositories")
 	repositories := make(map[string]*GithubRepository)
@@ -636,34 +898,7 @@ func (g *GoliacRemoteImpl) loadRepositories(ctx context.Context) (map[string]*Gi
 		}
 
 		for _, c := range gResult.Data.Organization.Repositories.Nodes {
-			repo := &GithubRepository{
-				Name:  c.Name,
-				Id:    c.DatabaseId,
-				RefId: c.Id,
-				BoolProperties: map[string]bool{
-					"archived":               c.IsArchived,
-					"private":                c.IsPrivate,
-					"allow_auto_merge":       c.AutoMergeAllowed,
-					"delete_branch_on_merge": c.DeleteBranchOnMerge,
-					"allow_update_branch":    c.AllowUpdateBranch,
-				},
-				ExternalUsers: make(map[string]string),
-				InternalUsers: make(map[string]string),
-				RuleSets:      make(map[string]*GithubRuleSet),
-			}
-			for _, outsideCollaborator := range c.OutsideCollaborators.Edges {
-				repo.ExternalUsers[outsideCollaborator.Node.Login] = outsideCollaborator.Permission
-			}
-			for _, internalCollaborator := range c.DirectCollaborators.Edges {
-				repo.InternalUsers[internalCollaborator.Node.Login] = internalCollaborator.Permission
-			}
-			for _, ruleset := range c.Rulesets.Nodes {
-				// if the source is the repository itself, it is not a organization ruleset
-				// we add the ruleset
-				if ruleset.Source.Name == c.Name {
-					repo.RuleSets[ruleset.Name] = g.fromGraphQLToGithubRuleset(&ruleset)
-				}
-			}
+			repo := g.fromGraphQLToGithubRepository(&c)
 			repositories[c.Name] = repo
 			repositoriesByRefId[c.Id] = repo
 		}
@@ -682,6 +917,14 @@ func (g *GoliacRemoteImpl) loadRepositories(ctx context.Context) (map[string]*Gi
 		}
 	}
 
+	// the custom properties values are only available with the REST api
+	err := g.loadCustomPropertyValues(ctx, repositories)
+	if err != nil {
+		logrus.Warnf("not able to load the repositories custom properties: %v", err)
+	}
+	g.propertyValuesErr = err
+
+	countEntitiesFetched(ctx, "repositories", len(repositories))
 	return repositories, repositoriesByRefId, retErr
 }
 
@@ -692,6 +935,7 @@ query listAllTeamsInOrg($orgLogin: String!, $endCursor: String) {
         nodes {
           name
 		  databaseId
+		  updatedAt
           slug
 		  parentTeam {
 		    databaseId
@@ -715,6 +959,7 @@ type GraplQLTeams struct {
 					Name       string
 					DatabaseId int `json:"databaseId"`
 					Slug       string
+					UpdatedAt  string `json:"updatedAt"`
 					ParentTeam struct {
 						DatabaseId int `json:"databaseId"`
 					} `json:"parentTeam"`
@@ -802,8 +1047,10 @@ func (g *GoliacRemoteImpl) loadAppIds(ctx context.Context) (map[string]int, erro
 // Load from a github repository. continueOnError is used for scaffolding
 func (g *GoliacRemoteImpl) Load(ctx context.Context, continueOnError bool) error {
 	var retErr error
+	loaded := false
 
 	if time.Now().After(g.ttlExpireAppIds) {
+		loaded = true
 		appIds, err := g.loadAppIds(ctx)
 		if err != nil {
 			if !continueOnError {
@@ -818,6 +1065,7 @@ func (g *GoliacRemoteImpl) Load(ctx context.Context, continueOnError bool) error
 
 	g.loadTeamsMutex.Lock()
 	if time.Now().After(g.ttlExpireTeams) {
+		loaded = true
 		teams, teamSlugByName, err := g.loadTeams(ctx)
 		if err != nil {
 			if !continueOnError {
@@ -834,6 +1082,7 @@ func (g *GoliacRemoteImpl) Load(ctx context.Context, continueOnError bool) error
 	g.loadTeamsMutex.Unlock()
 
 	if time.Now().After(g.ttlExpireUsers) {
+		loaded = true
 		users, err := g.loadOrgUsers(ctx)
 		if err != nil {
 			if !continueOnError {
@@ -847,6 +1096,7 @@ func (g *GoliacRemoteImpl) Load(ctx context.Context, continueOnError bool) error
 	}
 
 	if time.Now().After(g.ttlExpireRepositories) {
+		loaded = true
 		repositories, repositoriesByRefId, err := g.loadRepositories(ctx)
 		if err != nil {
 			if !continueOnError {
@@ -862,6 +1112,12 @@ func (g *GoliacRemoteImpl) Load(ctx context.Context, continueOnError bool) error
 
 	// let's load the rulesets after the repositories because I need the repository refs
 	if time.Now().After(g.ttlExpireRulesets) {
+		if reset, deferred := g.deferLoad("rulesets", github.RATELIMIT_GRAPHQL, 1, len(g.rulesets) > 0); deferred {
+			g.ttlExpireRulesets = reset
+		}
+	}
+	if time.Now().After(g.ttlExpireRulesets) {
+		loaded = true
 		rulesets, err := g.loadRulesets(ctx)
 		if err != nil {
 			if !continueOnError {
@@ -874,84 +1130,176 @@ func (g *GoliacRemoteImpl) Load(ctx context.Context, continueOnError bool) error
 		g.ttlExpireRulesets = time.Now().Add(time.Duration(config.Config.GithubCacheTTL) * time.Second)
 	}
 
+	// custom properties are not available on older GHES versions (and require
+	// the organization custom properties permission): we can live without them
+	if time.Now().After(g.ttlExpireProperties) {
+		loaded = true
+		properties, err := g.loadCustomProperties(ctx)
+		if err != nil {
+			logrus.Warnf("not able to load the custom properties: %v", err)
+		} else {
+			g.customProperties = properties
+		}
+		g.customPropertiesErr = err
+		g.ttlExpireProperties = time.Now().Add(time.Duration(config.Config.GithubCacheTTL) * time.Second)
+	}
+
 	if time.Now().After(g.ttlExpireTeamsRepos) {
-		if config.Config.GithubConcurrentThreads <= 1 {
-			teamsrepos, err := g.loadTeamReposNonConcurrently(ctx)
-			if err != nil {
-				if !continueOnError {
-					return err
-				}
-				logrus.Debugf("Error loading teams-repos: %v", err)
-				retErr = fmt.Errorf("error loading teams-repos: %v", err)
+		api, cost := g.teamReposLoadCost()
+		if reset, deferred := g.deferLoad("teams repos", api, cost, len(g.teamRepos) > 0); deferred {
+			g.ttlExpireTeamsRepos = reset
+		}
+	}
+	if time.Now().After(g.ttlExpireTeamsRepos) {
+		loaded = true
+		teamsrepos, err := g.loadTeamReposIncrementally(ctx)
+		if err != nil {
+			if !continueOnError {
+				return err
 			}
-			g.teamRepos = teamsrepos
+			logrus.Debugf("Error loading teams-repos: %v", err)
+			retErr = fmt.Errorf("error loading teams-repos: %v", err)
 		} else {
-			teamsrepos, err := g.loadTeamReposConcurrently(ctx, config.Config.GithubConcurrentThreads)
-			if err != nil {
-				if !continueOnError {
-					return err
-				}
-				logrus.Debugf("Error loading teams-repos: %v", err)
-				retErr = fmt.Errorf("error loading teams-repos: %v", err)
-			}
+			// on error, we keep what we had (it will be loaded again next time)
 			g.teamRepos = teamsrepos
+			g.ttlExpireTeamsRepos = time.Now().Add(time.Duration(config.Config.GithubCacheTTL) * time.Second)
 		}
-		g.ttlExpireTeamsRepos = time.Now().Add(time.Duration(config.Config.GithubCacheTTL) * time.Second)
 	}
 
 	logrus.Debugf("Nb remote users: %d", len(g.users))
 	logrus.Debugf("Nb remote teams: %d", len(g.teams))
 	logrus.Debugf("Nb remote repositories: %d", len(g.repositories))
 
+	if loaded && retErr == nil && config.Config.GithubCacheSnapshotFile != "" {
+		if err := g.SaveSnapshot(config.Config.GithubCacheSnapshotFile); err != nil {
+			logrus.Warn(err)
+		}
+	}
+
 	return retErr
 }
 
-func (g *GoliacRemoteImpl) loadTeamReposNonConcurrently(ctx context.Context) (map[string]map[string]*GithubTeamRepo, error) {
-	logrus.Debug("loading teamReposNonConcurrently")
-	teamRepos := make(map[string]map[string]*GithubTeamRepo)
+// staleTeamRepos returns the repositories whose teams must be (re)fetched
+func (g *GoliacRemoteImpl) staleTeamRepos() []string {
+	staleRepositories := make([]string, 0)
+	for reponame, repo := range g.repositories {
+		if freshness, ok := g.teamReposFreshness[reponame]; !ok || freshness.isStale(repo.UpdatedAt) {
+			staleRepositories = append(staleRepositories, reponame)
+		}
+	}
+	return staleRepositories
+}
 
-	teamsPerRepo := make(map[string]map[string]*GithubTeamRepo)
-	for repository := range g.repositories {
-		repos, err := g.loadTeamRepos(ctx, repository)
-		if err != nil {
-			return teamRepos, err
+/*
+ * loadTeamReposIncrementally fetches the teams of the repositories that changed on Github
+ * (or whose cache expired), and keeps the cached teams of the other repositories.
+ * On error, nothing is returned and the freshness of the repositories is left untouched
+ */
+func (g *GoliacRemoteImpl) loadTeamReposIncrementally(ctx context.Context) (map[string]map[string]*GithubTeamRepo, error) {
+	staleRepositories := g.staleTeamRepos()
+	logrus.Debugf("loading teams of %d repositories (out of %d)", len(staleRepositories), len(g.repositories))
+
+	var teamsPerRepo map[string]map[string]*GithubTeamRepo
+	var err error
+	if g.useBulkTeamRepos(len(staleRepositories)) {
+		// cheaper to load everything with GraphQL than one call per repository
+		teamsPerRepo, err = g.loadTeamReposBulk(ctx)
+		var notSupported *errBulkTeamReposNotSupported
+		if errors.As(err, &notSupported) {
+			logrus.Warnf("%v: using the REST API", err)
+			g.bulkTeamRepos = false
+		}
+	}
+	if !g.useBulkTeamRepos(len(staleRepositories)) {
+		if config.Config.GithubConcurrentThreads <= 1 {
+			teamsPerRepo, err = g.loadTeamReposNonConcurrently(ctx, staleRepositories)
+		} else {
+			teamsPerRepo, err = g.loadTeamReposConcurrently(ctx, staleRepositories, config.Config.GithubConcurrentThreads)
 		}
-		if g.feedback != nil {
-			g.feedback.LoadingAsset("teams_repos", 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	countEntitiesFetched(ctx, "teams_repos", len(teamsPerRepo))
+
+	teamRepos := make(map[string]map[string]*GithubTeamRepo)
+	addTeamRepo := func(team string, repository string, repo *GithubTeamRepo) {
+		if _, ok := teamRepos[team]; ok {
+			teamRepos[team][repository] = repo
+		} else {
+			teamRepos[team] = map[string]*GithubTeamRepo{repository: repo}
+		}
+	}
+
+	// we keep what we know about the repositories we didn't fetch
+	for team, repos := range g.teamRepos {
+		for repository, repo := range repos {
+			if _, fetched := teamsPerRepo[repository]; fetched {
+				continue
+			}
+			if _, exists := g.repositories[repository]; !exists {
+				continue
+			}
+			addTeamRepo(team, repository, repo)
 		}
-		teamsPerRepo[repository] = repos
 	}
 
 	// we have all the teams per repo, now we need to invert the map
 	for repository, repos := range teamsPerRepo {
 		for team, repo := range repos {
-			if _, ok := teamRepos[team]; ok {
-				teamRepos[team][repository] = repo
-			} else {
-				teamRepos[team] = map[string]*GithubTeamRepo{repository: repo}
-			}
+			addTeamRepo(team, repository, repo)
+		}
+		g.teamReposFreshness[repository] = newEntityFreshness(g.repositories[repository].UpdatedAt)
+	}
+
+	for repository := range g.teamReposFreshness {
+		if _, exists := g.repositories[repository]; !exists {
+			delete(g.teamReposFreshness, repository)
 		}
 	}
 
 	return teamRepos, nil
 }
 
-func (g *GoliacRemoteImpl) loadTeamReposConcurrently(ctx context.Context, maxGoroutines int64) (map[string]map[string]*GithubTeamRepo, error) {
-	logrus.Debug("loading teamReposConcurrently")
-	teamRepos := make(map[string]map[string]*GithubTeamRepo)
+/*
+ * loadTeamReposNonConcurrently returns
+ * map[repository]map[teamSlug]repoinfo
+ */
+func (g *GoliacRemoteImpl) loadTeamReposNonConcurrently(ctx context.Context, repositories []string) (map[string]map[string]*GithubTeamRepo, error) {
+	logrus.Debug("loading teamReposNonConcurrently")
+	teamsPerRepo := make(map[string]map[string]*GithubTeamRepo)
+	for _, repository := range repositories {
+		repos, err := g.loadTeamRepos(ctx, repository)
+		if err != nil {
+			return teamsPerRepo, err
+		}
+		if g.feedback != nil {
+			g.feedback.LoadingAsset("teams_repos", 1)
+		}
+		teamsPerRepo[repository] = repos
+	}
 
+	return teamsPerRepo, nil
+}
+
+/*
+ * loadTeamReposConcurrently returns
+ * map[repository]map[teamSlug]repoinfo
+ */
+func (g *GoliacRemoteImpl) loadTeamReposConcurrently(ctx context.Context, repositories []string, maxGoroutines int64) (map[string]map[string]*GithubTeamRepo, error) {
+	logrus.Debug("loading teamReposConcurrently")
 	teamsPerRepo := make(map[string]map[string]*GithubTeamRepo)
 
 	var wg sync.WaitGroup
 	var wg2 sync.WaitGroup
 
 	// Create buffered channels
-	reposChan := make(chan string, len(g.repositories))
+	reposChan := make(chan string, len(repositories))
 	errChan := make(chan error, 1) // will hold the first error
 	teamReposChan := make(chan struct {
 		repoName string
 		repos    map[string]*GithubTeamRepo
-	}, len(g.repositories))
+	}, len(repositories))
 
 	// Create worker goroutines
 	for i := int64(0); i < maxGoroutines; i++ {
@@ -977,7 +1325,7 @@ func (g *GoliacRemoteImpl) loadTeamReposConcurrently(ctx context.Context, maxGor
 	}
 
 	// Send repositories to reposChan
-	for repoName := range g.repositories {
+	for _, repoName := range repositories {
 		reposChan <- repoName
 	}
 	close(reposChan)
@@ -1001,23 +1349,12 @@ func (g *GoliacRemoteImpl) loadTeamReposConcurrently(ctx context.Context, maxGor
 	// Check if any goroutine returned an error
 	select {
 	case err := <-errChan:
-		return teamRepos, err
+		return teamsPerRepo, err
 	default:
 		//nop
 	}
 
-	// we have all the teams per repo, now we need to invert the map
-	for repository, repos := range teamsPerRepo {
-		for team, repo := range repos {
-			if _, ok := teamRepos[team]; ok {
-				teamRepos[team][repository] = repo
-			} else {
-				teamRepos[team] = map[string]*GithubTeamRepo{repository: repo}
-			}
-		}
-	}
-
-	return teamRepos, nil
+	return teamsPerRepo, nil
 }
 
 type TeamsRepoResponse struct {
@@ -1150,9 +1487,10 @@ func (g *GoliacRemoteImpl) loadTeams(ctx context.Context) (map[string]*GithubTea
 
 		for _, c := range gResult.Data.Organization.Teams.Nodes {
 			team := GithubTeam{
-				Name: c.Name,
-				Id:   c.DatabaseId,
-				Slug: c.Slug,
+				Name:      c.Name,
+				Id:        c.DatabaseId,
+				Slug:      c.Slug,
+				UpdatedAt: c.UpdatedAt,
 			}
 			if c.ParentTeam.DatabaseId != 0 {
 				parentId := c.ParentTeam.DatabaseId
@@ -1176,9 +1514,24 @@ func (g *GoliacRemoteImpl) loadTeams(ctx context.Context) (map[string]*GithubTea
 		}
 	}
 
-	// load team's members
+	countEntitiesFetched(ctx, "teams", len(teams))
+
+	// load team's members (only for the teams that changed)
+	staleTeams := make(map[string]*GithubTeam)
+	for slug, t := range teams {
+		previous, found := g.teams[slug]
+		if freshness, ok := g.teamMembersFreshness[slug]; ok && found && !freshness.isStale(t.UpdatedAt) {
+			t.Members = previous.Members
+			t.Maintainers = previous.Maintainers
+		} else {
+			staleTeams[slug] = t
+		}
+	}
+	logrus.Debugf("loading members of %d teams (out of %d)", len(staleTeams), len(teams))
+	countEntitiesFetched(ctx, "teams_members", len(staleTeams))
+
 	if config.Config.GithubConcurrentThreads <= 1 {
-		for _, t := range teams {
+		for _, t := range staleTeams {
 			err := g.loadTeamsMembers(ctx, t)
 			if err != nil {
 				return teams, teamSlugByName, err
@@ -1191,7 +1544,7 @@ func (g *GoliacRemoteImpl) loadTeams(ctx context.Context) (map[string]*GithubTea
 		var wg sync.WaitGroup
 
 		// Create buffered channels
-		teamsChan := make(chan *GithubTeam, len(teams))
+		teamsChan := make(chan *GithubTeam, len(staleTeams))
 		errChan := make(chan error, 1) // will hold the first error
 
 		// Create worker goroutines
@@ -1217,7 +1570,7 @@ func (g *GoliacRemoteImpl) loadTeams(ctx context.Context) (map[string]*GithubTea
 		}
 
 		// Send teams to teamsChan
-		for _, t := range teams {
+		for _, t := range staleTeams {
 			teamsChan <- t
 		}
 		close(teamsChan)
@@ -1234,6 +1587,15 @@ func (g *GoliacRemoteImpl) loadTeams(ctx context.Context) (map[string]*GithubTea
 		}
 	}
 
+	for slug, t := range staleTeams {
+		g.teamMembersFreshness[slug] = newEntityFreshness(t.UpdatedAt)
+	}
+	for slug := range g.teamMembersFreshness {
+		if _, exists := teams[slug]; !exists {
+			delete(g.teamMembersFreshness, slug)
+		}
+	}
+
 	return teams, teamSlugByName, nil
 }
 
@@ -1283,6 +1645,12 @@ func (g *GoliacRemoteImpl) loadTeamsMembers(ctx context.Context, t *GithubTeam)
 
 const listRulesets = `
 query listRulesets ($orgLogin: String!) { 
+	rateLimit {
+	  limit
+	  cost
+	  remaining
+	  resetAt
+	}
 	organization(login: $orgLogin) {
 	  rulesets(first: 100) { 
 		nodes {
@@ -1515,10 +1883,15 @@ func (g *GoliacRemoteImpl) loadRulesets(ctx context.Context) (map[string]*Github
 		}
 	}
 
+	countEntitiesFetched(ctx, "rulesets", len(rulesets))
 	return rulesets, nil
 }
 
 func (g *GoliacRemoteImpl) prepareRuleset(ruleset *GithubRuleSet) map[string]interface{} {
+	// we read the cache (app and repository ids)
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	bypassActors := make([]map[string]interface{}, 0)
 
 	for appname, mode := range ruleset.BypassApps {
@@ -1609,7 +1982,7 @@ func (g *GoliacRemoteImpl) prepareRuleset(ruleset *GithubRuleSet) map[string]int
 	return payload
 }
 
-func (g *GoliacRemoteImpl) AddRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) {
+func (g *GoliacRemoteImpl) AddRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) error {
 	// add ruleset
 	// https://docs.github.com/en/enterprise-cloud@latest/rest/orgs/rules?apiVersion=2022-11-28#create-an-organization-repository-ruleset
 
@@ -1622,14 +1995,18 @@ func (g *GoliacRemoteImpl) AddRuleset(ctx context.Context, dryrun bool, ruleset
 			g.prepareRuleset(ruleset),
 		)
 		if err != nil {
-			logrus.Errorf("failed to add ruleset to org: %v. %s", err, string(body))
+			return fmt.Errorf("failed to add ruleset to org: %v. %s", err, string(body))
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	g.rulesets[ruleset.Name] = ruleset
+	return nil
 }
 
-func (g *GoliacRemoteImpl) UpdateRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) {
+func (g *GoliacRemoteImpl) UpdateRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) error {
 	// update ruleset
 	// https://docs.github.com/en/enterprise-cloud@latest/rest/orgs/rules?apiVersion=2022-11-28#update-an-organization-repository-ruleset
 
@@ -1642,14 +2019,18 @@ func (g *GoliacRemoteImpl) UpdateRuleset(ctx context.Context, dryrun bool, rules
 			g.prepareRuleset(ruleset),
 		)
 		if err != nil {
-			logrus.Errorf("failed to update ruleset %d to org: %v. %s", ruleset.Id, err, string(body))
+			return fmt.Errorf("failed to update ruleset %d to org: %v. %s", ruleset.Id, err, string(body))
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	g.rulesets[ruleset.Name] = ruleset
+	return nil
 }
 
-func (g *GoliacRemoteImpl) DeleteRuleset(ctx context.Context, dryrun bool, rulesetid int) {
+func (g *GoliacRemoteImpl) DeleteRuleset(ctx context.Context, dryrun bool, rulesetid int) error {
 	// remove ruleset
 	// https://docs.github.com/en/enterprise-cloud@latest/rest/orgs/rules?apiVersion=2022-11-28#delete-an-organization-repository-ruleset
 
@@ -1662,79 +2043,94 @@ func (g *GoliacRemoteImpl) DeleteRuleset(ctx context.Context, dryrun bool, rules
 			nil,
 		)
 		if err != nil {
-			logrus.Errorf("failed to remove ruleset from org: %v", err)
+			return fmt.Errorf("failed to remove ruleset from org: %v", err)
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	for _, r := range g.rulesets {
 		if r.Id == rulesetid {
 			delete(g.rulesets, r.Name)
 			break
 		}
 	}
+	return nil
 }
 
-func (g *GoliacRemoteImpl) AddRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) {
+func (g *GoliacRemoteImpl) AddRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) error {
 	// add repository ruleset
 	// https://docs.github.com/en/rest/repos/rules?apiVersion=2022-11-28#create-a-repository-ruleset
 
 	if !dryrun {
 		body, err := g.client.CallRestAPI(
 			ctx,
-			fmt.Sprintf("/orgs/%s/%s/rulesets", config.Config.GithubAppOrganization, reponame),
+			fmt.Sprintf("/repos/%s/%s/rulesets", config.Config.GithubAppOrganization, reponame),
 			"",
 			"POST",
 			g.prepareRuleset(ruleset),
 		)
 		if err != nil {
-			logrus.Errorf("failed to add ruleset to repository: %v. %s", err, string(body))
+			return fmt.Errorf("failed to add ruleset to repository: %v. %s", err, string(body))
 		}
 	}
+
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
 	repo := g.repositories[reponame]
 	if repo != nil {
 		repo.RuleSets[ruleset.Name] = ruleset
 	}
+	return nil
 }
 
-func (g *GoliacRemoteImpl) UpdateRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) {
+func (g *GoliacRemoteImpl) UpdateRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) error {
 	// update repository ruleset
 	// https://docs.github.com/en/rest/repos/rules?apiVersion=2022-11-28#update-a-repository-ruleset
 
 	if !dryrun {
 		body, err := g.client.CallRestAPI(
 			ctx,
-			fmt.Sprintf("/orgs/%s/%s/rulesets/%d", config.Config.GithubAppOrganization, reponame, ruleset.Id),
+			fmt.Sprintf("/repos/%s/%s/rulesets/%d", config.Config.GithubAppOrganization, reponame, ruleset.Id),
 			"",
 			"PUT",
 			g.prepareRuleset(ruleset),
 		)
 		if err != nil {
-			logrus.Errorf("failed to update ruleset %d to repository: %v. %s", ruleset.Id, err, string(body))
+			return fmt.Errorf("failed to update ruleset %d to repository: %v. %s", ruleset.Id, err, string(body))
 		}
 	}
+
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
 	repo := g.repositories[reponame]
 	if repo != nil {
 		repo.RuleSets[ruleset.Name] = ruleset
 	}
+	return nil
 }
 
-func (g *GoliacRemoteImpl) DeleteRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, rulesetid int) {
+func (g *GoliacRemoteImpl) DeleteRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, rulesetid int) error {
 	// remove repository ruleset
 	// https://docs.github.com/en/rest/repos/rules?apiVersion=2022-11-28#delete-a-repository-ruleset
 
 	if !dryrun {
 		_, err := g.client.CallRestAPI(
 			ctx,
-			fmt.Sprintf("/orgs/%s/%s/rulesets/%d", config.Config.GithubAppOrganization, reponame, rulesetid),
+			fmt.Sprintf("/repos/%s/%s/rulesets/%d", config.Config.GithubAppOrganization, reponame, rulesetid),
 			"",
 			"DELETE",
 			nil,
 		)
 		if err != nil {
-			logrus.Errorf("failed to remove ruleset from repository: %v", err)
+			return fmt.Errorf("failed to remove ruleset from repository: %v", err)
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	repo := g.repositories[reponame]
 	if repo != nil {
 		for _, r := range repo.RuleSets {
@@ -1744,9 +2140,10 @@ func (g *GoliacRemoteImpl) DeleteRepositoryRuleset(ctx context.Context, dryrun b
 			}
 		}
 	}
+	return nil
 }
 
-func (g *GoliacRemoteImpl) AddUserToOrg(ctx context.Context, dryrun bool, ghuserid string) {
+func (g *GoliacRemoteImpl) AddUserToOrg(ctx context.Context, dryrun bool, ghuserid string) error {
 	// add member
 	// https://docs.github.com/en/rest/teams/teams?apiVersion=2022-11-28#create-a-team
 	if !dryrun {
@@ -1758,14 +2155,18 @@ func (g *GoliacRemoteImpl) AddUserToOrg(ctx context.Context, dryrun bool, ghuser
 			map[string]interface{}{"role": "member"},
 		)
 		if err != nil {
-			logrus.Errorf("failed to add user to org: %v. %s", err, string(body))
+			return fmt.Errorf("failed to add user to org: %v. %s", err, string(body))
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	g.users[ghuserid] = ghuserid
+	return nil
 }
 
-func (g *GoliacRemoteImpl) RemoveUserFromOrg(ctx context.Context, dryrun bool, ghuserid string) {
+func (g *GoliacRemoteImpl) RemoveUserFromOrg(ctx context.Context, dryrun bool, ghuserid string) error {
 	// remove member
 	// https://docs.github.com/en/rest/orgs/members?apiVersion=2022-11-28#remove-organization-membership-for-a-user
 	if !dryrun {
@@ -1777,11 +2178,15 @@ func (g *GoliacRemoteImpl) RemoveUserFromOrg(ctx context.Context, dryrun bool, g
 			nil,
 		)
 		if err != nil {
-			logrus.Errorf("failed to remove user from org: %v. %s", err, string(body))
+			return fmt.Errorf("failed to remove user from org: %v. %s", err, string(body))
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	delete(g.users, ghuserid)
+	return nil
 }
 
 type CreateTeamResponse struct {
@@ -1789,7 +2194,7 @@ type CreateTeamResponse struct {
 	Slug string
 }
 
-func (g *GoliacRemoteImpl) CreateTeam(ctx context.Context, dryrun bool, teamname string, description string, parentTeam *int, members []string) {
+func (g *GoliacRemoteImpl) CreateTeam(ctx context.Context, dryrun bool, teamname string, description string, parentTeam *int, members []string) error {
 	slugname := slug.Make(teamname)
 	// create team
 	// https://docs.github.com/en/rest/teams/teams?apiVersion=2022-11-28#create-a-team
@@ -1810,14 +2215,12 @@ func (g *GoliacRemoteImpl) CreateTeam(ctx context.Context, dryrun bool, teamname
 			params,
 		)
 		if err != nil {
-			logrus.Errorf("failed to create team: %v. %s", err, string(body))
-			return
+			return fmt.Errorf("failed to create team: %v. %s", err, string(body))
 		}
 		var res CreateTeamResponse
 		err = json.Unmarshal(body, &res)
 		if err != nil {
-			logrus.Errorf("failed to create team: %v", err)
-			return
+			return fmt.Errorf("failed to create team: %v", err)
 		}
 
 		// add members
@@ -1831,13 +2234,15 @@ func (g *GoliacRemoteImpl) CreateTeam(ctx context.Context, dryrun bool, teamname
 				map[string]interface{}{"role": "member"},
 			)
 			if err != nil {
-				logrus.Errorf("failed to create team: %v. %s", err, string(body))
-				return
+				return fmt.Errorf("failed to create team: %v. %s", err, string(body))
 			}
 		}
 		slugname = res.Slug
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	g.teams[slugname] = &GithubTeam{
 		Name:        teamname,
 		Slug:        slugname,
@@ -1845,10 +2250,11 @@ func (g *GoliacRemoteImpl) CreateTeam(ctx context.Context, dryrun bool, teamname
 		Maintainers: []string{},
 	}
 	g.teamSlugByName[teamname] = slugname
+	return nil
 }
 
 // role = member or maintainer (usually we use member)
-func (g *GoliacRemoteImpl) UpdateTeamAddMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) {
+func (g *GoliacRemoteImpl) UpdateTeamAddMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error {
 	// https://docs.github.com/en/rest/teams/members?apiVersion=2022-11-28#add-or-update-team-membership-for-a-user
 	if !dryrun {
 		body, err := g.client.CallRestAPI(
@@ -1859,10 +2265,13 @@ func (g *GoliacRemoteImpl) UpdateTeamAddMember(ctx context.Context, dryrun bool,
 			map[string]interface{}{"role": role},
 		)
 		if err != nil {
-			logrus.Errorf("failed to add team member: %v. %s", err, string(body))
+			return fmt.Errorf("failed to add team member: %v. %s", err, string(body))
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	if role == "maintainer" {
 		if team, ok := g.teams[teamslug]; ok {
 			// searching for maintainers
@@ -1892,10 +2301,11 @@ func (g *GoliacRemoteImpl) UpdateTeamAddMember(ctx context.Context, dryrun bool,
 			}
 		}
 	}
+	return nil
 }
 
 // role = member or maintainer (usually we use member)
-func (g *GoliacRemoteImpl) UpdateTeamUpdateMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) {
+func (g *GoliacRemoteImpl) UpdateTeamUpdateMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error {
 	// https://docs.github.com/en/rest/teams/members?apiVersion=2022-11-28#add-or-update-team-membership-for-a-user
 	if !dryrun {
 		body, err := g.client.CallRestAPI(
@@ -1906,10 +2316,13 @@ func (g *GoliacRemoteImpl) UpdateTeamUpdateMember(ctx context.Context, dryrun bo
 			map[string]interface{}{"role": role},
 		)
 		if err != nil {
-			logrus.Errorf("failed to update team member: %v. %s", err, string(body))
+			return fmt.Errorf("failed to update team member: %v. %s", err, string(body))
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	if role == "maintainer" {
 		if team, ok := g.teams[teamslug]; ok {
 			// searching for maintainers
@@ -1953,9 +2366,10 @@ func (g *GoliacRemoteImpl) UpdateTeamUpdateMember(ctx context.Context, dryrun bo
 			}
 		}
 	}
+	return nil
 }
 
-func (g *GoliacRemoteImpl) UpdateTeamRemoveMember(ctx context.Context, dryrun bool, teamslug string, username string) {
+func (g *GoliacRemoteImpl) UpdateTeamRemoveMember(ctx context.Context, dryrun bool, teamslug string, username string) error {
 	// https://docs.github.com/en/rest/teams/members?apiVersion=2022-11-28#add-or-update-team-membership-for-a-user
 	if !dryrun {
 		body, err := g.client.CallRestAPI(
@@ -1966,10 +2380,13 @@ func (g *GoliacRemoteImpl) UpdateTeamRemoveMember(ctx context.Context, dryrun bo
 			nil,
 		)
 		if err != nil {
-			logrus.Errorf("failed to remove team member: %v. %s", err, string(body))
+			return fmt.Errorf("failed to remove team member: %v. %s", err, string(body))
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	if team, ok := g.teams[teamslug]; ok {
 		members := team.Members
 		found := false
@@ -1983,9 +2400,10 @@ func (g *GoliacRemoteImpl) UpdateTeamRemoveMember(ctx context.Context, dryrun bo
 			g.teams[teamslug].Members = members
 		}
 	}
+	return nil
 }
 
-func (g *GoliacRemoteImpl) UpdateTeamSetParent(ctx context.Context, dryrun bool, teamslug string, parentTeam *int) {
+func (g *GoliacRemoteImpl) UpdateTeamSetParent(ctx context.Context, dryrun bool, teamslug string, parentTeam *int) error {
 	// set parent's team
 	// https://docs.github.com/en/rest/teams/teams?apiVersion=2022-11-28#update-a-team
 	if !dryrun {
@@ -1997,12 +2415,13 @@ func (g *GoliacRemoteImpl) UpdateTeamSetParent(ctx context.Context, dryrun bool,
 			map[string]interface{}{"parent_team_id": parentTeam},
 		)
 		if err != nil {
-			logrus.Errorf("failed to delete a team: %v. %s", err, string(body))
+			return fmt.Errorf("failed to set the parent team: %v. %s", err, string(body))
 		}
 	}
+	return nil
 }
 
-func (g *GoliacRemoteImpl) DeleteTeam(ctx context.Context, dryrun bool, teamslug string) {
+func (g *GoliacRemoteImpl) DeleteTeam(ctx context.Context, dryrun bool, teamslug string) error {
 	// delete team
 	// https://docs.github.com/en/rest/teams/teams?apiVersion=2022-11-28#delete-a-team
 	if !dryrun {
@@ -2014,16 +2433,20 @@ func (g *GoliacRemoteImpl) DeleteTeam(ctx context.Context, dryrun bool, teamslug
 			nil,
 		)
 		if err != nil {
-			logrus.Errorf("failed to delete a team: %v. %s", err, string(body))
+			return fmt.Errorf("failed to delete a team: %v. %s", err, string(body))
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	delete(g.teams, teamslug)
 	for name, slug := range g.teamSlugByName {
 		if slug == teamslug {
 			delete(g.teamSlugByName, name)
 		}
 	}
+	return nil
 }
 
 type CreateRepositoryResponse struct {
@@ -2038,9 +2461,11 @@ boolProperties are:
 - allow_auto_merge
 - delete_branch_on_merge
 - allow_update_branch
-- ...
+- allow_merge_commit, allow_rebase_merge, allow_squash_merge
+- allow_forking, web_commit_signoff_required
+- has_issues, has_wiki, has_projects, has_discussions
 */
-func (g *GoliacRemoteImpl) CreateRepository(ctx context.Context, dryrun bool, reponame string, description string, writers []string, readers []string, boolProperties map[string]bool) {
+func (g *GoliacRemoteImpl) CreateRepository(ctx context.Context, dryrun bool, reponame string, description string, writers []string, readers []string, boolProperties map[string]bool) error {
 	repoId := 0
 	repoRefId := reponame
 	// create repository
@@ -2062,16 +2487,14 @@ func (g *GoliacRemoteImpl) CreateRepository(ctx context.Context, dryrun bool, re
 			props,
 		)
 		if err != nil {
-			logrus.Errorf("failed to create repository: %v. %s", err, string(body))
-			return
+			return fmt.Errorf("failed to create repository: %v. %s", err, string(body))
 		}
 
 		// get the repo id
 		var resp CreateRepositoryResponse
 		err = json.Unmarshal(body, &resp)
 		if err != nil {
-			logrus.Errorf("failed to read the create repository action response: %v", err)
-			return
+			return fmt.Errorf("failed to read the create repository action response: %v", err)
 		}
 		repoId = resp.Id
 		repoRefId = resp.NodeId
@@ -2079,13 +2502,16 @@ func (g *GoliacRemoteImpl) CreateRepository(ctx context.Context, dryrun bool, re
 
 	// update the repositories list
 	newRepo := &GithubRepository{
-		Name:           reponame,
-		Id:             repoId,
-		RefId:          repoRefId,
-		BoolProperties: boolProperties,
+		Name:             reponame,
+		Id:               repoId,
+		RefId:            repoRefId,
+		BoolProperties:   boolProperties,
+		StringProperties: map[string]string{"description": description, "visibility": visibilityFromPrivate(boolProperties["private"])},
 	}
+	g.actionMutex.Lock()
 	g.repositories[reponame] = newRepo
 	g.repositoriesByRefId[repoRefId] = newRepo
+	g.actionMutex.Unlock()
 
 	// add members
 	for _, reader := range readers {
@@ -2099,11 +2525,11 @@ func (g *GoliacRemoteImpl) CreateRepository(ctx context.Context, dryrun bool, re
 				map[string]interface{}{"permission": "pull"},
 			)
 			if err != nil {
-				logrus.Errorf("failed to create repository (and add members): %v. %s", err, string(body))
-				return
+				return fmt.Errorf("failed to create repository (and add members): %v. %s", err, string(body))
 			}
 		}
 
+		g.actionMutex.Lock()
 		teamsRepos := g.teamRepos[reader]
 		if teamsRepos == nil {
 			teamsRepos = make(map[string]*GithubTeamRepo)
@@ -2113,6 +2539,7 @@ func (g *GoliacRemoteImpl) CreateRepository(ctx context.Context, dryrun bool, re
 			Permission: "READ",
 		}
 		g.teamRepos[reader] = teamsRepos
+		g.actionMutex.Unlock()
 	}
 	for _, writer := range writers {
 		// https://docs.github.com/en/rest/teams/teams?apiVersion=2022-11-28#add-or-update-team-repository-permissions
@@ -2125,10 +2552,11 @@ func (g *GoliacRemoteImpl) CreateRepository(ctx context.Context, dryrun bool, re
 				map[string]interface{}{"permission": "push"},
 			)
 			if err != nil {
-				logrus.Errorf("failed to create repository (and add members): %v. %s", err, string(body))
+				return fmt.Errorf("failed to create repository (and add members): %v. %s", err, string(body))
 			}
 		}
 
+		g.actionMutex.Lock()
 		teamsRepos := g.teamRepos[writer]
 		if teamsRepos == nil {
 			teamsRepos = make(map[string]*GithubTeamRepo)
@@ -2138,10 +2566,12 @@ func (g *GoliacRemoteImpl) CreateRepository(ctx context.Context, dryrun bool, re
 			Permission: "WRITE",
 		}
 		g.teamRepos[writer] = teamsRepos
+		g.actionMutex.Unlock()
 	}
+	return nil
 }
 
-func (g *GoliacRemoteImpl) UpdateRepositoryAddTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) {
+func (g *GoliacRemoteImpl) UpdateRepositoryAddTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
 	// update member
 	// https://docs.github.com/en/rest/teams/teams?apiVersion=2022-11-28#add-or-update-team-repository-permissions
 	if !dryrun {
@@ -2153,10 +2583,13 @@ func (g *GoliacRemoteImpl) UpdateRepositoryAddTeamAccess(ctx context.Context, dr
 			map[string]interface{}{"permission": permission},
 		)
 		if err != nil {
-			logrus.Errorf("failed to add team access: %v. %s", err, string(body))
+			return fmt.Errorf("failed to add team access: %v. %s", err, string(body))
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	teamsRepos := g.teamRepos[teamslug]
 	if teamsRepos == nil {
 		teamsRepos = make(map[string]*GithubTeamRepo)
@@ -2170,9 +2603,10 @@ func (g *GoliacRemoteImpl) UpdateRepositoryAddTeamAccess(ctx context.Context, dr
 		Permission: rPermission,
 	}
 	g.teamRepos[teamslug] = teamsRepos
+	return nil
 }
 
-func (g *GoliacRemoteImpl) UpdateRepositoryUpdateTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) {
+func (g *GoliacRemoteImpl) UpdateRepositoryUpdateTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
 	// update member
 	// https://docs.github.com/en/rest/teams/teams?apiVersion=2022-11-28#add-or-update-team-repository-permissions
 	if !dryrun {
@@ -2184,10 +2618,13 @@ func (g *GoliacRemoteImpl) UpdateRepositoryUpdateTeamAccess(ctx context.Context,
 			map[string]interface{}{"permission": permission},
 		)
 		if err != nil {
-			logrus.Errorf("failed to add team access: %v. %s", err, string(body))
+			return fmt.Errorf("failed to add team access: %v. %s", err, string(body))
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	teamsRepos := g.teamRepos[teamslug]
 	if teamsRepos == nil {
 		teamsRepos = make(map[string]*GithubTeamRepo)
@@ -2201,9 +2638,10 @@ func (g *GoliacRemoteImpl) UpdateRepositoryUpdateTeamAccess(ctx context.Context,
 		Permission: rPermission,
 	}
 	g.teamRepos[teamslug] = teamsRepos
+	return nil
 }
 
-func (g *GoliacRemoteImpl) UpdateRepositoryRemoveTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string) {
+func (g *GoliacRemoteImpl) UpdateRepositoryRemoveTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string) error {
 	// delete member
 	// https://docs.github.com/en/rest/teams/teams?apiVersion=2022-11-28#remove-a-repository-from-a-team
 	if !dryrun {
@@ -2215,14 +2653,18 @@ func (g *GoliacRemoteImpl) UpdateRepositoryRemoveTeamAccess(ctx context.Context,
 			nil,
 		)
 		if err != nil {
-			logrus.Errorf("failed to remove team access: %. %s", err, string(body))
+			return fmt.Errorf("failed to remove team access: %v. %s", err, string(body))
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	teamsRepos := g.teamRepos[teamslug]
 	if teamsRepos != nil {
 		delete(g.teamRepos[teamslug], reponame)
 	}
+	return nil
 }
 
 /*
@@ -2232,8 +2674,11 @@ Used for
 - delete_branch_on_merge
 - allow_update_branch
 - archived
+- allow_merge_commit, allow_rebase_merge, allow_squash_merge
+- allow_forking, web_commit_signoff_required
+- has_issues, has_wiki, has_projects, has_discussions
 */
-func (g *GoliacRemoteImpl) UpdateRepositoryUpdateBoolProperty(ctx context.Context, dryrun bool, reponame string, propertyName string, propertyValue bool) {
+func (g *GoliacRemoteImpl) UpdateRepositoryUpdateBoolProperty(ctx context.Context, dryrun bool, reponame string, propertyName string, propertyValue bool) error {
 	// https://docs.github.com/en/rest/repos/repos?apiVersion=2022-11-28#update-a-repository
 	if !dryrun {
 		body, err := g.client.CallRestAPI(
@@ -2244,16 +2689,90 @@ func (g *GoliacRemoteImpl) UpdateRepositoryUpdateBoolProperty(ctx context.Contex
 			map[string]interface{}{propertyName: propertyValue},
 		)
 		if err != nil {
-			logrus.Errorf("failed to update repository %s setting: %v. %s", propertyName, err, string(body))
+			return fmt.Errorf("failed to update repository %s setting: %v. %s", propertyName, err, string(body))
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	if repo, ok := g.repositories[reponame]; ok {
 		repo.BoolProperties[propertyName] = propertyValue
 	}
+	return nil
+}
+
+/*
+Used for
+- description
+- homepage
+- default_branch
+- squash_merge_commit_title, squash_merge_commit_message
+- merge_commit_title, merge_commit_message
+- visibility (public, private or internal)
+*/
+func (g *GoliacRemoteImpl) UpdateRepositoryUpdateStringProperties(ctx context.Context, dryrun bool, reponame string, properties map[string]string) error {
+	// https://docs.github.com/en/rest/repos/repos?apiVersion=2022-11-28#update-a-repository
+	if !dryrun {
+		props := make(map[string]interface{})
+		for k, v := range properties {
+			props[k] = v
+		}
+		body, err := g.client.CallRestAPI(
+			ctx,
+			fmt.Sprintf("repos/%s/%s", config.Config.GithubAppOrganization, reponame),
+			"",
+			"PATCH",
+			props,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update repository %s settings: %v. %s", reponame, err, string(body))
+		}
+	}
+
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
+	if repo, ok := g.repositories[reponame]; ok {
+		if repo.StringProperties == nil {
+			repo.StringProperties = make(map[string]string)
+		}
+		for k, v := range properties {
+			repo.StringProperties[k] = v
+		}
+		// an internal repository is private too
+		if visibility, ok := properties["visibility"]; ok && repo.BoolProperties != nil {
+			repo.BoolProperties["private"] = visibility != "public"
+		}
+	}
+	return nil
+}
+
+func (g *GoliacRemoteImpl) UpdateRepositorySetTopics(ctx context.Context, dryrun bool, reponame string, topics []string) error {
+	// https://docs.github.com/en/rest/repos/repos?apiVersion=2022-11-28#replace-all-repository-topics
+	if !dryrun {
+		body, err := g.client.CallRestAPI(
+			ctx,
+			fmt.Sprintf("repos/%s/%s/topics", config.Config.GithubAppOrganization, reponame),
+			"",
+			"PUT",
+			map[string]interface{}{"names": topics},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to set repository topics: %v. %s", err, string(body))
+		}
+	}
+
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
+	if repo, ok := g.repositories[reponame]; ok {
+		repo.Topics = sortedStrings(topics)
+	}
+	return nil
 }
 
-func (g *GoliacRemoteImpl) UpdateRepositorySetExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string, permission string) {
+func (g *GoliacRemoteImpl) UpdateRepositorySetExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string, permission string) error {
 	// https://docs.github.com/en/rest/collaborators/collaborators?apiVersion=2022-11-28#add-a-repository-collaborator
 	if !dryrun {
 		body, err := g.client.CallRestAPI(
@@ -2264,10 +2783,13 @@ func (g *GoliacRemoteImpl) UpdateRepositorySetExternalUser(ctx context.Context,
 			map[string]interface{}{"permission": permission},
 		)
 		if err != nil {
-			logrus.Errorf("failed to set repository collaborator: %v. %s", err, string(body))
+			return fmt.Errorf("failed to set repository collaborator: %v. %s", err, string(body))
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	if repo, ok := g.repositories[reponame]; ok {
 		if permission == "push" {
 			repo.ExternalUsers[githubid] = "WRITE"
@@ -2275,9 +2797,10 @@ func (g *GoliacRemoteImpl) UpdateRepositorySetExternalUser(ctx context.Context,
 			repo.ExternalUsers[githubid] = "READ"
 		}
 	}
+	return nil
 }
 
-func (g *GoliacRemoteImpl) updateRepositoryRemoveUser(ctx context.Context, dryrun bool, reponame string, githubid string) {
+func (g *GoliacRemoteImpl) updateRepositoryRemoveUser(ctx context.Context, dryrun bool, reponame string, githubid string) error {
 	// https://docs.github.com/en/rest/collaborators/collaborators?apiVersion=2022-11-28#remove-a-repository-collaborator
 	if !dryrun {
 		body, err := g.client.CallRestAPI(
@@ -2288,24 +2811,28 @@ func (g *GoliacRemoteImpl) updateRepositoryRemoveUser(ctx context.Context, dryru
 			nil,
 		)
 		if err != nil {
-			logrus.Errorf("failed to remove repository collaborator: %v. %s", err, string(body))
+			return fmt.Errorf("failed to remove repository collaborator: %v. %s", err, string(body))
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	if repo, ok := g.repositories[reponame]; ok {
 		delete(repo.ExternalUsers, githubid)
 	}
+	return nil
 }
 
-func (g *GoliacRemoteImpl) UpdateRepositoryRemoveExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) {
-	g.updateRepositoryRemoveUser(ctx, dryrun, reponame, githubid)
+func (g *GoliacRemoteImpl) UpdateRepositoryRemoveExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error {
+	return g.updateRepositoryRemoveUser(ctx, dryrun, reponame, githubid)
 }
 
-func (g *GoliacRemoteImpl) UpdateRepositoryRemoveInternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) {
-	g.updateRepositoryRemoveUser(ctx, dryrun, reponame, githubid)
+func (g *GoliacRemoteImpl) UpdateRepositoryRemoveInternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error {
+	return g.updateRepositoryRemoveUser(ctx, dryrun, reponame, githubid)
 }
 
-func (g *GoliacRemoteImpl) DeleteRepository(ctx context.Context, dryrun bool, reponame string) {
+func (g *GoliacRemoteImpl) DeleteRepository(ctx context.Context, dryrun bool, reponame string) error {
 	// delete repo
 	// https://docs.github.com/en/rest/repos/repos?apiVersion=2022-11-28#delete-a-repository
 	if !dryrun {
@@ -2317,18 +2844,22 @@ func (g *GoliacRemoteImpl) DeleteRepository(ctx context.Context, dryrun bool, re
 			nil,
 		)
 		if err != nil {
-			logrus.Errorf("failed to delete repository: %v. %s", err, string(body))
+			return fmt.Errorf("failed to delete repository: %v. %s", err, string(body))
 		}
 	}
 
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
 	// update the repositories list
 	if r, ok := g.repositories[reponame]; ok {
 		delete(g.repositoriesByRefId, r.RefId)
 		delete(g.repositories, reponame)
 	}
 
+	return nil
 }
-func (g *GoliacRemoteImpl) RenameRepository(ctx context.Context, dryrun bool, reponame string, newname string) {
+func (g *GoliacRemoteImpl) RenameRepository(ctx context.Context, dryrun bool, reponame string, newname string) error {
 	// update repository
 	// https://docs.github.com/fr/rest/repos/repos?apiVersion=2022-11-28#update-a-repository
 	if !dryrun {
@@ -2340,10 +2871,12 @@ func (g *GoliacRemoteImpl) RenameRepository(ctx context.Context, dryrun bool, re
 			map[string]interface{}{"name": newname},
 		)
 		if err != nil {
-			logrus.Errorf("failed to rename the repository %s (to %s): %v. %s", reponame, newname, err, string(body))
+			return fmt.Errorf("failed to rename the repository %s (to %s): %v. %s", reponame, newname, err, string(body))
 		}
 
 		// update the repositories list
+		g.actionMutex.Lock()
+		defer g.actionMutex.Unlock()
 		if r, ok := g.repositories[reponame]; ok {
 			delete(g.repositoriesByRefId, r.RefId)
 			delete(g.repositories, reponame)
@@ -2362,11 +2895,18 @@ func (g *GoliacRemoteImpl) RenameRepository(ctx context.Context, dryrun bool, re
 			}
 		}
 	}
+	return nil
 }
 func (g *GoliacRemoteImpl) Begin(dryrun bool) {
 }
 func (g *GoliacRemoteImpl) Rollback(dryrun bool, err error) {
 }
 func (g *GoliacRemoteImpl) Commit(ctx context.Context, dryrun bool) error {
+	// the cache has been updated with the changes applied: let's persist it
+	if !dryrun && config.Config.GithubCacheSnapshotFile != "" {
+		if err := g.SaveSnapshot(config.Config.GithubCacheSnapshotFile); err != nil {
+			logrus.Warn(err)
+		}
+	}
 	return nil
 }
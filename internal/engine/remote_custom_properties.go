@@ -0,0 +1,313 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+ * GithubCustomProperty is the definition (the schema) of an organization custom property
+ */
+type GithubCustomProperty struct {
+	Name          string
+	ValueType     string   // string, single_select, multi_select, true_false
+	Required      bool     // a required property must have a default value
+	DefaultValue  []string // a single value, except for multi_select
+	AllowedValues []string // only for single_select and multi_select
+	Description   string
+}
+
+type restCustomProperty struct {
+	PropertyName  string      `json:"property_name"`
+	ValueType     string      `json:"value_type"`
+	Required      bool        `json:"required"`
+	DefaultValue  interface{} `json:"default_value"` // string, []string or null
+	AllowedValues []string    `json:"allowed_values"`
+	Description   string      `json:"description"`
+}
+
+type restCustomPropertyValue struct {
+	PropertyName string      `json:"property_name"`
+	Value        interface{} `json:"value"` // string, []string or null
+}
+
+/*
+ * fromRestCustomPropertyValue converts a custom property value (a string, a list of strings or null)
+ */
+func fromRestCustomPropertyValue(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := []string{}
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+/*
+ * toRestCustomPropertyValue is the reverse of fromRestCustomPropertyValue.
+ * Only multi_select properties take a list of values, and an empty value is null
+ */
+func toRestCustomPropertyValue(valueType string, value []string) interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+	if valueType == "multi_select" || len(value) > 1 {
+		return value
+	}
+	return value[0]
+}
+
+func (g *GoliacRemoteImpl) CustomProperties(ctx context.Context) map[string]*GithubCustomProperty {
+	if time.Now().After(g.ttlExpireProperties) && remoteLoadAllowed(ctx) {
+		properties, err := g.loadCustomProperties(ctx)
+		if err == nil {
+			g.customProperties = properties
+			g.ttlExpireProperties = time.Now().Add(time.Duration(config.Config.GithubCacheTTL) * time.Second)
+		}
+		g.customPropertiesErr = err
+	}
+	return g.customProperties
+}
+
+/*
+ * CustomPropertiesError tells if we don't know the custom properties of the organization
+ * (older GHES versions, missing permission, ...): in this case they are not reconciled,
+ * else we would try to create the existing properties and set the values again
+ */
+func (g *GoliacRemoteImpl) CustomPropertiesError() error {
+	if g.customPropertiesErr != nil {
+		return g.customPropertiesErr
+	}
+	return g.propertyValuesErr
+}
+
+func (g *GoliacRemoteImpl) loadCustomProperties(ctx context.Context) (map[string]*GithubCustomProperty, error) {
+	logrus.Debug("loading custom properties")
+	// https://docs.github.com/en/rest/orgs/custom-properties?apiVersion=2022-11-28#get-all-custom-properties-for-an-organization
+	body, err := g.client.CallRestAPI(ctx,
+		fmt.Sprintf("/orgs/%s/properties/schema", config.Config.GithubAppOrganization),
+		"",
+		"GET",
+		nil)
+	if err != nil {
+		return nil, fmt.Errorf("not able to list custom properties: %v. %s", err, string(body))
+	}
+
+	var schema []restCustomProperty
+	if err := json.Unmarshal(body, &schema); err != nil {
+		return nil, fmt.Errorf("not able to list custom properties: %v", err)
+	}
+
+	properties := make(map[string]*GithubCustomProperty)
+	for _, p := range schema {
+		properties[p.PropertyName] = &GithubCustomProperty{
+			Name:          p.PropertyName,
+			ValueType:     p.ValueType,
+			Required:      p.Required,
+			DefaultValue:  fromRestCustomPropertyValue(p.DefaultValue),
+			AllowedValues: p.AllowedValues,
+			Description:   p.Description,
+		}
+	}
+
+	countEntitiesFetched(ctx, "custom_properties", len(properties))
+	return properties, nil
+}
+
+/*
+ * loadCustomPropertyValues sets the custom properties values of the (already loaded) repositories
+ */
+func (g *GoliacRemoteImpl) loadCustomPropertyValues(ctx context.Context, repositories map[string]*GithubRepository) error {
+	type repositoryValues struct {
+		RepositoryName string                    `json:"repository_name"`
+		Properties     []restCustomPropertyValue `json:"properties"`
+	}
+
+	// https://docs.github.com/en/rest/orgs/custom-properties?apiVersion=2022-11-28#list-custom-property-values-for-organization-repositories
+	for page := 1; page <= FORLOOP_STOP; page++ {
+		body, err := g.client.CallRestAPI(ctx,
+			fmt.Sprintf("/orgs/%s/properties/values", config.Config.GithubAppOrganization),
+			fmt.Sprintf("page=%d&per_page=100", page),
+			"GET",
+			nil)
+		if err != nil {
+			return fmt.Errorf("not able to list custom properties values: %v. %s", err, string(body))
+		}
+
+		var values []repositoryValues
+		if err := json.Unmarshal(body, &values); err != nil {
+			return fmt.Errorf("not able to list custom properties values: %v", err)
+		}
+
+		for _, v := range values {
+			if repo, ok := repositories[v.RepositoryName]; ok {
+				repo.CustomProperties = make(map[string][]string)
+				for _, p := range v.Properties {
+					if value := fromRestCustomPropertyValue(p.Value); len(value) != 0 {
+						repo.CustomProperties[p.PropertyName] = value
+					}
+				}
+			}
+		}
+
+		if len(values) < 100 {
+			break
+		}
+	}
+	return nil
+}
+
+/*
+ * loadRepositoryCustomPropertyValues loads the custom properties values of a single repository
+ */
+func (g *GoliacRemoteImpl) loadRepositoryCustomPropertyValues(ctx context.Context, reponame string) (map[string][]string, error) {
+	// https://docs.github.com/en/rest/repos/custom-properties?apiVersion=2022-11-28#get-all-custom-property-values-for-a-repository
+	body, err := g.client.CallRestAPI(ctx,
+		fmt.Sprintf("/repos/%s/%s/properties/values", config.Config.GithubAppOrganization, reponame),
+		"",
+		"GET",
+		nil)
+	if err != nil {
+		return nil, fmt.Errorf("not able to get repository %s custom properties values: %v. %s", reponame, err, string(body))
+	}
+
+	var values []restCustomPropertyValue
+	if err := json.Unmarshal(body, &values); err != nil {
+		return nil, fmt.Errorf("not able to get repository %s custom properties values: %v", reponame, err)
+	}
+
+	properties := make(map[string][]string)
+	for _, p := range values {
+		if value := fromRestCustomPropertyValue(p.Value); len(value) != 0 {
+			properties[p.PropertyName] = value
+		}
+	}
+	return properties, nil
+}
+
+func (g *GoliacRemoteImpl) prepareCustomProperty(property *GithubCustomProperty) map[string]interface{} {
+	payload := map[string]interface{}{
+		"value_type":    property.ValueType,
+		"required":      property.Required,
+		"default_value": toRestCustomPropertyValue(property.ValueType, property.DefaultValue),
+		"description":   property.Description,
+	}
+	if property.ValueType == "single_select" || property.ValueType == "multi_select" {
+		payload["allowed_values"] = property.AllowedValues
+	} else {
+		payload["allowed_values"] = nil
+	}
+	return payload
+}
+
+func (g *GoliacRemoteImpl) setCustomProperty(ctx context.Context, dryrun bool, property *GithubCustomProperty) error {
+	// https://docs.github.com/en/rest/orgs/custom-properties?apiVersion=2022-11-28#create-or-update-a-custom-property-for-an-organization
+	if !dryrun {
+		body, err := g.client.CallRestAPI(
+			ctx,
+			fmt.Sprintf("/orgs/%s/properties/schema/%s", config.Config.GithubAppOrganization, property.Name),
+			"",
+			"PUT",
+			g.prepareCustomProperty(property),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to set custom property %s: %v. %s", property.Name, err, string(body))
+		}
+	}
+
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
+	g.customProperties[property.Name] = property
+	return nil
+}
+
+func (g *GoliacRemoteImpl) AddCustomProperty(ctx context.Context, dryrun bool, property *GithubCustomProperty) error {
+	return g.setCustomProperty(ctx, dryrun, property)
+}
+
+func (g *GoliacRemoteImpl) UpdateCustomProperty(ctx context.Context, dryrun bool, property *GithubCustomProperty) error {
+	return g.setCustomProperty(ctx, dryrun, property)
+}
+
+func (g *GoliacRemoteImpl) DeleteCustomProperty(ctx context.Context, dryrun bool, propertyname string) error {
+	// https://docs.github.com/en/rest/orgs/custom-properties?apiVersion=2022-11-28#remove-a-custom-property-for-an-organization
+	if !dryrun {
+		body, err := g.client.CallRestAPI(
+			ctx,
+			fmt.Sprintf("/orgs/%s/properties/schema/%s", config.Config.GithubAppOrganization, propertyname),
+			"",
+			"DELETE",
+			nil,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to remove custom property %s: %v. %s", propertyname, err, string(body))
+		}
+	}
+
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
+	delete(g.customProperties, propertyname)
+	// the values are removed from all the repositories
+	for _, repo := range g.repositories {
+		delete(repo.CustomProperties, propertyname)
+	}
+	return nil
+}
+
+func (g *GoliacRemoteImpl) UpdateRepositorySetCustomProperties(ctx context.Context, dryrun bool, reponame string, properties map[string][]string, valueTypes map[string]string) error {
+	// https://docs.github.com/en/rest/repos/custom-properties?apiVersion=2022-11-28#create-or-update-custom-property-values-for-a-repository
+	if !dryrun {
+		names := make([]string, 0, len(properties))
+		for name := range properties {
+			names = append(names, name)
+		}
+		values := []restCustomPropertyValue{}
+		for _, name := range sortedStrings(names) {
+			values = append(values, restCustomPropertyValue{
+				PropertyName: name,
+				Value:        toRestCustomPropertyValue(valueTypes[name], properties[name]),
+			})
+		}
+		body, err := g.client.CallRestAPI(
+			ctx,
+			fmt.Sprintf("/repos/%s/%s/properties/values", config.Config.GithubAppOrganization, reponame),
+			"",
+			"PATCH",
+			map[string]interface{}{"properties": values},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to set repository %s custom properties: %v. %s", reponame, err, string(body))
+		}
+	}
+
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
+	if repo, ok := g.repositories[reponame]; ok {
+		if repo.CustomProperties == nil {
+			repo.CustomProperties = make(map[string][]string)
+		}
+		for k, v := range properties {
+			if len(v) == 0 {
+				delete(repo.CustomProperties, k)
+			} else {
+				repo.CustomProperties[k] = v
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Alayacare/goliac/internal/observability"
+)
+
+/*
+ * FileGoliacRemoteImpl is a read-only GoliacRemote loaded from an exported
+ * organization snapshot (goliac snapshot export), to plan without any Github access.
+ * The executor operations are accepted in dryrun mode only
+ */
+type FileGoliacRemoteImpl struct {
+	path            string
+	users           map[string]string
+	repositories    map[string]*GithubRepository
+	teams           map[string]*GithubTeam
+	teamRepos       map[string]map[string]*GithubTeamRepo
+	teamSlugByName  map[string]string
+	rulesets        map[string]*GithubRuleSet
+	appIds          map[string]int
+	properties      map[string]*GithubCustomProperty
+	isEnterprise    bool
+	teamsRepository string
+}
+
+func NewFileGoliacRemoteImpl(path string) (*FileGoliacRemoteImpl, error) {
+	snapshot, err := ReadOrgSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+
+	remote := &FileGoliacRemoteImpl{
+		path:            path,
+		users:           make(map[string]string),
+		repositories:    make(map[string]*GithubRepository),
+		teams:           make(map[string]*GithubTeam),
+		teamRepos:       make(map[string]map[string]*GithubTeamRepo),
+		teamSlugByName:  make(map[string]string),
+		rulesets:        make(map[string]*GithubRuleSet),
+		appIds:          copyMap(snapshot.Apps),
+		properties:      make(map[string]*GithubCustomProperty),
+		isEnterprise:    snapshot.Enterprise,
+		teamsRepository: snapshot.TeamsRepository,
+	}
+	if remote.appIds == nil {
+		remote.appIds = make(map[string]int)
+	}
+
+	for _, u := range snapshot.Users {
+		remote.users[u.Login] = u.Role
+	}
+
+	teamIdBySlug := make(map[string]int)
+	for _, t := range snapshot.Teams {
+		teamIdBySlug[t.Slug] = t.Id
+	}
+	for _, t := range snapshot.Teams {
+		team := &GithubTeam{
+			Name:        t.Name,
+			Id:          t.Id,
+			Slug:        t.Slug,
+			Members:     append([]string{}, t.Members...),
+			Maintainers: append([]string{}, t.Maintainers...),
+		}
+		if parentId, ok := teamIdBySlug[t.Parent]; ok && t.Parent != "" {
+			team.ParentTeam = &parentId
+		}
+		remote.teams[t.Slug] = team
+		remote.teamSlugByName[t.Name] = t.Slug
+
+		repos := make(map[string]*GithubTeamRepo)
+		for _, r := range t.Repositories {
+			repos[r.Repository] = &GithubTeamRepo{Name: r.Repository, Permission: r.Permission}
+		}
+		remote.teamRepos[t.Slug] = repos
+	}
+
+	for _, r := range snapshot.Repositories {
+		repo := &GithubRepository{
+			Name:             r.Name,
+			Id:               r.Id,
+			RefId:            r.RefId,
+			BoolProperties:   copyMap(r.Properties),
+			StringProperties: copyMap(r.Settings),
+			Topics:           append([]string{}, r.Topics...),
+			CustomProperties: make(map[string][]string),
+			ExternalUsers:    make(map[string]string),
+			InternalUsers:    make(map[string]string),
+			RuleSets:         make(map[string]*GithubRuleSet),
+		}
+		if repo.BoolProperties == nil {
+			repo.BoolProperties = make(map[string]bool)
+		}
+		for name, value := range r.CustomProperties {
+			repo.CustomProperties[name] = append([]string{}, value...)
+		}
+		for _, c := range r.Collaborators {
+			if c.Outside {
+				repo.ExternalUsers[c.Login] = c.Permission
+			} else {
+				repo.InternalUsers[c.Login] = c.Permission
+			}
+		}
+		for _, rs := range r.Rulesets {
+			repo.RuleSets[rs.Name] = rs.toGithubRuleSet()
+		}
+		remote.repositories[r.Name] = repo
+	}
+
+	for _, rs := range snapshot.Rulesets {
+		remote.rulesets[rs.Name] = rs.toGithubRuleSet()
+	}
+
+	for _, cp := range snapshot.CustomProperties {
+		remote.properties[cp.Name] = &GithubCustomProperty{
+			Name:          cp.Name,
+			ValueType:     cp.ValueType,
+			Required:      cp.Required,
+			DefaultValue:  append([]string{}, cp.DefaultValue...),
+			AllowedValues: append([]string{}, cp.AllowedValues...),
+			Description:   cp.Description,
+		}
+	}
+
+	return remote, nil
+}
+
+func (f *FileGoliacRemoteImpl) Load(ctx context.Context, continueOnError bool) error {
+	return nil
+}
+func (f *FileGoliacRemoteImpl) FlushCache() {
+}
+func (f *FileGoliacRemoteImpl) FlushCacheUsersTeamsOnly() {
+}
+func (f *FileGoliacRemoteImpl) Users(ctx context.Context) map[string]string {
+	return f.users
+}
+func (f *FileGoliacRemoteImpl) TeamSlugByName(ctx context.Context) map[string]string {
+	return f.teamSlugByName
+}
+func (f *FileGoliacRemoteImpl) Teams(ctx context.Context, current bool) map[string]*GithubTeam {
+	return f.teams
+}
+func (f *FileGoliacRemoteImpl) Repositories(ctx context.Context) map[string]*GithubRepository {
+	return f.repositories
+}
+func (f *FileGoliacRemoteImpl) TeamRepositories(ctx context.Context) map[string]map[string]*GithubTeamRepo {
+	return f.teamRepos
+}
+func (f *FileGoliacRemoteImpl) RuleSets(ctx context.Context) map[string]*GithubRuleSet {
+	return f.rulesets
+}
+func (f *FileGoliacRemoteImpl) AppIds(ctx context.Context) map[string]int {
+	return f.appIds
+}
+func (f *FileGoliacRemoteImpl) CustomProperties(ctx context.Context) map[string]*GithubCustomProperty {
+	return f.properties
+}
+func (f *FileGoliacRemoteImpl) CustomPropertiesError() error {
+	return nil
+}
+func (f *FileGoliacRemoteImpl) RefreshUser(ctx context.Context, login string) error {
+	return nil
+}
+func (f *FileGoliacRemoteImpl) RefreshTeam(ctx context.Context, teamslug string) error {
+	return nil
+}
+func (f *FileGoliacRemoteImpl) RefreshRepository(ctx context.Context, reponame string) error {
+	return nil
+}
+func (f *FileGoliacRemoteImpl) RefreshRulesets(ctx context.Context) error {
+	return nil
+}
+func (f *FileGoliacRemoteImpl) IsEnterprise() bool {
+	return f.isEnterprise
+}
+
+/*
+ * TeamsRepository returns the name of the teams repository recorded in the
+ * snapshot (empty if it was unknown at export)
+ */
+func (f *FileGoliacRemoteImpl) TeamsRepository() string {
+	return f.teamsRepository
+}
+func (f *FileGoliacRemoteImpl) CountAssets(ctx context.Context) (int, error) {
+	return 0, nil
+}
+func (f *FileGoliacRemoteImpl) SetRemoteObservability(feedback observability.RemoteObservability) {
+}
+
+/*
+ * the snapshot is never changed: only dryrun operations are accepted
+ */
+func (f *FileGoliacRemoteImpl) readOnly(dryrun bool) error {
+	if dryrun {
+		return nil
+	}
+	return fmt.Errorf("the remote loaded from the snapshot %s is read-only", f.path)
+}
+
+func (f *FileGoliacRemoteImpl) AddUserToOrg(ctx context.Context, dryrun bool, ghuserid string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) RemoveUserFromOrg(ctx context.Context, dryrun bool, ghuserid string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) CreateTeam(ctx context.Context, dryrun bool, teamname string, description string, parentTeam *int, members []string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateTeamAddMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateTeamUpdateMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateTeamRemoveMember(ctx context.Context, dryrun bool, teamslug string, username string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateTeamSetParent(ctx context.Context, dryrun bool, teamslug string, parentTeam *int) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) DeleteTeam(ctx context.Context, dryrun bool, teamslug string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) CreateRepository(ctx context.Context, dryrun bool, reponame string, descrition string, writers []string, readers []string, boolProperties map[string]bool) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateRepositoryUpdateBoolProperty(ctx context.Context, dryrun bool, reponame string, propertyName string, propertyValue bool) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateRepositoryUpdateStringProperties(ctx context.Context, dryrun bool, reponame string, properties map[string]string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateRepositorySetTopics(ctx context.Context, dryrun bool, reponame string, topics []string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateRepositorySetCustomProperties(ctx context.Context, dryrun bool, reponame string, properties map[string][]string, valueTypes map[string]string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateRepositoryAddTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateRepositoryUpdateTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateRepositoryRemoveTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) AddRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) DeleteRuleset(ctx context.Context, dryrun bool, rulesetid int) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) AddRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) DeleteRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, rulesetid int) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) AddCustomProperty(ctx context.Context, dryrun bool, property *GithubCustomProperty) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateCustomProperty(ctx context.Context, dryrun bool, property *GithubCustomProperty) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) DeleteCustomProperty(ctx context.Context, dryrun bool, propertyname string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateRepositorySetExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string, permission string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateRepositoryRemoveExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) UpdateRepositoryRemoveInternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) DeleteRepository(ctx context.Context, dryrun bool, reponame string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) RenameRepository(ctx context.Context, dryrun bool, reponame string, newname string) error {
+	return f.readOnly(dryrun)
+}
+func (f *FileGoliacRemoteImpl) Begin(dryrun bool) {
+}
+func (f *FileGoliacRemoteImpl) Rollback(dryrun bool, err error) {
+}
+func (f *FileGoliacRemoteImpl) Commit(ctx context.Context, dryrun bool) error {
+	return f.readOnly(dryrun)
+}
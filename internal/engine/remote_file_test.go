@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileGoliacRemote(t *testing.T) {
+
+	t.Run("happy path: the remote is loaded back from an exported snapshot", func(t *testing.T) {
+		exported := NewOrgSnapshot(context.TODO(), fixtureSnapshotRemote(), "myorg")
+		content, err := exported.ToYAML()
+		assert.Nil(t, err)
+		path := filepath.Join(t.TempDir(), "org.yaml")
+		assert.Nil(t, os.WriteFile(path, content, 0644))
+
+		remote, err := NewFileGoliacRemoteImpl(path)
+		assert.Nil(t, err)
+		ctx := context.TODO()
+		assert.Nil(t, remote.Load(ctx, false))
+
+		assert.Equal(t, 3, len(remote.Users(ctx)))
+		assert.Equal(t, "team1", remote.TeamSlugByName(ctx)["team1"])
+		assert.Equal(t, 1, *remote.Teams(ctx, false)["team1"].ParentTeam)
+		assert.Nil(t, remote.Teams(ctx, false)["parent"].ParentTeam)
+		assert.Equal(t, "WRITE", remote.TeamRepositories(ctx)["team1"]["repo1"].Permission)
+		assert.Equal(t, "READ", remote.Repositories(ctx)["repo1"].ExternalUsers["outside1"])
+		assert.Equal(t, 1, remote.RuleSets(ctx)["default"].Rules["pull_request"].RequiredApprovingReviewCount)
+		assert.Equal(t, 42, remote.AppIds(ctx)["goliac-app"])
+		assert.Equal(t, []string{"bronze"}, remote.CustomProperties(ctx)["tier"].DefaultValue)
+		assert.Equal(t, []string{"gold"}, remote.Repositories(ctx)["repo1"].CustomProperties["tier"])
+		assert.True(t, remote.IsEnterprise())
+
+		// the same organization is exported again
+		again := NewOrgSnapshot(ctx, remote, "myorg")
+		again.ExportedAt = exported.ExportedAt
+		assert.Equal(t, exported, again)
+	})
+
+	t.Run("not happy path: the remote is read-only", func(t *testing.T) {
+		content, _ := NewOrgSnapshot(context.TODO(), fixtureSnapshotRemote(), "myorg").ToJSON()
+		path := filepath.Join(t.TempDir(), "org.json")
+		assert.Nil(t, os.WriteFile(path, content, 0644))
+
+		remote, err := NewFileGoliacRemoteImpl(path)
+		assert.Nil(t, err)
+		assert.Nil(t, remote.DeleteTeam(context.TODO(), true, "team1"))
+		assert.NotNil(t, remote.DeleteTeam(context.TODO(), false, "team1"))
+		assert.Equal(t, 2, len(remote.Teams(context.TODO(), false)))
+
+		_, err = NewFileGoliacRemoteImpl(filepath.Join(t.TempDir(), "unknown.json"))
+		assert.NotNil(t, err)
+	})
+}
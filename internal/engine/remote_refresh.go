@@ -0,0 +1,375 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+ * The Refresh* functions update the cache for a single entity
+ * (usually after receiving a Github webhook event about it),
+ * without waiting for the GithubCacheTTL to expire
+ */
+
+const getRepository = `
+query getRepository($orgLogin: String!, $name: String!) {
+    repository(owner: $orgLogin, name: $name) {
+      name
+		  id
+		  databaseId
+		  updatedAt
+      isArchived
+      isPrivate
+      visibility
+		  autoMergeAllowed
+      deleteBranchOnMerge
+      allowUpdateBranch
+      mergeCommitAllowed
+      rebaseMergeAllowed
+      squashMergeAllowed
+      forkingAllowed
+      webCommitSignoffRequired
+      hasIssuesEnabled
+      hasWikiEnabled
+      hasProjectsEnabled
+      hasDiscussionsEnabled
+      description
+      homepageUrl
+      defaultBranchRef {
+        name
+      }
+      squashMergeCommitTitle
+      squashMergeCommitMessage
+      mergeCommitTitle
+      mergeCommitMessage
+      repositoryTopics(first: 20) {
+        nodes {
+          topic {
+            name
+          }
+        }
+      }
+      directCollaborators: collaborators(affiliation: DIRECT, first: 100) {
+        edges {
+          node {
+            login
+          }
+          permission
+        }
+      }
+      outsideCollaborators: collaborators(affiliation: OUTSIDE, first: 100) {
+        edges {
+          node {
+            login
+          }
+          permission
+        }
+      }
+      rulesets(first: 20) {
+        nodes {
+          databaseId
+          source {
+            ... on Repository {
+				  name
+            }
+          }
+          name
+          target
+          enforcement
+          conditions {
+            refName {
+              include
+              exclude
+            }
+          }
+          rules(first:20) {
+            nodes {
+              parameters {
+                ... on PullRequestParameters {
+                  dismissStaleReviewsOnPush
+                  requireCodeOwnerReview
+                  requiredApprovingReviewCount
+                  requiredReviewThreadResolution
+                  requireLastPushApproval
+                }
+              }
+              type
+            }
+          }
+        }
+      }
+    }
+  }
+`
+
+type GraplQLRepository struct {
+	Data struct {
+		Repository *GraphQLRepository `json:"repository"`
+	}
+	Errors []struct {
+		Path       []interface{} `json:"path"`
+		Type       string        `json:"type"` // like NOT_FOUND or RATE_LIMITED
+		Extensions struct {
+			Code         string
+			ErrorMessage string
+		} `json:"extensions"`
+		Message string
+	} `json:"errors"`
+}
+
+/*
+ * RefreshRepository reloads a repository (properties, collaborators, rulesets and teams access).
+ * If the repository doesn't exist anymore, it is removed from the cache
+ */
+func (g *GoliacRemoteImpl) RefreshRepository(ctx context.Context, reponame string) error {
+	logrus.Debugf("refreshing repository %s", reponame)
+	variables := make(map[string]interface{})
+	variables["orgLogin"] = config.Config.GithubAppOrganization
+	variables["name"] = reponame
+
+	data, err := g.client.QueryGraphQLAPI(ctx, getRepository, variables)
+	if err != nil {
+		return err
+	}
+	var gResult GraplQLRepository
+	err = json.Unmarshal(data, &gResult)
+	if err != nil {
+		return err
+	}
+
+	if gResult.Data.Repository == nil {
+		for _, e := range gResult.Errors {
+			if e.Type != "NOT_FOUND" {
+				return fmt.Errorf("graphql error on RefreshRepository: %v (%v)", e.Message, e.Path)
+			}
+		}
+		if len(gResult.Errors) == 0 {
+			return fmt.Errorf("not able to refresh repository %s: no repository returned", reponame)
+		}
+		logrus.Debugf("repository %s not found: %v", reponame, gResult.Errors[0].Message)
+
+		g.actionMutex.Lock()
+		defer g.actionMutex.Unlock()
+		g.evictRepository(reponame)
+		return nil
+	}
+
+	repo := g.fromGraphQLToGithubRepository(gResult.Data.Repository)
+	properties, propertiesErr := g.loadRepositoryCustomPropertyValues(ctx, repo.Name)
+	if propertiesErr != nil {
+		logrus.Warnf("not able to load the repository %s custom properties: %v", repo.Name, propertiesErr)
+	}
+	teamsrepo, err := g.loadTeamRepos(ctx, repo.Name)
+	if err != nil {
+		return err
+	}
+
+	g.actionMutex.Lock()
+	defer g.actionMutex.Unlock()
+
+	if propertiesErr == nil {
+		repo.CustomProperties = properties
+	} else if previous, ok := g.repositories[reponame]; ok {
+		// better the values we had than none (that would be set again)
+		repo.CustomProperties = previous.CustomProperties
+	}
+	g.evictRepository(reponame)
+	g.repositories[repo.Name] = repo
+	g.repositoriesByRefId[repo.RefId] = repo
+	for teamslug, teamrepo := range teamsrepo {
+		if _, ok := g.teamRepos[teamslug]; !ok {
+			g.teamRepos[teamslug] = make(map[string]*GithubTeamRepo)
+		}
+		g.teamRepos[teamslug][repo.Name] = teamrepo
+	}
+	g.teamReposFreshness[repo.Name] = newEntityFreshness(repo.UpdatedAt)
+	countEntitiesFetched(ctx, "repositories", 1)
+	countEntitiesFetched(ctx, "teams_repos", 1)
+	return nil
+}
+
+/*
+ * evictRepository removes a repository from the cache (actionMutex must be held)
+ */
+func (g *GoliacRemoteImpl) evictRepository(reponame string) {
+	if previous, ok := g.repositories[reponame]; ok {
+		delete(g.repositoriesByRefId, previous.RefId)
+		delete(g.repositories, reponame)
+	}
+	for _, repos := range g.teamRepos {
+		delete(repos, reponame)
+	}
+	delete(g.teamReposFreshness, reponame)
+}
+
+const getTeam = `
+query getTeam($orgLogin: String!, $teamSlug: String!) {
+    organization(login: $orgLogin) {
+      team(slug: $teamSlug) {
+        name
+        databaseId
+        slug
+        updatedAt
+        parentTeam {
+          databaseId
+        }
+      }
+    }
+  }
+`
+
+type GraplQLTeam struct {
+	Data struct {
+		Organization struct {
+			Team *struct {
+				Name       string
+				DatabaseId int `json:"databaseId"`
+				Slug       string
+				UpdatedAt  string `json:"updatedAt"`
+				ParentTeam struct {
+					DatabaseId int `json:"databaseId"`
+				} `json:"parentTeam"`
+			} `json:"team"`
+		}
+	}
+	Errors []struct {
+		Path       []interface{} `json:"path"`
+		Extensions struct {
+			Code         string
+			ErrorMessage string
+		} `json:"extensions"`
+		Message string
+	} `json:"errors"`
+}
+
+/*
+ * RefreshTeam reloads a team (name, parent and members).
+ * If the team doesn't exist anymore, it is removed from the cache
+ */
+func (g *GoliacRemoteImpl) RefreshTeam(ctx context.Context, teamslug string) error {
+	logrus.Debugf("refreshing team %s", teamslug)
+	variables := make(map[string]interface{})
+	variables["orgLogin"] = config.Config.GithubAppOrganization
+	variables["teamSlug"] = teamslug
+
+	data, err := g.client.QueryGraphQLAPI(ctx, getTeam, variables)
+	if err != nil {
+		return err
+	}
+	var gResult GraplQLTeam
+	err = json.Unmarshal(data, &gResult)
+	if err != nil {
+		return err
+	}
+	if len(gResult.Errors) > 0 {
+		return fmt.Errorf("graphql error on RefreshTeam: %v (%v)", gResult.Errors[0].Message, gResult.Errors[0].Path)
+	}
+
+	g.loadTeamsMutex.Lock()
+	defer g.loadTeamsMutex.Unlock()
+
+	c := gResult.Data.Organization.Team
+	if c == nil {
+		if previous, ok := g.teams[teamslug]; ok {
+			delete(g.teamSlugByName, previous.Name)
+			delete(g.teams, teamslug)
+		}
+		delete(g.teamRepos, teamslug)
+		delete(g.teamMembersFreshness, teamslug)
+		return nil
+	}
+
+	team := &GithubTeam{
+		Name:      c.Name,
+		Id:        c.DatabaseId,
+		Slug:      c.Slug,
+		UpdatedAt: c.UpdatedAt,
+	}
+	if c.ParentTeam.DatabaseId != 0 {
+		parentId := c.ParentTeam.DatabaseId
+		team.ParentTeam = &parentId
+	}
+	if err := g.loadTeamsMembers(ctx, team); err != nil {
+		return err
+	}
+
+	// the team may have been renamed
+	for slug, t := range g.teams {
+		if t.Id == team.Id {
+			delete(g.teamSlugByName, t.Name)
+			delete(g.teams, slug)
+			delete(g.teamMembersFreshness, slug)
+			if slug != team.Slug {
+				if repos, ok := g.teamRepos[slug]; ok {
+					g.teamRepos[team.Slug] = repos
+					delete(g.teamRepos, slug)
+				}
+			}
+		}
+	}
+	g.teams[team.Slug] = team
+	g.teamSlugByName[team.Name] = team.Slug
+	g.teamMembersFreshness[team.Slug] = newEntityFreshness(team.UpdatedAt)
+	countEntitiesFetched(ctx, "teams", 1)
+	countEntitiesFetched(ctx, "teams_members", 1)
+	return nil
+}
+
+type OrgMembership struct {
+	State string `json:"state"` // active, pending
+	Role  string `json:"role"`  // admin, member
+}
+
+/*
+ * RefreshUser reloads the organization membership of a user.
+ * If the user is not (or not yet) a member, it is removed from the cache
+ */
+func (g *GoliacRemoteImpl) RefreshUser(ctx context.Context, login string) error {
+	logrus.Debugf("refreshing user %s", login)
+	// https://docs.github.com/en/rest/orgs/members?apiVersion=2022-11-28#get-organization-membership-for-a-user
+	body, err := g.client.CallRestAPI(ctx,
+		fmt.Sprintf("/orgs/%s/memberships/%s", config.Config.GithubAppOrganization, login),
+		"",
+		"GET",
+		nil)
+
+	var membership OrgMembership
+	if err != nil {
+		var notFound struct {
+			Message string `json:"message"`
+		}
+		if jsonErr := json.Unmarshal(body, &notFound); jsonErr != nil || notFound.Message != "Not Found" {
+			return err
+		}
+	} else if err := json.Unmarshal(body, &membership); err != nil {
+		return fmt.Errorf("not able to parse the membership of %s: %v", login, err)
+	}
+
+	switch {
+	case membership.State != "active":
+		delete(g.users, login)
+	case membership.Role == "admin":
+		g.users[login] = "ADMIN"
+	default:
+		g.users[login] = "MEMBER"
+	}
+	countEntitiesFetched(ctx, "users", 1)
+	return nil
+}
+
+/*
+ * RefreshRulesets reloads the organization rulesets
+ */
+func (g *GoliacRemoteImpl) RefreshRulesets(ctx context.Context) error {
+	logrus.Debug("refreshing rulesets")
+	rulesets, err := g.loadRulesets(ctx)
+	if err != nil {
+		return err
+	}
+	g.rulesets = rulesets
+	return nil
+}
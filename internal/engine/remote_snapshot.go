@@ -0,0 +1,214 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// to be increased each time the snapshot format (or the cached structures) change
+const REMOTE_SNAPSHOT_VERSION = 5
+
+/*
+ * remoteSnapshot is the on-disk version of the remote cache,
+ * used to restart without reloading everything from Github
+ */
+type remoteSnapshot struct {
+	Version      int             `json:"version"`
+	Organization string          `json:"organization"`
+	Checksum     string          `json:"checksum"` // sha256 of data
+	Data         json.RawMessage `json:"data"`
+}
+
+type remoteSnapshotData struct {
+	Users                 map[string]string                     `json:"users"`
+	Repositories          map[string]*GithubRepository          `json:"repositories"`
+	Teams                 map[string]*GithubTeam                `json:"teams"`
+	TeamRepos             map[string]map[string]*GithubTeamRepo `json:"team_repos"`
+	TeamSlugByName        map[string]string                     `json:"team_slug_by_name"`
+	Rulesets              map[string]*GithubRuleSet             `json:"rulesets"`
+	AppIds                map[string]int                        `json:"app_ids"`
+	CustomProperties      map[string]*GithubCustomProperty      `json:"custom_properties"`
+	CustomPropertiesError string                                `json:"custom_properties_error,omitempty"` // cf CustomPropertiesError
+	TtlExpireUsers        time.Time                             `json:"ttl_expire_users"`
+	TtlExpireRepositories time.Time                             `json:"ttl_expire_repositories"`
+	TtlExpireTeams        time.Time                             `json:"ttl_expire_teams"`
+	TtlExpireTeamsRepos   time.Time                             `json:"ttl_expire_teams_repos"`
+	TtlExpireRulesets     time.Time                             `json:"ttl_expire_rulesets"`
+	TtlExpireAppIds       time.Time                             `json:"ttl_expire_app_ids"`
+	TtlExpireProperties   time.Time                             `json:"ttl_expire_properties"`
+	TeamMembersFreshness  map[string]entityFreshness            `json:"team_members_freshness"`
+	TeamReposFreshness    map[string]entityFreshness            `json:"team_repos_freshness"`
+}
+
+/*
+ * SaveSnapshot writes the remote cache (and its TTLs) to disk
+ */
+func (g *GoliacRemoteImpl) SaveSnapshot(path string) error {
+	customPropertiesError := ""
+	if err := g.CustomPropertiesError(); err != nil {
+		customPropertiesError = err.Error()
+	}
+	g.loadTeamsMutex.Lock()
+	data, err := json.Marshal(&remoteSnapshotData{
+		Users:                 g.users,
+		Repositories:          g.repositories,
+		Teams:                 g.teams,
+		TeamRepos:             g.teamRepos,
+		TeamSlugByName:        g.teamSlugByName,
+		Rulesets:              g.rulesets,
+		AppIds:                g.appIds,
+		CustomProperties:      g.customProperties,
+		CustomPropertiesError: customPropertiesError,
+		TtlExpireUsers:        g.ttlExpireUsers,
+		TtlExpireRepositories: g.ttlExpireRepositories,
+		TtlExpireTeams:        g.ttlExpireTeams,
+		TtlExpireTeamsRepos:   g.ttlExpireTeamsRepos,
+		TtlExpireRulesets:     g.ttlExpireRulesets,
+		TtlExpireAppIds:       g.ttlExpireAppIds,
+		TtlExpireProperties:   g.ttlExpireProperties,
+		TeamMembersFreshness:  g.teamMembersFreshness,
+		TeamReposFreshness:    g.teamReposFreshness,
+	})
+	g.loadTeamsMutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("not able to serialize the remote snapshot: %v", err)
+	}
+
+	checksum := sha256.Sum256(data)
+	content, err := json.Marshal(&remoteSnapshot{
+		Version:      REMOTE_SNAPSHOT_VERSION,
+		Organization: config.Config.GithubAppOrganization,
+		Checksum:     hex.EncodeToString(checksum[:]),
+		Data:         data,
+	})
+	if err != nil {
+		return fmt.Errorf("not able to serialize the remote snapshot: %v", err)
+	}
+
+	// write and rename, to never leave a partial snapshot behind
+	tmpfile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("not able to write the remote snapshot: %v", err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write(content); err != nil {
+		tmpfile.Close()
+		return fmt.Errorf("not able to write the remote snapshot: %v", err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		return fmt.Errorf("not able to write the remote snapshot: %v", err)
+	}
+	if err := os.Rename(tmpfile.Name(), path); err != nil {
+		return fmt.Errorf("not able to write the remote snapshot: %v", err)
+	}
+
+	logrus.Debugf("remote snapshot saved to %s", path)
+	return nil
+}
+
+/*
+ * LoadSnapshot restores the remote cache (and its TTLs) from disk.
+ * The snapshot is ignored (and an error returned) if it was written by another
+ * version of the snapshot format, for another organization, or if it is corrupted
+ */
+func (g *GoliacRemoteImpl) LoadSnapshot(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("not able to read the remote snapshot: %v", err)
+	}
+
+	var snapshot remoteSnapshot
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return fmt.Errorf("not able to parse the remote snapshot: %v", err)
+	}
+	if snapshot.Version != REMOTE_SNAPSHOT_VERSION {
+		return fmt.Errorf("remote snapshot version %d is not supported (expected %d)", snapshot.Version, REMOTE_SNAPSHOT_VERSION)
+	}
+	if snapshot.Organization != config.Config.GithubAppOrganization {
+		return fmt.Errorf("remote snapshot is for the %s organization (expected %s)", snapshot.Organization, config.Config.GithubAppOrganization)
+	}
+	checksum := sha256.Sum256(snapshot.Data)
+	if hex.EncodeToString(checksum[:]) != snapshot.Checksum {
+		return fmt.Errorf("remote snapshot checksum mismatch")
+	}
+
+	var data remoteSnapshotData
+	if err := json.Unmarshal(snapshot.Data, &data); err != nil {
+		return fmt.Errorf("not able to parse the remote snapshot: %v", err)
+	}
+
+	g.loadTeamsMutex.Lock()
+	defer g.loadTeamsMutex.Unlock()
+
+	g.users = data.Users
+	g.repositories = data.Repositories
+	g.repositoriesByRefId = make(map[string]*GithubRepository)
+	for _, r := range data.Repositories {
+		g.repositoriesByRefId[r.RefId] = r
+	}
+	g.teams = data.Teams
+	g.teamRepos = data.TeamRepos
+	g.teamSlugByName = data.TeamSlugByName
+	g.rulesets = data.Rulesets
+	g.appIds = data.AppIds
+	g.customProperties = data.CustomProperties
+	g.customPropertiesErr = nil
+	g.propertyValuesErr = nil
+	if data.CustomPropertiesError != "" {
+		g.customPropertiesErr = errors.New(data.CustomPropertiesError)
+	}
+	g.ttlExpireUsers = data.TtlExpireUsers
+	g.ttlExpireRepositories = data.TtlExpireRepositories
+	g.ttlExpireTeams = data.TtlExpireTeams
+	g.ttlExpireTeamsRepos = data.TtlExpireTeamsRepos
+	g.ttlExpireRulesets = data.TtlExpireRulesets
+	g.ttlExpireAppIds = data.TtlExpireAppIds
+	g.ttlExpireProperties = data.TtlExpireProperties
+	g.teamMembersFreshness = data.TeamMembersFreshness
+	g.teamReposFreshness = data.TeamReposFreshness
+
+	// a nil map in the snapshot must not end up as a nil map in the cache
+	if g.users == nil {
+		g.users = make(map[string]string)
+	}
+	if g.repositories == nil {
+		g.repositories = make(map[string]*GithubRepository)
+	}
+	if g.teams == nil {
+		g.teams = make(map[string]*GithubTeam)
+	}
+	if g.teamRepos == nil {
+		g.teamRepos = make(map[string]map[string]*GithubTeamRepo)
+	}
+	if g.teamSlugByName == nil {
+		g.teamSlugByName = make(map[string]string)
+	}
+	if g.rulesets == nil {
+		g.rulesets = make(map[string]*GithubRuleSet)
+	}
+	if g.appIds == nil {
+		g.appIds = make(map[string]int)
+	}
+	if g.customProperties == nil {
+		g.customProperties = make(map[string]*GithubCustomProperty)
+	}
+	if g.teamMembersFreshness == nil {
+		g.teamMembersFreshness = make(map[string]entityFreshness)
+	}
+	if g.teamReposFreshness == nil {
+		g.teamReposFreshness = make(map[string]entityFreshness)
+	}
+
+	logrus.Infof("remote snapshot loaded from %s (%d repositories, %d teams, %d users)", path, len(g.repositories), len(g.teams), len(g.users))
+	return nil
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoteSnapshot(t *testing.T) {
+	fixtureRemote := func() *GoliacRemoteImpl {
+		remoteImpl := NewGoliacRemoteImpl(&GitHubClientIsEnterpriseMock{})
+		remoteImpl.users["user1"] = "ADMIN"
+		remoteImpl.repositories["repo1"] = &GithubRepository{
+			Name:           "repo1",
+			RefId:          "R_1",
+			BoolProperties: map[string]bool{"private": true},
+			ExternalUsers:  map[string]string{},
+			InternalUsers:  map[string]string{},
+			RuleSets:       map[string]*GithubRuleSet{},
+		}
+		parent := 12
+		remoteImpl.teams["team1"] = &GithubTeam{Name: "team1", Slug: "team1", Id: 1, Members: []string{"user1"}, ParentTeam: &parent}
+		remoteImpl.teamSlugByName["team1"] = "team1"
+		remoteImpl.teamRepos["team1"] = map[string]*GithubTeamRepo{"repo1": {Name: "repo1", Permission: "WRITE"}}
+		remoteImpl.ttlExpireRepositories = time.Now().Add(time.Hour)
+		remoteImpl.teamReposFreshness["repo1"] = newEntityFreshness("2024-01-01T00:00:00Z")
+		return remoteImpl
+	}
+
+	t.Run("happy path: save and load a snapshot", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "snapshot.json")
+		remoteImpl := fixtureRemote()
+		err := remoteImpl.SaveSnapshot(path)
+		assert.Nil(t, err)
+
+		restored := NewGoliacRemoteImpl(&GitHubClientIsEnterpriseMock{})
+		err = restored.LoadSnapshot(path)
+		assert.Nil(t, err)
+
+		assert.Equal(t, "ADMIN", restored.users["user1"])
+		assert.Equal(t, true, restored.repositories["repo1"].BoolProperties["private"])
+		assert.Equal(t, "repo1", restored.repositoriesByRefId["R_1"].Name)
+		assert.Equal(t, 12, *restored.teams["team1"].ParentTeam)
+		assert.Equal(t, "WRITE", restored.teamRepos["team1"]["repo1"].Permission)
+		assert.True(t, restored.ttlExpireRepositories.Equal(remoteImpl.ttlExpireRepositories))
+		assert.False(t, restored.teamReposFreshness["repo1"].isStale("2024-01-01T00:00:00Z"))
+		assert.NotNil(t, restored.rulesets)
+	})
+
+	t.Run("happy path: snapshot loaded at startup", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "snapshot.json")
+		err := fixtureRemote().SaveSnapshot(path)
+		assert.Nil(t, err)
+
+		config.Config.GithubCacheSnapshotFile = path
+		defer func() { config.Config.GithubCacheSnapshotFile = "" }()
+
+		restored := NewGoliacRemoteImpl(&GitHubClientIsEnterpriseMock{})
+		assert.Equal(t, 1, len(restored.repositories))
+	})
+
+	t.Run("not happy path: corrupted snapshot", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "snapshot.json")
+		err := fixtureRemote().SaveSnapshot(path)
+		assert.Nil(t, err)
+
+		content, err := os.ReadFile(path)
+		assert.Nil(t, err)
+		content = []byte(strings.Replace(string(content), "ADMIN", "MEMBER", 1))
+		err = os.WriteFile(path, content, 0600)
+		assert.Nil(t, err)
+
+		restored := NewGoliacRemoteImpl(&GitHubClientIsEnterpriseMock{})
+		err = restored.LoadSnapshot(path)
+		assert.NotNil(t, err)
+		assert.Equal(t, 0, len(restored.users))
+	})
+
+	t.Run("not happy path: snapshot of another organization", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "snapshot.json")
+		err := fixtureRemote().SaveSnapshot(path)
+		assert.Nil(t, err)
+
+		previousOrg := config.Config.GithubAppOrganization
+		config.Config.GithubAppOrganization = "another-org"
+		defer func() { config.Config.GithubAppOrganization = previousOrg }()
+
+		restored := NewGoliacRemoteImpl(&GitHubClientIsEnterpriseMock{})
+		err = restored.LoadSnapshot(path)
+		assert.NotNil(t, err)
+	})
+}
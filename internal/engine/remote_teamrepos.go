@@ -0,0 +1,390 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/Alayacare/goliac/internal/github"
+	"github.com/hashicorp/go-version"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+ * The teams repos can be loaded
+ * - with one REST call per repository (loadTeamRepos): it is what we do when only
+ *   a few repositories changed, or on old GHES versions
+ * - in bulk, with GraphQL: all the teams (and their repositories) of the organization,
+ *   page after page (loadTeamReposBulk)
+ */
+
+// minimum GHES version exposing the teams repositories permission in GraphQL
+const BULK_TEAM_REPOS_MIN_GHES_VERSION = "3.0"
+
+/*
+ * Number of teams fetched per GraphQL query. Each team comes with its first 100 repositories,
+ * so a query fetches up to 100 * BULK_TEAM_REPOS_TEAMS_PER_PAGE repositories.
+ * Github computes the cost of a query from the number of nodes requested, and returns
+ * it (rateLimit.cost): the page size is reduced when a page costs more than
+ * BULK_TEAM_REPOS_TARGET_COST points.
+ * The page size is also halved (down to BULK_TEAM_REPOS_MIN_TEAMS_PER_PAGE) if Github
+ * doesn't manage to answer (timeout, 5xx)
+ */
+const BULK_TEAM_REPOS_TEAMS_PER_PAGE = 50
+const BULK_TEAM_REPOS_MIN_TEAMS_PER_PAGE = 5
+const BULK_TEAM_REPOS_TARGET_COST = 1
+
+const listAllTeamsReposInOrg = `
+query listAllTeamsReposInOrg($orgLogin: String!, $teamsPerPage: Int!, $endCursor: String) {
+    rateLimit {
+      limit
+      cost
+      remaining
+      resetAt
+    }
+    organization(login: $orgLogin) {
+      teams(first: $teamsPerPage, after: $endCursor) {
+        nodes {
+          slug
+          repositories(first: 100) {
+            edges {
+              permission
+              node {
+                name
+              }
+            }
+            pageInfo {
+              hasNextPage
+              endCursor
+            }
+          }
+        }
+        pageInfo {
+          hasNextPage
+          endCursor
+        }
+      }
+    }
+}
+`
+
+const listTeamReposInOrg = `
+query listTeamReposInOrg($orgLogin: String!, $teamSlug: String!, $endCursor: String) {
+    organization(login: $orgLogin) {
+      team(slug: $teamSlug) {
+        repositories(first: 100, after: $endCursor) {
+          edges {
+            permission
+            node {
+              name
+            }
+          }
+          pageInfo {
+            hasNextPage
+            endCursor
+          }
+        }
+      }
+    }
+}
+`
+
+type GraphQLTeamRepositories struct {
+	Edges []struct {
+		Permission string `json:"permission"` // ADMIN, MAINTAIN, WRITE, TRIAGE, READ
+		Node       struct {
+			Name string `json:"name"`
+		} `json:"node"`
+	} `json:"edges"`
+	PageInfo struct {
+		HasNextPage bool
+		EndCursor   string
+	} `json:"pageInfo"`
+}
+
+type GraphQLGithubError struct {
+	Path       []interface{} `json:"path"`
+	Extensions struct {
+		Code         string
+		ErrorMessage string
+	} `json:"extensions"`
+	Message string
+}
+
+type GraplQLTeamsRepos struct {
+	Data struct {
+		RateLimit struct {
+			Cost      int `json:"cost"`
+			Remaining int `json:"remaining"`
+		} `json:"rateLimit"`
+		Organization struct {
+			Teams struct {
+				Nodes []struct {
+					Slug         string                  `json:"slug"`
+					Repositories GraphQLTeamRepositories `json:"repositories"`
+				} `json:"nodes"`
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   string
+				} `json:"pageInfo"`
+			} `json:"teams"`
+			Team struct {
+				Repositories GraphQLTeamRepositories `json:"repositories"`
+			} `json:"team"`
+		}
+	}
+	Errors []GraphQLGithubError `json:"errors"`
+}
+
+/*
+ * errBulkTeamReposNotSupported is returned when Github doesn't know the fields
+ * used by the bulk loading (we then fallback on the REST loading)
+ */
+type errBulkTeamReposNotSupported struct {
+	message string
+}
+
+func (e *errBulkTeamReposNotSupported) Error() string {
+	return fmt.Sprintf("graphql teams repositories not supported: %s", e.message)
+}
+
+func graphQLTeamsReposError(where string, errors []GraphQLGithubError) error {
+	for _, e := range errors {
+		if e.Extensions.Code == "undefinedField" || e.Extensions.Code == "argumentLiteralsIncompatible" {
+			return &errBulkTeamReposNotSupported{message: e.Message}
+		}
+	}
+	return fmt.Errorf("graphql error on %s: %v (%v)", where, errors[0].Message, errors[0].Path)
+}
+
+/*
+ * supportsBulkTeamRepos tells if the teams repos can be loaded with GraphQL
+ * (always on github.com, from BULK_TEAM_REPOS_MIN_GHES_VERSION on GHES)
+ */
+func supportsBulkTeamRepos(ctx context.Context, client github.GitHubClient) bool {
+	ghesInfo, err := getGHESVersion(ctx, client)
+	if err != nil || ghesInfo.InstalledVersion == "" {
+		// not a GHES
+		return true
+	}
+	minVersion, err := version.NewVersion(BULK_TEAM_REPOS_MIN_GHES_VERSION)
+	if err != nil {
+		return false
+	}
+	ghesVersion, err := version.NewVersion(ghesInfo.InstalledVersion)
+	if err != nil {
+		return false
+	}
+	if ghesVersion.LessThan(minVersion) {
+		logrus.Infof("GHES %s doesn't support loading the teams repos with GraphQL, using the REST API", ghesInfo.InstalledVersion)
+		return false
+	}
+	return true
+}
+
+/*
+ * bulkTeamReposCalls estimates the number of GraphQL calls to load all the teams repos
+ */
+func (g *GoliacRemoteImpl) bulkTeamReposCalls() int {
+	return len(g.teams)/BULK_TEAM_REPOS_TEAMS_PER_PAGE + 1
+}
+
+/*
+ * bulkTeamReposCost estimates the GraphQL points needed to load all the teams repos:
+ * what the last bulk loading cost, or 1 point per call if we don't know yet
+ */
+func (g *GoliacRemoteImpl) bulkTeamReposCost() int {
+	if g.bulkTeamReposLastCost > 0 {
+		return g.bulkTeamReposLastCost
+	}
+	return g.bulkTeamReposCalls()
+}
+
+/*
+ * useBulkTeamRepos tells if the stale teams repos are loaded in bulk (GraphQL)
+ * or one repository at a time (REST)
+ */
+func (g *GoliacRemoteImpl) useBulkTeamRepos(staleRepositories int) bool {
+	return g.bulkTeamRepos && staleRepositories > g.bulkTeamReposCalls()
+}
+
+/*
+ * teamReposLoadCost returns the API used to load the stale teams repos,
+ * and how much of its budget it will take
+ */
+func (g *GoliacRemoteImpl) teamReposLoadCost() (string, int) {
+	staleRepositories := len(g.staleTeamRepos())
+	if g.useBulkTeamRepos(staleRepositories) {
+		return github.RATELIMIT_GRAPHQL, g.bulkTeamReposCost()
+	}
+	return github.RATELIMIT_REST, staleRepositories
+}
+
+/*
+ * nextBulkTeamsPerPage adapts the page size to the cost of the last page:
+ * scaled down (to BULK_TEAM_REPOS_MIN_TEAMS_PER_PAGE at least) if it cost
+ * more than BULK_TEAM_REPOS_TARGET_COST
+ */
+func nextBulkTeamsPerPage(teamsPerPage int, cost int) int {
+	if cost <= BULK_TEAM_REPOS_TARGET_COST {
+		return teamsPerPage
+	}
+	return max(teamsPerPage*BULK_TEAM_REPOS_TARGET_COST/cost, BULK_TEAM_REPOS_MIN_TEAMS_PER_PAGE)
+}
+
+/*
+ * isBulkQueryTooBig tells if Github failed to answer a query (timeout, 5xx),
+ * which usually means the page asked is too big
+ */
+func isBulkQueryTooBig(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		// we are cancelled: smaller pages won't help
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return strings.HasPrefix(err.Error(), "unexpected status: 5")
+}
+
+/*
+ * loadTeamReposBulk returns (for all the repositories of the organization)
+ * map[repository]map[teamSlug]repoinfo
+ * Nothing is returned on error (we don't know which repositories were complete)
+ */
+func (g *GoliacRemoteImpl) loadTeamReposBulk(ctx context.Context) (map[string]map[string]*GithubTeamRepo, error) {
+	logrus.Debug("loading teamReposBulk")
+	teamsPerRepo := make(map[string]map[string]*GithubTeamRepo)
+	// the repositories without any team must be there too
+	for reponame := range g.repositories {
+		teamsPerRepo[reponame] = make(map[string]*GithubTeamRepo)
+	}
+	addTeamRepositories := func(teamslug string, repositories *GraphQLTeamRepositories) {
+		for _, edge := range repositories.Edges {
+			if _, ok := teamsPerRepo[edge.Node.Name]; !ok {
+				// not a repository we know about (created since we loaded the repositories)
+				continue
+			}
+			teamsPerRepo[edge.Node.Name][teamslug] = &GithubTeamRepo{
+				Name:       edge.Node.Name,
+				Permission: edge.Permission,
+			}
+		}
+	}
+
+	variables := make(map[string]interface{})
+	variables["orgLogin"] = config.Config.GithubAppOrganization
+	variables["endCursor"] = nil
+	teamsPerPage := BULK_TEAM_REPOS_TEAMS_PER_PAGE
+	totalCost := 0
+
+	hasNextPage := true
+	count := 0
+	for hasNextPage {
+		variables["teamsPerPage"] = teamsPerPage
+		queryCtx := ctx
+		if teamsPerPage > BULK_TEAM_REPOS_MIN_TEAMS_PER_PAGE {
+			// no need to retry the same (too big) page: we will ask for a smaller one
+			queryCtx = github.WithoutServerErrorRetries(ctx)
+		}
+		data, err := g.client.QueryGraphQLAPI(queryCtx, listAllTeamsReposInOrg, variables)
+		if err != nil {
+			// Github may not manage to answer a big query: let's try with smaller pages
+			if isBulkQueryTooBig(ctx, err) && teamsPerPage > BULK_TEAM_REPOS_MIN_TEAMS_PER_PAGE {
+				teamsPerPage = max(teamsPerPage/2, BULK_TEAM_REPOS_MIN_TEAMS_PER_PAGE)
+				logrus.Debugf("not able to load the teams repos (%v), trying with %d teams per page", err, teamsPerPage)
+				continue
+			}
+			return nil, err
+		}
+		var gResult GraplQLTeamsRepos
+
+		err = json.Unmarshal(data, &gResult)
+		if err != nil {
+			return nil, err
+		}
+		if len(gResult.Errors) > 0 {
+			return nil, graphQLTeamsReposError("loadTeamReposBulk", gResult.Errors)
+		}
+
+		for _, t := range gResult.Data.Organization.Teams.Nodes {
+			repositories := t.Repositories
+			addTeamRepositories(t.Slug, &repositories)
+			if repositories.PageInfo.HasNextPage {
+				// a team with (a lot of) more repositories
+				if err := g.loadTeamReposNextPages(ctx, t.Slug, repositories.PageInfo.EndCursor, addTeamRepositories); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		hasNextPage = gResult.Data.Organization.Teams.PageInfo.HasNextPage
+		variables["endCursor"] = gResult.Data.Organization.Teams.PageInfo.EndCursor
+
+		cost := gResult.Data.RateLimit.Cost
+		totalCost += max(cost, 1)
+		if next := nextBulkTeamsPerPage(teamsPerPage, cost); next != teamsPerPage {
+			logrus.Debugf("loading %d teams repos cost %d point(s), trying with %d teams per page", teamsPerPage, cost, next)
+			teamsPerPage = next
+		}
+
+		count++
+		// sanity check to avoid loops
+		if count > FORLOOP_STOP {
+			break
+		}
+	}
+	g.bulkTeamReposLastCost = totalCost
+
+	if g.feedback != nil {
+		g.feedback.LoadingAsset("teams_repos", len(teamsPerRepo))
+	}
+
+	return teamsPerRepo, nil
+}
+
+/*
+ * loadTeamReposNextPages loads the next pages of the repositories of a team
+ */
+func (g *GoliacRemoteImpl) loadTeamReposNextPages(ctx context.Context, teamslug string, endCursor string, addTeamRepositories func(string, *GraphQLTeamRepositories)) error {
+	variables := make(map[string]interface{})
+	variables["orgLogin"] = config.Config.GithubAppOrganization
+	variables["teamSlug"] = teamslug
+	variables["endCursor"] = endCursor
+
+	hasNextPage := true
+	count := 0
+	for hasNextPage {
+		data, err := g.client.QueryGraphQLAPI(ctx, listTeamReposInOrg, variables)
+		if err != nil {
+			return err
+		}
+		var gResult GraplQLTeamsRepos
+
+		err = json.Unmarshal(data, &gResult)
+		if err != nil {
+			return err
+		}
+		if len(gResult.Errors) > 0 {
+			return graphQLTeamsReposError("loadTeamReposNextPages", gResult.Errors)
+		}
+
+		repositories := gResult.Data.Organization.Team.Repositories
+		addTeamRepositories(teamslug, &repositories)
+
+		hasNextPage = repositories.PageInfo.HasNextPage
+		variables["endCursor"] = repositories.PageInfo.EndCursor
+
+		count++
+		// sanity check to avoid loops
+		if count > FORLOOP_STOP {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,442 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/Alayacare/goliac/internal/github"
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+ * teamsReposFixture is the teams repos of an organization
+ * (testdata/teams_repos.json: 300 repositories, 122 teams, 2 of them with access to all the repositories)
+ */
+type teamsReposFixture struct {
+	Repositories []string                     `json:"repositories"`
+	Teams        map[string]map[string]string `json:"teams"` // [teamslug][repository]permission
+}
+
+func loadTeamsReposFixture(t testing.TB) *teamsReposFixture {
+	content, err := os.ReadFile("testdata/teams_repos.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixture teamsReposFixture
+	if err := json.Unmarshal(content, &fixture); err != nil {
+		t.Fatal(err)
+	}
+	return &fixture
+}
+
+/*
+ * TeamsReposFixtureClient serves the teams repos fixture, with the REST API
+ * (one call per repository) and with the GraphQL API
+ */
+type TeamsReposFixtureClient struct {
+	fixture      *teamsReposFixture
+	ghesVersion  string // if set, pretends to be a GHES
+	graphqlError string // if set, GraphQL queries return this error code
+	// if set, the cost (in points) of a page of teams
+	teamsPageCost func(teamsPerPage int) int
+	// if set, the page of teams (starting at 0) that fails, and the number of times it fails
+	failingTeamsPage  int
+	teamsPageFailures int
+	teamsPageError    error
+	mutex             sync.Mutex
+	restCalls         int
+	graphqlCalls      int
+	teamsPages        int   // pages of teams served
+	teamsPerPage      []int // page size asked by each teams query (including the failed ones)
+}
+
+func (c *TeamsReposFixtureClient) teamSlugs() []string {
+	slugs := make([]string, 0, len(c.fixture.Teams))
+	for slug := range c.fixture.Teams {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+	return slugs
+}
+
+// repositories returns (up to) 100 repositories of the team, after the cursor (an index)
+func (c *TeamsReposFixtureClient) repositories(slug string, after string) map[string]interface{} {
+	names := make([]string, 0)
+	for name := range c.fixture.Teams[slug] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	start, _ := strconv.Atoi(after)
+	end := start + 100
+	if end > len(names) {
+		end = len(names)
+	}
+	edges := make([]map[string]interface{}, 0)
+	for _, name := range names[start:end] {
+		edges = append(edges, map[string]interface{}{
+			"permission": c.fixture.Teams[slug][name],
+			"node":       map[string]interface{}{"name": name},
+		})
+	}
+	return map[string]interface{}{
+		"edges": edges,
+		"pageInfo": map[string]interface{}{
+			"hasNextPage": end < len(names),
+			"endCursor":   strconv.Itoa(end),
+		},
+	}
+}
+
+func (c *TeamsReposFixtureClient) QueryGraphQLAPI(ctx context.Context, query string, variables map[string]interface{}) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.graphqlCalls++
+
+	if c.graphqlError != "" {
+		return []byte(fmt.Sprintf(`{"errors":[{"path":["query"],"extensions":{"code":"%s"},"message":"field is not defined"}]}`, c.graphqlError)), nil
+	}
+
+	after := ""
+	if cursor, ok := variables["endCursor"].(string); ok {
+		after = cursor
+	}
+
+	var organization map[string]interface{}
+	rateLimit := map[string]interface{}{"cost": 1, "remaining": 4000}
+	switch {
+	case strings.Contains(query, "query listAllTeamsReposInOrg"):
+		teamsPerPage := variables["teamsPerPage"].(int)
+		c.teamsPerPage = append(c.teamsPerPage, teamsPerPage)
+		if c.teamsPageFailures > 0 && c.teamsPages == c.failingTeamsPage {
+			c.teamsPageFailures--
+			return nil, c.teamsPageError
+		}
+		c.teamsPages++
+		if c.teamsPageCost != nil {
+			rateLimit["cost"] = c.teamsPageCost(teamsPerPage)
+		}
+		slugs := c.teamSlugs()
+		start, _ := strconv.Atoi(after)
+		end := start + teamsPerPage
+		if end > len(slugs) {
+			end = len(slugs)
+		}
+		nodes := make([]map[string]interface{}, 0)
+		for _, slug := range slugs[start:end] {
+			nodes = append(nodes, map[string]interface{}{
+				"slug":         slug,
+				"repositories": c.repositories(slug, ""),
+			})
+		}
+		organization = map[string]interface{}{
+			"teams": map[string]interface{}{
+				"nodes": nodes,
+				"pageInfo": map[string]interface{}{
+					"hasNextPage": end < len(slugs),
+					"endCursor":   strconv.Itoa(end),
+				},
+			},
+		}
+	case strings.Contains(query, "query listTeamReposInOrg"):
+		organization = map[string]interface{}{
+			"team": map[string]interface{}{
+				"repositories": c.repositories(variables["teamSlug"].(string), after),
+			},
+		}
+	default:
+		return nil, fmt.Errorf("unexpected query")
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"data": map[string]interface{}{
+			"rateLimit":    rateLimit,
+			"organization": organization,
+		},
+	})
+}
+
+func (c *TeamsReposFixtureClient) CallRestAPI(ctx context.Context, endpoint, parameters, method string, body map[string]interface{}) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if endpoint == "/api/v3" {
+		if c.ghesVersion == "" {
+			return nil, fmt.Errorf("unexpected status: 404 Not Found")
+		}
+		return []byte(fmt.Sprintf(`{"installed_version":"%s"}`, c.ghesVersion)), nil
+	}
+
+	prefix := "/repos/" + config.Config.GithubAppOrganization + "/"
+	if !strings.HasPrefix(endpoint, prefix) || !strings.HasSuffix(endpoint, "/teams") {
+		return nil, fmt.Errorf("unexpected status: 404 Not Found")
+	}
+	c.restCalls++
+	repository := strings.TrimSuffix(strings.TrimPrefix(endpoint, prefix), "/teams")
+
+	restPermissions := map[string]string{"ADMIN": "admin", "WRITE": "push", "READ": "pull"}
+	teams := make([]TeamsRepoResponse, 0)
+	for _, slug := range c.teamSlugs() {
+		if permission, ok := c.fixture.Teams[slug][repository]; ok {
+			teams = append(teams, TeamsRepoResponse{Name: slug, Slug: slug, Permission: restPermissions[permission]})
+		}
+	}
+	return json.Marshal(teams)
+}
+
+func (c *TeamsReposFixtureClient) GetAccessToken(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+func (c *TeamsReposFixtureClient) GetAppSlug() string {
+	return "goliac-project-app"
+}
+
+func (c *TeamsReposFixtureClient) GetRateLimits() github.RateLimits {
+	return github.RateLimits{}
+}
+
+/*
+ * newTeamsReposFixtureRemote returns a remote with the repositories and the teams of the fixture
+ * (but without their teams repos)
+ */
+func newTeamsReposFixtureRemote(client *TeamsReposFixtureClient) *GoliacRemoteImpl {
+	remoteImpl := NewGoliacRemoteImpl(client)
+	for _, name := range client.fixture.Repositories {
+		remoteImpl.repositories[name] = &GithubRepository{
+			Name:      name,
+			UpdatedAt: "2024-01-01T00:00:00Z",
+		}
+	}
+	for slug := range client.fixture.Teams {
+		remoteImpl.teams[slug] = &GithubTeam{
+			Name: slug,
+			Slug: slug,
+		}
+	}
+	return remoteImpl
+}
+
+func TestRemoteBulkTeamRepos(t *testing.T) {
+	fixture := loadTeamsReposFixture(t)
+
+	t.Run("happy path: the teams repos are loaded with GraphQL", func(t *testing.T) {
+		client := &TeamsReposFixtureClient{fixture: fixture}
+		remoteImpl := newTeamsReposFixtureRemote(client)
+		assert.True(t, remoteImpl.bulkTeamRepos)
+
+		teamRepos, err := remoteImpl.loadTeamReposIncrementally(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 0, client.restCalls)
+		// 3 pages of teams, and 2 teams with 300 repositories (2 more pages each)
+		assert.Equal(t, 3+2*2, client.graphqlCalls)
+
+		assert.Equal(t, 300, len(teamRepos["platform"]))
+		assert.Equal(t, "ADMIN", teamRepos["platform"]["repo-299"].Permission)
+		assert.Equal(t, 300, len(teamRepos["security"]))
+		for slug, repos := range fixture.Teams {
+			assert.Equal(t, len(repos), len(teamRepos[slug]), slug)
+		}
+		assert.Equal(t, 300, len(remoteImpl.teamReposFreshness))
+	})
+
+	t.Run("happy path: GraphQL and REST load the same teams repos", func(t *testing.T) {
+		graphqlClient := &TeamsReposFixtureClient{fixture: fixture}
+		graphqlTeamRepos, err := newTeamsReposFixtureRemote(graphqlClient).loadTeamReposIncrementally(context.TODO())
+		assert.Nil(t, err)
+
+		restClient := &TeamsReposFixtureClient{fixture: fixture, ghesVersion: "2.22.0"}
+		restRemote := newTeamsReposFixtureRemote(restClient)
+		assert.False(t, restRemote.bulkTeamRepos)
+		restTeamRepos, err := restRemote.loadTeamReposIncrementally(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 0, restClient.graphqlCalls)
+		assert.Equal(t, 300, restClient.restCalls)
+
+		assert.Equal(t, restTeamRepos, graphqlTeamRepos)
+	})
+
+	t.Run("happy path: only a few repositories changed, they are loaded with REST", func(t *testing.T) {
+		client := &TeamsReposFixtureClient{fixture: fixture}
+		remoteImpl := newTeamsReposFixtureRemote(client)
+		teamRepos, err := remoteImpl.loadTeamReposIncrementally(context.TODO())
+		assert.Nil(t, err)
+		remoteImpl.teamRepos = teamRepos
+
+		client.graphqlCalls = 0
+		remoteImpl.repositories["repo-001"].UpdatedAt = "2024-02-01T00:00:00Z"
+		remoteImpl.repositories["repo-002"].UpdatedAt = "2024-02-01T00:00:00Z"
+		teamRepos, err = remoteImpl.loadTeamReposIncrementally(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 0, client.graphqlCalls)
+		assert.Equal(t, 2, client.restCalls)
+		assert.Equal(t, 300, len(teamRepos["platform"]))
+	})
+
+	t.Run("not happy path: fallback on REST when GraphQL doesn't know the fields", func(t *testing.T) {
+		client := &TeamsReposFixtureClient{fixture: fixture, graphqlError: "undefinedField"}
+		remoteImpl := newTeamsReposFixtureRemote(client)
+
+		teamRepos, err := remoteImpl.loadTeamReposIncrementally(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, client.graphqlCalls)
+		assert.Equal(t, 300, client.restCalls)
+		assert.Equal(t, 300, len(teamRepos["platform"]))
+		// and we don't try anymore
+		assert.False(t, remoteImpl.bulkTeamRepos)
+	})
+
+	t.Run("not happy path: a GraphQL error is returned", func(t *testing.T) {
+		client := &TeamsReposFixtureClient{fixture: fixture, graphqlError: "INTERNAL"}
+		remoteImpl := newTeamsReposFixtureRemote(client)
+
+		_, err := remoteImpl.loadTeamReposIncrementally(context.TODO())
+		assert.NotNil(t, err)
+		assert.True(t, remoteImpl.bulkTeamRepos)
+	})
+
+	t.Run("not happy path: nothing is kept from a bulk loading that failed in the middle", func(t *testing.T) {
+		client := &TeamsReposFixtureClient{fixture: fixture}
+		remoteImpl := newTeamsReposFixtureRemote(client)
+		teamRepos, err := remoteImpl.loadTeamReposIncrementally(context.TODO())
+		assert.Nil(t, err)
+		remoteImpl.teamRepos = teamRepos
+		freshness := remoteImpl.teamReposFreshness["repo-001"]
+
+		// all the repositories changed, but Github fails on the 2nd page of teams
+		for _, repo := range remoteImpl.repositories {
+			repo.UpdatedAt = "2024-02-01T00:00:00Z"
+		}
+		client.teamsPages = 0
+		client.failingTeamsPage = 1
+		client.teamsPageFailures = 1
+		client.teamsPageError = fmt.Errorf("unexpected status: 401 Unauthorized")
+
+		teamRepos, err = remoteImpl.loadTeamReposIncrementally(context.TODO())
+		assert.NotNil(t, err)
+		assert.Nil(t, teamRepos)
+		// the repositories are still stale
+		assert.Equal(t, freshness, remoteImpl.teamReposFreshness["repo-001"])
+		assert.Equal(t, 300, len(remoteImpl.staleTeamRepos()))
+	})
+
+	t.Run("not happy path: Load keeps the cached teams repos when it fails to load them", func(t *testing.T) {
+		client := &TeamsReposFixtureClient{fixture: fixture, teamsPageFailures: 1, teamsPageError: fmt.Errorf("unexpected status: 401 Unauthorized")}
+		remoteImpl := newTeamsReposFixtureRemote(client)
+		cached := map[string]map[string]*GithubTeamRepo{"platform": {"repo-001": {Name: "repo-001", Permission: "ADMIN"}}}
+		remoteImpl.teamRepos = cached
+		// everything else is already loaded
+		future := time.Now().Add(time.Hour)
+		remoteImpl.ttlExpireAppIds = future
+		remoteImpl.ttlExpireTeams = future
+		remoteImpl.ttlExpireUsers = future
+		remoteImpl.ttlExpireRepositories = future
+		remoteImpl.ttlExpireRulesets = future
+		remoteImpl.ttlExpireProperties = future
+
+		err := remoteImpl.Load(context.TODO(), true)
+		assert.NotNil(t, err)
+		assert.Equal(t, cached, remoteImpl.teamRepos)
+		assert.Equal(t, 0, len(remoteImpl.teamReposFreshness))
+	})
+
+	t.Run("happy path: the page size follows the cost of the queries", func(t *testing.T) {
+		client := &TeamsReposFixtureClient{
+			fixture: fixture,
+			// 2 points for 50 teams
+			teamsPageCost: func(teamsPerPage int) int { return (teamsPerPage + 24) / 25 },
+		}
+		remoteImpl := newTeamsReposFixtureRemote(client)
+
+		teamRepos, err := remoteImpl.loadTeamReposIncrementally(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, []int{50, 25, 25, 25}, client.teamsPerPage)
+		assert.Equal(t, 2+1+1+1, remoteImpl.bulkTeamReposLastCost)
+		for slug, repos := range fixture.Teams {
+			assert.Equal(t, len(repos), len(teamRepos[slug]), slug)
+		}
+	})
+
+	t.Run("happy path: smaller pages when Github fails to answer", func(t *testing.T) {
+		client := &TeamsReposFixtureClient{
+			fixture:           fixture,
+			failingTeamsPage:  1,
+			teamsPageFailures: 2,
+			teamsPageError:    fmt.Errorf("unexpected status: 502 Bad Gateway"),
+		}
+		remoteImpl := newTeamsReposFixtureRemote(client)
+
+		teamRepos, err := remoteImpl.loadTeamReposIncrementally(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, []int{50, 50, 25, 12, 12, 12, 12, 12, 12}, client.teamsPerPage)
+		for slug, repos := range fixture.Teams {
+			assert.Equal(t, len(repos), len(teamRepos[slug]), slug)
+		}
+	})
+
+	t.Run("happy path: the load cost is the one of the path that will run", func(t *testing.T) {
+		client := &TeamsReposFixtureClient{fixture: fixture}
+		remoteImpl := newTeamsReposFixtureRemote(client)
+
+		// 122 teams: 3 GraphQL calls (instead of 300 REST calls)
+		api, cost := remoteImpl.teamReposLoadCost()
+		assert.Equal(t, github.RATELIMIT_GRAPHQL, api)
+		assert.Equal(t, 3, cost)
+
+		teamRepos, err := remoteImpl.loadTeamReposIncrementally(context.TODO())
+		assert.Nil(t, err)
+		remoteImpl.teamRepos = teamRepos
+
+		remoteImpl.repositories["repo-001"].UpdatedAt = "2024-02-01T00:00:00Z"
+		api, cost = remoteImpl.teamReposLoadCost()
+		assert.Equal(t, github.RATELIMIT_REST, api)
+		assert.Equal(t, 1, cost)
+
+		// all the repositories changed: we expect what the last bulk loading cost
+		for _, repo := range remoteImpl.repositories {
+			repo.UpdatedAt = "2024-03-01T00:00:00Z"
+		}
+		remoteImpl.bulkTeamReposLastCost = 7
+		api, cost = remoteImpl.teamReposLoadCost()
+		assert.Equal(t, github.RATELIMIT_GRAPHQL, api)
+		assert.Equal(t, 7, cost)
+	})
+}
+
+/*
+ * BenchmarkLoadTeamRepos compares the number of Github calls needed to load
+ * the teams repos of the fixture (reported as calls/op)
+ */
+func BenchmarkLoadTeamRepos(b *testing.B) {
+	fixture := loadTeamsReposFixture(b)
+
+	for _, bench := range []struct {
+		name        string
+		ghesVersion string
+	}{
+		{"rest", "2.22.0"},
+		{"graphql", ""},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			calls := 0
+			for i := 0; i < b.N; i++ {
+				client := &TeamsReposFixtureClient{fixture: fixture, ghesVersion: bench.ghesVersion}
+				remoteImpl := newTeamsReposFixtureRemote(client)
+				if _, err := remoteImpl.loadTeamReposIncrementally(context.TODO()); err != nil {
+					b.Fatal(err)
+				}
+				calls += client.restCalls + client.graphqlCalls
+			}
+			b.ReportMetric(float64(calls)/float64(b.N), "calls/op")
+		})
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"io"
 	"math/rand"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Alayacare/goliac/internal/config"
 	"github.com/Alayacare/goliac/internal/github"
@@ -33,6 +35,7 @@ func GetGithubGraphqlSchema() (string, error) {
 type MockGithubClient struct {
 	cursorValue    string
 	cursorPosition int
+	rateLimits     github.RateLimits
 }
 
 type GraphQLResult struct {
@@ -362,6 +365,10 @@ func (m *MockGithubClient) GetAppSlug() string {
 	return "mock-github-client"
 }
 
+func (m *MockGithubClient) GetRateLimits() github.RateLimits {
+	return m.rateLimits
+}
+
 func (m *MockGithubClient) QueryGraphQLAPI(ctx context.Context, query string, variables map[string]interface{}) ([]byte, error) {
 
 	doc, err := parser.ParseQuery(&ast.Source{Input: query})
@@ -405,6 +412,11 @@ func (m *MockGithubClient) CallRestAPI(ctx context.Context, endpoint, parameters
 		}
 		return []byte(fmt.Sprintf(`[{"name":"team_1","permission":"push","slug":"slug-%d"},{"name":"team_2","permission":"push","slug":"slug-2"}]`, repoId)), nil
 	}
+	if endpoint == "/api/v3" {
+		// the mock only fakes the REST teams repos loading: let's pretend to be a GHES
+		// without the GraphQL teams repositories (cf remote_teamrepos_test.go for the GraphQL loading)
+		return []byte(`{"installed_version":"2.22.0"}`), nil
+	}
 	if strings.HasSuffix(endpoint, "installations") {
 
 		type Installation struct {
@@ -508,6 +520,10 @@ func (g *GitHubClientIsEnterpriseMock) GetAppSlug() string {
 	return ""
 }
 
+func (g *GitHubClientIsEnterpriseMock) GetRateLimits() github.RateLimits {
+	return github.RateLimits{}
+}
+
 func TestIsEnterprise(t *testing.T) {
 
 	t.Run("test GHES", func(t *testing.T) {
@@ -616,3 +632,330 @@ func TestIsEnterprise(t *testing.T) {
 		}
 	})
 }
+
+func TestRemoteRefresh(t *testing.T) {
+	t.Run("happy path: refresh an org admin", func(t *testing.T) {
+		client := GitHubClientIsEnterpriseMock{
+			results: map[string][]byte{
+				"/orgs/" + config.Config.GithubAppOrganization + "/memberships/alice": []byte(`{"state":"active","role":"admin"}`),
+			},
+		}
+		remoteImpl := NewGoliacRemoteImpl(&client)
+		remoteImpl.users["alice"] = "MEMBER"
+
+		err := remoteImpl.RefreshUser(context.TODO(), "alice")
+		assert.Nil(t, err)
+		assert.Equal(t, "ADMIN", remoteImpl.users["alice"])
+	})
+
+	t.Run("happy path: refresh a removed user", func(t *testing.T) {
+		client := GitHubClientIsEnterpriseMock{
+			results: map[string][]byte{
+				"/orgs/" + config.Config.GithubAppOrganization + "/memberships/alice": []byte(`{"message":"Not Found"}`),
+			},
+			err: fmt.Errorf("unexpected status: 404 Not Found"),
+		}
+		remoteImpl := NewGoliacRemoteImpl(&client)
+		remoteImpl.users["alice"] = "MEMBER"
+
+		err := remoteImpl.RefreshUser(context.TODO(), "alice")
+		assert.Nil(t, err)
+		_, found := remoteImpl.users["alice"]
+		assert.False(t, found)
+	})
+
+	t.Run("not happy path: refresh a user on a Github error", func(t *testing.T) {
+		client := GitHubClientIsEnterpriseMock{
+			results: map[string][]byte{},
+			err:     fmt.Errorf("unexpected status: 500 Internal Server Error"),
+		}
+		remoteImpl := NewGoliacRemoteImpl(&client)
+		remoteImpl.users["alice"] = "MEMBER"
+
+		err := remoteImpl.RefreshUser(context.TODO(), "alice")
+		assert.NotNil(t, err)
+		assert.Equal(t, "MEMBER", remoteImpl.users["alice"])
+	})
+}
+
+type GitHubClientGraphQLMock struct {
+	GitHubClientIsEnterpriseMock
+	graphql []byte
+}
+
+func (g *GitHubClientGraphQLMock) QueryGraphQLAPI(ctx context.Context, query string, variables map[string]interface{}) ([]byte, error) {
+	return g.graphql, nil
+}
+
+func TestRemoteRefreshRepository(t *testing.T) {
+	t.Run("happy path: a deleted repository is removed from the cache", func(t *testing.T) {
+		client := GitHubClientGraphQLMock{
+			graphql: []byte(`{"data":{"repository":null},"errors":[{"type":"NOT_FOUND","path":["repository"],"message":"Could not resolve to a Repository with the name 'myorg/repo1'."}]}`),
+		}
+		remoteImpl := NewGoliacRemoteImpl(&client)
+		remoteImpl.repositories["repo1"] = &GithubRepository{Name: "repo1", RefId: "R_1"}
+		remoteImpl.repositoriesByRefId["R_1"] = remoteImpl.repositories["repo1"]
+		remoteImpl.teamRepos["team1"] = map[string]*GithubTeamRepo{"repo1": {Name: "repo1", Permission: "WRITE"}}
+
+		err := remoteImpl.RefreshRepository(context.TODO(), "repo1")
+		assert.Nil(t, err)
+		_, found := remoteImpl.repositories["repo1"]
+		assert.False(t, found)
+		_, found = remoteImpl.teamRepos["team1"]["repo1"]
+		assert.False(t, found)
+	})
+
+	t.Run("not happy path: a rate limited refresh keeps the repository", func(t *testing.T) {
+		client := GitHubClientGraphQLMock{
+			graphql: []byte(`{"data":{"repository":null},"errors":[{"type":"RATE_LIMITED","path":["repository"],"message":"API rate limit exceeded"}]}`),
+		}
+		remoteImpl := NewGoliacRemoteImpl(&client)
+		remoteImpl.repositories["repo1"] = &GithubRepository{Name: "repo1", RefId: "R_1"}
+		remoteImpl.teamRepos["team1"] = map[string]*GithubTeamRepo{"repo1": {Name: "repo1", Permission: "WRITE"}}
+
+		err := remoteImpl.RefreshRepository(context.TODO(), "repo1")
+		assert.NotNil(t, err)
+		_, found := remoteImpl.repositories["repo1"]
+		assert.True(t, found)
+		_, found = remoteImpl.teamRepos["team1"]["repo1"]
+		assert.True(t, found)
+	})
+}
+
+func TestRemoteCustomPropertiesError(t *testing.T) {
+	t.Run("not happy path: the custom properties could not be loaded", func(t *testing.T) {
+		client := GitHubClientIsEnterpriseMock{
+			err: fmt.Errorf("unexpected status: 403 Forbidden"),
+		}
+		remoteImpl := NewGoliacRemoteImpl(&client)
+		remoteImpl.customProperties["tier"] = &GithubCustomProperty{Name: "tier"}
+
+		properties := remoteImpl.CustomProperties(context.TODO())
+		assert.NotNil(t, remoteImpl.CustomPropertiesError())
+		// we keep what we had
+		assert.Equal(t, 1, len(properties))
+
+		// and it is known again once loaded
+		client.err = nil
+		client.results = map[string][]byte{
+			"/orgs/" + config.Config.GithubAppOrganization + "/properties/schema": []byte(`[{"property_name":"tier","value_type":"string"}]`),
+		}
+		remoteImpl.CustomProperties(context.TODO())
+		assert.Nil(t, remoteImpl.CustomPropertiesError())
+	})
+
+	t.Run("not happy path: the error is kept in the snapshot", func(t *testing.T) {
+		client := GitHubClientIsEnterpriseMock{}
+		remoteImpl := NewGoliacRemoteImpl(&client)
+		remoteImpl.propertyValuesErr = fmt.Errorf("unexpected status: 403 Forbidden")
+
+		path := filepath.Join(t.TempDir(), "snapshot.json")
+		assert.Nil(t, remoteImpl.SaveSnapshot(path))
+
+		restored := NewGoliacRemoteImpl(&client)
+		assert.Nil(t, restored.LoadSnapshot(path))
+		assert.Equal(t, "unexpected status: 403 Forbidden", restored.CustomPropertiesError().Error())
+	})
+}
+
+func TestRemoteWithoutRemoteLoad(t *testing.T) {
+	t.Run("happy path: the expired cache is returned without reloading it", func(t *testing.T) {
+		client := GitHubClientGraphQLMock{
+			graphql: []byte(`{"data":{"organization":{"repositories":{"nodes":[],"pageInfo":{"hasNextPage":false}}}}}`),
+		}
+		remoteImpl := NewGoliacRemoteImpl(&client)
+		remoteImpl.repositories["repo1"] = &GithubRepository{Name: "repo1"}
+		remoteImpl.ttlExpireRepositories = time.Now().Add(-time.Minute)
+
+		ctx := WithoutRemoteLoad(context.TODO())
+		assert.Equal(t, 1, len(remoteImpl.Repositories(ctx)))
+
+		// without it, the cache is reloaded (and repo1 is gone)
+		assert.Equal(t, 0, len(remoteImpl.Repositories(context.TODO())))
+	})
+}
+
+/*
+ * GitHubClientRecorderMock records the REST calls (method and endpoint)
+ */
+type GitHubClientRecorderMock struct {
+	GitHubClientIsEnterpriseMock
+	calls []string
+}
+
+func (g *GitHubClientRecorderMock) CallRestAPI(ctx context.Context, endpoint, parameters, method string, body map[string]interface{}) ([]byte, error) {
+	g.calls = append(g.calls, method+" "+endpoint)
+	return []byte(`{"id":1}`), nil
+}
+
+func TestRemoteRepositoryRulesets(t *testing.T) {
+	t.Run("happy path: repository rulesets are managed under /repos", func(t *testing.T) {
+		client := GitHubClientRecorderMock{}
+		remoteImpl := NewGoliacRemoteImpl(&client)
+		remoteImpl.repositories["repo1"] = &GithubRepository{Name: "repo1", RuleSets: map[string]*GithubRuleSet{}}
+		ruleset := &GithubRuleSet{Name: "ruleset1", Id: 42, Enforcement: "active"}
+		// forget the calls done when creating the remote (GHES detection)
+		client.calls = nil
+
+		ctx := context.TODO()
+		assert.Nil(t, remoteImpl.AddRepositoryRuleset(ctx, false, "repo1", ruleset))
+		assert.Nil(t, remoteImpl.UpdateRepositoryRuleset(ctx, false, "repo1", ruleset))
+		assert.Nil(t, remoteImpl.DeleteRepositoryRuleset(ctx, false, "repo1", 42))
+
+		org := config.Config.GithubAppOrganization
+		assert.Equal(t, []string{
+			"POST /repos/" + org + "/repo1/rulesets",
+			"PUT /repos/" + org + "/repo1/rulesets/42",
+			"DELETE /repos/" + org + "/repo1/rulesets/42",
+		}, client.calls)
+	})
+}
+
+func TestRemoteIncrementalRefresh(t *testing.T) {
+	t.Run("happy path: only the changed repositories' teams are fetched", func(t *testing.T) {
+		// MockGithubClient doesn't support concurrent access
+		client := MockGithubClient{}
+		remoteImpl := NewGoliacRemoteImpl(&client)
+
+		stats := config.GoliacStatistics{}
+		ctx := context.WithValue(context.TODO(), config.ContextKeyStatistics, &stats)
+		err := remoteImpl.Load(ctx, false)
+		assert.Nil(t, err)
+		assert.Equal(t, 133, stats.EntitiesFetched["repositories"])
+		assert.Equal(t, 133, stats.EntitiesFetched["teams_repos"])
+		assert.Equal(t, 122, stats.EntitiesFetched["teams_members"])
+
+		// nothing changed on Github
+		stats = config.GoliacStatistics{}
+		teamRepos, err := remoteImpl.loadTeamReposIncrementally(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, stats.EntitiesFetched["teams_repos"])
+		assert.Equal(t, 1, len(teamRepos["slug-1"]))
+
+		// repo_1 was updated on Github
+		remoteImpl.repositories["repo_1"].UpdatedAt = "2024-01-01T00:00:00Z"
+		teamRepos, err = remoteImpl.loadTeamReposIncrementally(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, stats.EntitiesFetched["teams_repos"])
+		assert.Equal(t, 1, len(teamRepos["slug-1"]))
+
+		// repo_2 was deleted
+		delete(remoteImpl.repositories, "repo_2")
+		teamRepos, err = remoteImpl.loadTeamReposIncrementally(ctx)
+		assert.Nil(t, err)
+		_, found := teamRepos["slug-2"]["repo_2"]
+		assert.False(t, found)
+		_, found = remoteImpl.teamReposFreshness["repo_2"]
+		assert.False(t, found)
+	})
+}
+
+func TestRemoteApiBudget(t *testing.T) {
+	reserve := config.Config.GithubApiReserve
+	config.Config.GithubApiReserve = 500
+	defer func() { config.Config.GithubApiReserve = reserve }()
+
+	t.Run("happy path: the teams repos loading is deferred when the budget is low", func(t *testing.T) {
+		client := MockGithubClient{}
+		remoteImpl := NewGoliacRemoteImpl(&client)
+
+		ctx := context.TODO()
+		err := remoteImpl.Load(ctx, false)
+		assert.Nil(t, err)
+
+		reset := time.Now().Add(20 * time.Minute)
+		client.rateLimits = github.RateLimits{
+			Rest:    &github.RateLimit{Limit: 5000, Remaining: 400, Reset: reset},
+			GraphQL: &github.RateLimit{Limit: 5000, Remaining: 4000, Reset: reset},
+		}
+		remoteImpl.FlushCache()
+
+		stats := config.GoliacStatistics{}
+		ctx = context.WithValue(context.TODO(), config.ContextKeyStatistics, &stats)
+		err = remoteImpl.Load(ctx, false)
+		assert.Nil(t, err)
+		// repositories and teams are always loaded
+		assert.Equal(t, 133, stats.EntitiesFetched["repositories"])
+		// teams repos are not, we keep the cached ones until the budget is reset
+		assert.Equal(t, 0, stats.EntitiesFetched["teams_repos"])
+		assert.Equal(t, 1, len(remoteImpl.TeamRepositories(ctx)["slug-1"]))
+		assert.Equal(t, reset, remoteImpl.ttlExpireTeamsRepos)
+	})
+
+	t.Run("happy path: the loading is not deferred if there is enough budget", func(t *testing.T) {
+		client := MockGithubClient{}
+		remoteImpl := NewGoliacRemoteImpl(&client)
+
+		ctx := context.TODO()
+		err := remoteImpl.Load(ctx, false)
+		assert.Nil(t, err)
+
+		client.rateLimits = github.RateLimits{
+			Rest: &github.RateLimit{Limit: 5000, Remaining: 1000, Reset: time.Now().Add(20 * time.Minute)},
+		}
+		remoteImpl.FlushCache()
+
+		stats := config.GoliacStatistics{}
+		ctx = context.WithValue(context.TODO(), config.ContextKeyStatistics, &stats)
+		err = remoteImpl.Load(ctx, false)
+		assert.Nil(t, err)
+		assert.Equal(t, 133, stats.EntitiesFetched["teams_repos"])
+	})
+
+	t.Run("happy path: the loading is not deferred if nothing was loaded yet", func(t *testing.T) {
+		client := MockGithubClient{
+			rateLimits: github.RateLimits{
+				Rest: &github.RateLimit{Limit: 5000, Remaining: 10, Reset: time.Now().Add(20 * time.Minute)},
+			},
+		}
+		remoteImpl := NewGoliacRemoteImpl(&client)
+
+		stats := config.GoliacStatistics{}
+		ctx := context.WithValue(context.TODO(), config.ContextKeyStatistics, &stats)
+		err := remoteImpl.Load(ctx, false)
+		assert.Nil(t, err)
+		assert.Equal(t, 133, stats.EntitiesFetched["teams_repos"])
+	})
+
+	t.Run("happy path: an expired budget is not taken into account", func(t *testing.T) {
+		limits := github.RateLimits{
+			Rest: &github.RateLimit{Limit: 5000, Remaining: 0, Reset: time.Now().Add(-time.Minute)},
+		}
+		_, known := limits.Get(github.RATELIMIT_REST)
+		assert.False(t, known)
+		_, known = limits.Get(github.RATELIMIT_GRAPHQL)
+		assert.False(t, known)
+	})
+}
+
+func TestRemoteMutationErrors(t *testing.T) {
+
+	t.Run("not happy path: a failed mutation returns the error and doesn't update the cache", func(t *testing.T) {
+		client := &GitHubClientIsEnterpriseMock{
+			results: map[string][]byte{},
+			err:     fmt.Errorf("unexpected status: 403 Forbidden"),
+		}
+		remoteImpl := NewGoliacRemoteImpl(client)
+		remoteImpl.teams["team1"] = &GithubTeam{Name: "team1", Slug: "team1", Members: []string{}}
+		remoteImpl.repositories["repo1"] = &GithubRepository{Name: "repo1", BoolProperties: map[string]bool{"archived": false}}
+
+		ctx := context.TODO()
+		err := remoteImpl.UpdateTeamAddMember(ctx, false, "team1", "user1", "member")
+		assert.NotNil(t, err)
+		assert.Equal(t, 0, len(remoteImpl.teams["team1"].Members))
+
+		err = remoteImpl.UpdateRepositoryUpdateBoolProperty(ctx, false, "repo1", "archived", true)
+		assert.NotNil(t, err)
+		assert.False(t, remoteImpl.repositories["repo1"].BoolProperties["archived"])
+
+		err = remoteImpl.CreateRepository(ctx, false, "repo2", "", []string{}, []string{}, map[string]bool{})
+		assert.NotNil(t, err)
+		_, found := remoteImpl.repositories["repo2"]
+		assert.False(t, found)
+
+		// in dryrun, nothing is sent to Github
+		err = remoteImpl.UpdateTeamAddMember(ctx, true, "team1", "user1", "member")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"user1"}, remoteImpl.teams["team1"].Members)
+	})
+}
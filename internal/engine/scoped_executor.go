@@ -0,0 +1,312 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/gosimple/slug"
+)
+
+/*
+ * ReconcileScope lists the entities a targeted reconciliation is allowed to touch
+ */
+type ReconcileScope struct {
+	Users        map[string]bool // user login
+	Teams        map[string]bool // team slug
+	Repositories map[string]bool // repository name
+	Rulesets     bool            // organization rulesets
+}
+
+func NewReconcileScope() *ReconcileScope {
+	return &ReconcileScope{
+		Users:        make(map[string]bool),
+		Teams:        make(map[string]bool),
+		Repositories: make(map[string]bool),
+		Rulesets:     false,
+	}
+}
+
+func (s *ReconcileScope) IsEmpty() bool {
+	return len(s.Users) == 0 && len(s.Teams) == 0 && len(s.Repositories) == 0 && !s.Rulesets
+}
+
+/*
+ * ScopedExecutor forwards to the underlying executor only the commands
+ * touching an entity of the scope (and drops the others).
+ * It is used to reconcile a single entity after a Github webhook event:
+ * the whole local state is compared, but only the changed entity is fixed.
+ */
+type ScopedExecutor struct {
+	executor ReconciliatorExecutor
+	scope    *ReconcileScope
+	changes  int
+}
+
+func NewScopedExecutor(executor ReconciliatorExecutor, scope *ReconcileScope) *ScopedExecutor {
+	return &ScopedExecutor{
+		executor: executor,
+		scope:    scope,
+		changes:  0,
+	}
+}
+
+/*
+ * Changes returns the number of commands forwarded to the underlying executor
+ */
+func (s *ScopedExecutor) Changes() int {
+	return s.changes
+}
+
+func (s *ScopedExecutor) inUser(ghuserid string) bool {
+	if s.scope.Users[ghuserid] {
+		s.changes++
+		return true
+	}
+	return false
+}
+
+func (s *ScopedExecutor) inTeam(teamslug string) bool {
+	if s.scope.Teams[teamslug] {
+		s.changes++
+		return true
+	}
+	return false
+}
+
+func (s *ScopedExecutor) inRepository(reponame string) bool {
+	if s.scope.Repositories[reponame] {
+		s.changes++
+		return true
+	}
+	return false
+}
+
+func (s *ScopedExecutor) inRepositoryOrTeam(reponame string, teamslug string) bool {
+	if s.scope.Repositories[reponame] || s.scope.Teams[teamslug] {
+		s.changes++
+		return true
+	}
+	return false
+}
+
+func (s *ScopedExecutor) inRulesets() bool {
+	if s.scope.Rulesets {
+		s.changes++
+		return true
+	}
+	return false
+}
+
+func (s *ScopedExecutor) AddUserToOrg(ctx context.Context, dryrun bool, ghuserid string) error {
+	if s.inUser(ghuserid) {
+		return s.executor.AddUserToOrg(ctx, dryrun, ghuserid)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) RemoveUserFromOrg(ctx context.Context, dryrun bool, ghuserid string) error {
+	if s.inUser(ghuserid) {
+		return s.executor.RemoveUserFromOrg(ctx, dryrun, ghuserid)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) CreateTeam(ctx context.Context, dryrun bool, teamname string, description string, parentTeam *int, members []string) error {
+	if s.inTeam(slug.Make(teamname)) {
+		return s.executor.CreateTeam(ctx, dryrun, teamname, description, parentTeam, members)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateTeamAddMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error {
+	if s.inTeam(teamslug) {
+		return s.executor.UpdateTeamAddMember(ctx, dryrun, teamslug, username, role)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateTeamUpdateMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error {
+	if s.inTeam(teamslug) {
+		return s.executor.UpdateTeamUpdateMember(ctx, dryrun, teamslug, username, role)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateTeamRemoveMember(ctx context.Context, dryrun bool, teamslug string, username string) error {
+	if s.inTeam(teamslug) {
+		return s.executor.UpdateTeamRemoveMember(ctx, dryrun, teamslug, username)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateTeamSetParent(ctx context.Context, dryrun bool, teamslug string, parentTeam *int) error {
+	if s.inTeam(teamslug) {
+		return s.executor.UpdateTeamSetParent(ctx, dryrun, teamslug, parentTeam)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) DeleteTeam(ctx context.Context, dryrun bool, teamslug string) error {
+	if s.inTeam(teamslug) {
+		return s.executor.DeleteTeam(ctx, dryrun, teamslug)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) CreateRepository(ctx context.Context, dryrun bool, reponame string, descrition string, writers []string, readers []string, boolProperties map[string]bool) error {
+	if s.inRepository(reponame) {
+		return s.executor.CreateRepository(ctx, dryrun, reponame, descrition, writers, readers, boolProperties)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateRepositoryUpdateBoolProperty(ctx context.Context, dryrun bool, reponame string, propertyName string, propertyValue bool) error {
+	if s.inRepository(reponame) {
+		return s.executor.UpdateRepositoryUpdateBoolProperty(ctx, dryrun, reponame, propertyName, propertyValue)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateRepositoryUpdateStringProperties(ctx context.Context, dryrun bool, reponame string, properties map[string]string) error {
+	if s.inRepository(reponame) {
+		return s.executor.UpdateRepositoryUpdateStringProperties(ctx, dryrun, reponame, properties)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateRepositorySetTopics(ctx context.Context, dryrun bool, reponame string, topics []string) error {
+	if s.inRepository(reponame) {
+		return s.executor.UpdateRepositorySetTopics(ctx, dryrun, reponame, topics)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateRepositorySetCustomProperties(ctx context.Context, dryrun bool, reponame string, properties map[string][]string, valueTypes map[string]string) error {
+	if s.inRepository(reponame) {
+		return s.executor.UpdateRepositorySetCustomProperties(ctx, dryrun, reponame, properties, valueTypes)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateRepositoryAddTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
+	if s.inRepositoryOrTeam(reponame, teamslug) {
+		return s.executor.UpdateRepositoryAddTeamAccess(ctx, dryrun, reponame, teamslug, permission)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateRepositoryUpdateTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
+	if s.inRepositoryOrTeam(reponame, teamslug) {
+		return s.executor.UpdateRepositoryUpdateTeamAccess(ctx, dryrun, reponame, teamslug, permission)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateRepositoryRemoveTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string) error {
+	if s.inRepositoryOrTeam(reponame, teamslug) {
+		return s.executor.UpdateRepositoryRemoveTeamAccess(ctx, dryrun, reponame, teamslug)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) AddRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) error {
+	if s.inRulesets() {
+		return s.executor.AddRuleset(ctx, dryrun, ruleset)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateRuleset(ctx context.Context, dryrun bool, ruleset *GithubRuleSet) error {
+	if s.inRulesets() {
+		return s.executor.UpdateRuleset(ctx, dryrun, ruleset)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) DeleteRuleset(ctx context.Context, dryrun bool, rulesetid int) error {
+	if s.inRulesets() {
+		return s.executor.DeleteRuleset(ctx, dryrun, rulesetid)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) AddRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) error {
+	if s.inRepository(reponame) {
+		return s.executor.AddRepositoryRuleset(ctx, dryrun, reponame, ruleset)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *GithubRuleSet) error {
+	if s.inRepository(reponame) {
+		return s.executor.UpdateRepositoryRuleset(ctx, dryrun, reponame, ruleset)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) DeleteRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, rulesetid int) error {
+	if s.inRepository(reponame) {
+		return s.executor.DeleteRepositoryRuleset(ctx, dryrun, reponame, rulesetid)
+	}
+	return nil
+}
+
+// the organization custom properties definitions are only reconciled by a full apply
+
+func (s *ScopedExecutor) AddCustomProperty(ctx context.Context, dryrun bool, property *GithubCustomProperty) error {
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateCustomProperty(ctx context.Context, dryrun bool, property *GithubCustomProperty) error {
+	return nil
+}
+
+func (s *ScopedExecutor) DeleteCustomProperty(ctx context.Context, dryrun bool, propertyname string) error {
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateRepositorySetExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string, permission string) error {
+	if s.inRepository(reponame) {
+		return s.executor.UpdateRepositorySetExternalUser(ctx, dryrun, reponame, githubid, permission)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateRepositoryRemoveExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error {
+	if s.inRepository(reponame) {
+		return s.executor.UpdateRepositoryRemoveExternalUser(ctx, dryrun, reponame, githubid)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) UpdateRepositoryRemoveInternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error {
+	if s.inRepository(reponame) {
+		return s.executor.UpdateRepositoryRemoveInternalUser(ctx, dryrun, reponame, githubid)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) DeleteRepository(ctx context.Context, dryrun bool, reponame string) error {
+	if s.inRepository(reponame) {
+		return s.executor.DeleteRepository(ctx, dryrun, reponame)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) RenameRepository(ctx context.Context, dryrun bool, reponame string, newname string) error {
+	if s.inRepository(reponame) {
+		return s.executor.RenameRepository(ctx, dryrun, reponame, newname)
+	}
+	return nil
+}
+
+func (s *ScopedExecutor) Begin(dryrun bool) {
+	s.executor.Begin(dryrun)
+}
+
+func (s *ScopedExecutor) Rollback(dryrun bool, err error) {
+	s.executor.Rollback(dryrun, err)
+}
+
+func (s *ScopedExecutor) Commit(ctx context.Context, dryrun bool) error {
+	return s.executor.Commit(ctx, dryrun)
+}
@@ -0,0 +1,249 @@
+package entity
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Alayacare/goliac/internal/utils"
+	"github.com/go-git/go-billy/v5"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * CustomPropertyValue is the value of a custom property: a single value
+ * (string, single_select, true_false) or a list of values (multi_select).
+ * In yaml it can be written as a scalar or as a list
+ */
+type CustomPropertyValue []string
+
+func (v *CustomPropertyValue) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		if value.Tag == "!!null" {
+			*v = CustomPropertyValue{}
+		} else {
+			*v = CustomPropertyValue{value.Value}
+		}
+		return nil
+	case yaml.SequenceNode:
+		values := []string{}
+		if err := value.Decode(&values); err != nil {
+			return err
+		}
+		*v = CustomPropertyValue(values)
+		return nil
+	}
+	return fmt.Errorf("invalid custom property value at line %d: it must be a value or a list of values", value.Line)
+}
+
+func (v CustomPropertyValue) MarshalYAML() (interface{}, error) {
+	if len(v) == 1 {
+		return v[0], nil
+	}
+	return []string(v), nil
+}
+
+/*
+ * CustomProperty is the definition (the schema) of an organization custom property.
+ * The values are set per repository (see Repository.Spec.Properties)
+ */
+type CustomProperty struct {
+	Entity `yaml:",inline"`
+	Spec   struct {
+		ValueType     string              `yaml:"value_type"` // string, single_select, multi_select, true_false
+		Required      bool                `yaml:"required,omitempty"`
+		DefaultValue  CustomPropertyValue `yaml:"default_value,omitempty"`  // mandatory if required
+		AllowedValues []string            `yaml:"allowed_values,omitempty"` // only for single_select and multi_select
+		Description   string              `yaml:"description,omitempty"`
+	} `yaml:"spec"`
+}
+
+// Github custom property names: letters, numbers, and the _ - $ # characters (up to 75 characters)
+var customPropertyNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_\-$#]{1,75}$`)
+
+/*
+ * NewCustomProperty reads a file and returns a CustomProperty object
+ * The next step is to validate the CustomProperty object using the Validate method
+ */
+func NewCustomProperty(fs billy.Filesystem, filename string) (*CustomProperty, error) {
+	filecontent, err := utils.ReadFile(fs, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	property := CustomProperty{}
+	err = yaml.Unmarshal(filecontent, &property)
+	if err != nil {
+		return nil, err
+	}
+
+	return &property, nil
+}
+
+/**
+ * ReadCustomPropertyDirectory reads all the files in the dirname directory and returns
+ * - a map of CustomProperty objects
+ * - a slice of errors that must stop the validation process
+ * - a slice of warning that must not stop the validation process
+ */
+func ReadCustomPropertyDirectory(fs billy.Filesystem, dirname string) (map[string]*CustomProperty, []error, []Warning) {
+	errors := []error{}
+	warning := []Warning{}
+	properties := make(map[string]*CustomProperty)
+
+	exist, err := utils.Exists(fs, dirname)
+	if err != nil {
+		errors = append(errors, err)
+		return properties, errors, warning
+	}
+	if !exist {
+		return properties, errors, warning
+	}
+
+	// Parse all the custom properties in the dirname directory
+	entries, err := fs.ReadDir(dirname)
+	if err != nil {
+		errors = append(errors, err)
+		return properties, errors, warning
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		// skipping files starting with '.'
+		if e.Name()[0] == '.' {
+			continue
+		}
+		property, err := NewCustomProperty(fs, filepath.Join(dirname, e.Name()))
+		if err != nil {
+			errors = append(errors, err)
+		} else {
+			err := property.Validate(filepath.Join(dirname, e.Name()))
+			if err != nil {
+				errors = append(errors, err)
+			} else {
+				properties[property.Name] = property
+			}
+		}
+	}
+	return properties, errors, warning
+}
+
+func (p *CustomProperty) Validate(filename string) error {
+
+	if p.ApiVersion != "v1" {
+		return fmt.Errorf("invalid apiVersion: %s for custom property filename %s", p.ApiVersion, filename)
+	}
+
+	if p.Kind != "CustomProperty" {
+		return fmt.Errorf("invalid kind: %s for custom property filename %s", p.Kind, filename)
+	}
+
+	if p.Name == "" {
+		return fmt.Errorf("metadata.name is empty for custom property filename %s", filename)
+	}
+
+	filename = filepath.Base(filename)
+	if p.Name != filename[:len(filename)-len(filepath.Ext(filename))] {
+		return fmt.Errorf("invalid metadata.name: %s for custom property filename %s", p.Name, filename)
+	}
+
+	if !customPropertyNamePattern.MatchString(p.Name) {
+		return fmt.Errorf("invalid metadata.name: %s must only contain letters, numbers, _, -, $ or # (up to 75 characters) for custom property filename %s", p.Name, filename)
+	}
+
+	switch p.Spec.ValueType {
+	case "string", "true_false":
+		if len(p.Spec.AllowedValues) != 0 {
+			return fmt.Errorf("allowed_values can only be used with single_select and multi_select value types for custom property filename %s", filename)
+		}
+	case "single_select", "multi_select":
+		if len(p.Spec.AllowedValues) == 0 {
+			return fmt.Errorf("allowed_values is mandatory for the %s value type for custom property filename %s", p.Spec.ValueType, filename)
+		}
+		allowed := make(map[string]bool)
+		for _, v := range p.Spec.AllowedValues {
+			if allowed[v] {
+				return fmt.Errorf("invalid allowed_values: %s is listed twice for custom property filename %s", v, filename)
+			}
+			allowed[v] = true
+		}
+	default:
+		return fmt.Errorf("invalid value_type: %s, it must be one of string,single_select,multi_select,true_false for custom property filename %s", p.Spec.ValueType, filename)
+	}
+
+	if p.Spec.Required && len(p.Spec.DefaultValue) == 0 {
+		return fmt.Errorf("a required custom property must have a default_value for custom property filename %s", filename)
+	}
+
+	if len(p.Spec.DefaultValue) != 0 {
+		if err := p.ValidateValue(p.Spec.DefaultValue); err != nil {
+			return fmt.Errorf("invalid default_value: %v for custom property filename %s", err, filename)
+		}
+	}
+
+	return nil
+}
+
+/*
+ * ValidateValue checks that a value matches the custom property value type
+ * (and its allowed values)
+ */
+func (p *CustomProperty) ValidateValue(value CustomPropertyValue) error {
+	if p.Spec.ValueType != "multi_select" && len(value) > 1 {
+		return fmt.Errorf("%s expects a single value (found %s)", p.Name, strings.Join(value, ","))
+	}
+	switch p.Spec.ValueType {
+	case "true_false":
+		for _, v := range value {
+			if v != "true" && v != "false" {
+				return fmt.Errorf("%s expects true or false (found %s)", p.Name, v)
+			}
+		}
+	case "single_select", "multi_select":
+		for _, v := range value {
+			found := false
+			for _, a := range p.Spec.AllowedValues {
+				if v == a {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("%s doesn't allow %s (allowed values are %s)", p.Name, v, strings.Join(p.Spec.AllowedValues, ","))
+			}
+		}
+	}
+	return nil
+}
+
+/*
+ * ValidateProperties checks the repository custom property values against the
+ * organization custom properties definitions
+ */
+func (r *Repository) ValidateProperties(customProperties map[string]*CustomProperty) error {
+	names := make([]string, 0, len(r.Spec.Properties))
+	for name := range r.Spec.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := customProperties[name]
+		if !ok {
+			return fmt.Errorf("invalid property: custom property %s is not defined (check repository %s)", name, r.Name)
+		}
+		value := r.Spec.Properties[name]
+		if len(value) == 0 && property.Spec.Required {
+			return fmt.Errorf("invalid property: custom property %s is required and cannot be unset (check repository %s)", name, r.Name)
+		}
+		if err := property.ValidateValue(value); err != nil {
+			return fmt.Errorf("invalid property: %v (check repository %s)", err, r.Name)
+		}
+	}
+	return nil
+}
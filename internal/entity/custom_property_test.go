@@ -0,0 +1,175 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/Alayacare/goliac/internal/utils"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func fixtureCreateCustomProperties(t *testing.T, fs billy.Filesystem) {
+	fs.MkdirAll("custom_properties", 0755)
+	err := utils.WriteFile(fs, "custom_properties/tier.yaml", []byte(`
+apiVersion: v1
+kind: CustomProperty
+name: tier
+spec:
+  value_type: single_select
+  required: true
+  default_value: bronze
+  allowed_values:
+    - gold
+    - silver
+    - bronze
+`), 0644)
+	assert.Nil(t, err)
+
+	err = utils.WriteFile(fs, "custom_properties/data-classification.yaml", []byte(`
+apiVersion: v1
+kind: CustomProperty
+name: data-classification
+spec:
+  value_type: multi_select
+  allowed_values:
+    - pii
+    - phi
+    - public
+`), 0644)
+	assert.Nil(t, err)
+
+	err = utils.WriteFile(fs, "custom_properties/owner-cost-center.yaml", []byte(`
+apiVersion: v1
+kind: CustomProperty
+name: owner-cost-center
+spec:
+  value_type: string
+  description: the cost center paying for the repository
+`), 0644)
+	assert.Nil(t, err)
+}
+
+func TestCustomProperty(t *testing.T) {
+
+	t.Run("happy path", func(t *testing.T) {
+		fs := memfs.New()
+		fixtureCreateCustomProperties(t, fs)
+
+		properties, errs, warns := ReadCustomPropertyDirectory(fs, "custom_properties")
+		assert.Equal(t, 0, len(errs))
+		assert.Equal(t, 0, len(warns))
+		assert.Equal(t, 3, len(properties))
+		assert.Equal(t, CustomPropertyValue{"bronze"}, properties["tier"].Spec.DefaultValue)
+		assert.Equal(t, []string{"pii", "phi", "public"}, properties["data-classification"].Spec.AllowedValues)
+	})
+
+	t.Run("happy path: no custom_properties directory", func(t *testing.T) {
+		fs := memfs.New()
+
+		properties, errs, warns := ReadCustomPropertyDirectory(fs, "custom_properties")
+		assert.Equal(t, 0, len(errs))
+		assert.Equal(t, 0, len(warns))
+		assert.Equal(t, 0, len(properties))
+	})
+
+	t.Run("not happy path: invalid definitions", func(t *testing.T) {
+		fs := memfs.New()
+		fs.MkdirAll("custom_properties", 0755)
+		for filename, content := range map[string]string{
+			"wrongtype.yaml": `
+apiVersion: v1
+kind: CustomProperty
+name: wrongtype
+spec:
+  value_type: number
+`,
+			"noallowed.yaml": `
+apiVersion: v1
+kind: CustomProperty
+name: noallowed
+spec:
+  value_type: single_select
+`,
+			"nodefault.yaml": `
+apiVersion: v1
+kind: CustomProperty
+name: nodefault
+spec:
+  value_type: string
+  required: true
+`,
+			"wrongdefault.yaml": `
+apiVersion: v1
+kind: CustomProperty
+name: wrongdefault
+spec:
+  value_type: single_select
+  default_value: platinum
+  allowed_values:
+    - gold
+`,
+			"wrongname.yaml": `
+apiVersion: v1
+kind: CustomProperty
+name: anothername
+spec:
+  value_type: string
+`,
+		} {
+			assert.Nil(t, utils.WriteFile(fs, "custom_properties/"+filename, []byte(content), 0644))
+		}
+
+		properties, errs, _ := ReadCustomPropertyDirectory(fs, "custom_properties")
+		assert.Equal(t, 5, len(errs))
+		assert.Equal(t, 0, len(properties))
+	})
+}
+
+func TestRepositoryProperties(t *testing.T) {
+
+	t.Run("happy path: valid values", func(t *testing.T) {
+		fs := memfs.New()
+		fixtureCreateCustomProperties(t, fs)
+		properties, _, _ := ReadCustomPropertyDirectory(fs, "custom_properties")
+
+		fs.MkdirAll("teams/team1", 0755)
+		err := utils.WriteFile(fs, "teams/team1/repo1.yaml", []byte(`
+apiVersion: v1
+kind: Repository
+name: repo1
+spec:
+  properties:
+    tier: gold
+    data-classification:
+      - pii
+      - phi
+    owner-cost-center: "1234"
+`), 0644)
+		assert.Nil(t, err)
+
+		repo, err := NewRepository(fs, "teams/team1/repo1.yaml")
+		assert.Nil(t, err)
+		assert.Equal(t, CustomPropertyValue{"pii", "phi"}, repo.Spec.Properties["data-classification"])
+		assert.Nil(t, repo.ValidateProperties(properties))
+	})
+
+	t.Run("not happy path: invalid values", func(t *testing.T) {
+		fs := memfs.New()
+		fixtureCreateCustomProperties(t, fs)
+		properties, _, _ := ReadCustomPropertyDirectory(fs, "custom_properties")
+
+		for _, values := range []map[string]CustomPropertyValue{
+			{"unknown": {"value"}},
+			{"tier": {"platinum"}},
+			{"tier": {"gold", "silver"}},
+			{"tier": {}},
+			{"data-classification": {"pii", "secret"}},
+		} {
+			repo := &Repository{}
+			repo.Name = "repo1"
+			repo.Spec.Properties = values
+			assert.NotNil(t, repo.ValidateProperties(properties), values)
+		}
+	})
+}
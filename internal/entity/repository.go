@@ -3,6 +3,7 @@ package entity
 import (
 	"fmt"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/Alayacare/goliac/internal/utils"
@@ -17,11 +18,38 @@ type Repository struct {
 		Readers             []string            `yaml:"readers,omitempty"`
 		ExternalUserReaders []string            `yaml:"externalUserReaders,omitempty"`
 		ExternalUserWriters []string            `yaml:"externalUserWriters,omitempty"`
-		IsPublic            bool                `yaml:"public,omitempty"`
+		IsPublic            bool                `yaml:"public,omitempty"`     // deprecated: use visibility
+		Visibility          string              `yaml:"visibility,omitempty"` // public, private or internal (Enterprise only)
 		AllowAutoMerge      bool                `yaml:"allow_auto_merge,omitempty"`
 		DeleteBranchOnMerge bool                `yaml:"delete_branch_on_merge,omitempty"`
 		AllowUpdateBranch   bool                `yaml:"allow_update_branch,omitempty"`
 		Rulesets            []RepositoryRuleSet `yaml:"rulesets,omitempty"`
+
+		// merge strategies and features are only managed when they are set
+		// (here or in the goliac.yaml repository_defaults)
+		AllowMergeCommit         *bool `yaml:"allow_merge_commit,omitempty"`
+		AllowRebaseMerge         *bool `yaml:"allow_rebase_merge,omitempty"`
+		AllowSquashMerge         *bool `yaml:"allow_squash_merge,omitempty"`
+		AllowForking             *bool `yaml:"allow_forking,omitempty"`
+		WebCommitSignoffRequired *bool `yaml:"web_commit_signoff_required,omitempty"`
+		HasIssues                *bool `yaml:"has_issues,omitempty"`
+		HasWiki                  *bool `yaml:"has_wiki,omitempty"`
+		HasProjects              *bool `yaml:"has_projects,omitempty"`
+		HasDiscussions           *bool `yaml:"has_discussions,omitempty"`
+
+		Topics []string `yaml:"topics,omitempty"` // not managed when not set (an empty list removes all topics)
+
+		// organization custom properties values (only the listed ones are managed)
+		Properties map[string]CustomPropertyValue `yaml:"properties,omitempty"`
+
+		// string settings are only managed when they are set
+		Description              string `yaml:"description,omitempty"`
+		Homepage                 string `yaml:"homepage,omitempty"`
+		DefaultBranch            string `yaml:"default_branch,omitempty"`
+		SquashMergeCommitTitle   string `yaml:"squash_merge_commit_title,omitempty"`   // PR_TITLE or COMMIT_OR_PR_TITLE
+		SquashMergeCommitMessage string `yaml:"squash_merge_commit_message,omitempty"` // PR_BODY, COMMIT_MESSAGES or BLANK
+		MergeCommitTitle         string `yaml:"merge_commit_title,omitempty"`          // PR_TITLE or MERGE_MESSAGE
+		MergeCommitMessage       string `yaml:"merge_commit_message,omitempty"`        // PR_BODY, PR_TITLE or BLANK
 	} `yaml:"spec,omitempty"`
 	Archived      bool    `yaml:"archived,omitempty"` // implicit: will be set by Goliac
 	Owner         *string `yaml:"-"`                  // implicit. team name owning the repo (if any)
@@ -231,9 +259,138 @@ func (r *Repository) Validate(filename string, teams map[string]*Team, externalU
 		rulesetname[ruleset.Name] = true
 	}
 
+	if isFalse(r.Spec.AllowMergeCommit) && isFalse(r.Spec.AllowRebaseMerge) && isFalse(r.Spec.AllowSquashMerge) {
+		return fmt.Errorf("invalid merge strategies: at least one of allow_merge_commit, allow_rebase_merge or allow_squash_merge must be allowed (check repository filename %s)", filename)
+	}
+
+	if err := r.validateVisibility(filename); err != nil {
+		return err
+	}
+
+	if err := r.validateStringSettings(filename); err != nil {
+		return err
+	}
+
+	if err := r.validateTopics(filename); err != nil {
+		return err
+	}
+
 	if utils.GithubAnsiString(r.Name) != r.Name {
 		return fmt.Errorf("invalid name: %s will be changed to %s (check repository filename %s)", r.Name, utils.GithubAnsiString(r.Name), filename)
 	}
 
 	return nil
 }
+
+/*
+ * Visibility returns the repository visibility (public, private or internal).
+ * Without visibility, the (older) public field is used
+ */
+func (r *Repository) Visibility() string {
+	if r.Spec.Visibility != "" {
+		return r.Spec.Visibility
+	}
+	if r.Spec.IsPublic {
+		return "public"
+	}
+	return "private"
+}
+
+func (r *Repository) validateVisibility(filename string) error {
+	if r.Spec.Visibility == "" {
+		return nil
+	}
+	if r.Spec.Visibility != "public" && r.Spec.Visibility != "private" && r.Spec.Visibility != "internal" {
+		return fmt.Errorf("invalid visibility: %s, it must be one of public,private,internal (check repository filename %s)", r.Spec.Visibility, filename)
+	}
+	if r.Spec.IsPublic && r.Spec.Visibility != "public" {
+		return fmt.Errorf("invalid visibility: %s contradicts public: true (check repository filename %s)", r.Spec.Visibility, filename)
+	}
+	return nil
+}
+
+/*
+ * ValidateVisibility checks that the repository visibility is available
+ * on the Github organization (internal repositories need Github Enterprise)
+ */
+func (r *Repository) ValidateVisibility(isEnterprise bool) error {
+	if r.Visibility() == "internal" && !isEnterprise {
+		return fmt.Errorf("invalid visibility: internal repositories are only available on Github Enterprise (check repository %s)", r.Name)
+	}
+	return nil
+}
+
+/*
+ * validateStringSettings checks the merge commit formats against the values
+ * accepted by Github (a message can only be set with its title)
+ */
+func (r *Repository) validateStringSettings(filename string) error {
+	enums := []struct {
+		name    string
+		value   string
+		allowed []string
+	}{
+		{"squash_merge_commit_title", r.Spec.SquashMergeCommitTitle, []string{"PR_TITLE", "COMMIT_OR_PR_TITLE"}},
+		{"squash_merge_commit_message", r.Spec.SquashMergeCommitMessage, []string{"PR_BODY", "COMMIT_MESSAGES", "BLANK"}},
+		{"merge_commit_title", r.Spec.MergeCommitTitle, []string{"PR_TITLE", "MERGE_MESSAGE"}},
+		{"merge_commit_message", r.Spec.MergeCommitMessage, []string{"PR_BODY", "PR_TITLE", "BLANK"}},
+	}
+	for _, e := range enums {
+		if e.value == "" {
+			continue
+		}
+		found := false
+		for _, a := range e.allowed {
+			if e.value == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("invalid %s: %s, it must be one of %s (check repository filename %s)", e.name, e.value, strings.Join(e.allowed, ","), filename)
+		}
+	}
+
+	if r.Spec.SquashMergeCommitMessage != "" && r.Spec.SquashMergeCommitTitle == "" {
+		return fmt.Errorf("squash_merge_commit_message requires squash_merge_commit_title (check repository filename %s)", filename)
+	}
+	if r.Spec.MergeCommitMessage != "" && r.Spec.MergeCommitTitle == "" {
+		return fmt.Errorf("merge_commit_message requires merge_commit_title (check repository filename %s)", filename)
+	}
+	if r.Spec.SquashMergeCommitTitle == "COMMIT_OR_PR_TITLE" && r.Spec.SquashMergeCommitMessage != "" && r.Spec.SquashMergeCommitMessage != "COMMIT_MESSAGES" {
+		return fmt.Errorf("squash_merge_commit_title COMMIT_OR_PR_TITLE can only be used with squash_merge_commit_message COMMIT_MESSAGES (check repository filename %s)", filename)
+	}
+	if r.Spec.MergeCommitTitle == "MERGE_MESSAGE" && r.Spec.MergeCommitMessage != "" && r.Spec.MergeCommitMessage != "PR_TITLE" {
+		return fmt.Errorf("merge_commit_title MERGE_MESSAGE can only be used with merge_commit_message PR_TITLE (check repository filename %s)", filename)
+	}
+	if strings.ContainsAny(r.Spec.DefaultBranch, " ~^:?*[\\") {
+		return fmt.Errorf("invalid default_branch: %s is not a valid branch name (check repository filename %s)", r.Spec.DefaultBranch, filename)
+	}
+	return nil
+}
+
+// Github topics: lowercase letters, numbers and hyphens, up to 50 characters
+var topicPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
+const maxTopics = 20
+
+func (r *Repository) validateTopics(filename string) error {
+	if len(r.Spec.Topics) > maxTopics {
+		return fmt.Errorf("invalid topics: a repository can have at most %d topics (check repository filename %s)", maxTopics, filename)
+	}
+	topics := make(map[string]bool)
+	for _, topic := range r.Spec.Topics {
+		if !topicPattern.MatchString(topic) {
+			return fmt.Errorf("invalid topic: %s, a topic must start with a lowercase letter or a number, and contain only lowercase letters, numbers and hyphens, up to 50 characters (check repository filename %s)", topic, filename)
+		}
+		if topics[topic] {
+			return fmt.Errorf("invalid topics: %s is listed 2 times (check repository filename %s)", topic, filename)
+		}
+		topics[topic] = true
+	}
+	return nil
+}
+
+func isFalse(b *bool) bool {
+	return b != nil && !*b
+}
@@ -214,4 +214,189 @@ name: repo1
 		assert.NotNil(t, repos)
 		assert.Equal(t, len(repos), 1)
 	})
+
+	t.Run("happy path: string settings", func(t *testing.T) {
+		fs := memfs.New()
+		fixtureCreateUserTeam(t, fs)
+
+		err := utils.WriteFile(fs, "teams/team1/repo1.yaml", []byte(`
+apiVersion: v1
+kind: Repository
+name: repo1
+spec:
+  description: the first repository
+  homepage: https://example.com
+  default_branch: main
+  squash_merge_commit_title: PR_TITLE
+  squash_merge_commit_message: PR_BODY
+  merge_commit_title: MERGE_MESSAGE
+`), 0644)
+		assert.Nil(t, err)
+		users, _, _ := ReadUserDirectory(fs, "users")
+		teams, _, _ := ReadTeamDirectory(fs, "teams", users)
+
+		repos, errs, warns := ReadRepositories(fs, "archived", "teams", teams, map[string]*User{})
+		assert.Equal(t, 0, len(errs))
+		assert.Equal(t, 0, len(warns))
+		assert.Equal(t, "the first repository", repos["repo1"].Spec.Description)
+		assert.Equal(t, "main", repos["repo1"].Spec.DefaultBranch)
+		assert.Equal(t, "PR_BODY", repos["repo1"].Spec.SquashMergeCommitMessage)
+	})
+
+	t.Run("not happy path: invalid string settings", func(t *testing.T) {
+		for _, spec := range []string{
+			"squash_merge_commit_title: TITLE",
+			"merge_commit_message: BLANK",
+			"merge_commit_title: MERGE_MESSAGE\n  merge_commit_message: PR_BODY",
+			"squash_merge_commit_title: COMMIT_OR_PR_TITLE\n  squash_merge_commit_message: BLANK",
+			"default_branch: my branch",
+		} {
+			fs := memfs.New()
+			fixtureCreateUserTeam(t, fs)
+
+			err := utils.WriteFile(fs, "teams/team1/repo1.yaml", []byte(`
+apiVersion: v1
+kind: Repository
+name: repo1
+spec:
+  `+spec+`
+`), 0644)
+			assert.Nil(t, err)
+			users, _, _ := ReadUserDirectory(fs, "users")
+			teams, _, _ := ReadTeamDirectory(fs, "teams", users)
+
+			_, errs, _ := ReadRepositories(fs, "archived", "teams", teams, map[string]*User{})
+			assert.Equal(t, 1, len(errs), spec)
+		}
+	})
+
+	t.Run("happy path: merge strategies and features", func(t *testing.T) {
+		fs := memfs.New()
+		fixtureCreateUserTeam(t, fs)
+
+		err := utils.WriteFile(fs, "teams/team1/repo1.yaml", []byte(`
+apiVersion: v1
+kind: Repository
+name: repo1
+spec:
+  allow_merge_commit: false
+  allow_squash_merge: true
+  has_wiki: false
+`), 0644)
+		assert.Nil(t, err)
+		users, _, _ := ReadUserDirectory(fs, "users")
+		teams, _, _ := ReadTeamDirectory(fs, "teams", users)
+
+		repos, errs, _ := ReadRepositories(fs, "archived", "teams", teams, map[string]*User{})
+		assert.Equal(t, 0, len(errs))
+		assert.False(t, *repos["repo1"].Spec.AllowMergeCommit)
+		assert.True(t, *repos["repo1"].Spec.AllowSquashMerge)
+		assert.False(t, *repos["repo1"].Spec.HasWiki)
+		assert.Nil(t, repos["repo1"].Spec.HasIssues)
+	})
+
+	t.Run("not happy path: no merge strategy allowed", func(t *testing.T) {
+		fs := memfs.New()
+		fixtureCreateUserTeam(t, fs)
+
+		err := utils.WriteFile(fs, "teams/team1/repo1.yaml", []byte(`
+apiVersion: v1
+kind: Repository
+name: repo1
+spec:
+  allow_merge_commit: false
+  allow_rebase_merge: false
+  allow_squash_merge: false
+`), 0644)
+		assert.Nil(t, err)
+		users, _, _ := ReadUserDirectory(fs, "users")
+		teams, _, _ := ReadTeamDirectory(fs, "teams", users)
+
+		_, errs, _ := ReadRepositories(fs, "archived", "teams", teams, map[string]*User{})
+		assert.Equal(t, 1, len(errs))
+	})
+
+	t.Run("happy path: visibility", func(t *testing.T) {
+		for spec, visibility := range map[string]string{
+			"":                                   "private",
+			"public: true":                       "public",
+			"visibility: internal":               "internal",
+			"public: true\n  visibility: public": "public",
+		} {
+			fs := memfs.New()
+			fixtureCreateUserTeam(t, fs)
+
+			err := utils.WriteFile(fs, "teams/team1/repo1.yaml", []byte(`
+apiVersion: v1
+kind: Repository
+name: repo1
+spec:
+  `+spec+`
+`), 0644)
+			assert.Nil(t, err)
+			users, _, _ := ReadUserDirectory(fs, "users")
+			teams, _, _ := ReadTeamDirectory(fs, "teams", users)
+
+			repos, errs, _ := ReadRepositories(fs, "archived", "teams", teams, map[string]*User{})
+			assert.Equal(t, 0, len(errs), spec)
+			assert.Equal(t, visibility, repos["repo1"].Visibility(), spec)
+		}
+	})
+
+	t.Run("not happy path: invalid visibility", func(t *testing.T) {
+		for _, spec := range []string{
+			"visibility: secret",
+			"public: true\n  visibility: private",
+		} {
+			fs := memfs.New()
+			fixtureCreateUserTeam(t, fs)
+
+			err := utils.WriteFile(fs, "teams/team1/repo1.yaml", []byte(`
+apiVersion: v1
+kind: Repository
+name: repo1
+spec:
+  `+spec+`
+`), 0644)
+			assert.Nil(t, err)
+			users, _, _ := ReadUserDirectory(fs, "users")
+			teams, _, _ := ReadTeamDirectory(fs, "teams", users)
+
+			_, errs, _ := ReadRepositories(fs, "archived", "teams", teams, map[string]*User{})
+			assert.Equal(t, 1, len(errs), spec)
+		}
+
+		// internal repositories need Github Enterprise
+		repo := &Repository{}
+		repo.Name = "repo1"
+		repo.Spec.Visibility = "internal"
+		assert.Nil(t, repo.ValidateVisibility(true))
+		assert.NotNil(t, repo.ValidateVisibility(false))
+	})
+
+	t.Run("not happy path: invalid topics", func(t *testing.T) {
+		for _, topics := range []string{
+			"[Backend]",
+			"[-backend]",
+			"[backend, backend]",
+			"[backend_api]",
+		} {
+			fs := memfs.New()
+			fixtureCreateUserTeam(t, fs)
+
+			err := utils.WriteFile(fs, "teams/team1/repo1.yaml", []byte(`
+apiVersion: v1
+kind: Repository
+name: repo1
+spec:
+  topics: `+topics+`
+`), 0644)
+			assert.Nil(t, err)
+			users, _, _ := ReadUserDirectory(fs, "users")
+			teams, _, _ := ReadTeamDirectory(fs, "teams", users)
+
+			_, errs, _ := ReadRepositories(fs, "archived", "teams", teams, map[string]*User{})
+			assert.Equal(t, 1, len(errs), topics)
+		}
+	})
 }
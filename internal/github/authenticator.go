@@ -0,0 +1,168 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/Alayacare/goliac/internal/utils"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	AUTH_MODE_APP     = "app"     // Github App (private key in a file, or inline)
+	AUTH_MODE_PAT     = "pat"     // (fine-grained) personal access token
+	AUTH_MODE_ACTIONS = "actions" // GITHUB_TOKEN of a Github Actions workflow
+)
+
+/*
+ * Authenticator provides the token used to authenticate the Github calls
+ */
+type Authenticator interface {
+	// returns a valid token (renewed if needed)
+	Token(ctx context.Context) (string, error)
+	// returns the Github App slug ("" if we are not authenticated as a Github App)
+	AppSlug() string
+	// describes who we are authenticated as (used in the logs and in the error messages)
+	String() string
+}
+
+/*
+ * TokenAuthenticator authenticates with a static token
+ * (personal access token, or the GITHUB_TOKEN of a Github Actions workflow)
+ */
+type TokenAuthenticator struct {
+	token       string
+	appSlug     string
+	description string
+}
+
+func NewTokenAuthenticator(token string, appSlug string, description string) *TokenAuthenticator {
+	return &TokenAuthenticator{
+		token:       token,
+		appSlug:     appSlug,
+		description: description,
+	}
+}
+
+func (auth *TokenAuthenticator) Token(ctx context.Context) (string, error) {
+	return auth.token, nil
+}
+
+func (auth *TokenAuthenticator) AppSlug() string {
+	return auth.appSlug
+}
+
+func (auth *TokenAuthenticator) String() string {
+	return auth.description
+}
+
+/*
+ * NewAuthenticatorFromConfig returns the authenticator of the configured
+ * authentication mode (GOLIAC_GITHUB_AUTH_MODE).
+ * appID, privateKeyFile and privateKey (inline, takes precedence) are used in app mode
+ * (the private key file is watched by utils.DefaultSecretsWatcher)
+ */
+func NewAuthenticatorFromConfig(githubServer, organizationName string, appID int64, privateKeyFile string, privateKey string) (Authenticator, error) {
+	switch config.Config.GithubAuthMode {
+	case AUTH_MODE_APP, "":
+		key := utils.NewStaticSecret(fmt.Sprintf("Github App %d private key", appID), []byte(privateKey))
+		if privateKey == "" {
+			var err error
+			key, err = utils.NewSecretFile(fmt.Sprintf("Github App %d private key", appID), privateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			// reloaded when rotated (by the Goliac server), if the new key can be parsed
+			key.SetValidator(func(value []byte) error {
+				_, err := jwt.ParseRSAPrivateKeyFromPEM(value)
+				return err
+			})
+			utils.DefaultSecretsWatcher.Watch(key)
+		}
+		return NewAppAuthenticator(githubServer, organizationName, appID, key)
+	case AUTH_MODE_PAT:
+		if config.Config.GithubToken == "" {
+			return nil, fmt.Errorf("GOLIAC_GITHUB_TOKEN must be set to authenticate with a personal access token")
+		}
+		return NewTokenAuthenticator(config.Config.GithubToken, "", "the personal access token"), nil
+	case AUTH_MODE_ACTIONS:
+		token := config.Config.GithubToken
+		if token == "" {
+			token = config.Config.GithubActionsToken
+		}
+		if token == "" {
+			return nil, fmt.Errorf("GITHUB_TOKEN (or GOLIAC_GITHUB_TOKEN) must be set to authenticate with the Github Actions token")
+		}
+		// the GITHUB_TOKEN belongs to the github-actions app
+		return NewTokenAuthenticator(token, "github-actions", "the Github Actions GITHUB_TOKEN"), nil
+	}
+	return nil, fmt.Errorf("unknown Github authentication mode %s (expected %s, %s or %s)", config.Config.GithubAuthMode, AUTH_MODE_APP, AUTH_MODE_PAT, AUTH_MODE_ACTIONS)
+}
+
+/*
+ * permissionError explains a forbidden call (403, or 404 for a resource we are not allowed to see):
+ * Github tells which permissions (Github Apps, fine-grained tokens) or which scopes (classic tokens)
+ * the call needs. It returns nil if Github didn't tell
+ */
+func permissionError(resp *http.Response, authenticator Authenticator) error {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusNotFound {
+		return nil
+	}
+	who := "the Github token"
+	if authenticator != nil {
+		who = authenticator.String()
+	}
+
+	if needed := resp.Header.Get("X-Accepted-GitHub-Permissions"); needed != "" {
+		return fmt.Errorf("unexpected status: %s: %s lacks the permission(s) needed by this call: %s", resp.Status, who, needed)
+	}
+
+	needed := resp.Header.Get("X-Accepted-OAuth-Scopes")
+	if needed == "" {
+		return nil
+	}
+	granted := make(map[string]bool)
+	for _, scope := range strings.Split(resp.Header.Get("X-OAuth-Scopes"), ",") {
+		granted[strings.TrimSpace(scope)] = true
+	}
+	for _, scope := range strings.Split(needed, ",") {
+		if granted[strings.TrimSpace(scope)] {
+			// the token has (one of) the scope(s) needed: the call is forbidden for another reason
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected status: %s: %s lacks the scope(s) needed by this call: %s (granted: %s)", resp.Status, who, needed, resp.Header.Get("X-OAuth-Scopes"))
+}
+
+/*
+ * graphQLScopesError explains a GraphQL query refused because of missing scopes
+ * (Github answers with a 200 and an INSUFFICIENT_SCOPES error). It returns nil otherwise
+ */
+func graphQLScopesError(body []byte, authenticator Authenticator) error {
+	if !strings.Contains(string(body), "INSUFFICIENT_SCOPES") {
+		return nil
+	}
+	var response struct {
+		Errors []struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil
+	}
+	who := "the Github token"
+	if authenticator != nil {
+		who = authenticator.String()
+	}
+	for _, e := range response.Errors {
+		if e.Type == "INSUFFICIENT_SCOPES" {
+			return fmt.Errorf("%s lacks the scope(s) needed by this query: %s", who, e.Message)
+		}
+	}
+	return nil
+}
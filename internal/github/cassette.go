@@ -0,0 +1,297 @@
+package github
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosimple/slug"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+ * A cassette is the recording of the Github API traffic of a Goliac run
+ * (GOLIAC_RECORD_DIR), to replay it offline later (goliac plan --replay).
+ *
+ * It is a JSON lines file: a CassetteHeader, then one CassetteInteraction per call
+ * (in the order they were done). The secrets are never recorded:
+ * - the request headers are not recorded (Authorization)
+ * - the token looking values, and the values of the secret fields (token, ...),
+ *   are redacted in the request and response bodies
+ */
+type CassetteHeader struct {
+	Server     string    `json:"server"`
+	AppSlug    string    `json:"app_slug"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+type CassetteInteraction struct {
+	Method       string            `json:"method"`
+	Path         string            `json:"path"` // with the query parameters
+	RequestBody  string            `json:"request_body,omitempty"`
+	Status       int               `json:"status"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	ResponseBody string            `json:"response_body,omitempty"`
+}
+
+const CASSETTE_REDACTED = "REDACTED"
+
+// the response headers used by Goliac (rate limits, conditional requests, permissions errors)
+var cassetteHeaders = []string{
+	"Content-Type",
+	"ETag",
+	"Last-Modified",
+	"Retry-After",
+	"X-RateLimit-Limit",
+	"X-RateLimit-Remaining",
+	"X-RateLimit-Reset",
+	"X-RateLimit-Used",
+	"X-RateLimit-Resource",
+	"X-Accepted-GitHub-Permissions",
+	"X-Accepted-OAuth-Scopes",
+	"X-OAuth-Scopes",
+}
+
+// Github tokens (ghp_, gho_, ghu_, ghs_, ghr_, github_pat_) and JWTs
+var tokenPattern = regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9_]{16,}|github_pat_[A-Za-z0-9_]{16,}|eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]+)`)
+
+// the JSON fields whose value is always redacted
+var secretFieldPattern = regexp.MustCompile(`("(?:token|access_token|refresh_token|client_secret|private_key|secret|password)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+/*
+ * redactSecrets removes the secrets of a request or response body
+ */
+func redactSecrets(body string) string {
+	body = secretFieldPattern.ReplaceAllString(body, `$1"`+CASSETTE_REDACTED+`"`)
+	return tokenPattern.ReplaceAllString(body, CASSETTE_REDACTED)
+}
+
+/*
+ * cassetteRecorder appends the interactions to a cassette file.
+ * The clients authenticated as the same identity share the same cassette
+ */
+type cassetteRecorder struct {
+	path  string
+	mutex sync.Mutex
+}
+
+var cassetteRecorders = map[string]*cassetteRecorder{}
+var cassetteRecordersMutex sync.Mutex
+
+/*
+ * newCassetteRecorder creates (or reuses) the cassette of this process for this identity
+ * in dir (<dir>/<date>-<identity>.cassette)
+ */
+func newCassetteRecorder(dir string, githubServer string, authenticator Authenticator) (*cassetteRecorder, error) {
+	cassetteRecordersMutex.Lock()
+	defer cassetteRecordersMutex.Unlock()
+
+	key := filepath.Join(dir, slug.Make(authenticator.String()))
+	if recorder, ok := cassetteRecorders[key]; ok {
+		return recorder, nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("not able to create the record directory %s: %v", dir, err)
+	}
+	now := time.Now().UTC()
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.cassette", now.Format("20060102T150405"), slug.Make(authenticator.String())))
+	header, err := json.Marshal(CassetteHeader{
+		Server:     githubServer,
+		AppSlug:    authenticator.AppSlug(),
+		RecordedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, append(header, '\n'), 0600); err != nil {
+		return nil, fmt.Errorf("not able to create the cassette %s: %v", path, err)
+	}
+	logrus.Infof("recording the Github API calls in %s", path)
+
+	recorder := &cassetteRecorder{path: path}
+	cassetteRecorders[key] = recorder
+	return recorder, nil
+}
+
+func (r *cassetteRecorder) record(interaction CassetteInteraction) {
+	line, err := json.Marshal(interaction)
+	if err != nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		logrus.Warnf("not able to record in the cassette %s: %v", r.path, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		logrus.Warnf("not able to record in the cassette %s: %v", r.path, err)
+	}
+}
+
+/*
+ * RecordingTransport records the calls done through the next transport
+ */
+type RecordingTransport struct {
+	next     http.RoundTripper
+	recorder *cassetteRecorder
+	etags    *conditionalCache // to record the cached body of a 304 response
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody := ""
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			content, _ := io.ReadAll(body)
+			body.Close()
+			requestBody = string(content)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	content, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(content))
+
+	interaction := CassetteInteraction{
+		Method:       req.Method,
+		Path:         req.URL.RequestURI(),
+		RequestBody:  redactSecrets(requestBody),
+		Status:       resp.StatusCode,
+		Headers:      map[string]string{},
+		ResponseBody: redactSecrets(string(content)),
+	}
+	for _, h := range cassetteHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			interaction.Headers[h] = v
+		}
+	}
+	// the replay doesn't have our conditional cache: we record what the 304 stands for
+	if resp.StatusCode == http.StatusNotModified && t.etags != nil {
+		if cached := t.etags.get(req.URL.String()); cached != nil {
+			interaction.Status = http.StatusOK
+			interaction.ResponseBody = redactSecrets(string(cached.Body))
+		}
+	}
+	t.recorder.record(interaction)
+
+	return resp, nil
+}
+
+/*
+ * ReplayTransport answers the calls from a cassette: each call gets the response
+ * recorded for the same method, path and request body (in the recorded order
+ * if the same call was done several times, the last one being repeated)
+ */
+type ReplayTransport struct {
+	mutex        sync.Mutex
+	interactions map[string][]CassetteInteraction
+}
+
+func replayKey(method string, path string, body string) string {
+	return method + " " + path + "\n" + body
+}
+
+/*
+ * LoadCassette reads a cassette recorded with GOLIAC_RECORD_DIR
+ */
+func LoadCassette(path string) (*CassetteHeader, *ReplayTransport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not able to open the cassette %s: %v", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 256*1024*1024)
+
+	var header CassetteHeader
+	if !scanner.Scan() {
+		return nil, nil, fmt.Errorf("the cassette %s is empty", path)
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, nil, fmt.Errorf("not able to read the cassette %s header: %v", path, err)
+	}
+
+	transport := &ReplayTransport{
+		interactions: make(map[string][]CassetteInteraction),
+	}
+	line := 1
+	for scanner.Scan() {
+		line++
+		var interaction CassetteInteraction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil {
+			return nil, nil, fmt.Errorf("not able to read the cassette %s (line %d): %v", path, line, err)
+		}
+		key := replayKey(interaction.Method, interaction.Path, interaction.RequestBody)
+		transport.interactions[key] = append(transport.interactions[key], interaction)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("not able to read the cassette %s: %v", path, err)
+	}
+	return &header, transport, nil
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody := ""
+	if req.Body != nil {
+		content, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		requestBody = string(content)
+	}
+	key := replayKey(req.Method, req.URL.RequestURI(), redactSecrets(requestBody))
+
+	t.mutex.Lock()
+	var interaction *CassetteInteraction
+	if recorded := t.interactions[key]; len(recorded) > 0 {
+		interaction = &recorded[0]
+		if len(recorded) > 1 {
+			t.interactions[key] = recorded[1:]
+		}
+	}
+	t.mutex.Unlock()
+
+	resp := &http.Response{
+		Request:    req,
+		Header:     http.Header{},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+	}
+	if interaction == nil {
+		logrus.Warnf("%s %s was not recorded in the cassette", req.Method, req.URL.RequestURI())
+		resp.StatusCode = http.StatusNotFound
+		resp.Status = "404 Not Found"
+		resp.Header.Set("Content-Type", "application/json")
+		resp.Body = io.NopCloser(strings.NewReader(`{"message":"not recorded in the cassette"}`))
+		return resp, nil
+	}
+	resp.StatusCode = interaction.Status
+	resp.Status = fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status))
+	for h, v := range interaction.Headers {
+		resp.Header.Set(h, v)
+	}
+	resp.Body = io.NopCloser(strings.NewReader(interaction.ResponseBody))
+	return resp, nil
+}
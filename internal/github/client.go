@@ -8,15 +8,11 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/Alayacare/goliac/internal/config"
-	jwt "github.com/dgrijalva/jwt-go"
-	"github.com/sirupsen/logrus"
+	"github.com/gosimple/slug"
 )
 
 type GitHubClient interface {
@@ -24,46 +20,29 @@ type GitHubClient interface {
 	CallRestAPI(ctx context.Context, endpoint, parameters, method string, body map[string]interface{}) ([]byte, error)
 	GetAccessToken(ctx context.Context) (string, error)
 	GetAppSlug() string
+	GetRateLimits() RateLimits // API budget left, as reported by Github
 }
 
 type GitHubClientImpl struct {
-	gitHubServer    string
-	appID           int64
-	installationID  int64
-	appSlug         string
-	privateKey      []byte
-	accessToken     string
-	httpClient      *http.Client
-	tokenExpiration time.Time
-	mu              sync.Mutex
+	gitHubServer  string
+	authenticator Authenticator
+	httpClient    *http.Client
+	retry         retryPolicy
+	rateLimits    rateLimitTracker
+	etags         *conditionalCache // nil if conditional requests are not used
 }
 
 type AuthorizedTransport struct {
-	client *GitHubClientImpl
+	authenticator Authenticator
 }
 
 func (t *AuthorizedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	t.client.mu.Lock()
-
-	// Refresh the access token if necessary
-	if t.client.accessToken == "" || time.Until(t.client.tokenExpiration) < 5*time.Minute {
-		token, err := t.client.createJWT()
-		if err != nil {
-			t.client.mu.Unlock()
-			return nil, err
-		}
-
-		accessToken, expiresAt, err := t.client.getAccessTokenForInstallation(req.Context(), token)
-		if err != nil {
-			t.client.mu.Unlock()
-			return nil, err
-		}
-		t.client.accessToken = accessToken
-		t.client.tokenExpiration = expiresAt
+	token, err := t.authenticator.Token(req.Context())
+	if err != nil {
+		return nil, err
 	}
-	t.client.mu.Unlock()
 
-	req.Header.Add("Authorization", "Bearer "+t.client.accessToken)
+	req.Header.Add("Authorization", "Bearer "+token)
 
 	return http.DefaultTransport.RoundTrip(req)
 }
@@ -71,60 +50,50 @@ func (t *AuthorizedTransport) RoundTrip(req *http.Request) (*http.Response, erro
 /**
  * NewGitHubClient
  * @param {string} githubServer usually https://api.github.com
- * @param {string} organizationName
- * @param {string} appID
- * @param {string} privateKeyFile
+ * @param {Authenticator} authenticator (cf NewAuthenticatorFromConfig)
  * @return {GitHubClient} client
  * @return {error} error
  *
  * Example:
- * client, err := NewGitHubClient(
+ * authenticator, err := NewAppAuthenticator(
  * 	"https://api.github.com",
  * 	"my-org",
- * 	"12345",
- * 	"private-key.pem",
+ * 	12345,
+ * 	privateKey,
+ * )
+ * client, err := NewGitHubClient(
+ * 	"https://api.github.com",
+ * 	authenticator,
  * )
  */
-func NewGitHubClientImpl(githubServer, organizationName string, appID int64, privateKeyFile string) (GitHubClient, error) {
-	privateKey, err := os.ReadFile(privateKeyFile)
-	if err != nil {
-		return nil, err
-	}
-
+func NewGitHubClientImpl(githubServer string, authenticator Authenticator) (GitHubClient, error) {
 	client := &GitHubClientImpl{
-		gitHubServer: githubServer,
-		appID:        appID,
-		privateKey:   privateKey,
+		gitHubServer:  githubServer,
+		authenticator: authenticator,
+		retry:         newRetryPolicy(int(config.Config.GithubMaxRetries)),
 	}
 
-	// create JWT
-	token, err := client.createJWT()
-	if err != nil {
-		return nil, err
+	// each identity has its own cache: they may not see the same things
+	httpCacheDir := ""
+	if config.Config.GithubHttpCacheDir != "" {
+		httpCacheDir = filepath.Join(config.Config.GithubHttpCacheDir, slug.Make(authenticator.String()))
 	}
+	client.etags = newConditionalCache(httpCacheDir)
 
-	// retrieve all installations for the authenticated app
-	installations, err := client.getInstallations(token)
-	if err != nil {
-		return nil, err
+	var transport http.RoundTripper = &AuthorizedTransport{
+		authenticator: authenticator,
 	}
 
-	// find the installation ID for the given organization
-	for _, installation := range installations {
-		logrus.Debugf("Found installation %s with id %d for organization: %s", installation.AppSlug, installation.ID, organizationName)
-		if strings.EqualFold(installation.Account.Login, organizationName) && installation.AppId == appID {
-			client.installationID = installation.ID
-			client.appSlug = installation.AppSlug
-			break
+	if config.Config.GithubRecordDir != "" {
+		recorder, err := newCassetteRecorder(config.Config.GithubRecordDir, githubServer, authenticator)
+		if err != nil {
+			return nil, err
+		}
+		transport = &RecordingTransport{
+			next:     transport,
+			recorder: recorder,
+			etags:    client.etags,
 		}
-	}
-
-	if client.installationID == 0 {
-		return nil, fmt.Errorf("installation not found for organization: %s", organizationName)
-	}
-
-	transport := &AuthorizedTransport{
-		client: client,
 	}
 
 	httpClient := &http.Client{Transport: transport}
@@ -134,30 +103,31 @@ func NewGitHubClientImpl(githubServer, organizationName string, appID int64, pri
 	return client, nil
 }
 
-// waitRateLimit helps dealing with rate limits
-// cf https://docs.github.com/en/rest/guides/best-practices-for-integrators?apiVersion=2022-11-28#dealing-with-rate-limits
-func waitRateLimit(resetTimeStr string) error {
-	if resetTimeStr == "" {
-		return fmt.Errorf("X-RateLimit-Reset header not found")
-	}
-
-	logrus.Infof("Rate limit exceeded, waiting for %s", resetTimeStr)
-
-	// Parse the reset time.
-	resetTimeUnix, err := strconv.ParseInt(resetTimeStr, 10, 64)
+/*
+ * NewGitHubClientReplay returns a client answering from a cassette recorded
+ * with GOLIAC_RECORD_DIR, without any network call
+ */
+func NewGitHubClientReplay(cassettePath string) (GitHubClient, error) {
+	header, transport, err := LoadCassette(cassettePath)
 	if err != nil {
-		return fmt.Errorf("failed to parse X-RateLimit-Reset header: %w", err)
+		return nil, err
+	}
+	server := header.Server
+	if server == "" {
+		server = "https://api.github.com"
 	}
 
-	resetTime := time.Unix(resetTimeUnix, 0)
-
-	// Calculate how long we need to wait.
-	waitDuration := time.Until(resetTime)
-
-	// Wait until the reset time.
-	time.Sleep(waitDuration)
+	retry := newRetryPolicy(int(config.Config.GithubMaxRetries))
+	retry.baseDelay = 0
+	retry.maxDelay = 0
+	retry.secondaryRateLimitDelay = 0
 
-	return nil
+	return &GitHubClientImpl{
+		gitHubServer:  server,
+		authenticator: NewTokenAuthenticator("replay", header.AppSlug, "the cassette "+cassettePath),
+		httpClient:    &http.Client{Transport: transport},
+		retry:         retry,
+	}, nil
 }
 
 type GraphQLRequest struct {
@@ -195,60 +165,32 @@ func (client *GitHubClientImpl) QueryGraphQLAPI(ctx context.Context, query strin
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", client.gitHubServer+"/graphql", bytes.NewBuffer(body))
+	// queries can be retried, mutations only if Github didn't process them (rate limited)
+	idempotent := !strings.HasPrefix(strings.TrimSpace(query), "mutation")
+
+	resp, responseBody, err := client.doWithRetry(ctx, idempotent, true, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", client.gitHubServer+"/graphql", bytes.NewBuffer(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	stats := ctx.Value(config.ContextKeyStatistics)
-	if stats != nil {
-		goliacStats := stats.(*config.GoliacStatistics)
-		goliacStats.GithubApiCalls++
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
 	}
-
-	resp, err := client.httpClient.Do(req)
-	if err != nil {
+	if err := permissionError(resp, client.authenticator); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusForbidden {
-		if stats != nil {
-			goliacStats := stats.(*config.GoliacStatistics)
-			goliacStats.GithubThrottled++
-		}
-
-		if resp.Header.Get("X-RateLimit-Reset") != "" {
-			// We're being rate limited. Get the reset time from the headers.
-			if err := waitRateLimit(resp.Header.Get("X-RateLimit-Reset")); err != nil {
-				return nil, err
-			}
-		} else if resp.Header.Get("Retry-After") != "" {
-			retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
-			if err != nil {
-				return nil, err
-			}
-			if retryAfter > 30 {
-				retryAfter = retryAfter / 2 // ok we shouldn't be too aggressive
-			}
-			logrus.Debugf("2nd rate limit reached, waiting for %d seconds", retryAfter)
-			time.Sleep(time.Duration(retryAfter) * time.Second)
-		} else {
-			return nil, fmt.Errorf("unexpected status: %s", resp.Status)
-		}
-
-		// Retry the request.
-		return client.QueryGraphQLAPI(ctx, query, variables)
-	} else {
-		responseBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-
-		return responseBody, nil
+	if err := graphQLScopesError(responseBody, client.authenticator); err != nil {
+		return nil, err
 	}
+	client.rateLimits.updateFromGraphQL(responseBody)
+	return responseBody, nil
 }
 
 /*
@@ -265,126 +207,81 @@ func (client *GitHubClientImpl) QueryGraphQLAPI(ctx context.Context, query strin
  * responseBody, err := client.CallRestAPIWithBody("orgs/my-org/repos", "POST", body)
  */
 func (client *GitHubClientImpl) CallRestAPI(ctx context.Context, endpoint, parameters, method string, body map[string]interface{}) ([]byte, error) {
-	var bodyReader io.Reader
+	var jsonBody []byte
 	if body != nil {
-		jsonBody, err := json.Marshal(body)
+		var err error
+		jsonBody, err = json.Marshal(body)
 		if err != nil {
 			return nil, err
 		}
-		bodyReader = bytes.NewBuffer(jsonBody)
 	}
 	urlpath, err := url.JoinPath(client.gitHubServer, endpoint)
 	if err != nil {
 		return nil, err
 	}
 
-	stats := ctx.Value(config.ContextKeyStatistics)
-	if stats != nil {
-		goliacStats := stats.(*config.GoliacStatistics)
-		goliacStats.GithubApiCalls++
-	}
-
 	if parameters != "" {
 		urlpath = urlpath + "?" + parameters
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, urlpath, bodyReader)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Accept", "application/vnd.github+json")
-	//	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
-	resp, err := client.httpClient.Do(req)
-	if err != nil {
-		return nil, err
+	// GET requests are sent as conditional requests, if we already have the response
+	var cached *conditionalCacheEntry
+	if method == "GET" && client.etags != nil {
+		cached = client.etags.get(urlpath)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		if stats != nil {
-			goliacStats := stats.(*config.GoliacStatistics)
-			goliacStats.GithubThrottled++
+	resp, responseBody, err := client.doWithRetry(ctx, isIdempotentMethod(method), false, func() (*http.Request, error) {
+		var bodyReader io.Reader
+		if jsonBody != nil {
+			bodyReader = bytes.NewBuffer(jsonBody)
 		}
-
-		// We're being rate limited. Get the reset time from the headers.
-		if err := waitRateLimit(resp.Header.Get("X-RateLimit-Reset")); err != nil {
-			return nil, err
-		}
-
-		// Retry the request.
-		return client.CallRestAPI(ctx, endpoint, parameters, method, body)
-	} else {
-		responseBody, err := io.ReadAll(resp.Body)
+		req, err := http.NewRequestWithContext(ctx, method, urlpath, bodyReader)
 		if err != nil {
 			return nil, err
 		}
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return responseBody, fmt.Errorf("unexpected status: %s", resp.Status)
+		req.Header.Set("Accept", "application/vnd.github+json")
+		//	req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		if cached != nil {
+			if cached.ETag != "" {
+				req.Header.Set("If-None-Match", cached.ETag)
+			}
+			if cached.LastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.LastModified)
+			}
 		}
-
-		return responseBody, nil
-	}
-}
-
-func (client *GitHubClientImpl) createJWT() (string, error) {
-	key, err := jwt.ParseRSAPrivateKeyFromPEM(client.privateKey)
-	if err != nil {
-		return "", err
-	}
-
-	// create a JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
-		"iat": int32(time.Now().Unix()),
-		"exp": int32(time.Now().Add(10 * time.Minute).Unix()),
-		"iss": client.appID,
+		return req, nil
 	})
-
-	// sign the JWT with the app's private key
-	signedToken, err := token.SignedString(key)
-	if err != nil {
-		return "", err
-	}
-
-	return signedToken, nil
-}
-
-type AccessTokenResponse struct {
-	Token string `json:"token"`
-}
-
-func (client *GitHubClientImpl) getAccessTokenForInstallation(ctx context.Context, jwt string) (string, time.Time, error) {
-	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/app/installations/%d/access_tokens", client.gitHubServer, client.installationID), nil)
 	if err != nil {
-		return "", time.Now(), err
-	}
-
-	req.Header.Add("Authorization", "Bearer "+jwt)
-	req.Header.Add("Accept", "application/vnd.github.machine-man-preview+json")
-
-	stats := ctx.Value(config.ContextKeyStatistics)
-	if stats != nil {
-		goliacStats := stats.(*config.GoliacStatistics)
-		goliacStats.GithubApiCalls++
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", time.Now(), err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		return "", time.Now(), fmt.Errorf("unexpected status: %s", resp.Status)
+	if method == "GET" && client.etags != nil {
+		var goliacStats *config.GoliacStatistics
+		if stats := ctx.Value(config.ContextKeyStatistics); stats != nil {
+			goliacStats = stats.(*config.GoliacStatistics)
+		}
+		if resp.StatusCode == http.StatusNotModified && cached != nil {
+			if goliacStats != nil {
+				goliacStats.GithubCacheHits++
+			}
+			return cached.Body, nil
+		}
+		if resp.StatusCode == http.StatusOK {
+			if goliacStats != nil {
+				goliacStats.GithubCacheMisses++
+			}
+			client.etags.put(urlpath, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"), responseBody)
+		}
 	}
 
-	var accessTokenResponse AccessTokenResponse
-	err = json.NewDecoder(resp.Body).Decode(&accessTokenResponse)
-	if err != nil {
-		return "", time.Now(), err
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if err := permissionError(resp, client.authenticator); err != nil {
+			return responseBody, err
+		}
+		return responseBody, fmt.Errorf("unexpected status: %s", resp.Status)
 	}
-
-	return accessTokenResponse.Token, time.Now().Add(1 * time.Hour), nil
+	return responseBody, nil
 }
 
 /*
@@ -406,30 +303,13 @@ func (client *GitHubClientImpl) getAccessTokenForInstallation(ctx context.Contex
  *	},
  */
 func (client *GitHubClientImpl) GetAccessToken(ctx context.Context) (string, error) {
-	logrus.Debugf("GetAccessToken(): client.tokenExpiration: %v", client.tokenExpiration)
-
-	if client.accessToken != "" && client.tokenExpiration.After(time.Now()) {
-		return client.accessToken, nil
-	}
-
-	jwt, err := client.createJWT()
-	if err != nil {
-		return "", err
-	}
-
-	accessToken, expiration, err := client.getAccessTokenForInstallation(ctx, jwt)
-	if err != nil {
-		return "", err
-	}
-
-	client.accessToken = accessToken
-	client.tokenExpiration = expiration
-
-	logrus.Debugf("GetAccessToken(): client.tokenExpiration: %v", client.tokenExpiration)
-
-	return accessToken, nil
+	return client.authenticator.Token(ctx)
 }
 
 func (client *GitHubClientImpl) GetAppSlug() string {
-	return client.appSlug
+	return client.authenticator.AppSlug()
+}
+
+func (client *GitHubClientImpl) GetRateLimits() RateLimits {
+	return client.rateLimits.get()
 }
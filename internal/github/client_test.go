@@ -2,10 +2,18 @@ package github
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/stretchr/testify/assert"
 )
 
 type MockRoundTripper struct {
@@ -47,3 +55,538 @@ func TestQueryGraphQLAPI(t *testing.T) {
 		t.Errorf("expected 'octocat' in the result, got %s", result)
 	}
 }
+
+func newRetryTestClient(server *httptest.Server) *GitHubClientImpl {
+	return &GitHubClientImpl{
+		gitHubServer: server.URL,
+		httpClient:   server.Client(),
+		retry: retryPolicy{
+			maxRetries:              3,
+			baseDelay:               time.Millisecond,
+			maxDelay:                10 * time.Millisecond,
+			secondaryRateLimitDelay: time.Millisecond,
+		},
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+
+	t.Run("happy path: a GET is retried after a 5xx", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(`{"name":"repo1"}`))
+		}))
+		defer server.Close()
+
+		stats := config.GoliacStatistics{}
+		ctx := context.WithValue(context.TODO(), config.ContextKeyStatistics, &stats)
+		body, err := newRetryTestClient(server).CallRestAPI(ctx, "/repos/org/repo1", "", "GET", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, `{"name":"repo1"}`, string(body))
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, 2, stats.GithubApiCalls)
+		assert.Equal(t, 1, stats.GithubRetries)
+		assert.Equal(t, 0, stats.GithubThrottled)
+	})
+
+	t.Run("not happy path: a POST is not retried after a 5xx", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		_, err := newRetryTestClient(server).CallRestAPI(context.TODO(), "/orgs/org/repos", "", "POST", map[string]interface{}{"name": "repo1"})
+		assert.NotNil(t, err)
+		assert.Equal(t, "unexpected status: 502 Bad Gateway", err.Error())
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("happy path: a rate limited POST is retried (with the same body)", func(t *testing.T) {
+		bodies := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(b))
+			if len(bodies) == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"message":"You have exceeded a secondary rate limit"}`))
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer server.Close()
+
+		stats := config.GoliacStatistics{}
+		ctx := context.WithValue(context.TODO(), config.ContextKeyStatistics, &stats)
+		_, err := newRetryTestClient(server).CallRestAPI(ctx, "/orgs/org/repos", "", "POST", map[string]interface{}{"name": "repo1"})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{`{"name":"repo1"}`, `{"name":"repo1"}`}, bodies)
+		assert.Equal(t, 1, stats.GithubThrottled)
+		assert.Equal(t, 0, stats.GithubRetries)
+	})
+
+	t.Run("happy path: secondary rate limit without Retry-After", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"message":"You have exceeded a secondary rate limit. Please wait a few minutes before you try again."}`))
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		_, err := newRetryTestClient(server).CallRestAPI(context.TODO(), "/orgs/org/teams/team1", "", "DELETE", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("not happy path: a forbidden call (missing permission) is not retried", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"Resource not accessible by integration"}`))
+		}))
+		defer server.Close()
+
+		body, err := newRetryTestClient(server).CallRestAPI(context.TODO(), "/repos/org/repo1", "", "DELETE", nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, "unexpected status: 403 Forbidden", err.Error())
+		assert.Equal(t, `{"message":"Resource not accessible by integration"}`, string(body))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("not happy path: retries are limited", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		_, err := newRetryTestClient(server).CallRestAPI(context.TODO(), "/repos/org/repo1", "", "GET", nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, 4, calls)
+	})
+
+	t.Run("happy path: GraphQL RATE_LIMITED errors are retried", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.Write([]byte(`{"errors":[{"type":"RATE_LIMITED","message":"API rate limit exceeded"}]}`))
+				return
+			}
+			w.Write([]byte(`{"data": {"user": {"name": "octocat"}}}`))
+		}))
+		defer server.Close()
+
+		stats := config.GoliacStatistics{}
+		ctx := context.WithValue(context.TODO(), config.ContextKeyStatistics, &stats)
+		result, err := newRetryTestClient(server).QueryGraphQLAPI(ctx, `query { user(login: "octocat") { name } }`, nil)
+		assert.Nil(t, err)
+		assert.Contains(t, string(result), "octocat")
+		assert.Equal(t, 1, stats.GithubThrottled)
+	})
+
+	t.Run("not happy path: a GraphQL mutation is not retried after a 5xx", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		_, err := newRetryTestClient(server).QueryGraphQLAPI(context.TODO(), `mutation { addStar(input: {starrableId: "1"}) { clientMutationId } }`, nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("not happy path: a query is not retried after a 5xx when the caller asked for it", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		ctx := WithoutServerErrorRetries(context.TODO())
+		_, err := newRetryTestClient(server).QueryGraphQLAPI(ctx, `query { viewer { login } }`, nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, "unexpected status: 502 Bad Gateway", err.Error())
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("not happy path: the context is cancelled while waiting", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := newRetryTestClient(server).CallRestAPI(ctx, "/repos/org/repo1", "", "GET", nil)
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.True(t, time.Since(start) < 5*time.Second)
+	})
+
+	t.Run("happy path: primary rate limit reset", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-RateLimit-Remaining", "0")
+		header.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(10*time.Second).Unix(), 10))
+		delay, ok := rateLimitDelay(header)
+		assert.True(t, ok)
+		assert.True(t, delay > 9*time.Second && delay <= 12*time.Second)
+
+		header.Set("X-RateLimit-Remaining", "10")
+		_, ok = rateLimitDelay(header)
+		assert.False(t, ok)
+	})
+
+	t.Run("happy path: jittered exponential backoff", func(t *testing.T) {
+		policy := newRetryPolicy(5)
+		for attempt := 0; attempt < 10; attempt++ {
+			delay := policy.backoff(attempt)
+			expected := policy.maxDelay
+			if attempt < 6 {
+				expected = policy.baseDelay << attempt
+			}
+			assert.True(t, delay >= expected/2 && delay <= expected)
+		}
+	})
+}
+
+func TestRateLimits(t *testing.T) {
+
+	t.Run("happy path: the REST budget is tracked from the response headers", func(t *testing.T) {
+		reset := time.Now().Add(30 * time.Minute).Unix()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", "4321")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+			w.Header().Set("X-RateLimit-Resource", "core")
+			w.Write([]byte(`{}`))
+		}))
+		defer server.Close()
+
+		client := newRetryTestClient(server)
+		_, known := client.GetRateLimits().Get(RATELIMIT_REST)
+		assert.False(t, known)
+
+		_, err := client.CallRestAPI(context.TODO(), "/repos/org/repo1", "", "GET", nil)
+		assert.Nil(t, err)
+		budget, known := client.GetRateLimits().Get(RATELIMIT_REST)
+		assert.True(t, known)
+		assert.Equal(t, 5000, budget.Limit)
+		assert.Equal(t, 4321, budget.Remaining)
+		assert.Equal(t, reset, budget.Reset.Unix())
+		_, known = client.GetRateLimits().Get(RATELIMIT_GRAPHQL)
+		assert.False(t, known)
+	})
+
+	t.Run("happy path: the GraphQL budget is tracked from the rateLimit object", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// headers are overridden by the rateLimit object (more recent)
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", "4990")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(30*time.Minute).Unix(), 10))
+			w.Write([]byte(`{"data": {"rateLimit": {"limit": 5000, "cost": 11, "remaining": 4979, "resetAt": "` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}}}`))
+		}))
+		defer server.Close()
+
+		client := newRetryTestClient(server)
+		_, err := client.QueryGraphQLAPI(context.TODO(), `query { rateLimit { limit cost remaining resetAt } }`, nil)
+		assert.Nil(t, err)
+		budget, known := client.GetRateLimits().Get(RATELIMIT_GRAPHQL)
+		assert.True(t, known)
+		assert.Equal(t, 4979, budget.Remaining)
+		_, known = client.GetRateLimits().Get(RATELIMIT_REST)
+		assert.False(t, known)
+	})
+}
+
+func TestConditionalRequests(t *testing.T) {
+
+	newServer := func(calls *[]string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*calls = append(*calls, r.Method+" "+r.Header.Get("If-None-Match"))
+			if r.Method == "GET" && r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(`[{"name":"team1","permission":"push"}]`))
+		}))
+	}
+
+	t.Run("happy path: an unchanged GET returns the cached response", func(t *testing.T) {
+		calls := []string{}
+		server := newServer(&calls)
+		defer server.Close()
+
+		client := newRetryTestClient(server)
+		client.etags = newConditionalCache("")
+
+		stats := config.GoliacStatistics{}
+		ctx := context.WithValue(context.TODO(), config.ContextKeyStatistics, &stats)
+		body, err := client.CallRestAPI(ctx, "/repos/org/repo1/teams", "", "GET", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, `[{"name":"team1","permission":"push"}]`, string(body))
+
+		body, err = client.CallRestAPI(ctx, "/repos/org/repo1/teams", "", "GET", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, `[{"name":"team1","permission":"push"}]`, string(body))
+
+		assert.Equal(t, []string{"GET ", `GET "v1"`}, calls)
+		assert.Equal(t, 1, stats.GithubCacheHits)
+		assert.Equal(t, 1, stats.GithubCacheMisses)
+	})
+
+	t.Run("happy path: other methods are not cached", func(t *testing.T) {
+		calls := []string{}
+		server := newServer(&calls)
+		defer server.Close()
+
+		client := newRetryTestClient(server)
+		client.etags = newConditionalCache("")
+
+		_, err := client.CallRestAPI(context.TODO(), "/repos/org/repo1/teams", "", "PUT", map[string]interface{}{"permission": "push"})
+		assert.Nil(t, err)
+		_, err = client.CallRestAPI(context.TODO(), "/repos/org/repo1/teams", "", "PUT", map[string]interface{}{"permission": "push"})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"PUT ", "PUT "}, calls)
+	})
+
+	t.Run("happy path: the cache is persisted on disk", func(t *testing.T) {
+		calls := []string{}
+		server := newServer(&calls)
+		defer server.Close()
+		dir := t.TempDir()
+
+		client := newRetryTestClient(server)
+		client.etags = newConditionalCache(dir)
+		_, err := client.CallRestAPI(context.TODO(), "/repos/org/repo1/teams", "", "GET", nil)
+		assert.Nil(t, err)
+
+		// after a restart
+		client = newRetryTestClient(server)
+		client.etags = newConditionalCache(dir)
+		body, err := client.CallRestAPI(context.TODO(), "/repos/org/repo1/teams", "", "GET", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, `[{"name":"team1","permission":"push"}]`, string(body))
+		assert.Equal(t, []string{"GET ", `GET "v1"`}, calls)
+	})
+}
+
+func TestAuthenticators(t *testing.T) {
+
+	t.Run("happy path: the token is sent by the transport", func(t *testing.T) {
+		authorization := ""
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			w.Write([]byte(`[]`))
+		}))
+		defer server.Close()
+
+		client, err := NewGitHubClientImpl(server.URL, NewTokenAuthenticator("ghp_secret", "", "the personal access token"))
+		assert.Nil(t, err)
+		_, err = client.CallRestAPI(context.TODO(), "/orgs/org/teams", "", "GET", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "Bearer ghp_secret", authorization)
+		assert.Equal(t, "", client.GetAppSlug())
+	})
+
+	t.Run("happy path: authentication modes", func(t *testing.T) {
+		defer func(mode, token, actionsToken string) {
+			config.Config.GithubAuthMode = mode
+			config.Config.GithubToken = token
+			config.Config.GithubActionsToken = actionsToken
+		}(config.Config.GithubAuthMode, config.Config.GithubToken, config.Config.GithubActionsToken)
+
+		config.Config.GithubAuthMode = AUTH_MODE_PAT
+		config.Config.GithubToken = "ghp_secret"
+		authenticator, err := NewAuthenticatorFromConfig("https://api.github.com", "org", 0, "", "")
+		assert.Nil(t, err)
+		token, err := authenticator.Token(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, "ghp_secret", token)
+
+		config.Config.GithubAuthMode = AUTH_MODE_ACTIONS
+		config.Config.GithubToken = ""
+		config.Config.GithubActionsToken = "ghs_actions"
+		authenticator, err = NewAuthenticatorFromConfig("https://api.github.com", "org", 0, "", "")
+		assert.Nil(t, err)
+		token, err = authenticator.Token(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, "ghs_actions", token)
+		assert.Equal(t, "github-actions", authenticator.AppSlug())
+	})
+
+	t.Run("not happy path: misconfigured authentication modes", func(t *testing.T) {
+		defer func(mode, token, actionsToken string) {
+			config.Config.GithubAuthMode = mode
+			config.Config.GithubToken = token
+			config.Config.GithubActionsToken = actionsToken
+		}(config.Config.GithubAuthMode, config.Config.GithubToken, config.Config.GithubActionsToken)
+		config.Config.GithubToken = ""
+		config.Config.GithubActionsToken = ""
+
+		config.Config.GithubAuthMode = AUTH_MODE_PAT
+		_, err := NewAuthenticatorFromConfig("https://api.github.com", "org", 0, "", "")
+		assert.NotNil(t, err)
+
+		config.Config.GithubAuthMode = AUTH_MODE_ACTIONS
+		_, err = NewAuthenticatorFromConfig("https://api.github.com", "org", 0, "", "")
+		assert.NotNil(t, err)
+
+		config.Config.GithubAuthMode = "oauth"
+		_, err = NewAuthenticatorFromConfig("https://api.github.com", "org", 0, "", "")
+		assert.NotNil(t, err)
+
+		config.Config.GithubAuthMode = AUTH_MODE_APP
+		_, err = NewAuthenticatorFromConfig("https://api.github.com", "org", 1234, "", "not a PEM key")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("not happy path: the token lacks a fine-grained permission", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Accepted-GitHub-Permissions", "administration=write")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"Resource not accessible by personal access token"}`))
+		}))
+		defer server.Close()
+
+		client := newRetryTestClient(server)
+		client.authenticator = NewTokenAuthenticator("github_pat_secret", "", "the personal access token")
+		_, err := client.CallRestAPI(context.TODO(), "/orgs/org/teams", "", "POST", map[string]interface{}{"name": "team1"})
+		assert.NotNil(t, err)
+		assert.Equal(t, "unexpected status: 403 Forbidden: the personal access token lacks the permission(s) needed by this call: administration=write", err.Error())
+	})
+
+	t.Run("not happy path: the classic token lacks a scope", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-OAuth-Scopes", "repo, read:org")
+			w.Header().Set("X-Accepted-OAuth-Scopes", "admin:org, write:org")
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		client := newRetryTestClient(server)
+		client.authenticator = NewTokenAuthenticator("ghp_secret", "", "the personal access token")
+		_, err := client.CallRestAPI(context.TODO(), "/orgs/org/teams", "", "POST", map[string]interface{}{"name": "team1"})
+		assert.NotNil(t, err)
+		assert.Equal(t, "unexpected status: 404 Not Found: the personal access token lacks the scope(s) needed by this call: admin:org, write:org (granted: repo, read:org)", err.Error())
+	})
+
+	t.Run("not happy path: the GraphQL query needs more scopes", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"errors":[{"type":"INSUFFICIENT_SCOPES","message":"Your token has not been granted the required scopes to execute this query. The 'login' field requires one of the following scopes: ['read:org']"}]}`))
+		}))
+		defer server.Close()
+
+		client := newRetryTestClient(server)
+		client.authenticator = NewTokenAuthenticator("ghp_secret", "", "the personal access token")
+		_, err := client.QueryGraphQLAPI(context.TODO(), "query { organization(login: \"org\") { login } }", nil)
+		assert.NotNil(t, err)
+		assert.True(t, strings.HasPrefix(err.Error(), "the personal access token lacks the scope(s) needed by this query:"))
+	})
+}
+
+func TestCassette(t *testing.T) {
+
+	t.Run("happy path: the calls are recorded and replayed", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/graphql":
+				w.Write([]byte(`{"data":{"organization":{"login":"org"}}}`))
+			case r.Method == "POST":
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"token":"ghs_0123456789abcdefghij0123","expires_at":"2024-01-02T00:00:00Z"}`))
+			case r.Header.Get("If-None-Match") == `"v1"`:
+				w.WriteHeader(http.StatusNotModified)
+			default:
+				w.Header().Set("ETag", `"v1"`)
+				w.Write([]byte(`[{"name":"team1","permission":"push"}]`))
+			}
+		}))
+		defer server.Close()
+
+		dir := t.TempDir()
+		previousDir := config.Config.GithubRecordDir
+		config.Config.GithubRecordDir = dir
+		defer func() { config.Config.GithubRecordDir = previousDir }()
+
+		client, err := NewGitHubClientImpl(server.URL, NewTokenAuthenticator("ghp_supersecret0123456789", "my-app", "the test token"))
+		assert.Nil(t, err)
+		ctx := context.TODO()
+		_, err = client.CallRestAPI(ctx, "/repos/org/repo1/teams", "page=1", "GET", nil)
+		assert.Nil(t, err)
+		_, err = client.CallRestAPI(ctx, "/repos/org/repo1/teams", "page=1", "GET", nil) // 304
+		assert.Nil(t, err)
+		_, err = client.CallRestAPI(ctx, "/app/installations/1/access_tokens", "", "POST", map[string]interface{}{"client_secret": "s3cr3t"})
+		assert.Nil(t, err)
+		_, err = client.QueryGraphQLAPI(ctx, "query { organization(login: $org) { login } }", map[string]interface{}{"org": "org"})
+		assert.Nil(t, err)
+
+		// the same identity shares the same cassette
+		other, err := NewGitHubClientImpl(server.URL, NewTokenAuthenticator("ghp_supersecret0123456789", "my-app", "the test token"))
+		assert.Nil(t, err)
+		_, err = other.CallRestAPI(ctx, "/orgs/org", "", "GET", nil)
+		assert.Nil(t, err)
+
+		cassettes, _ := filepath.Glob(filepath.Join(dir, "*.cassette"))
+		assert.Equal(t, 1, len(cassettes))
+		content, err := os.ReadFile(cassettes[0])
+		assert.Nil(t, err)
+		assert.Equal(t, 6, len(strings.Split(strings.TrimSpace(string(content)), "\n")))
+		assert.NotContains(t, string(content), "supersecret")
+		assert.NotContains(t, string(content), "ghs_0123456789")
+		assert.NotContains(t, string(content), "s3cr3t")
+		assert.NotContains(t, string(content), "304")
+
+		// replay, without the server
+		server.Close()
+		replay, err := NewGitHubClientReplay(cassettes[0])
+		assert.Nil(t, err)
+		assert.Equal(t, "my-app", replay.GetAppSlug())
+
+		body, err := replay.CallRestAPI(ctx, "/repos/org/repo1/teams", "page=1", "GET", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, `[{"name":"team1","permission":"push"}]`, string(body))
+		body, err = replay.CallRestAPI(ctx, "/repos/org/repo1/teams", "page=1", "GET", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, `[{"name":"team1","permission":"push"}]`, string(body))
+		body, err = replay.CallRestAPI(ctx, "/app/installations/1/access_tokens", "", "POST", map[string]interface{}{"client_secret": "another"})
+		assert.Nil(t, err)
+		assert.Equal(t, `{"token":"REDACTED","expires_at":"2024-01-02T00:00:00Z"}`, string(body))
+		body, err = replay.QueryGraphQLAPI(ctx, "query { organization(login: $org) { login } }", map[string]interface{}{"org": "org"})
+		assert.Nil(t, err)
+		assert.Equal(t, `{"data":{"organization":{"login":"org"}}}`, string(body))
+	})
+
+	t.Run("not happy path: a call that was not recorded", func(t *testing.T) {
+		dir := t.TempDir()
+		cassette := filepath.Join(dir, "empty.cassette")
+		assert.Nil(t, os.WriteFile(cassette, []byte(`{"server":"https://api.github.com","app_slug":"my-app"}`+"\n"), 0600))
+
+		replay, err := NewGitHubClientReplay(cassette)
+		assert.Nil(t, err)
+		_, err = replay.CallRestAPI(context.TODO(), "/orgs/org", "", "GET", nil)
+		assert.NotNil(t, err)
+
+		_, err = NewGitHubClientReplay(filepath.Join(dir, "unknown.cassette"))
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,130 @@
+package github
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+/*
+ * conditionalCache keeps the last response of the REST GET requests, with their
+ * ETag/Last-Modified validators. The next time the same URL is requested,
+ * Github is asked if it changed (If-None-Match/If-Modified-Since): a 304 response
+ * doesn't count against the rate limit, and the cached body is used.
+ *
+ * If dir is set, the cache is also persisted on disk (one file per URL), to survive a restart
+ */
+type conditionalCache struct {
+	dir     string
+	mutex   sync.Mutex
+	entries map[string]*conditionalCacheEntry // key is the URL (with its parameters)
+}
+
+type conditionalCacheEntry struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Body         []byte `json:"body"`
+}
+
+func newConditionalCache(dir string) *conditionalCache {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			logrus.Warnf("not able to create the Github http cache directory %s (the cache is kept in memory only): %v", dir, err)
+			dir = ""
+		}
+	}
+	return &conditionalCache{
+		dir:     dir,
+		entries: make(map[string]*conditionalCacheEntry),
+	}
+}
+
+func (c *conditionalCache) filename(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(hash[:])+".json")
+}
+
+/*
+ * get returns the cached response of url (from memory, or from disk), if any
+ */
+func (c *conditionalCache) get(url string) *conditionalCacheEntry {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if entry, ok := c.entries[url]; ok {
+		return entry
+	}
+	if c.dir == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(c.filename(url))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logrus.Debugf("not able to read the Github http cache for %s: %v", url, err)
+		}
+		return nil
+	}
+	var entry conditionalCacheEntry
+	// we check the url, in the (very) unlikely case of a hash collision
+	if err := json.Unmarshal(content, &entry); err != nil || entry.URL != url {
+		return nil
+	}
+	c.entries[url] = &entry
+	return &entry
+}
+
+/*
+ * put caches the response of url, if Github sent a validator (ETag or Last-Modified)
+ */
+func (c *conditionalCache) put(url string, etag string, lastModified string, body []byte) {
+	if etag == "" && lastModified == "" {
+		return
+	}
+	entry := &conditionalCacheEntry{
+		URL:          url,
+		ETag:         etag,
+		LastModified: lastModified,
+		Body:         body,
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries[url] = entry
+	if c.dir == "" {
+		return
+	}
+
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	// write and rename, to never leave a partial entry behind
+	path := c.filename(url)
+	tmpfile, err := os.CreateTemp(c.dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		logrus.Debugf("not able to write the Github http cache for %s: %v", url, err)
+		return
+	}
+	defer os.Remove(tmpfile.Name())
+	if _, err := tmpfile.Write(content); err != nil {
+		tmpfile.Close()
+		logrus.Debugf("not able to write the Github http cache for %s: %v", url, err)
+		return
+	}
+	if err := tmpfile.Close(); err != nil {
+		logrus.Debugf("not able to write the Github http cache for %s: %v", url, err)
+		return
+	}
+	if err := os.Rename(tmpfile.Name(), path); err != nil {
+		logrus.Debugf("not able to write the Github http cache for %s: %v", url, err)
+	}
+}
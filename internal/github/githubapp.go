@@ -1,10 +1,19 @@
 package github
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/Alayacare/goliac/internal/utils"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
 )
 
 type Installation struct {
@@ -16,8 +25,162 @@ type Installation struct {
 	} `json:"account"`
 }
 
-func (client *GitHubClientImpl) getInstallations(jwt string) ([]Installation, error) {
-	req, err := http.NewRequest("GET", client.gitHubServer+"/app/installations", nil)
+/*
+ * AppAuthenticator authenticates as a Github App installation:
+ * a JWT (signed with the app private key) is exchanged for an installation
+ * access token, renewed before it expires
+ */
+type AppAuthenticator struct {
+	gitHubServer    string
+	appID           int64
+	installationID  int64
+	appSlug         string
+	privateKey      *utils.Secret
+	keyVersion      int // version of the private key used to get the access token
+	accessToken     string
+	tokenExpiration time.Time
+	mu              sync.Mutex
+}
+
+/*
+ * NewAppAuthenticator
+ * @param {string} githubServer usually https://api.github.com
+ * @param {string} organizationName
+ * @param {int64} appID
+ * @param {*utils.Secret} privateKey (PEM), renewing the access token when it is rotated
+ * @return {Authenticator} authenticator
+ * @return {error} error
+ */
+func NewAppAuthenticator(githubServer, organizationName string, appID int64, privateKey *utils.Secret) (*AppAuthenticator, error) {
+	auth := &AppAuthenticator{
+		gitHubServer: githubServer,
+		appID:        appID,
+		privateKey:   privateKey,
+	}
+
+	// create JWT
+	token, err := auth.createJWT()
+	if err != nil {
+		return nil, err
+	}
+
+	// retrieve all installations for the authenticated app
+	installations, err := auth.getInstallations(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// find the installation ID for the given organization
+	for _, installation := range installations {
+		logrus.Debugf("Found installation %s with id %d for organization: %s", installation.AppSlug, installation.ID, organizationName)
+		if strings.EqualFold(installation.Account.Login, organizationName) && installation.AppId == appID {
+			auth.installationID = installation.ID
+			auth.appSlug = installation.AppSlug
+			break
+		}
+	}
+
+	if auth.installationID == 0 {
+		return nil, fmt.Errorf("installation not found for organization: %s", organizationName)
+	}
+
+	return auth, nil
+}
+
+func (auth *AppAuthenticator) Token(ctx context.Context) (string, error) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	// Refresh the access token if necessary (or if the private key was rotated)
+	keyVersion := auth.privateKey.Version()
+	if auth.accessToken == "" || time.Until(auth.tokenExpiration) < 5*time.Minute || keyVersion != auth.keyVersion {
+		logrus.Debugf("renewing the Github App access token (expiration: %v)", auth.tokenExpiration)
+		token, err := auth.createJWT()
+		if err != nil {
+			return "", err
+		}
+
+		accessToken, expiresAt, err := auth.getAccessTokenForInstallation(ctx, token)
+		if err != nil {
+			return "", err
+		}
+		auth.accessToken = accessToken
+		auth.tokenExpiration = expiresAt
+		auth.keyVersion = keyVersion
+	}
+	return auth.accessToken, nil
+}
+
+func (auth *AppAuthenticator) AppSlug() string {
+	return auth.appSlug
+}
+
+func (auth *AppAuthenticator) String() string {
+	return fmt.Sprintf("Github App %s (%d)", auth.appSlug, auth.appID)
+}
+
+func (auth *AppAuthenticator) createJWT() (string, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(auth.privateKey.Get())
+	if err != nil {
+		return "", err
+	}
+
+	// create a JWT
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iat": int32(time.Now().Unix()),
+		"exp": int32(time.Now().Add(10 * time.Minute).Unix()),
+		"iss": auth.appID,
+	})
+
+	// sign the JWT with the app's private key
+	signedToken, err := token.SignedString(key)
+	if err != nil {
+		return "", err
+	}
+
+	return signedToken, nil
+}
+
+type AccessTokenResponse struct {
+	Token string `json:"token"`
+}
+
+func (auth *AppAuthenticator) getAccessTokenForInstallation(ctx context.Context, jwt string) (string, time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/app/installations/%d/access_tokens", auth.gitHubServer, auth.installationID), nil)
+	if err != nil {
+		return "", time.Now(), err
+	}
+
+	req.Header.Add("Authorization", "Bearer "+jwt)
+	req.Header.Add("Accept", "application/vnd.github.machine-man-preview+json")
+
+	stats := ctx.Value(config.ContextKeyStatistics)
+	if stats != nil {
+		goliacStats := stats.(*config.GoliacStatistics)
+		goliacStats.GithubApiCalls++
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", time.Now(), err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", time.Now(), fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var accessTokenResponse AccessTokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&accessTokenResponse)
+	if err != nil {
+		return "", time.Now(), err
+	}
+
+	return accessTokenResponse.Token, time.Now().Add(1 * time.Hour), nil
+}
+
+func (auth *AppAuthenticator) getInstallations(jwt string) ([]Installation, error) {
+	req, err := http.NewRequest("GET", auth.gitHubServer+"/app/installations", nil)
 	if err != nil {
 		return nil, err
 	}
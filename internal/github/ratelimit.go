@@ -0,0 +1,140 @@
+package github
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	RATELIMIT_REST    = "core"
+	RATELIMIT_GRAPHQL = "graphql"
+)
+
+/*
+ * RateLimit is the (last known) API budget of the Github installation,
+ * for one API (REST and GraphQL have their own budget)
+ */
+type RateLimit struct {
+	Limit     int       // calls (REST) or points (GraphQL) per hour
+	Remaining int       // calls (or points) left until Reset
+	Reset     time.Time // when the budget is reset
+}
+
+/*
+ * RateLimits is the API budget, as reported by Github in the last responses.
+ * An API is nil until we called it at least once
+ */
+type RateLimits struct {
+	Rest    *RateLimit
+	GraphQL *RateLimit
+}
+
+/*
+ * Get returns the budget of an API (RATELIMIT_REST or RATELIMIT_GRAPHQL), if known.
+ * A budget whose reset time is over is considered full again
+ */
+func (r RateLimits) Get(api string) (*RateLimit, bool) {
+	budget := r.Rest
+	if api == RATELIMIT_GRAPHQL {
+		budget = r.GraphQL
+	}
+	if budget == nil || time.Now().After(budget.Reset) {
+		return nil, false
+	}
+	return budget, true
+}
+
+// rateLimitTracker keeps the last budget reported by Github
+type rateLimitTracker struct {
+	mutex  sync.Mutex
+	limits RateLimits
+}
+
+func (t *rateLimitTracker) get() RateLimits {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.limits
+}
+
+func (t *rateLimitTracker) set(api string, budget *RateLimit) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	switch api {
+	case RATELIMIT_REST:
+		t.limits.Rest = budget
+	case RATELIMIT_GRAPHQL:
+		t.limits.GraphQL = budget
+	}
+}
+
+/*
+ * updateFromHeaders tracks the X-RateLimit-* headers sent by Github with each response
+ * (graphql tells which API was called, if Github doesn't say it in X-RateLimit-Resource)
+ */
+func (t *rateLimitTracker) updateFromHeaders(header http.Header, graphql bool) {
+	if header == nil {
+		return
+	}
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	api := strings.ToLower(header.Get("X-RateLimit-Resource"))
+	if api == "" {
+		api = RATELIMIT_REST
+		if graphql {
+			api = RATELIMIT_GRAPHQL
+		}
+	}
+	// other resources (search, ...) are not used by Goliac
+	t.set(api, &RateLimit{
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     time.Unix(reset, 0),
+	})
+}
+
+/*
+ * updateFromGraphQL tracks the rateLimit object of a GraphQL response, if the query asked for it:
+ *
+ *	rateLimit {
+ *	  limit
+ *	  cost
+ *	  remaining
+ *	  resetAt
+ *	}
+ */
+func (t *rateLimitTracker) updateFromGraphQL(body []byte) {
+	var response struct {
+		Data struct {
+			RateLimit *struct {
+				Limit     int       `json:"limit"`
+				Cost      int       `json:"cost"`
+				Remaining int       `json:"remaining"`
+				ResetAt   time.Time `json:"resetAt"`
+			} `json:"rateLimit"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || response.Data.RateLimit == nil {
+		return
+	}
+	rateLimit := response.Data.RateLimit
+	logrus.Debugf("GraphQL query cost: %d point(s), %d remaining", rateLimit.Cost, rateLimit.Remaining)
+	t.set(RATELIMIT_GRAPHQL, &RateLimit{
+		Limit:     rateLimit.Limit,
+		Remaining: rateLimit.Remaining,
+		Reset:     rateLimit.ResetAt,
+	})
+}
@@ -0,0 +1,247 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+ * retryPolicy tells how a Github call is retried:
+ * - when Github rate limits it (primary or secondary rate limit, GraphQL RATE_LIMITED error).
+ *   The request was not processed, so it is always retried (after the delay asked by Github)
+ * - when it fails with a network error or a 5xx response. Only idempotent requests are retried:
+ *   a POST creating a repository may have been processed before failing
+ * The delay between 2 retries grows exponentially (with jitter, to not retry all together)
+ */
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration // first backoff delay
+	maxDelay   time.Duration // backoff delays are capped
+	// minimum delay when we hit a secondary rate limit without any hint from Github
+	// cf https://docs.github.com/en/rest/using-the-rest-api/rate-limits-for-the-rest-api#handle-rate-limit-errors-appropriately
+	secondaryRateLimitDelay time.Duration
+}
+
+func newRetryPolicy(maxRetries int) retryPolicy {
+	return retryPolicy{
+		maxRetries:              maxRetries,
+		baseDelay:               1 * time.Second,
+		maxDelay:                60 * time.Second,
+		secondaryRateLimitDelay: 60 * time.Second,
+	}
+}
+
+// backoff returns the (jittered) delay before the retry number attempt (starting at 0)
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.maxDelay
+	if attempt < 30 && p.baseDelay<<attempt < p.maxDelay {
+		delay = p.baseDelay << attempt
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// "equal jitter": between delay/2 and delay
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+/*
+ * retryDelay tells if a response (or a network error) must be retried, and after which delay.
+ * throttled is true if Github rate limited the call
+ */
+func (p retryPolicy) retryDelay(resp *http.Response, body []byte, err error, idempotent bool, graphql bool, attempt int) (delay time.Duration, throttled bool, retry bool) {
+	if err != nil {
+		return p.backoff(attempt), false, idempotent
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusForbidden:
+		if delay, ok := rateLimitDelay(resp.Header); ok {
+			return delay, true, true
+		}
+		if resp.StatusCode == http.StatusTooManyRequests || strings.Contains(strings.ToLower(string(body)), "secondary rate limit") {
+			return p.secondaryBackoff(attempt), true, true
+		}
+		// a "real" forbidden (missing permission, ...)
+		return 0, false, false
+	case resp.StatusCode >= 500:
+		if !idempotent {
+			return 0, false, false
+		}
+		if delay, ok := rateLimitDelay(resp.Header); ok {
+			return delay, false, true
+		}
+		return p.backoff(attempt), false, true
+	case graphql && isGraphQLRateLimited(body):
+		if delay, ok := rateLimitDelay(resp.Header); ok {
+			return delay, true, true
+		}
+		return p.secondaryBackoff(attempt), true, true
+	}
+	return 0, false, false
+}
+
+func (p retryPolicy) secondaryBackoff(attempt int) time.Duration {
+	delay := p.backoff(attempt)
+	if delay < p.secondaryRateLimitDelay {
+		delay = p.secondaryRateLimitDelay
+	}
+	return delay
+}
+
+/*
+ * rateLimitDelay returns the delay asked by Github:
+ * - Retry-After (in seconds, or as a HTTP date)
+ * - or the primary rate limit reset time (X-RateLimit-Reset) when no call remains
+ */
+func rateLimitDelay(header http.Header) (time.Duration, bool) {
+	if retryAfter := header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			return positive(time.Until(date)), true
+		}
+	}
+	if header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			// +1s to be sure the limit is reset on Github side
+			return positive(time.Until(time.Unix(reset, 0))) + time.Second, true
+		}
+	}
+	return 0, false
+}
+
+func positive(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// GraphQL rate limits come as a 200 response with a RATE_LIMITED error
+func isGraphQLRateLimited(body []byte) bool {
+	var response struct {
+		Errors []struct {
+			Type string `json:"type"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return false
+	}
+	for _, e := range response.Errors {
+		if e.Type == "RATE_LIMITED" {
+			return true
+		}
+	}
+	return false
+}
+
+type noServerErrorRetriesKey struct{}
+
+/*
+ * WithoutServerErrorRetries returns a context whose Github calls are not retried on a
+ * network error or a 5xx response (they are still retried when rate limited).
+ * Useful when the caller has a better way to recover, like asking for smaller pages
+ */
+func WithoutServerErrorRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noServerErrorRetriesKey{}, true)
+}
+
+func serverErrorRetries(ctx context.Context) bool {
+	noRetries, _ := ctx.Value(noServerErrorRetriesKey{}).(bool)
+	return !noRetries
+}
+
+// methods that can be sent twice without side effect
+func isIdempotentMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// sleepContext waits for the delay, or until the context is cancelled
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+/*
+ * doWithRetry sends the request (built again by newRequest for each attempt),
+ * and retries it according to the client retry policy.
+ * It returns the last response, with its body already read.
+ */
+func (client *GitHubClientImpl) doWithRetry(ctx context.Context, idempotent bool, graphql bool, newRequest func() (*http.Request, error)) (*http.Response, []byte, error) {
+	var goliacStats *config.GoliacStatistics
+	if stats := ctx.Value(config.ContextKeyStatistics); stats != nil {
+		goliacStats = stats.(*config.GoliacStatistics)
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if goliacStats != nil {
+			goliacStats.GithubApiCalls++
+		}
+
+		var body []byte
+		resp, err := client.httpClient.Do(req)
+		if err == nil {
+			body, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			client.rateLimits.updateFromHeaders(resp.Header, graphql)
+		}
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+
+		delay, throttled, retry := client.retry.retryDelay(resp, body, err, idempotent, graphql, attempt)
+		if !throttled && !serverErrorRetries(ctx) {
+			retry = false
+		}
+		if !retry || attempt >= client.retry.maxRetries {
+			if err != nil {
+				return nil, nil, err
+			}
+			return resp, body, nil
+		}
+
+		if goliacStats != nil {
+			if throttled {
+				goliacStats.GithubThrottled++
+			} else {
+				goliacStats.GithubRetries++
+			}
+		}
+		if throttled {
+			logrus.Infof("Github rate limit reached when calling %s %s, waiting for %s", req.Method, req.URL.Path, delay)
+		} else if err != nil {
+			logrus.Warnf("Github call %s %s failed (%v), retrying in %s", req.Method, req.URL.Path, err, delay)
+		} else {
+			logrus.Warnf("Github call %s %s failed (%s), retrying in %s", req.Method, req.URL.Path, resp.Status, delay)
+		}
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, nil, err
+		}
+	}
+}
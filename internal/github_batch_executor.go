@@ -3,9 +3,14 @@ package internal
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/Alayacare/goliac/internal/config"
 	"github.com/Alayacare/goliac/internal/engine"
+	"github.com/gosimple/slug"
+	"github.com/sirupsen/logrus"
 )
 
 /**
@@ -13,14 +18,92 @@ import (
  * object, so we can regroup all of them to apply (or cancel) them in batch
  */
 type GithubCommand interface {
-	Apply(ctx context.Context)
+	Apply(ctx context.Context) error
+	String() string      // human readable description of the command (used in the apply report)
+	Resources() []string // Github entities touched by the command (used to order the commands)
+	// Inverse returns the commands undoing this one. It must be called before the command is applied
+	// (it is computed from the current remote state, that must not be reloaded from Github, cf
+	// engine.WithoutRemoteLoad). reversible is false if the command cannot be undone
+	Inverse(ctx context.Context, remote engine.GoliacRemote) (inverse []GithubCommand, reversible bool)
+}
+
+const (
+	// all commands changing the teams hierarchy (creating, deleting or moving a team) are applied in order
+	RESOURCE_TEAMS_HIERARCHY = "teams_hierarchy"
+	RESOURCE_RULESETS        = "rulesets"
+)
+
+func teamResource(teamslug string) string {
+	return "team:" + teamslug
+}
+
+func repositoryResource(reponame string) string {
+	return "repository:" + reponame
+}
+
+func userResource(githubid string) string {
+	return "user:" + githubid
+}
+
+func customPropertyResource(propertyname string) string {
+	return "custom_property:" + propertyname
+}
+
+// an organization ruleset refers to the repositories (ids) it applies to
+func rulesetResources(ruleset *engine.GithubRuleSet) []string {
+	resources := []string{RESOURCE_RULESETS}
+	for _, r := range ruleset.Repositories {
+		resources = append(resources, repositoryResource(r))
+	}
+	return resources
+}
+
+/*
+ * GithubCommandFailure is a command that failed to be applied on Github
+ */
+type GithubCommandFailure struct {
+	Command string
+	Err     error
+}
+
+/*
+ * ApplyError is returned by GithubBatchExecutor.Commit when some commands failed
+ * (the other commands are still applied). It is the apply report of the batch.
+ */
+type ApplyError struct {
+	Applied  int // number of commands successfully applied
+	Failures []GithubCommandFailure
+	// transactional mode only
+	RolledBack       int                    // number of applied commands that were undone
+	RollbackFailures []GithubCommandFailure // applied commands that could not be undone
+}
+
+func (e *ApplyError) Error() string {
+	failures := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		failures = append(failures, fmt.Sprintf("%s: %v", f.Command, f.Err))
+	}
+	message := fmt.Sprintf("%d operation(s) failed on Github (%d applied): %s", len(e.Failures), e.Applied, strings.Join(failures, "; "))
+	if e.RolledBack > 0 || len(e.RollbackFailures) > 0 {
+		message += fmt.Sprintf(" (%d rolled back", e.RolledBack)
+		for _, f := range e.RollbackFailures {
+			message += fmt.Sprintf("; not able to undo %s: %v", f.Command, f.Err)
+		}
+		message += ")"
+	}
+	return message
 }
 
 /*
  * GithubBatchExecutor will collects all commands to apply
  * if there the number of changes to apply is not too big, it will apply on the `Commit()`
+ * Commands touching the same Github entity (team, repository, user, ...) are applied
+ * in the order they were queued, the others are applied concurrently
+ * (up to concurrentThreads at the same time).
+ * In transactional mode, the commands are applied one by one, and if one of them
+ * fails, the commands already applied are undone (in reverse order).
  * Usage:
- * gal := NewGithubBatchExecutor(client)
+ * gal := NewGithubBatchExecutor(client, maxChangesets, concurrentThreads, transactional)
  * gal.Begin()
  * gal.Create...
  * gal.Update...
@@ -28,37 +111,56 @@ type GithubCommand interface {
  * gal.Commit()
  */
 type GithubBatchExecutor struct {
-	client        engine.ReconciliatorExecutor
-	maxChangesets int
-	commands      []GithubCommand
-}
-
-func NewGithubBatchExecutor(client engine.ReconciliatorExecutor, maxChangesets int) *GithubBatchExecutor {
+	client            engine.GoliacRemoteExecutor
+	maxChangesets     int
+	concurrentThreads int
+	transactional     bool
+	commands          []GithubCommand
+	journal           *ApplyJournal // optional
+	journalCommit     string        // teams repo commit being applied (recorded in the journal)
+	journaling        bool          // if the current Commit is recorded in the journal
+	applied           int           // number of commands applied (successfully) so far
+}
+
+func NewGithubBatchExecutor(client engine.GoliacRemoteExecutor, maxChangesets int, concurrentThreads int, transactional bool) *GithubBatchExecutor {
 	gal := GithubBatchExecutor{
-		client:        client,
-		maxChangesets: maxChangesets,
-		commands:      make([]GithubCommand, 0),
+		client:            client,
+		maxChangesets:     maxChangesets,
+		concurrentThreads: concurrentThreads,
+		transactional:     transactional,
+		commands:          make([]GithubCommand, 0),
 	}
 	return &gal
 }
 
-func (g *GithubBatchExecutor) AddUserToOrg(ctx context.Context, dryrun bool, ghuserid string) {
+/*
+ * SetJournal records the next changesets (coming from the teams repo commit) in the journal
+ * before applying them
+ */
+func (g *GithubBatchExecutor) SetJournal(journal *ApplyJournal, commit string) {
+	g.journal = journal
+	g.journalCommit = commit
+}
+
+func (g *GithubBatchExecutor) AddUserToOrg(ctx context.Context, dryrun bool, ghuserid string) error {
 	g.commands = append(g.commands, &GithubCommandAddUserToOrg{
 		client:   g.client,
 		dryrun:   dryrun,
 		ghuserid: ghuserid,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) RemoveUserFromOrg(ctx context.Context, dryrun bool, ghuserid string) {
-	g.commands = append(g.commands, &GithubCommandAddUserToOrg{
+func (g *GithubBatchExecutor) RemoveUserFromOrg(ctx context.Context, dryrun bool, ghuserid string) error {
+	g.commands = append(g.commands, &GithubCommandRemoveUserFromOrg{
 		client:   g.client,
 		dryrun:   dryrun,
 		ghuserid: ghuserid,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) CreateTeam(ctx context.Context, dryrun bool, teamname string, description string, parentTeam *int, members []string) {
+func (g *GithubBatchExecutor) CreateTeam(ctx context.Context, dryrun bool, teamname string, description string, parentTeam *int, members []string) error {
 	g.commands = append(g.commands, &GithubCommandCreateTeam{
 		client:      g.client,
 		dryrun:      dryrun,
@@ -67,10 +169,11 @@ func (g *GithubBatchExecutor) CreateTeam(ctx context.Context, dryrun bool, teamn
 		parentTeam:  parentTeam,
 		members:     members,
 	})
+	return nil
 }
 
 // role = member or maintainer (usually we use member)
-func (g *GithubBatchExecutor) UpdateTeamAddMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) {
+func (g *GithubBatchExecutor) UpdateTeamAddMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error {
 	g.commands = append(g.commands, &GithubCommandUpdateTeamAddMember{
 		client:   g.client,
 		dryrun:   dryrun,
@@ -78,10 +181,11 @@ func (g *GithubBatchExecutor) UpdateTeamAddMember(ctx context.Context, dryrun bo
 		member:   username,
 		role:     role,
 	})
+	return nil
 }
 
 // role = member or maintainer (usually we use member)
-func (g *GithubBatchExecutor) UpdateTeamUpdateMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) {
+func (g *GithubBatchExecutor) UpdateTeamUpdateMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error {
 	g.commands = append(g.commands, &GithubCommandUpdateTeamUpdateMember{
 		client:   g.client,
 		dryrun:   dryrun,
@@ -89,35 +193,39 @@ func (g *GithubBatchExecutor) UpdateTeamUpdateMember(ctx context.Context, dryrun
 		member:   username,
 		role:     role,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) UpdateTeamRemoveMember(ctx context.Context, dryrun bool, teamslug string, username string) {
+func (g *GithubBatchExecutor) UpdateTeamRemoveMember(ctx context.Context, dryrun bool, teamslug string, username string) error {
 	g.commands = append(g.commands, &GithubCommandUpdateTeamRemoveMember{
 		client:   g.client,
 		dryrun:   dryrun,
 		teamslug: teamslug,
 		member:   username,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) UpdateTeamSetParent(ctx context.Context, dryrun bool, teamslug string, parentTeam *int) {
+func (g *GithubBatchExecutor) UpdateTeamSetParent(ctx context.Context, dryrun bool, teamslug string, parentTeam *int) error {
 	g.commands = append(g.commands, &GithubCommandUpdateTeamSetParent{
 		client:     g.client,
 		dryrun:     dryrun,
 		teamslug:   teamslug,
 		parentTeam: parentTeam,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) DeleteTeam(ctx context.Context, dryrun bool, teamslug string) {
+func (g *GithubBatchExecutor) DeleteTeam(ctx context.Context, dryrun bool, teamslug string) error {
 	g.commands = append(g.commands, &GithubCommandDeleteTeam{
 		client:   g.client,
 		dryrun:   dryrun,
 		teamslug: teamslug,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) CreateRepository(ctx context.Context, dryrun bool, reponame string, description string, writers []string, readers []string, boolProperties map[string]bool) {
+func (g *GithubBatchExecutor) CreateRepository(ctx context.Context, dryrun bool, reponame string, description string, writers []string, readers []string, boolProperties map[string]bool) error {
 	g.commands = append(g.commands, &GithubCommandCreateRepository{
 		client:         g.client,
 		dryrun:         dryrun,
@@ -127,9 +235,10 @@ func (g *GithubBatchExecutor) CreateRepository(ctx context.Context, dryrun bool,
 		writers:        writers,
 		boolProperties: boolProperties,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) UpdateRepositoryAddTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) {
+func (g *GithubBatchExecutor) UpdateRepositoryAddTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
 	g.commands = append(g.commands, &GithubCommandUpdateRepositoryAddTeamAccess{
 		client:     g.client,
 		dryrun:     dryrun,
@@ -137,9 +246,10 @@ func (g *GithubBatchExecutor) UpdateRepositoryAddTeamAccess(ctx context.Context,
 		teamslug:   teamslug,
 		permission: permission,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) UpdateRepositoryUpdateTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) {
+func (g *GithubBatchExecutor) UpdateRepositoryUpdateTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
 	g.commands = append(g.commands, &GithubCommandUpdateRepositoryUpdateTeamAccess{
 		client:     g.client,
 		dryrun:     dryrun,
@@ -147,18 +257,20 @@ func (g *GithubBatchExecutor) UpdateRepositoryUpdateTeamAccess(ctx context.Conte
 		teamslug:   teamslug,
 		permission: permission,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) UpdateRepositoryRemoveTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string) {
+func (g *GithubBatchExecutor) UpdateRepositoryRemoveTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string) error {
 	g.commands = append(g.commands, &GithubCommandUpdateRepositoryRemoveTeamAccess{
 		client:   g.client,
 		dryrun:   dryrun,
 		reponame: reponame,
 		teamslug: teamslug,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) UpdateRepositoryUpdateBoolProperty(ctx context.Context, dryrun bool, reponame string, propertyName string, propertyValue bool) {
+func (g *GithubBatchExecutor) UpdateRepositoryUpdateBoolProperty(ctx context.Context, dryrun bool, reponame string, propertyName string, propertyValue bool) error {
 	g.commands = append(g.commands, &GithubCommandUpdateRepositoryUpdateBoolProperty{
 		client:        g.client,
 		dryrun:        dryrun,
@@ -166,9 +278,30 @@ func (g *GithubBatchExecutor) UpdateRepositoryUpdateBoolProperty(ctx context.Con
 		propertyName:  propertyName,
 		propertyValue: propertyValue,
 	})
+	return nil
+}
+
+func (g *GithubBatchExecutor) UpdateRepositoryUpdateStringProperties(ctx context.Context, dryrun bool, reponame string, properties map[string]string) error {
+	g.commands = append(g.commands, &GithubCommandUpdateRepositoryUpdateStringProperties{
+		client:     g.client,
+		dryrun:     dryrun,
+		reponame:   reponame,
+		properties: properties,
+	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) UpdateRepositorySetExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string, permission string) {
+func (g *GithubBatchExecutor) UpdateRepositorySetTopics(ctx context.Context, dryrun bool, reponame string, topics []string) error {
+	g.commands = append(g.commands, &GithubCommandUpdateRepositorySetTopics{
+		client:   g.client,
+		dryrun:   dryrun,
+		reponame: reponame,
+		topics:   topics,
+	})
+	return nil
+}
+
+func (g *GithubBatchExecutor) UpdateRepositorySetExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string, permission string) error {
 	g.commands = append(g.commands, &GithubCommandUpdateRepositorySetExternalUser{
 		client:     g.client,
 		dryrun:     dryrun,
@@ -176,119 +309,443 @@ func (g *GithubBatchExecutor) UpdateRepositorySetExternalUser(ctx context.Contex
 		githubid:   githubid,
 		permission: permission,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) UpdateRepositoryRemoveExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) {
+func (g *GithubBatchExecutor) UpdateRepositoryRemoveExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error {
 	g.commands = append(g.commands, &GithubCommandUpdateRepositoryRemoveExternalUser{
 		client:   g.client,
 		dryrun:   dryrun,
 		reponame: reponame,
 		githubid: githubid,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) UpdateRepositoryRemoveInternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) {
+func (g *GithubBatchExecutor) UpdateRepositoryRemoveInternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error {
 	g.commands = append(g.commands, &GithubCommandUpdateRepositoryRemoveInternalUser{
 		client:   g.client,
 		dryrun:   dryrun,
 		reponame: reponame,
 		githubid: githubid,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) DeleteRepository(ctx context.Context, dryrun bool, reponame string) {
+func (g *GithubBatchExecutor) DeleteRepository(ctx context.Context, dryrun bool, reponame string) error {
 	g.commands = append(g.commands, &GithubCommandDeleteRepository{
 		client:   g.client,
 		dryrun:   dryrun,
 		reponame: reponame,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) RenameRepository(ctx context.Context, dryrun bool, reponame string, newname string) {
+func (g *GithubBatchExecutor) RenameRepository(ctx context.Context, dryrun bool, reponame string, newname string) error {
 	g.commands = append(g.commands, &GithubCommandRenameRepository{
 		client:   g.client,
 		dryrun:   dryrun,
 		reponame: reponame,
 		newname:  newname,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) AddRuleset(ctx context.Context, dryrun bool, ruleset *engine.GithubRuleSet) {
+func (g *GithubBatchExecutor) AddRuleset(ctx context.Context, dryrun bool, ruleset *engine.GithubRuleSet) error {
 	g.commands = append(g.commands, &GithubCommandAddRuletset{
 		client:  g.client,
 		dryrun:  dryrun,
 		ruleset: ruleset,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) UpdateRuleset(ctx context.Context, dryrun bool, ruleset *engine.GithubRuleSet) {
+func (g *GithubBatchExecutor) UpdateRuleset(ctx context.Context, dryrun bool, ruleset *engine.GithubRuleSet) error {
 	g.commands = append(g.commands, &GithubCommandUpdateRuletset{
 		client:  g.client,
 		dryrun:  dryrun,
 		ruleset: ruleset,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) DeleteRuleset(ctx context.Context, dryrun bool, rulesetid int) {
+func (g *GithubBatchExecutor) DeleteRuleset(ctx context.Context, dryrun bool, rulesetid int) error {
 	g.commands = append(g.commands, &GithubCommandDeleteRuletset{
 		client:    g.client,
 		dryrun:    dryrun,
 		rulesetid: rulesetid,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) AddRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *engine.GithubRuleSet) {
+func (g *GithubBatchExecutor) AddRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *engine.GithubRuleSet) error {
 	g.commands = append(g.commands, &GithubCommandAddRepositoryRuletset{
 		client:   g.client,
 		dryrun:   dryrun,
 		reponame: reponame,
 		ruleset:  ruleset,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) UpdateRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *engine.GithubRuleSet) {
+func (g *GithubBatchExecutor) UpdateRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *engine.GithubRuleSet) error {
 	g.commands = append(g.commands, &GithubCommandUpdateRepositoryRuletset{
 		client:   g.client,
 		dryrun:   dryrun,
 		reponame: reponame,
 		ruleset:  ruleset,
 	})
+	return nil
 }
 
-func (g *GithubBatchExecutor) DeleteRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, rulesetid int) {
+func (g *GithubBatchExecutor) DeleteRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, rulesetid int) error {
 	g.commands = append(g.commands, &GithubCommandDeleteRepositoryRuletset{
 		client:    g.client,
 		dryrun:    dryrun,
 		reponame:  reponame,
 		rulesetid: rulesetid,
 	})
+	return nil
+}
+
+func (g *GithubBatchExecutor) UpdateRepositorySetCustomProperties(ctx context.Context, dryrun bool, reponame string, properties map[string][]string, valueTypes map[string]string) error {
+	g.commands = append(g.commands, &GithubCommandUpdateRepositorySetCustomProperties{
+		client:     g.client,
+		dryrun:     dryrun,
+		reponame:   reponame,
+		properties: properties,
+		valueTypes: valueTypes,
+	})
+	return nil
+}
+
+func (g *GithubBatchExecutor) AddCustomProperty(ctx context.Context, dryrun bool, property *engine.GithubCustomProperty) error {
+	g.commands = append(g.commands, &GithubCommandAddCustomProperty{
+		client:   g.client,
+		dryrun:   dryrun,
+		property: property,
+	})
+	return nil
+}
+
+func (g *GithubBatchExecutor) UpdateCustomProperty(ctx context.Context, dryrun bool, property *engine.GithubCustomProperty) error {
+	g.commands = append(g.commands, &GithubCommandUpdateCustomProperty{
+		client:   g.client,
+		dryrun:   dryrun,
+		property: property,
+	})
+	return nil
+}
+
+func (g *GithubBatchExecutor) DeleteCustomProperty(ctx context.Context, dryrun bool, propertyname string) error {
+	g.commands = append(g.commands, &GithubCommandDeleteCustomProperty{
+		client:       g.client,
+		dryrun:       dryrun,
+		propertyname: propertyname,
+	})
+	return nil
+}
+
+/*
+ * Applied returns the number of commands applied (successfully) since the executor was created
+ */
+func (g *GithubBatchExecutor) Applied() int {
+	return g.applied
 }
 
 func (g *GithubBatchExecutor) Begin(dryrun bool) {
 	g.commands = make([]GithubCommand, 0)
+	g.client.Begin(dryrun)
 }
 func (g *GithubBatchExecutor) Rollback(dryrun bool, err error) {
 	g.commands = make([]GithubCommand, 0)
+	g.client.Rollback(dryrun, err)
 }
 func (g *GithubBatchExecutor) Commit(ctx context.Context, dryrun bool) error {
 	if len(g.commands) > g.maxChangesets && !config.Config.MaxChangesetsOverride {
 		return fmt.Errorf("more than %d changesets to apply (total of %d), this is suspicious. Aborting (see Goliac troubleshooting guide for help)", g.maxChangesets, len(g.commands))
 	}
-	for _, c := range g.commands {
-		c.Apply(ctx)
+	if g.journal != nil && !dryrun && len(g.commands) > 0 {
+		commands := make([]string, 0, len(g.commands))
+		for _, c := range g.commands {
+			commands = append(commands, c.String())
+		}
+		// we don't apply anything we cannot keep track of
+		if err := g.journal.Begin(g.journalCommit, commands); err != nil {
+			g.commands = make([]GithubCommand, 0)
+			return err
+		}
+		g.journaling = true
+		defer func() { g.journaling = false }()
+	}
+
+	report := &ApplyError{
+		Failures: make([]GithubCommandFailure, 0),
+	}
+
+	var errs []error
+	if g.transactional && !dryrun {
+		errs = g.applyCommandsTransactionally(ctx, report)
+	} else {
+		errs = g.applyCommands(ctx)
 	}
+
+	for i, c := range g.commands {
+		if errs[i] != nil {
+			logrus.Errorf("failed to %s: %v", c, errs[i])
+			report.Failures = append(report.Failures, GithubCommandFailure{Command: c.String(), Err: errs[i]})
+		} else {
+			report.Applied++
+		}
+	}
+	g.applied += report.Applied
 	g.commands = make([]GithubCommand, 0)
+	if err := g.client.Commit(ctx, dryrun); err != nil {
+		return err
+	}
+	if len(report.Failures) > 0 {
+		return report
+	}
 	return nil
 }
 
+/*
+ * commandsDependencies returns, for each command, the (previous) commands it must wait for:
+ * a command waits for the last previous command touching one of its resources.
+ * For example adding a team to a repository waits for the team creation,
+ * and updating a renamed repository waits for the rename.
+ */
+func commandsDependencies(commands []GithubCommand) [][]int {
+	dependencies := make([][]int, len(commands))
+	lastCommandPerResource := make(map[string]int)
+
+	for i, c := range commands {
+		deps := make(map[int]bool)
+		for _, r := range c.Resources() {
+			if last, ok := lastCommandPerResource[r]; ok && last != i {
+				deps[last] = true
+			}
+			lastCommandPerResource[r] = i
+		}
+		dependencies[i] = make([]int, 0, len(deps))
+		for d := range deps {
+			dependencies[i] = append(dependencies[i], d)
+		}
+		sort.Ints(dependencies[i])
+	}
+	return dependencies
+}
+
+/*
+ * applyCommands applies all the queued commands (respecting their dependencies)
+ * and returns the error (if any) of each command.
+ * A command whose dependency failed is not applied.
+ */
+func (g *GithubBatchExecutor) applyCommands(ctx context.Context) []error {
+	dependencies := commandsDependencies(g.commands)
+	errs := make([]error, len(g.commands))
+
+	apply := func(i int) {
+		defer func() { g.journalDone(i, errs[i]) }()
+		for _, d := range dependencies[i] {
+			if errs[d] != nil {
+				errs[i] = fmt.Errorf("not applied because '%s' failed", g.commands[d])
+				return
+			}
+		}
+		errs[i] = g.commands[i].Apply(ctx)
+	}
+
+	if g.concurrentThreads <= 1 {
+		for i := range g.commands {
+			apply(i)
+		}
+		return errs
+	}
+
+	// the commands waiting for each command
+	dependents := make([][]int, len(g.commands))
+	pending := make([]int, len(g.commands))
+	for i, deps := range dependencies {
+		pending[i] = len(deps)
+		for _, d := range deps {
+			dependents[d] = append(dependents[d], i)
+		}
+	}
+
+	readyChan := make(chan int, len(g.commands))
+	doneChan := make(chan int, len(g.commands))
+
+	var wg sync.WaitGroup
+	for w := 0; w < g.concurrentThreads; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range readyChan {
+				apply(i)
+				doneChan <- i
+			}
+		}()
+	}
+
+	for i := range g.commands {
+		if pending[i] == 0 {
+			readyChan <- i
+		}
+	}
+	for done := 0; done < len(g.commands); done++ {
+		i := <-doneChan
+		for _, d := range dependents[i] {
+			pending[d]--
+			if pending[d] == 0 {
+				readyChan <- d
+			}
+		}
+	}
+	close(readyChan)
+	wg.Wait()
+
+	return errs
+}
+
+/*
+ * applyCommandsTransactionally applies the commands one by one (in the order they were
+ * queued) and stops at the first failure. The commands already applied are then undone
+ * in reverse order, using their inverse computed just before they were applied.
+ * It returns the error (if any) of each command, and adds the rollback result to the report.
+ */
+func (g *GithubBatchExecutor) applyCommandsTransactionally(ctx context.Context, report *ApplyError) []error {
+	type appliedCommand struct {
+		command    GithubCommand
+		inverse    []GithubCommand
+		reversible bool
+	}
+	errs := make([]error, len(g.commands))
+	applied := make([]appliedCommand, 0, len(g.commands))
+
+	failed := -1
+	for i, c := range g.commands {
+		if failed >= 0 {
+			errs[i] = fmt.Errorf("not applied because '%s' failed", g.commands[failed])
+			g.journalDone(i, errs[i])
+			continue
+		}
+		// the inverse is computed from the cache (updated by the commands already applied):
+		// reloading it from Github now would mix in changes made outside of this batch
+		inverse, reversible := c.Inverse(engine.WithoutRemoteLoad(ctx), g.client)
+		errs[i] = c.Apply(ctx)
+		g.journalDone(i, errs[i])
+		if errs[i] != nil {
+			failed = i
+			continue
+		}
+		applied = append(applied, appliedCommand{command: c, inverse: inverse, reversible: reversible})
+	}
+	if failed < 0 {
+		return errs
+	}
+
+	logrus.Warnf("'%s' failed, undoing the %d command(s) already applied", g.commands[failed], len(applied))
+	for i := len(applied) - 1; i >= 0; i-- {
+		a := applied[i]
+		if !a.reversible {
+			logrus.Errorf("not able to undo '%s': it cannot be undone automatically", a.command)
+			report.RollbackFailures = append(report.RollbackFailures, GithubCommandFailure{Command: a.command.String(), Err: fmt.Errorf("it cannot be undone automatically")})
+			continue
+		}
+		var undoErr error
+		for _, u := range a.inverse {
+			if err := u.Apply(ctx); err != nil {
+				undoErr = fmt.Errorf("failed to %s: %v", u, err)
+				break
+			}
+		}
+		if undoErr != nil {
+			logrus.Errorf("not able to undo '%s': %v", a.command, undoErr)
+			report.RollbackFailures = append(report.RollbackFailures, GithubCommandFailure{Command: a.command.String(), Err: undoErr})
+		} else {
+			report.RolledBack++
+		}
+	}
+	return errs
+}
+
+// records the completion of the command (if there is a journal)
+func (g *GithubBatchExecutor) journalDone(index int, err error) {
+	if !g.journaling {
+		return
+	}
+	if jerr := g.journal.Done(index, err); jerr != nil {
+		logrus.Warn(jerr)
+	}
+}
+
+// from a Github permission (as returned by the GraphQL API) to the permission expected by the REST API
+func restPermission(permission string) string {
+	switch permission {
+	case "ADMIN":
+		return "admin"
+	case "MAINTAIN":
+		return "maintain"
+	case "WRITE":
+		return "push"
+	case "TRIAGE":
+		return "triage"
+	default:
+		return "pull"
+	}
+}
+
+// returns the role ("member" or "maintainer") of a user in a team, or "" if the user is not part of the team
+func teamMemberRole(ctx context.Context, remote engine.GoliacRemote, teamslug string, username string) string {
+	team, ok := remote.Teams(ctx, true)[teamslug]
+	if !ok {
+		return ""
+	}
+	for _, m := range team.Maintainers {
+		if m == username {
+			return "maintainer"
+		}
+	}
+	for _, m := range team.Members {
+		if m == username {
+			return "member"
+		}
+	}
+	return ""
+}
+
+// returns the (REST) permission of a team on a repository, or "" if the team has no access
+func teamRepositoryPermission(ctx context.Context, remote engine.GoliacRemote, teamslug string, reponame string) string {
+	if tr, ok := remote.TeamRepositories(ctx)[teamslug][reponame]; ok {
+		return restPermission(tr.Permission)
+	}
+	return ""
+}
+
 type GithubCommandAddUserToOrg struct {
 	client   engine.ReconciliatorExecutor
 	dryrun   bool
 	ghuserid string
 }
 
-func (g *GithubCommandAddUserToOrg) Apply(ctx context.Context) {
-	g.client.AddUserToOrg(ctx, g.dryrun, g.ghuserid)
+func (g *GithubCommandAddUserToOrg) Apply(ctx context.Context) error {
+	return g.client.AddUserToOrg(ctx, g.dryrun, g.ghuserid)
+}
+
+func (g *GithubCommandAddUserToOrg) String() string {
+	return fmt.Sprintf("add user %s to the organization", g.ghuserid)
+}
+
+func (g *GithubCommandAddUserToOrg) Resources() []string {
+	return []string{userResource(g.ghuserid)}
+}
+
+func (g *GithubCommandAddUserToOrg) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	if _, ok := remote.Users(ctx)[g.ghuserid]; ok {
+		return []GithubCommand{}, true
+	}
+	return []GithubCommand{&GithubCommandRemoveUserFromOrg{client: g.client, dryrun: g.dryrun, ghuserid: g.ghuserid}}, true
 }
 
 type GithubCommandCreateRepository struct {
@@ -301,8 +758,27 @@ type GithubCommandCreateRepository struct {
 	boolProperties map[string]bool
 }
 
-func (g *GithubCommandCreateRepository) Apply(ctx context.Context) {
-	g.client.CreateRepository(ctx, g.dryrun, g.reponame, g.description, g.writers, g.readers, g.boolProperties)
+func (g *GithubCommandCreateRepository) Apply(ctx context.Context) error {
+	return g.client.CreateRepository(ctx, g.dryrun, g.reponame, g.description, g.writers, g.readers, g.boolProperties)
+}
+
+func (g *GithubCommandCreateRepository) String() string {
+	return fmt.Sprintf("create repository %s", g.reponame)
+}
+
+func (g *GithubCommandCreateRepository) Resources() []string {
+	resources := []string{repositoryResource(g.reponame)}
+	for _, t := range g.writers {
+		resources = append(resources, teamResource(t))
+	}
+	for _, t := range g.readers {
+		resources = append(resources, teamResource(t))
+	}
+	return resources
+}
+
+func (g *GithubCommandCreateRepository) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	return []GithubCommand{&GithubCommandDeleteRepository{client: g.client, dryrun: g.dryrun, reponame: g.reponame}}, true
 }
 
 type GithubCommandCreateTeam struct {
@@ -314,8 +790,24 @@ type GithubCommandCreateTeam struct {
 	members     []string
 }
 
-func (g *GithubCommandCreateTeam) Apply(ctx context.Context) {
-	g.client.CreateTeam(ctx, g.dryrun, g.teamname, g.description, g.parentTeam, g.members)
+func (g *GithubCommandCreateTeam) Apply(ctx context.Context) error {
+	return g.client.CreateTeam(ctx, g.dryrun, g.teamname, g.description, g.parentTeam, g.members)
+}
+
+func (g *GithubCommandCreateTeam) String() string {
+	return fmt.Sprintf("create team %s", g.teamname)
+}
+
+func (g *GithubCommandCreateTeam) Resources() []string {
+	resources := []string{teamResource(slug.Make(g.teamname)), RESOURCE_TEAMS_HIERARCHY}
+	for _, m := range g.members {
+		resources = append(resources, userResource(m))
+	}
+	return resources
+}
+
+func (g *GithubCommandCreateTeam) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	return []GithubCommand{&GithubCommandDeleteTeam{client: g.client, dryrun: g.dryrun, teamslug: slug.Make(g.teamname)}}, true
 }
 
 type GithubCommandDeleteRepository struct {
@@ -324,8 +816,21 @@ type GithubCommandDeleteRepository struct {
 	reponame string
 }
 
-func (g *GithubCommandDeleteRepository) Apply(ctx context.Context) {
-	g.client.DeleteRepository(ctx, g.dryrun, g.reponame)
+func (g *GithubCommandDeleteRepository) Apply(ctx context.Context) error {
+	return g.client.DeleteRepository(ctx, g.dryrun, g.reponame)
+}
+
+func (g *GithubCommandDeleteRepository) String() string {
+	return fmt.Sprintf("delete repository %s", g.reponame)
+}
+
+func (g *GithubCommandDeleteRepository) Resources() []string {
+	return []string{repositoryResource(g.reponame)}
+}
+
+func (g *GithubCommandDeleteRepository) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	// the repository content is lost
+	return nil, false
 }
 
 type GithubCommandRenameRepository struct {
@@ -335,8 +840,20 @@ type GithubCommandRenameRepository struct {
 	newname  string
 }
 
-func (g *GithubCommandRenameRepository) Apply(ctx context.Context) {
-	g.client.RenameRepository(ctx, g.dryrun, g.reponame, g.newname)
+func (g *GithubCommandRenameRepository) Apply(ctx context.Context) error {
+	return g.client.RenameRepository(ctx, g.dryrun, g.reponame, g.newname)
+}
+
+func (g *GithubCommandRenameRepository) String() string {
+	return fmt.Sprintf("rename repository %s to %s", g.reponame, g.newname)
+}
+
+func (g *GithubCommandRenameRepository) Resources() []string {
+	return []string{repositoryResource(g.reponame), repositoryResource(g.newname)}
+}
+
+func (g *GithubCommandRenameRepository) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	return []GithubCommand{&GithubCommandRenameRepository{client: g.client, dryrun: g.dryrun, reponame: g.newname, newname: g.reponame}}, true
 }
 
 type GithubCommandDeleteTeam struct {
@@ -345,8 +862,21 @@ type GithubCommandDeleteTeam struct {
 	teamslug string
 }
 
-func (g *GithubCommandDeleteTeam) Apply(ctx context.Context) {
-	g.client.DeleteTeam(ctx, g.dryrun, g.teamslug)
+func (g *GithubCommandDeleteTeam) Apply(ctx context.Context) error {
+	return g.client.DeleteTeam(ctx, g.dryrun, g.teamslug)
+}
+
+func (g *GithubCommandDeleteTeam) String() string {
+	return fmt.Sprintf("delete team %s", g.teamslug)
+}
+
+func (g *GithubCommandDeleteTeam) Resources() []string {
+	return []string{teamResource(g.teamslug), RESOURCE_TEAMS_HIERARCHY}
+}
+
+func (g *GithubCommandDeleteTeam) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	// a new team would get a new id (and Github also removes the child teams)
+	return nil, false
 }
 
 type GithubCommandRemoveUserFromOrg struct {
@@ -355,8 +885,24 @@ type GithubCommandRemoveUserFromOrg struct {
 	ghuserid string
 }
 
-func (g *GithubCommandRemoveUserFromOrg) Apply(ctx context.Context) {
-	g.client.RemoveUserFromOrg(ctx, g.dryrun, g.ghuserid)
+func (g *GithubCommandRemoveUserFromOrg) Apply(ctx context.Context) error {
+	return g.client.RemoveUserFromOrg(ctx, g.dryrun, g.ghuserid)
+}
+
+func (g *GithubCommandRemoveUserFromOrg) String() string {
+	return fmt.Sprintf("remove user %s from the organization", g.ghuserid)
+}
+
+func (g *GithubCommandRemoveUserFromOrg) Resources() []string {
+	return []string{userResource(g.ghuserid)}
+}
+
+func (g *GithubCommandRemoveUserFromOrg) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	if _, ok := remote.Users(ctx)[g.ghuserid]; !ok {
+		return []GithubCommand{}, true
+	}
+	// the user would have to accept a new invitation (and would lose its teams memberships)
+	return nil, false
 }
 
 type GithubCommandUpdateRepositoryRemoveTeamAccess struct {
@@ -366,8 +912,24 @@ type GithubCommandUpdateRepositoryRemoveTeamAccess struct {
 	teamslug string
 }
 
-func (g *GithubCommandUpdateRepositoryRemoveTeamAccess) Apply(ctx context.Context) {
-	g.client.UpdateRepositoryRemoveTeamAccess(ctx, g.dryrun, g.reponame, g.teamslug)
+func (g *GithubCommandUpdateRepositoryRemoveTeamAccess) Apply(ctx context.Context) error {
+	return g.client.UpdateRepositoryRemoveTeamAccess(ctx, g.dryrun, g.reponame, g.teamslug)
+}
+
+func (g *GithubCommandUpdateRepositoryRemoveTeamAccess) String() string {
+	return fmt.Sprintf("remove team %s access to repository %s", g.teamslug, g.reponame)
+}
+
+func (g *GithubCommandUpdateRepositoryRemoveTeamAccess) Resources() []string {
+	return []string{repositoryResource(g.reponame), teamResource(g.teamslug)}
+}
+
+func (g *GithubCommandUpdateRepositoryRemoveTeamAccess) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	permission := teamRepositoryPermission(ctx, remote, g.teamslug, g.reponame)
+	if permission == "" {
+		return []GithubCommand{}, true
+	}
+	return []GithubCommand{&GithubCommandUpdateRepositoryAddTeamAccess{client: g.client, dryrun: g.dryrun, reponame: g.reponame, teamslug: g.teamslug, permission: permission}}, true
 }
 
 type GithubCommandUpdateRepositoryAddTeamAccess struct {
@@ -378,8 +940,24 @@ type GithubCommandUpdateRepositoryAddTeamAccess struct {
 	permission string
 }
 
-func (g *GithubCommandUpdateRepositoryAddTeamAccess) Apply(ctx context.Context) {
-	g.client.UpdateRepositoryAddTeamAccess(ctx, g.dryrun, g.reponame, g.teamslug, g.permission)
+func (g *GithubCommandUpdateRepositoryAddTeamAccess) Apply(ctx context.Context) error {
+	return g.client.UpdateRepositoryAddTeamAccess(ctx, g.dryrun, g.reponame, g.teamslug, g.permission)
+}
+
+func (g *GithubCommandUpdateRepositoryAddTeamAccess) String() string {
+	return fmt.Sprintf("add team %s access (%s) to repository %s", g.teamslug, g.permission, g.reponame)
+}
+
+func (g *GithubCommandUpdateRepositoryAddTeamAccess) Resources() []string {
+	return []string{repositoryResource(g.reponame), teamResource(g.teamslug)}
+}
+
+func (g *GithubCommandUpdateRepositoryAddTeamAccess) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	permission := teamRepositoryPermission(ctx, remote, g.teamslug, g.reponame)
+	if permission == "" {
+		return []GithubCommand{&GithubCommandUpdateRepositoryRemoveTeamAccess{client: g.client, dryrun: g.dryrun, reponame: g.reponame, teamslug: g.teamslug}}, true
+	}
+	return []GithubCommand{&GithubCommandUpdateRepositoryUpdateTeamAccess{client: g.client, dryrun: g.dryrun, reponame: g.reponame, teamslug: g.teamslug, permission: permission}}, true
 }
 
 type GithubCommandUpdateRepositoryUpdateTeamAccess struct {
@@ -390,8 +968,24 @@ type GithubCommandUpdateRepositoryUpdateTeamAccess struct {
 	permission string
 }
 
-func (g *GithubCommandUpdateRepositoryUpdateTeamAccess) Apply(ctx context.Context) {
-	g.client.UpdateRepositoryUpdateTeamAccess(ctx, g.dryrun, g.reponame, g.teamslug, g.permission)
+func (g *GithubCommandUpdateRepositoryUpdateTeamAccess) Apply(ctx context.Context) error {
+	return g.client.UpdateRepositoryUpdateTeamAccess(ctx, g.dryrun, g.reponame, g.teamslug, g.permission)
+}
+
+func (g *GithubCommandUpdateRepositoryUpdateTeamAccess) String() string {
+	return fmt.Sprintf("update team %s access (%s) to repository %s", g.teamslug, g.permission, g.reponame)
+}
+
+func (g *GithubCommandUpdateRepositoryUpdateTeamAccess) Resources() []string {
+	return []string{repositoryResource(g.reponame), teamResource(g.teamslug)}
+}
+
+func (g *GithubCommandUpdateRepositoryUpdateTeamAccess) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	permission := teamRepositoryPermission(ctx, remote, g.teamslug, g.reponame)
+	if permission == "" {
+		return []GithubCommand{&GithubCommandUpdateRepositoryRemoveTeamAccess{client: g.client, dryrun: g.dryrun, reponame: g.reponame, teamslug: g.teamslug}}, true
+	}
+	return []GithubCommand{&GithubCommandUpdateRepositoryUpdateTeamAccess{client: g.client, dryrun: g.dryrun, reponame: g.reponame, teamslug: g.teamslug, permission: permission}}, true
 }
 
 type GithubCommandUpdateRepositorySetExternalUser struct {
@@ -402,8 +996,28 @@ type GithubCommandUpdateRepositorySetExternalUser struct {
 	permission string
 }
 
-func (g *GithubCommandUpdateRepositorySetExternalUser) Apply(ctx context.Context) {
-	g.client.UpdateRepositorySetExternalUser(ctx, g.dryrun, g.reponame, g.githubid, g.permission)
+func (g *GithubCommandUpdateRepositorySetExternalUser) Apply(ctx context.Context) error {
+	return g.client.UpdateRepositorySetExternalUser(ctx, g.dryrun, g.reponame, g.githubid, g.permission)
+}
+
+func (g *GithubCommandUpdateRepositorySetExternalUser) String() string {
+	return fmt.Sprintf("set external user %s access (%s) to repository %s", g.githubid, g.permission, g.reponame)
+}
+
+func (g *GithubCommandUpdateRepositorySetExternalUser) Resources() []string {
+	return []string{repositoryResource(g.reponame), userResource(g.githubid)}
+}
+
+func (g *GithubCommandUpdateRepositorySetExternalUser) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	repo, ok := remote.Repositories(ctx)[g.reponame]
+	if !ok {
+		return nil, false
+	}
+	permission, ok := repo.ExternalUsers[g.githubid]
+	if !ok {
+		return []GithubCommand{&GithubCommandUpdateRepositoryRemoveExternalUser{client: g.client, dryrun: g.dryrun, reponame: g.reponame, githubid: g.githubid}}, true
+	}
+	return []GithubCommand{&GithubCommandUpdateRepositorySetExternalUser{client: g.client, dryrun: g.dryrun, reponame: g.reponame, githubid: g.githubid, permission: restPermission(permission)}}, true
 }
 
 type GithubCommandUpdateRepositoryRemoveExternalUser struct {
@@ -413,8 +1027,28 @@ type GithubCommandUpdateRepositoryRemoveExternalUser struct {
 	githubid string
 }
 
-func (g *GithubCommandUpdateRepositoryRemoveExternalUser) Apply(ctx context.Context) {
-	g.client.UpdateRepositoryRemoveExternalUser(ctx, g.dryrun, g.reponame, g.githubid)
+func (g *GithubCommandUpdateRepositoryRemoveExternalUser) Apply(ctx context.Context) error {
+	return g.client.UpdateRepositoryRemoveExternalUser(ctx, g.dryrun, g.reponame, g.githubid)
+}
+
+func (g *GithubCommandUpdateRepositoryRemoveExternalUser) String() string {
+	return fmt.Sprintf("remove external user %s from repository %s", g.githubid, g.reponame)
+}
+
+func (g *GithubCommandUpdateRepositoryRemoveExternalUser) Resources() []string {
+	return []string{repositoryResource(g.reponame), userResource(g.githubid)}
+}
+
+func (g *GithubCommandUpdateRepositoryRemoveExternalUser) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	repo, ok := remote.Repositories(ctx)[g.reponame]
+	if !ok {
+		return nil, false
+	}
+	permission, ok := repo.ExternalUsers[g.githubid]
+	if !ok {
+		return []GithubCommand{}, true
+	}
+	return []GithubCommand{&GithubCommandUpdateRepositorySetExternalUser{client: g.client, dryrun: g.dryrun, reponame: g.reponame, githubid: g.githubid, permission: restPermission(permission)}}, true
 }
 
 type GithubCommandUpdateRepositoryRemoveInternalUser struct {
@@ -424,8 +1058,29 @@ type GithubCommandUpdateRepositoryRemoveInternalUser struct {
 	githubid string
 }
 
-func (g *GithubCommandUpdateRepositoryRemoveInternalUser) Apply(ctx context.Context) {
-	g.client.UpdateRepositoryRemoveInternalUser(ctx, g.dryrun, g.reponame, g.githubid)
+func (g *GithubCommandUpdateRepositoryRemoveInternalUser) Apply(ctx context.Context) error {
+	return g.client.UpdateRepositoryRemoveInternalUser(ctx, g.dryrun, g.reponame, g.githubid)
+}
+
+func (g *GithubCommandUpdateRepositoryRemoveInternalUser) String() string {
+	return fmt.Sprintf("remove internal user %s from repository %s", g.githubid, g.reponame)
+}
+
+func (g *GithubCommandUpdateRepositoryRemoveInternalUser) Resources() []string {
+	return []string{repositoryResource(g.reponame), userResource(g.githubid)}
+}
+
+func (g *GithubCommandUpdateRepositoryRemoveInternalUser) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	repo, ok := remote.Repositories(ctx)[g.reponame]
+	if !ok {
+		return nil, false
+	}
+	permission, ok := repo.InternalUsers[g.githubid]
+	if !ok {
+		return []GithubCommand{}, true
+	}
+	// internal and external collaborators are added the same way
+	return []GithubCommand{&GithubCommandUpdateRepositorySetExternalUser{client: g.client, dryrun: g.dryrun, reponame: g.reponame, githubid: g.githubid, permission: restPermission(permission)}}, true
 }
 
 type GithubCommandUpdateRepositoryUpdateBoolProperty struct {
@@ -436,8 +1091,102 @@ type GithubCommandUpdateRepositoryUpdateBoolProperty struct {
 	propertyValue bool
 }
 
-func (g *GithubCommandUpdateRepositoryUpdateBoolProperty) Apply(ctx context.Context) {
-	g.client.UpdateRepositoryUpdateBoolProperty(ctx, g.dryrun, g.reponame, g.propertyName, g.propertyValue)
+func (g *GithubCommandUpdateRepositoryUpdateBoolProperty) Apply(ctx context.Context) error {
+	return g.client.UpdateRepositoryUpdateBoolProperty(ctx, g.dryrun, g.reponame, g.propertyName, g.propertyValue)
+}
+
+func (g *GithubCommandUpdateRepositoryUpdateBoolProperty) String() string {
+	return fmt.Sprintf("update repository %s %s to %v", g.reponame, g.propertyName, g.propertyValue)
+}
+
+func (g *GithubCommandUpdateRepositoryUpdateBoolProperty) Resources() []string {
+	return []string{repositoryResource(g.reponame)}
+}
+
+func (g *GithubCommandUpdateRepositoryUpdateBoolProperty) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	repo, ok := remote.Repositories(ctx)[g.reponame]
+	if !ok {
+		return nil, false
+	}
+	value, ok := repo.BoolProperties[g.propertyName]
+	if !ok {
+		return nil, false
+	}
+	if value == g.propertyValue {
+		return []GithubCommand{}, true
+	}
+	return []GithubCommand{&GithubCommandUpdateRepositoryUpdateBoolProperty{client: g.client, dryrun: g.dryrun, reponame: g.reponame, propertyName: g.propertyName, propertyValue: value}}, true
+}
+
+type GithubCommandUpdateRepositoryUpdateStringProperties struct {
+	client     engine.ReconciliatorExecutor
+	dryrun     bool
+	reponame   string
+	properties map[string]string
+}
+
+func (g *GithubCommandUpdateRepositoryUpdateStringProperties) Apply(ctx context.Context) error {
+	return g.client.UpdateRepositoryUpdateStringProperties(ctx, g.dryrun, g.reponame, g.properties)
+}
+
+func (g *GithubCommandUpdateRepositoryUpdateStringProperties) String() string {
+	names := make([]string, 0, len(g.properties))
+	for k := range g.properties {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	values := make([]string, 0, len(names))
+	for _, k := range names {
+		values = append(values, fmt.Sprintf("%s to '%s'", k, g.properties[k]))
+	}
+	return fmt.Sprintf("update repository %s %s", g.reponame, strings.Join(values, ", "))
+}
+
+func (g *GithubCommandUpdateRepositoryUpdateStringProperties) Resources() []string {
+	return []string{repositoryResource(g.reponame)}
+}
+
+func (g *GithubCommandUpdateRepositoryUpdateStringProperties) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	repo, ok := remote.Repositories(ctx)[g.reponame]
+	if !ok {
+		return nil, false
+	}
+	previous := make(map[string]string)
+	for k := range g.properties {
+		value, ok := repo.StringProperties[k]
+		if !ok {
+			return nil, false
+		}
+		previous[k] = value
+	}
+	return []GithubCommand{&GithubCommandUpdateRepositoryUpdateStringProperties{client: g.client, dryrun: g.dryrun, reponame: g.reponame, properties: previous}}, true
+}
+
+type GithubCommandUpdateRepositorySetTopics struct {
+	client   engine.ReconciliatorExecutor
+	dryrun   bool
+	reponame string
+	topics   []string
+}
+
+func (g *GithubCommandUpdateRepositorySetTopics) Apply(ctx context.Context) error {
+	return g.client.UpdateRepositorySetTopics(ctx, g.dryrun, g.reponame, g.topics)
+}
+
+func (g *GithubCommandUpdateRepositorySetTopics) String() string {
+	return fmt.Sprintf("set repository %s topics to [%s]", g.reponame, strings.Join(g.topics, ","))
+}
+
+func (g *GithubCommandUpdateRepositorySetTopics) Resources() []string {
+	return []string{repositoryResource(g.reponame)}
+}
+
+func (g *GithubCommandUpdateRepositorySetTopics) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	repo, ok := remote.Repositories(ctx)[g.reponame]
+	if !ok {
+		return nil, false
+	}
+	return []GithubCommand{&GithubCommandUpdateRepositorySetTopics{client: g.client, dryrun: g.dryrun, reponame: g.reponame, topics: append([]string{}, repo.Topics...)}}, true
 }
 
 type GithubCommandUpdateTeamAddMember struct {
@@ -448,8 +1197,24 @@ type GithubCommandUpdateTeamAddMember struct {
 	role     string
 }
 
-func (g *GithubCommandUpdateTeamAddMember) Apply(ctx context.Context) {
-	g.client.UpdateTeamAddMember(ctx, g.dryrun, g.teamslug, g.member, g.role)
+func (g *GithubCommandUpdateTeamAddMember) Apply(ctx context.Context) error {
+	return g.client.UpdateTeamAddMember(ctx, g.dryrun, g.teamslug, g.member, g.role)
+}
+
+func (g *GithubCommandUpdateTeamAddMember) String() string {
+	return fmt.Sprintf("add member %s (%s) to team %s", g.member, g.role, g.teamslug)
+}
+
+func (g *GithubCommandUpdateTeamAddMember) Resources() []string {
+	return []string{teamResource(g.teamslug), userResource(g.member)}
+}
+
+func (g *GithubCommandUpdateTeamAddMember) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	role := teamMemberRole(ctx, remote, g.teamslug, g.member)
+	if role == "" {
+		return []GithubCommand{&GithubCommandUpdateTeamRemoveMember{client: g.client, dryrun: g.dryrun, teamslug: g.teamslug, member: g.member}}, true
+	}
+	return []GithubCommand{&GithubCommandUpdateTeamUpdateMember{client: g.client, dryrun: g.dryrun, teamslug: g.teamslug, member: g.member, role: role}}, true
 }
 
 type GithubCommandUpdateTeamRemoveMember struct {
@@ -459,8 +1224,24 @@ type GithubCommandUpdateTeamRemoveMember struct {
 	member   string
 }
 
-func (g *GithubCommandUpdateTeamRemoveMember) Apply(ctx context.Context) {
-	g.client.UpdateTeamRemoveMember(ctx, g.dryrun, g.teamslug, g.member)
+func (g *GithubCommandUpdateTeamRemoveMember) Apply(ctx context.Context) error {
+	return g.client.UpdateTeamRemoveMember(ctx, g.dryrun, g.teamslug, g.member)
+}
+
+func (g *GithubCommandUpdateTeamRemoveMember) String() string {
+	return fmt.Sprintf("remove member %s from team %s", g.member, g.teamslug)
+}
+
+func (g *GithubCommandUpdateTeamRemoveMember) Resources() []string {
+	return []string{teamResource(g.teamslug), userResource(g.member)}
+}
+
+func (g *GithubCommandUpdateTeamRemoveMember) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	role := teamMemberRole(ctx, remote, g.teamslug, g.member)
+	if role == "" {
+		return []GithubCommand{}, true
+	}
+	return []GithubCommand{&GithubCommandUpdateTeamAddMember{client: g.client, dryrun: g.dryrun, teamslug: g.teamslug, member: g.member, role: role}}, true
 }
 
 type GithubCommandUpdateTeamUpdateMember struct {
@@ -471,8 +1252,24 @@ type GithubCommandUpdateTeamUpdateMember struct {
 	role     string
 }
 
-func (g *GithubCommandUpdateTeamUpdateMember) Apply(ctx context.Context) {
-	g.client.UpdateTeamUpdateMember(ctx, g.dryrun, g.teamslug, g.member, g.role)
+func (g *GithubCommandUpdateTeamUpdateMember) Apply(ctx context.Context) error {
+	return g.client.UpdateTeamUpdateMember(ctx, g.dryrun, g.teamslug, g.member, g.role)
+}
+
+func (g *GithubCommandUpdateTeamUpdateMember) String() string {
+	return fmt.Sprintf("update member %s (%s) of team %s", g.member, g.role, g.teamslug)
+}
+
+func (g *GithubCommandUpdateTeamUpdateMember) Resources() []string {
+	return []string{teamResource(g.teamslug), userResource(g.member)}
+}
+
+func (g *GithubCommandUpdateTeamUpdateMember) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	role := teamMemberRole(ctx, remote, g.teamslug, g.member)
+	if role == "" {
+		return []GithubCommand{&GithubCommandUpdateTeamRemoveMember{client: g.client, dryrun: g.dryrun, teamslug: g.teamslug, member: g.member}}, true
+	}
+	return []GithubCommand{&GithubCommandUpdateTeamUpdateMember{client: g.client, dryrun: g.dryrun, teamslug: g.teamslug, member: g.member, role: role}}, true
 }
 
 type GithubCommandUpdateTeamSetParent struct {
@@ -482,8 +1279,29 @@ type GithubCommandUpdateTeamSetParent struct {
 	parentTeam *int
 }
 
-func (g *GithubCommandUpdateTeamSetParent) Apply(ctx context.Context) {
-	g.client.UpdateTeamSetParent(ctx, g.dryrun, g.teamslug, g.parentTeam)
+func (g *GithubCommandUpdateTeamSetParent) Apply(ctx context.Context) error {
+	return g.client.UpdateTeamSetParent(ctx, g.dryrun, g.teamslug, g.parentTeam)
+}
+
+func (g *GithubCommandUpdateTeamSetParent) String() string {
+	return fmt.Sprintf("update team %s parent", g.teamslug)
+}
+
+func (g *GithubCommandUpdateTeamSetParent) Resources() []string {
+	return []string{teamResource(g.teamslug), RESOURCE_TEAMS_HIERARCHY}
+}
+
+func (g *GithubCommandUpdateTeamSetParent) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	team, ok := remote.Teams(ctx, true)[g.teamslug]
+	if !ok {
+		return nil, false
+	}
+	var parentTeam *int
+	if team.ParentTeam != nil {
+		parent := *team.ParentTeam
+		parentTeam = &parent
+	}
+	return []GithubCommand{&GithubCommandUpdateTeamSetParent{client: g.client, dryrun: g.dryrun, teamslug: g.teamslug, parentTeam: parentTeam}}, true
 }
 
 type GithubCommandAddRepositoryRuletset struct {
@@ -493,8 +1311,21 @@ type GithubCommandAddRepositoryRuletset struct {
 	ruleset  *engine.GithubRuleSet
 }
 
-func (g *GithubCommandAddRepositoryRuletset) Apply(ctx context.Context) {
-	g.client.AddRepositoryRuleset(ctx, g.dryrun, g.reponame, g.ruleset)
+func (g *GithubCommandAddRepositoryRuletset) Apply(ctx context.Context) error {
+	return g.client.AddRepositoryRuleset(ctx, g.dryrun, g.reponame, g.ruleset)
+}
+
+func (g *GithubCommandAddRepositoryRuletset) String() string {
+	return fmt.Sprintf("add ruleset %s to repository %s", g.ruleset.Name, g.reponame)
+}
+
+func (g *GithubCommandAddRepositoryRuletset) Resources() []string {
+	return []string{repositoryResource(g.reponame)}
+}
+
+func (g *GithubCommandAddRepositoryRuletset) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	// the id of the new ruleset is only known by Github
+	return nil, false
 }
 
 type GithubCommandUpdateRepositoryRuletset struct {
@@ -504,8 +1335,28 @@ type GithubCommandUpdateRepositoryRuletset struct {
 	ruleset  *engine.GithubRuleSet
 }
 
-func (g *GithubCommandUpdateRepositoryRuletset) Apply(ctx context.Context) {
-	g.client.UpdateRepositoryRuleset(ctx, g.dryrun, g.reponame, g.ruleset)
+func (g *GithubCommandUpdateRepositoryRuletset) Apply(ctx context.Context) error {
+	return g.client.UpdateRepositoryRuleset(ctx, g.dryrun, g.reponame, g.ruleset)
+}
+
+func (g *GithubCommandUpdateRepositoryRuletset) String() string {
+	return fmt.Sprintf("update ruleset %s of repository %s", g.ruleset.Name, g.reponame)
+}
+
+func (g *GithubCommandUpdateRepositoryRuletset) Resources() []string {
+	return []string{repositoryResource(g.reponame)}
+}
+
+func (g *GithubCommandUpdateRepositoryRuletset) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	repo, ok := remote.Repositories(ctx)[g.reponame]
+	if !ok {
+		return nil, false
+	}
+	previous, ok := repo.RuleSets[g.ruleset.Name]
+	if !ok {
+		return nil, false
+	}
+	return []GithubCommand{&GithubCommandUpdateRepositoryRuletset{client: g.client, dryrun: g.dryrun, reponame: g.reponame, ruleset: previous}}, true
 }
 
 type GithubCommandDeleteRepositoryRuletset struct {
@@ -515,8 +1366,29 @@ type GithubCommandDeleteRepositoryRuletset struct {
 	rulesetid int
 }
 
-func (g *GithubCommandDeleteRepositoryRuletset) Apply(ctx context.Context) {
-	g.client.DeleteRepositoryRuleset(ctx, g.dryrun, g.reponame, g.rulesetid)
+func (g *GithubCommandDeleteRepositoryRuletset) Apply(ctx context.Context) error {
+	return g.client.DeleteRepositoryRuleset(ctx, g.dryrun, g.reponame, g.rulesetid)
+}
+
+func (g *GithubCommandDeleteRepositoryRuletset) String() string {
+	return fmt.Sprintf("delete ruleset %d of repository %s", g.rulesetid, g.reponame)
+}
+
+func (g *GithubCommandDeleteRepositoryRuletset) Resources() []string {
+	return []string{repositoryResource(g.reponame)}
+}
+
+func (g *GithubCommandDeleteRepositoryRuletset) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	repo, ok := remote.Repositories(ctx)[g.reponame]
+	if !ok {
+		return nil, false
+	}
+	for _, r := range repo.RuleSets {
+		if r.Id == g.rulesetid {
+			return []GithubCommand{&GithubCommandAddRepositoryRuletset{client: g.client, dryrun: g.dryrun, reponame: g.reponame, ruleset: r}}, true
+		}
+	}
+	return nil, false
 }
 
 type GithubCommandAddRuletset struct {
@@ -525,8 +1397,21 @@ type GithubCommandAddRuletset struct {
 	ruleset *engine.GithubRuleSet
 }
 
-func (g *GithubCommandAddRuletset) Apply(ctx context.Context) {
-	g.client.AddRuleset(ctx, g.dryrun, g.ruleset)
+func (g *GithubCommandAddRuletset) Apply(ctx context.Context) error {
+	return g.client.AddRuleset(ctx, g.dryrun, g.ruleset)
+}
+
+func (g *GithubCommandAddRuletset) String() string {
+	return fmt.Sprintf("add ruleset %s", g.ruleset.Name)
+}
+
+func (g *GithubCommandAddRuletset) Resources() []string {
+	return rulesetResources(g.ruleset)
+}
+
+func (g *GithubCommandAddRuletset) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	// the id of the new ruleset is only known by Github
+	return nil, false
 }
 
 type GithubCommandUpdateRuletset struct {
@@ -535,8 +1420,24 @@ type GithubCommandUpdateRuletset struct {
 	ruleset *engine.GithubRuleSet
 }
 
-func (g *GithubCommandUpdateRuletset) Apply(ctx context.Context) {
-	g.client.UpdateRuleset(ctx, g.dryrun, g.ruleset)
+func (g *GithubCommandUpdateRuletset) Apply(ctx context.Context) error {
+	return g.client.UpdateRuleset(ctx, g.dryrun, g.ruleset)
+}
+
+func (g *GithubCommandUpdateRuletset) String() string {
+	return fmt.Sprintf("update ruleset %s", g.ruleset.Name)
+}
+
+func (g *GithubCommandUpdateRuletset) Resources() []string {
+	return rulesetResources(g.ruleset)
+}
+
+func (g *GithubCommandUpdateRuletset) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	previous, ok := remote.RuleSets(ctx)[g.ruleset.Name]
+	if !ok {
+		return nil, false
+	}
+	return []GithubCommand{&GithubCommandUpdateRuletset{client: g.client, dryrun: g.dryrun, ruleset: previous}}, true
 }
 
 type GithubCommandDeleteRuletset struct {
@@ -545,6 +1446,141 @@ type GithubCommandDeleteRuletset struct {
 	rulesetid int
 }
 
-func (g *GithubCommandDeleteRuletset) Apply(ctx context.Context) {
-	g.client.DeleteRuleset(ctx, g.dryrun, g.rulesetid)
+func (g *GithubCommandDeleteRuletset) Apply(ctx context.Context) error {
+	return g.client.DeleteRuleset(ctx, g.dryrun, g.rulesetid)
+}
+
+func (g *GithubCommandDeleteRuletset) String() string {
+	return fmt.Sprintf("delete ruleset %d", g.rulesetid)
+}
+
+func (g *GithubCommandDeleteRuletset) Resources() []string {
+	return []string{RESOURCE_RULESETS}
+}
+
+func (g *GithubCommandDeleteRuletset) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	for _, r := range remote.RuleSets(ctx) {
+		if r.Id == g.rulesetid {
+			return []GithubCommand{&GithubCommandAddRuletset{client: g.client, dryrun: g.dryrun, ruleset: r}}, true
+		}
+	}
+	return nil, false
+}
+
+type GithubCommandUpdateRepositorySetCustomProperties struct {
+	client     engine.ReconciliatorExecutor
+	dryrun     bool
+	reponame   string
+	properties map[string][]string
+	valueTypes map[string]string
+}
+
+func (g *GithubCommandUpdateRepositorySetCustomProperties) Apply(ctx context.Context) error {
+	return g.client.UpdateRepositorySetCustomProperties(ctx, g.dryrun, g.reponame, g.properties, g.valueTypes)
+}
+
+func (g *GithubCommandUpdateRepositorySetCustomProperties) String() string {
+	names := make([]string, 0, len(g.properties))
+	for name := range g.properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make([]string, 0, len(names))
+	for _, name := range names {
+		values = append(values, fmt.Sprintf("%s=[%s]", name, strings.Join(g.properties[name], ",")))
+	}
+	return fmt.Sprintf("set repository %s custom properties %s", g.reponame, strings.Join(values, " "))
+}
+
+// the values must be set after the custom properties definitions are created
+func (g *GithubCommandUpdateRepositorySetCustomProperties) Resources() []string {
+	resources := []string{repositoryResource(g.reponame)}
+	for name := range g.properties {
+		resources = append(resources, customPropertyResource(name))
+	}
+	return resources
+}
+
+func (g *GithubCommandUpdateRepositorySetCustomProperties) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	repo, ok := remote.Repositories(ctx)[g.reponame]
+	if !ok {
+		return nil, false
+	}
+	previous := make(map[string][]string)
+	for k := range g.properties {
+		// an empty value unsets the property
+		previous[k] = append([]string{}, repo.CustomProperties[k]...)
+	}
+	return []GithubCommand{&GithubCommandUpdateRepositorySetCustomProperties{client: g.client, dryrun: g.dryrun, reponame: g.reponame, properties: previous, valueTypes: g.valueTypes}}, true
+}
+
+type GithubCommandAddCustomProperty struct {
+	client   engine.ReconciliatorExecutor
+	dryrun   bool
+	property *engine.GithubCustomProperty
+}
+
+func (g *GithubCommandAddCustomProperty) Apply(ctx context.Context) error {
+	return g.client.AddCustomProperty(ctx, g.dryrun, g.property)
+}
+
+func (g *GithubCommandAddCustomProperty) String() string {
+	return fmt.Sprintf("add custom property %s", g.property.Name)
+}
+
+func (g *GithubCommandAddCustomProperty) Resources() []string {
+	return []string{customPropertyResource(g.property.Name)}
+}
+
+func (g *GithubCommandAddCustomProperty) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	return []GithubCommand{&GithubCommandDeleteCustomProperty{client: g.client, dryrun: g.dryrun, propertyname: g.property.Name}}, true
+}
+
+type GithubCommandUpdateCustomProperty struct {
+	client   engine.ReconciliatorExecutor
+	dryrun   bool
+	property *engine.GithubCustomProperty
+}
+
+func (g *GithubCommandUpdateCustomProperty) Apply(ctx context.Context) error {
+	return g.client.UpdateCustomProperty(ctx, g.dryrun, g.property)
+}
+
+func (g *GithubCommandUpdateCustomProperty) String() string {
+	return fmt.Sprintf("update custom property %s", g.property.Name)
+}
+
+func (g *GithubCommandUpdateCustomProperty) Resources() []string {
+	return []string{customPropertyResource(g.property.Name)}
+}
+
+func (g *GithubCommandUpdateCustomProperty) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	previous, ok := remote.CustomProperties(ctx)[g.property.Name]
+	if !ok {
+		return nil, false
+	}
+	return []GithubCommand{&GithubCommandUpdateCustomProperty{client: g.client, dryrun: g.dryrun, property: previous}}, true
+}
+
+type GithubCommandDeleteCustomProperty struct {
+	client       engine.ReconciliatorExecutor
+	dryrun       bool
+	propertyname string
+}
+
+func (g *GithubCommandDeleteCustomProperty) Apply(ctx context.Context) error {
+	return g.client.DeleteCustomProperty(ctx, g.dryrun, g.propertyname)
+}
+
+func (g *GithubCommandDeleteCustomProperty) String() string {
+	return fmt.Sprintf("delete custom property %s", g.propertyname)
+}
+
+func (g *GithubCommandDeleteCustomProperty) Resources() []string {
+	return []string{customPropertyResource(g.propertyname)}
+}
+
+func (g *GithubCommandDeleteCustomProperty) Inverse(ctx context.Context, remote engine.GoliacRemote) ([]GithubCommand, bool) {
+	// the definition can be recreated, but the repositories values are lost
+	return nil, false
 }
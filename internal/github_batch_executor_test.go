@@ -0,0 +1,431 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Alayacare/goliac/internal/engine"
+	"github.com/Alayacare/goliac/swagger_gen/restapi/operations/app"
+	"github.com/stretchr/testify/assert"
+)
+
+// GitHubClientMock that fails the REST calls on the endpoints containing failOn
+type GitHubClientFailingMock struct {
+	GitHubClientMock
+	failOn string
+}
+
+func (c *GitHubClientFailingMock) CallRestAPI(ctx context.Context, endpoint, parameters, method string, body map[string]interface{}) ([]byte, error) {
+	if strings.Contains(endpoint, c.failOn) {
+		return []byte(`{"message": "Must have admin rights to Repository."}`), fmt.Errorf("unexpected status: 403 Forbidden")
+	}
+	if method == "POST" && strings.HasSuffix(endpoint, "/teams") {
+		return []byte(`{"name": "team3", "slug": "team3"}`), nil
+	}
+	return nil, nil
+}
+
+func TestGithubBatchExecutor(t *testing.T) {
+
+	t.Run("happy path: all commands applied", func(t *testing.T) {
+		remote := engine.NewGoliacRemoteImpl(&GitHubClientFailingMock{failOn: "not-called"})
+		executor := NewGithubBatchExecutor(remote, 50, 1, false)
+
+		ctx := context.TODO()
+		executor.Begin(false)
+		executor.CreateTeam(ctx, false, "team3", "", nil, []string{})
+		executor.UpdateTeamAddMember(ctx, false, "team3", "user1", "member")
+		err := executor.Commit(ctx, false)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("not happy path: failures are reported and the other commands still applied", func(t *testing.T) {
+		remote := engine.NewGoliacRemoteImpl(&GitHubClientFailingMock{failOn: "/repo1"})
+		executor := NewGithubBatchExecutor(remote, 50, 1, false)
+
+		ctx := context.TODO()
+		executor.Begin(false)
+		executor.CreateTeam(ctx, false, "team3", "", nil, []string{})
+		executor.UpdateRepositoryAddTeamAccess(ctx, false, "repo1", "team3", "push")
+		executor.RenameRepository(ctx, false, "repo1", "repo2")
+		err := executor.Commit(ctx, false)
+
+		assert.NotNil(t, err)
+		var applyErr *ApplyError
+		assert.True(t, errors.As(err, &applyErr))
+		assert.Equal(t, 1, applyErr.Applied)
+		assert.Equal(t, 2, len(applyErr.Failures))
+		assert.Equal(t, "add team team3 access (push) to repository repo1", applyErr.Failures[0].Command)
+		assert.Equal(t, "rename repository repo1 to repo2", applyErr.Failures[1].Command)
+		assert.True(t, strings.Contains(applyErr.Failures[0].Err.Error(), "Must have admin rights"))
+		// the rename depends on the (failed) team access change
+		assert.Equal(t, "not applied because 'add team team3 access (push) to repository repo1' failed", applyErr.Failures[1].Err.Error())
+	})
+
+	t.Run("not happy path: too many changesets", func(t *testing.T) {
+		remote := engine.NewGoliacRemoteImpl(&GitHubClientFailingMock{failOn: "not-called"})
+		executor := NewGithubBatchExecutor(remote, 1, 1, false)
+
+		ctx := context.TODO()
+		executor.Begin(false)
+		executor.CreateTeam(ctx, false, "team3", "", nil, []string{})
+		executor.CreateTeam(ctx, false, "team4", "", nil, []string{})
+		err := executor.Commit(ctx, false)
+
+		assert.NotNil(t, err)
+		var applyErr *ApplyError
+		assert.False(t, errors.As(err, &applyErr))
+	})
+
+	t.Run("happy path: the failed operations are exposed in the status and the notification", func(t *testing.T) {
+		localfixture, remotefixture := fixtureGoliacLocal()
+		applyErr := &ApplyError{
+			Applied: 3,
+			Failures: []GithubCommandFailure{
+				{Command: "delete repository repo1", Err: fmt.Errorf("unexpected status: 403 Forbidden")},
+			},
+		}
+		server := GoliacServerImpl{
+			goliac:            NewGoliacMock(localfixture, remotefixture),
+			lastSyncError:     fmt.Errorf("failed to apply on branch main: %w", applyErr),
+			lastApplyFailures: applyErr.Failures,
+		}
+
+		res := server.GetStatus(app.GetStatusParams{})
+		payload := res.(*app.GetStatusOK)
+		assert.Equal(t, 1, len(payload.Payload.FailedOperations))
+		assert.Equal(t, "delete repository repo1", payload.Payload.FailedOperations[0].Operation)
+		assert.Equal(t, "unexpected status: 403 Forbidden", payload.Payload.FailedOperations[0].Error)
+
+		message := applyFailuresMessage("Goliac failed to apply some changes on Github when syncing", applyErr)
+		assert.Equal(t, "Goliac failed to apply some changes on Github when syncing (1 operation(s) failed, 3 applied):\n- delete repository repo1: unexpected status: 403 Forbidden\n", message)
+	})
+
+	t.Run("happy path: the commits applied one by one are notified", func(t *testing.T) {
+		commits := []AppliedCommit{
+			{CommitAudit: engine.CommitAudit{CommitHash: "abc", Author: "user1", PullRequest: 42}, Operations: 2},
+			{CommitAudit: engine.CommitAudit{CommitHash: "def", Author: "user2"}, Skipped: fmt.Errorf("invalid")},
+			{CommitAudit: engine.CommitAudit{CommitHash: "ghi", Author: "user3"}},
+		}
+		message := appliedCommitsMessage(commits)
+		assert.Equal(t, "Goliac applied the teams repo commits:\n- abc by user1 (PR #42): 2 operation(s)\n- def by user2: skipped (invalid)\n", message)
+
+		// nothing done: nothing to notify
+		assert.Equal(t, "", appliedCommitsMessage(commits[2:]))
+	})
+}
+
+// GoliacRemoteExecutorMock that records the order in which the commands are applied
+type GoliacRemoteExecutorOrderMock struct {
+	*GoliacRemoteExecutorMock
+	orderMutex sync.Mutex
+	order      []string
+	slow       map[string]bool // commands that take some time to be applied
+	fail       map[string]bool // commands that fail
+}
+
+func (e *GoliacRemoteExecutorOrderMock) record(command string) error {
+	if e.slow[command] {
+		time.Sleep(50 * time.Millisecond)
+	}
+	e.orderMutex.Lock()
+	defer e.orderMutex.Unlock()
+	e.order = append(e.order, command)
+	if e.fail[command] {
+		return fmt.Errorf("unexpected status: 500 Internal Server Error")
+	}
+	return nil
+}
+
+func (e *GoliacRemoteExecutorOrderMock) indexOf(command string) int {
+	for i, c := range e.order {
+		if c == command {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *GoliacRemoteExecutorOrderMock) AddUserToOrg(ctx context.Context, dryrun bool, ghuserid string) error {
+	return e.record("add_user:" + ghuserid)
+}
+func (e *GoliacRemoteExecutorOrderMock) CreateTeam(ctx context.Context, dryrun bool, teamname string, description string, parentTeam *int, members []string) error {
+	return e.record("create_team:" + teamname)
+}
+func (e *GoliacRemoteExecutorOrderMock) UpdateTeamSetParent(ctx context.Context, dryrun bool, teamslug string, parentTeam *int) error {
+	return e.record("set_parent:" + teamslug)
+}
+func (e *GoliacRemoteExecutorOrderMock) UpdateTeamAddMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error {
+	return e.record("add_member:" + teamslug + ":" + username)
+}
+func (e *GoliacRemoteExecutorOrderMock) CreateRepository(ctx context.Context, dryrun bool, reponame string, descrition string, writers []string, readers []string, boolProperties map[string]bool) error {
+	return e.record("create_repository:" + reponame)
+}
+func (e *GoliacRemoteExecutorOrderMock) UpdateRepositoryAddTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
+	return e.record("add_team_access:" + reponame + ":" + teamslug)
+}
+func (e *GoliacRemoteExecutorOrderMock) RenameRepository(ctx context.Context, dryrun bool, reponame string, newname string) error {
+	return e.record("rename_repository:" + reponame)
+}
+func (e *GoliacRemoteExecutorOrderMock) UpdateRepositoryUpdateTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
+	return e.record("update_team_access:" + reponame + ":" + teamslug + ":" + permission)
+}
+func (e *GoliacRemoteExecutorOrderMock) UpdateRepositoryRemoveTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string) error {
+	return e.record("remove_team_access:" + reponame + ":" + teamslug)
+}
+func (e *GoliacRemoteExecutorOrderMock) DeleteTeam(ctx context.Context, dryrun bool, teamslug string) error {
+	return e.record("delete_team:" + teamslug)
+}
+func (e *GoliacRemoteExecutorOrderMock) DeleteRepository(ctx context.Context, dryrun bool, reponame string) error {
+	return e.record("delete_repository:" + reponame)
+}
+func (e *GoliacRemoteExecutorOrderMock) AddRuleset(ctx context.Context, dryrun bool, ruleset *engine.GithubRuleSet) error {
+	return e.record("add_ruleset:" + ruleset.Name)
+}
+
+func TestGithubBatchExecutorOrdering(t *testing.T) {
+
+	t.Run("happy path: dependencies between commands", func(t *testing.T) {
+		executor := NewGithubBatchExecutor(NewGoliacRemoteExecutorMock(), 50, 4, false)
+		ctx := context.TODO()
+		parent := 1
+		executor.CreateTeam(ctx, false, "Team 3", "", nil, []string{"user1"})
+		executor.AddUserToOrg(ctx, false, "user1")
+		executor.UpdateRepositoryAddTeamAccess(ctx, false, "repo1", "team-3", "push")
+		executor.RenameRepository(ctx, false, "repo2", "repo3")
+		executor.UpdateRepositoryUpdateBoolProperty(ctx, false, "repo3", "archived", true)
+		executor.CreateTeam(ctx, false, "team4", "", &parent, []string{})
+		executor.UpdateTeamSetParent(ctx, false, "team5", &parent)
+		executor.UpdateRepositoryAddTeamAccess(ctx, false, "repo4", "team6", "pull")
+		executor.CreateRepository(ctx, false, "repo1", "", []string{"team-3"}, []string{"team-3"}, map[string]bool{})
+		executor.AddRuleset(ctx, false, &engine.GithubRuleSet{Name: "rs", Repositories: []string{"repo1"}})
+
+		dependencies := commandsDependencies(executor.commands)
+		assert.Equal(t, []int{}, dependencies[0])
+		assert.Equal(t, []int{0}, dependencies[1]) // user1 is a member of the team created
+		assert.Equal(t, []int{0}, dependencies[2]) // team created before being added to a repo
+		assert.Equal(t, []int{}, dependencies[3])  // independent
+		assert.Equal(t, []int{3}, dependencies[4]) // repo renamed before being updated
+		assert.Equal(t, []int{0}, dependencies[5]) // teams hierarchy is applied in order
+		assert.Equal(t, []int{5}, dependencies[6]) // teams hierarchy is applied in order
+		assert.Equal(t, []int{}, dependencies[7])  // independent
+		assert.Equal(t, []int{2}, dependencies[8]) // same repo, same team (and no self dependency)
+		assert.Equal(t, []int{8}, dependencies[9]) // ruleset applied on a created repository
+	})
+
+	t.Run("happy path: independent commands are applied concurrently, the others in order", func(t *testing.T) {
+		remote := &GoliacRemoteExecutorOrderMock{
+			GoliacRemoteExecutorMock: NewGoliacRemoteExecutorMock().(*GoliacRemoteExecutorMock),
+			slow:                     map[string]bool{"create_team:team3": true, "rename_repository:repo2": true},
+		}
+		executor := NewGithubBatchExecutor(remote, 50, 4, false)
+		ctx := context.TODO()
+		executor.Begin(false)
+		executor.CreateTeam(ctx, false, "team3", "", nil, []string{})
+		executor.UpdateTeamAddMember(ctx, false, "team3", "user1", "member")
+		executor.UpdateRepositoryAddTeamAccess(ctx, false, "repo1", "team3", "push")
+		executor.RenameRepository(ctx, false, "repo2", "repo3")
+		executor.UpdateRepositoryAddTeamAccess(ctx, false, "repo3", "team4", "push")
+		executor.AddUserToOrg(ctx, false, "user2")
+		err := executor.Commit(ctx, false)
+		assert.Nil(t, err)
+
+		assert.Equal(t, 6, len(remote.order))
+		// the independent (fast) command didn't wait for the slow ones
+		assert.Equal(t, 0, remote.indexOf("add_user:user2"))
+		// the dependent commands waited
+		assert.True(t, remote.indexOf("create_team:team3") < remote.indexOf("add_member:team3:user1"))
+		assert.True(t, remote.indexOf("add_member:team3:user1") < remote.indexOf("add_team_access:repo1:team3"))
+		assert.True(t, remote.indexOf("rename_repository:repo2") < remote.indexOf("add_team_access:repo3:team4"))
+	})
+
+	t.Run("happy path: a single thread applies the commands in order", func(t *testing.T) {
+		remote := &GoliacRemoteExecutorOrderMock{
+			GoliacRemoteExecutorMock: NewGoliacRemoteExecutorMock().(*GoliacRemoteExecutorMock),
+			slow:                     map[string]bool{"create_team:team3": true},
+		}
+		executor := NewGithubBatchExecutor(remote, 50, 1, false)
+		ctx := context.TODO()
+		executor.Begin(false)
+		executor.CreateTeam(ctx, false, "team3", "", nil, []string{})
+		executor.AddUserToOrg(ctx, false, "user2")
+		executor.CreateRepository(ctx, false, "repo5", "", []string{}, []string{}, map[string]bool{})
+		err := executor.Commit(ctx, false)
+		assert.Nil(t, err)
+
+		assert.Equal(t, []string{"create_team:team3", "add_user:user2", "create_repository:repo5"}, remote.order)
+	})
+}
+
+func TestGithubBatchExecutorTransactional(t *testing.T) {
+
+	t.Run("happy path: inverse commands computed from the remote state", func(t *testing.T) {
+		remote := NewGoliacRemoteExecutorMock()
+		executor := NewGithubBatchExecutor(remote, 50, 1, true)
+		ctx := context.TODO()
+		executor.UpdateRepositoryAddTeamAccess(ctx, false, "repo1", "team1", "admin")
+		executor.UpdateRepositoryAddTeamAccess(ctx, false, "repo2", "team1", "pull")
+		executor.UpdateRepositoryRemoveTeamAccess(ctx, false, "repo2", "team2")
+		executor.UpdateTeamRemoveMember(ctx, false, "team1", "github1")
+		executor.UpdateTeamAddMember(ctx, false, "team1", "github3", "member")
+		executor.UpdateRepositoryUpdateBoolProperty(ctx, false, "repo1", "archived", true)
+		executor.RenameRepository(ctx, false, "repo1", "repo3")
+		executor.CreateTeam(ctx, false, "Team 3", "", nil, []string{})
+		executor.AddUserToOrg(ctx, false, "github1")
+		executor.DeleteRepository(ctx, false, "repo2")
+		executor.DeleteTeam(ctx, false, "team2")
+
+		expected := []string{
+			"update team team1 access (push) to repository repo1", // team1 had write access
+			"remove team team1 access to repository repo2",
+			"add team team2 access (push) to repository repo2",
+			"add member github1 (member) to team team1",
+			"remove member github3 from team team1",
+			"update repository repo1 archived to false",
+			"rename repository repo3 to repo1",
+			"delete team team-3",
+			"", // github1 was already part of the organization
+		}
+		for i, c := range expected {
+			inverse, reversible := executor.commands[i].Inverse(ctx, remote)
+			assert.True(t, reversible)
+			inverses := make([]string, 0)
+			for _, ic := range inverse {
+				inverses = append(inverses, ic.String())
+			}
+			assert.Equal(t, c, strings.Join(inverses, ","))
+		}
+
+		_, reversible := executor.commands[9].Inverse(ctx, remote)
+		assert.False(t, reversible)
+		_, reversible = executor.commands[10].Inverse(ctx, remote)
+		assert.False(t, reversible)
+	})
+
+	t.Run("happy path: inverse of the repository settings and topics", func(t *testing.T) {
+		remote := NewGoliacRemoteExecutorMock()
+		executor := NewGithubBatchExecutor(remote, 50, 1, true)
+		ctx := context.TODO()
+		executor.UpdateRepositorySetTopics(ctx, false, "repo1", []string{"backend", "go"})
+		executor.UpdateRepositoryUpdateStringProperties(ctx, false, "repo1", map[string]string{"description": "the first repository"})
+
+		inverse, reversible := executor.commands[0].Inverse(ctx, remote)
+		assert.True(t, reversible)
+		assert.Equal(t, "set repository repo1 topics to [backend]", inverse[0].String())
+
+		// the previous description is unknown
+		_, reversible = executor.commands[1].Inverse(ctx, remote)
+		assert.False(t, reversible)
+	})
+
+	t.Run("happy path: inverse of the custom properties", func(t *testing.T) {
+		remote := NewGoliacRemoteExecutorMock()
+		executor := NewGithubBatchExecutor(remote, 50, 1, true)
+		ctx := context.TODO()
+		executor.AddCustomProperty(ctx, false, &engine.GithubCustomProperty{Name: "owner", ValueType: "string"})
+		executor.UpdateCustomProperty(ctx, false, &engine.GithubCustomProperty{Name: "tier", ValueType: "single_select", AllowedValues: []string{"gold", "silver"}})
+		executor.UpdateRepositorySetCustomProperties(ctx, false, "repo1", map[string][]string{"tier": {"silver"}, "owner": {"team1"}}, map[string]string{"tier": "single_select", "owner": "string"})
+		executor.DeleteCustomProperty(ctx, false, "tier")
+
+		inverse, reversible := executor.commands[0].Inverse(ctx, remote)
+		assert.True(t, reversible)
+		assert.Equal(t, "delete custom property owner", inverse[0].String())
+
+		inverse, reversible = executor.commands[1].Inverse(ctx, remote)
+		assert.True(t, reversible)
+		assert.Equal(t, []string{"gold", "silver", "bronze"}, inverse[0].(*GithubCommandUpdateCustomProperty).property.AllowedValues)
+
+		// owner was not set: it is unset
+		inverse, reversible = executor.commands[2].Inverse(ctx, remote)
+		assert.True(t, reversible)
+		assert.Equal(t, "set repository repo1 custom properties owner=[] tier=[gold]", inverse[0].String())
+
+		// the repositories values would be lost
+		_, reversible = executor.commands[3].Inverse(ctx, remote)
+		assert.False(t, reversible)
+	})
+
+	t.Run("happy path: no failure, nothing is undone", func(t *testing.T) {
+		remote := &GoliacRemoteExecutorOrderMock{
+			GoliacRemoteExecutorMock: NewGoliacRemoteExecutorMock().(*GoliacRemoteExecutorMock),
+		}
+		executor := NewGithubBatchExecutor(remote, 50, 4, true)
+		ctx := context.TODO()
+		executor.Begin(false)
+		executor.CreateTeam(ctx, false, "team3", "", nil, []string{})
+		executor.UpdateRepositoryAddTeamAccess(ctx, false, "repo1", "team1", "admin")
+		err := executor.Commit(ctx, false)
+		assert.Nil(t, err)
+
+		assert.Equal(t, []string{"create_team:team3", "add_team_access:repo1:team1"}, remote.order)
+	})
+
+	t.Run("not happy path: the applied commands are undone in reverse order", func(t *testing.T) {
+		remote := &GoliacRemoteExecutorOrderMock{
+			GoliacRemoteExecutorMock: NewGoliacRemoteExecutorMock().(*GoliacRemoteExecutorMock),
+			fail:                     map[string]bool{"add_user:user2": true},
+		}
+		executor := NewGithubBatchExecutor(remote, 50, 4, true)
+		ctx := context.TODO()
+		executor.Begin(false)
+		executor.CreateTeam(ctx, false, "team3", "", nil, []string{})
+		executor.UpdateRepositoryAddTeamAccess(ctx, false, "repo1", "team1", "admin")
+		executor.AddUserToOrg(ctx, false, "user2")
+		executor.CreateRepository(ctx, false, "repo5", "", []string{}, []string{}, map[string]bool{})
+		err := executor.Commit(ctx, false)
+
+		var applyErr *ApplyError
+		assert.True(t, errors.As(err, &applyErr))
+		assert.Equal(t, 2, applyErr.Applied)
+		assert.Equal(t, 2, applyErr.RolledBack)
+		assert.Equal(t, 0, len(applyErr.RollbackFailures))
+		assert.Equal(t, 2, len(applyErr.Failures))
+		assert.Equal(t, "add user user2 to the organization", applyErr.Failures[0].Command)
+		assert.Equal(t, "not applied because 'add user user2 to the organization' failed", applyErr.Failures[1].Err.Error())
+
+		assert.Equal(t, []string{
+			"create_team:team3",
+			"add_team_access:repo1:team1",
+			"add_user:user2",
+			"update_team_access:repo1:team1:push",
+			"delete_team:team3",
+		}, remote.order)
+	})
+
+	t.Run("not happy path: the commands that cannot be undone are reported", func(t *testing.T) {
+		remote := &GoliacRemoteExecutorOrderMock{
+			GoliacRemoteExecutorMock: NewGoliacRemoteExecutorMock().(*GoliacRemoteExecutorMock),
+			fail:                     map[string]bool{"create_team:team3": true},
+		}
+		executor := NewGithubBatchExecutor(remote, 50, 1, true)
+		ctx := context.TODO()
+		executor.Begin(false)
+		executor.UpdateRepositoryAddTeamAccess(ctx, false, "repo2", "team1", "pull")
+		executor.DeleteRepository(ctx, false, "repo1")
+		executor.CreateTeam(ctx, false, "team3", "", nil, []string{})
+		err := executor.Commit(ctx, false)
+
+		var applyErr *ApplyError
+		assert.True(t, errors.As(err, &applyErr))
+		assert.Equal(t, 1, applyErr.RolledBack)
+		assert.Equal(t, 1, len(applyErr.RollbackFailures))
+		assert.Equal(t, "delete repository repo1", applyErr.RollbackFailures[0].Command)
+		assert.Equal(t, "1 operation(s) failed on Github (2 applied): create team team3: unexpected status: 500 Internal Server Error (1 rolled back; not able to undo delete repository repo1: it cannot be undone automatically)", applyErr.Error())
+
+		assert.Equal(t, []string{
+			"add_team_access:repo2:team1",
+			"delete_repository:repo1",
+			"create_team:team3",
+			"remove_team_access:repo2:team1",
+		}, remote.order)
+
+		message := applyFailuresMessage("Goliac failed to apply some changes on Github when syncing", applyErr)
+		assert.Equal(t, "Goliac failed to apply some changes on Github when syncing (1 operation(s) failed, 2 applied):\n- create team team3: unexpected status: 500 Internal Server Error\n1 applied operation(s) rolled back, 1 could not be undone:\n- delete repository repo1: it cannot be undone automatically\n", message)
+	})
+}
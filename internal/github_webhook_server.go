@@ -11,15 +11,48 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/Alayacare/goliac/internal/utils"
 	"github.com/sirupsen/logrus"
 )
 
 type GithubWebhookServerCallback func()
 
+/*
+ * PullRequest identifies the head of a pull request to evaluate
+ */
+type PullRequest struct {
+	Repository string // repository name (without the organization)
+	Number     int
+	HeadRef    string
+	HeadSha    string
+	Fork       bool // the head branch is on another repository
+}
+
+type GithubWebhookServerPullRequestCallback func(pr PullRequest)
+
+/*
+ * RemoteChangeEvent describes a change done directly on Github
+ * (i.e. not via the teams repo), that may need to be reverted
+ */
+type RemoteChangeEvent struct {
+	Event        string // webhook event type (member, membership, team, team_add, repository, organization, repository_ruleset)
+	Action       string
+	Sender       string // login of the actor
+	Repository   string // repository name (if any)
+	PreviousName string // previous repository name (when renamed)
+	Team         string // team slug (if any)
+	User         string // user login (if any)
+}
+
+type GithubWebhookServerRemoteChangeCallback func(change RemoteChangeEvent)
+
 /*
 GithubWebhookServer is the interface for the webhook server
 It will wait for a Github webhook event and call the callback function
 when a merge event is received on the main branch
+(or the pull request callback when a pull request targeting the main branch is opened or updated,
+or the remote change callback when a user, team or repository is changed directly on Github)
 */
 type GithubWebhookServer interface {
 	// Start the server
@@ -31,21 +64,27 @@ type GithubWebhookServerImpl struct {
 	webhookServerAddress string
 	webhookServerPort    int
 	webhookPath          string
-	webhookSecret        string
+	webhookSecret        *utils.Secret
+	secretGracePeriod    time.Duration // the previous webhook secret is still accepted during this period after a rotation
 	server               *http.Server
 	mainBranch           string
 	callback             GithubWebhookServerCallback
+	pullRequestCallback  GithubWebhookServerPullRequestCallback
+	remoteChangeCallback GithubWebhookServerRemoteChangeCallback
 }
 
-func NewGithubWebhookServerImpl(httpaddr string, httpport int, webhookPath string, secret string, mainBranch string, callback GithubWebhookServerCallback) GithubWebhookServer {
+func NewGithubWebhookServerImpl(httpaddr string, httpport int, webhookPath string, secret *utils.Secret, mainBranch string, callback GithubWebhookServerCallback, pullRequestCallback GithubWebhookServerPullRequestCallback, remoteChangeCallback GithubWebhookServerRemoteChangeCallback) GithubWebhookServer {
 	return &GithubWebhookServerImpl{
 		webhookServerAddress: httpaddr,
 		webhookServerPort:    httpport,
 		webhookPath:          webhookPath,
 		webhookSecret:        secret,
+		secretGracePeriod:    time.Duration(config.Config.GithubWebhookSecretGracePeriod) * time.Second,
 		server:               nil,
 		mainBranch:           mainBranch,
 		callback:             callback,
+		pullRequestCallback:  pullRequestCallback,
+		remoteChangeCallback: remoteChangeCallback,
 	}
 }
 
@@ -77,6 +116,59 @@ type PushEvent struct {
 	Ref string `json:"ref"`
 }
 
+type PullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Head struct {
+			Ref  string `json:"ref"`
+			Sha  string `json:"sha"`
+			Repo *struct {
+				FullName string `json:"full_name"`
+			} `json:"repo"`
+		} `json:"head"`
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
+	Repository struct {
+		Name     string `json:"name"`
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+/*
+ * OrganizationChangeEvent contains the fields we need from the
+ * member, membership, team, team_add, repository, organization and repository_ruleset events
+ */
+type OrganizationChangeEvent struct {
+	Action string `json:"action"`
+	Sender struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+	Repository *struct {
+		Name string `json:"name"`
+	} `json:"repository"`
+	Team *struct {
+		Slug string `json:"slug"`
+	} `json:"team"`
+	Member *struct {
+		Login string `json:"login"`
+	} `json:"member"`
+	Membership *struct {
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	} `json:"membership"`
+	Changes struct {
+		Repository struct {
+			Name struct {
+				From string `json:"from"`
+			} `json:"name"`
+		} `json:"repository"`
+	} `json:"changes"`
+}
+
 func (s *GithubWebhookServerImpl) WebhookHandler(w http.ResponseWriter, r *http.Request) {
 	logrus.Debugf("Received webhook event")
 	// handle the github webhook
@@ -104,12 +196,18 @@ func (s *GithubWebhookServerImpl) WebhookHandler(w http.ResponseWriter, r *http.
 	}
 	defer r.Body.Close()
 
-	if s.webhookSecret != "" {
-		mac := hmac.New(sha256.New, []byte(s.webhookSecret))
-		mac.Write(body)
-		expectedSignature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
-
-		if !hmac.Equal([]byte(expectedSignature), []byte(signature)) {
+	if s.webhookSecret != nil && len(s.webhookSecret.Get()) > 0 {
+		valid := validSignature(s.webhookSecret.Get(), body, signature)
+		if !valid {
+			// the secret may have been rotated before Github was configured with the new one
+			if previous := s.webhookSecret.Previous(s.secretGracePeriod); previous != nil {
+				valid = validSignature(previous, body, signature)
+				if valid {
+					logrus.Debugf("webhook event signed with the previous secret")
+				}
+			}
+		}
+		if !valid {
 			http.Error(w, "Invalid signature", http.StatusUnauthorized)
 			return
 		}
@@ -126,6 +224,10 @@ func (s *GithubWebhookServerImpl) WebhookHandler(w http.ResponseWriter, r *http.
 		s.handlePingEvent(w)
 	case "push":
 		s.handlePushEvent(w, body)
+	case "pull_request":
+		s.handlePullRequestEvent(w, body)
+	case "member", "membership", "team", "team_add", "repository", "organization", "repository_ruleset":
+		s.handleRemoteChangeEvent(w, eventType, body)
 	default:
 		logrus.Debugf("Event type %s not supported", eventType)
 		w.WriteHeader(http.StatusOK)
@@ -155,3 +257,70 @@ func (s *GithubWebhookServerImpl) handlePushEvent(w http.ResponseWriter, body []
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func (s *GithubWebhookServerImpl) handlePullRequestEvent(w http.ResponseWriter, body []byte) {
+	var prEvent PullRequestEvent
+
+	err := json.Unmarshal(body, &prEvent)
+	if err != nil {
+		http.Error(w, "Failed to parse pull_request event", http.StatusBadRequest)
+		return
+	}
+
+	// we only evaluate new PR content targeting the main branch
+	if (prEvent.Action == "opened" || prEvent.Action == "synchronize" || prEvent.Action == "reopened") &&
+		prEvent.PullRequest.Base.Ref == s.mainBranch &&
+		s.pullRequestCallback != nil {
+		s.pullRequestCallback(PullRequest{
+			Repository: prEvent.Repository.Name,
+			Number:     prEvent.Number,
+			HeadRef:    prEvent.PullRequest.Head.Ref,
+			HeadSha:    prEvent.PullRequest.Head.Sha,
+			Fork:       prEvent.PullRequest.Head.Repo != nil && prEvent.PullRequest.Head.Repo.FullName != prEvent.Repository.FullName,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *GithubWebhookServerImpl) handleRemoteChangeEvent(w http.ResponseWriter, eventType string, body []byte) {
+	var event OrganizationChangeEvent
+
+	err := json.Unmarshal(body, &event)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to parse %s event", eventType), http.StatusBadRequest)
+		return
+	}
+
+	change := RemoteChangeEvent{
+		Event:        eventType,
+		Action:       event.Action,
+		Sender:       event.Sender.Login,
+		PreviousName: event.Changes.Repository.Name.From,
+	}
+	if event.Repository != nil {
+		change.Repository = event.Repository.Name
+	}
+	if event.Team != nil {
+		change.Team = event.Team.Slug
+	}
+	if event.Member != nil {
+		change.User = event.Member.Login
+	}
+	if event.Membership != nil {
+		change.User = event.Membership.User.Login
+	}
+
+	if s.remoteChangeCallback != nil {
+		s.remoteChangeCallback(change)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func validSignature(secret []byte, body []byte, signature string) bool {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	expectedSignature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expectedSignature), []byte(signature))
+}
@@ -6,9 +6,13 @@ import (
 	"encoding/hex"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/Alayacare/goliac/internal/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,7 +23,7 @@ func TestWebhookHandler(t *testing.T) {
 		callback := func() {
 			callbackreceived = true
 		}
-		wh := NewGithubWebhookServerImpl("localhost", 8080, "/web", "secret", "main", callback).(*GithubWebhookServerImpl)
+		wh := NewGithubWebhookServerImpl("localhost", 8080, "/web", utils.NewStaticSecret("webhook secret", []byte("secret")), "main", callback, nil, nil).(*GithubWebhookServerImpl)
 
 		body := `{
 			"zen": "testing",
@@ -48,7 +52,7 @@ func TestWebhookHandler(t *testing.T) {
 		callback := func() {
 			callbackreceived = true
 		}
-		wh := NewGithubWebhookServerImpl("localhost", 8080, "/web", "secret", "main", callback).(*GithubWebhookServerImpl)
+		wh := NewGithubWebhookServerImpl("localhost", 8080, "/web", utils.NewStaticSecret("webhook secret", []byte("secret")), "main", callback, nil, nil).(*GithubWebhookServerImpl)
 
 		body := `{
 			"ref": "refs/heads/main"
@@ -76,7 +80,7 @@ func TestWebhookHandler(t *testing.T) {
 		callback := func() {
 			callbackreceived = true
 		}
-		wh := NewGithubWebhookServerImpl("localhost", 8080, "/web", "secret", "main", callback).(*GithubWebhookServerImpl)
+		wh := NewGithubWebhookServerImpl("localhost", 8080, "/web", utils.NewStaticSecret("webhook secret", []byte("secret")), "main", callback, nil, nil).(*GithubWebhookServerImpl)
 
 		body := `{
 			"zen": "testing",
@@ -97,4 +101,211 @@ func TestWebhookHandler(t *testing.T) {
 		assert.Equal(t, false, callbackreceived)
 	})
 
+	t.Run("happy path: test pull_request webhook", func(t *testing.T) {
+		var received *PullRequest
+		prCallback := func(pr PullRequest) {
+			received = &pr
+		}
+		wh := NewGithubWebhookServerImpl("localhost", 8080, "/web", utils.NewStaticSecret("webhook secret", []byte("secret")), "main", func() {}, prCallback, nil).(*GithubWebhookServerImpl)
+
+		body := `{
+			"action": "synchronize",
+			"number": 12,
+			"pull_request": {
+				"head": { "ref": "feature", "sha": "abcdef" },
+				"base": { "ref": "main" }
+			},
+			"repository": { "name": "goliac-teams" }
+		}`
+
+		bodyReader := strings.NewReader(body)
+		req := httptest.NewRequest("POST", "/webhook", bodyReader)
+		sign := hmac.New(sha256.New, []byte("secret"))
+		sign.Write([]byte(body))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(sign.Sum(nil)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-GitHub-Event", "pull_request")
+
+		w := httptest.NewRecorder()
+		wh.WebhookHandler(w, req)
+
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotNil(t, received)
+		assert.Equal(t, PullRequest{Repository: "goliac-teams", Number: 12, HeadRef: "feature", HeadSha: "abcdef"}, *received)
+	})
+
+	t.Run("happy path: pull_request webhook from a fork", func(t *testing.T) {
+		var received *PullRequest
+		prCallback := func(pr PullRequest) {
+			received = &pr
+		}
+		wh := NewGithubWebhookServerImpl("localhost", 8080, "/web", utils.NewStaticSecret("webhook secret", []byte("secret")), "main", func() {}, prCallback, nil).(*GithubWebhookServerImpl)
+
+		body := `{
+			"action": "opened",
+			"number": 13,
+			"pull_request": {
+				"head": { "ref": "main", "sha": "abcdef", "repo": { "full_name": "alice/goliac-teams" } },
+				"base": { "ref": "main" }
+			},
+			"repository": { "name": "goliac-teams", "full_name": "myorg/goliac-teams" }
+		}`
+
+		bodyReader := strings.NewReader(body)
+		req := httptest.NewRequest("POST", "/webhook", bodyReader)
+		sign := hmac.New(sha256.New, []byte("secret"))
+		sign.Write([]byte(body))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(sign.Sum(nil)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-GitHub-Event", "pull_request")
+
+		w := httptest.NewRecorder()
+		wh.WebhookHandler(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.NotNil(t, received)
+		assert.True(t, received.Fork)
+	})
+
+	t.Run("happy path: closed pull_request is ignored", func(t *testing.T) {
+		prCallbackReceived := false
+		prCallback := func(pr PullRequest) {
+			prCallbackReceived = true
+		}
+		wh := NewGithubWebhookServerImpl("localhost", 8080, "/web", utils.NewStaticSecret("webhook secret", []byte("secret")), "main", func() {}, prCallback, nil).(*GithubWebhookServerImpl)
+
+		body := `{
+			"action": "closed",
+			"number": 12,
+			"pull_request": {
+				"head": { "ref": "feature", "sha": "abcdef" },
+				"base": { "ref": "main" }
+			},
+			"repository": { "name": "goliac-teams" }
+		}`
+
+		bodyReader := strings.NewReader(body)
+		req := httptest.NewRequest("POST", "/webhook", bodyReader)
+		sign := hmac.New(sha256.New, []byte("secret"))
+		sign.Write([]byte(body))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(sign.Sum(nil)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-GitHub-Event", "pull_request")
+
+		w := httptest.NewRecorder()
+		wh.WebhookHandler(w, req)
+
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, false, prCallbackReceived)
+	})
+
+	t.Run("happy path: test team_add webhook", func(t *testing.T) {
+		var received *RemoteChangeEvent
+		remoteChangeCallback := func(change RemoteChangeEvent) {
+			received = &change
+		}
+		wh := NewGithubWebhookServerImpl("localhost", 8080, "/web", utils.NewStaticSecret("webhook secret", []byte("secret")), "main", func() {}, nil, remoteChangeCallback).(*GithubWebhookServerImpl)
+
+		body := `{
+			"team": { "slug": "team1" },
+			"repository": { "name": "repo1" },
+			"sender": { "login": "alice" }
+		}`
+
+		bodyReader := strings.NewReader(body)
+		req := httptest.NewRequest("POST", "/webhook", bodyReader)
+		sign := hmac.New(sha256.New, []byte("secret"))
+		sign.Write([]byte(body))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(sign.Sum(nil)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-GitHub-Event", "team_add")
+
+		w := httptest.NewRecorder()
+		wh.WebhookHandler(w, req)
+
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotNil(t, received)
+		assert.Equal(t, RemoteChangeEvent{Event: "team_add", Sender: "alice", Repository: "repo1", Team: "team1"}, *received)
+	})
+
+	t.Run("happy path: test organization webhook", func(t *testing.T) {
+		var received *RemoteChangeEvent
+		remoteChangeCallback := func(change RemoteChangeEvent) {
+			received = &change
+		}
+		wh := NewGithubWebhookServerImpl("localhost", 8080, "/web", utils.NewStaticSecret("webhook secret", []byte("secret")), "main", func() {}, nil, remoteChangeCallback).(*GithubWebhookServerImpl)
+
+		body := `{
+			"action": "member_added",
+			"membership": { "user": { "login": "bob" } },
+			"sender": { "login": "alice" }
+		}`
+
+		bodyReader := strings.NewReader(body)
+		req := httptest.NewRequest("POST", "/webhook", bodyReader)
+		sign := hmac.New(sha256.New, []byte("secret"))
+		sign.Write([]byte(body))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(sign.Sum(nil)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-GitHub-Event", "organization")
+
+		w := httptest.NewRecorder()
+		wh.WebhookHandler(w, req)
+
+		resp := w.Result()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotNil(t, received)
+		assert.Equal(t, RemoteChangeEvent{Event: "organization", Action: "member_added", Sender: "alice", User: "bob"}, *received)
+	})
+}
+
+func TestWebhookSecretRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "webhook-secret")
+	assert.Nil(t, os.WriteFile(path, []byte("old-secret"), 0600))
+	secret, err := utils.NewSecretFile("webhook secret", path)
+	assert.Nil(t, err)
+
+	sendPing := func(wh *GithubWebhookServerImpl, signedWith string) int {
+		body := `{"zen": "testing", "hook_id": 1234}`
+		req := httptest.NewRequest("POST", "/webhook", strings.NewReader(body))
+		sign := hmac.New(sha256.New, []byte(signedWith))
+		sign.Write([]byte(body))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(sign.Sum(nil)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-GitHub-Event", "ping")
+
+		w := httptest.NewRecorder()
+		wh.WebhookHandler(w, req)
+		return w.Result().StatusCode
+	}
+
+	wh := NewGithubWebhookServerImpl("localhost", 8080, "/web", secret, "main", func() {}, nil, nil).(*GithubWebhookServerImpl)
+	wh.secretGracePeriod = time.Hour
+	assert.Equal(t, http.StatusOK, sendPing(wh, "old-secret"))
+	assert.Equal(t, http.StatusUnauthorized, sendPing(wh, "new-secret"))
+
+	assert.Nil(t, os.WriteFile(path, []byte("new-secret"), 0600))
+	rotated, err := secret.Reload()
+	assert.Nil(t, err)
+	assert.True(t, rotated)
+
+	t.Run("happy path: both secrets are accepted during the grace period", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, sendPing(wh, "new-secret"))
+		assert.Equal(t, http.StatusOK, sendPing(wh, "old-secret"))
+		assert.Equal(t, http.StatusUnauthorized, sendPing(wh, "another-secret"))
+	})
+
+	t.Run("not happy path: the old secret is rejected after the grace period", func(t *testing.T) {
+		wh.secretGracePeriod = 0
+		assert.Equal(t, http.StatusOK, sendPing(wh, "new-secret"))
+		assert.Equal(t, http.StatusUnauthorized, sendPing(wh, "old-secret"))
+	})
 }
@@ -0,0 +1,465 @@
+package githubfake
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var graphQLOperation = regexp.MustCompile(`(query|mutation)\s+(\w+)`)
+
+// what we answer in the rateLimit block (the fake is never rate limited)
+var graphQLRateLimit = map[string]interface{}{
+	"limit":     5000,
+	"cost":      1,
+	"remaining": 5000,
+	"resetAt":   "2100-01-01T00:00:00Z",
+}
+
+/*
+ * handleGraphQL answers the GraphQL queries sent by Goliac (all the results in one page)
+ */
+func (s *Server) handleGraphQL(w http.ResponseWriter, body map[string]interface{}) {
+	query, _ := body["query"].(string)
+	variables, _ := body["variables"].(map[string]interface{})
+	if variables == nil {
+		variables = map[string]interface{}{}
+	}
+
+	operation := ""
+	if match := graphQLOperation.FindStringSubmatch(query); match != nil {
+		operation = match[2]
+	}
+	if login, ok := variables["orgLogin"].(string); ok && login != s.Org {
+		writeJSON(w, http.StatusOK, graphQLError("Could not resolve to an Organization with the login of '"+login+"'."))
+		return
+	}
+
+	var data map[string]interface{}
+	switch {
+	case operation == "getAssets":
+		data = s.graphQLAssets()
+	case strings.Contains(query, "membersWithRole("):
+		// listAllOrgMembers (whose operation is named listAllReposInOrg)
+		data = s.graphQLOrgMembers()
+	case operation == "listAllReposInOrg":
+		data = s.graphQLRepositories()
+	case operation == "getRepository":
+		name, _ := variables["name"].(string)
+		r, ok := s.Repositories[name]
+		if !ok {
+			// like Github: a null repository with a NOT_FOUND error
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"data": map[string]interface{}{"repository": nil},
+				"errors": []interface{}{
+					map[string]interface{}{
+						"type":    "NOT_FOUND",
+						"path":    []string{"repository"},
+						"message": "Could not resolve to a Repository with the name '" + s.Org + "/" + name + "'.",
+					},
+				},
+			})
+			return
+		}
+		data = map[string]interface{}{"repository": s.graphQLRepository(r)}
+	case operation == "listAllTeamsInOrg":
+		data = s.graphQLTeams()
+	case operation == "getTeam":
+		slug, _ := variables["teamSlug"].(string)
+		var team interface{}
+		if t, ok := s.Teams[slug]; ok {
+			team = s.graphQLTeam(t)
+		}
+		data = organization(map[string]interface{}{"team": team})
+	case operation == "listAllTeamMembersInOrg":
+		slug, _ := variables["teamSlug"].(string)
+		data = s.graphQLTeamMembers(slug)
+	case operation == "listAllTeamsReposInOrg":
+		data = s.graphQLTeamsRepos()
+	case operation == "listTeamReposInOrg":
+		slug, _ := variables["teamSlug"].(string)
+		var team interface{}
+		if t, ok := s.Teams[slug]; ok {
+			team = map[string]interface{}{"repositories": s.graphQLTeamRepositories(t)}
+		}
+		data = organization(map[string]interface{}{"team": team})
+	case operation == "listRulesets":
+		data = s.graphQLRulesets()
+	case operation == "listSamlUsers":
+		// no SAML identity provider configured
+		data = organization(map[string]interface{}{"samlIdentityProvider": nil})
+	default:
+		writeJSON(w, http.StatusOK, graphQLError("unsupported query "+operation))
+		return
+	}
+
+	if strings.Contains(query, "rateLimit") {
+		data["rateLimit"] = graphQLRateLimit
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+func graphQLError(message string) map[string]interface{} {
+	return map[string]interface{}{
+		"data": nil,
+		"errors": []interface{}{
+			map[string]interface{}{"message": message, "path": []string{}},
+		},
+	}
+}
+
+func organization(fields map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"organization": fields}
+}
+
+// lastPage is the pageInfo of a single page result
+var lastPage = map[string]interface{}{"hasNextPage": false, "endCursor": nil}
+
+func (s *Server) graphQLAssets() map[string]interface{} {
+	return organization(map[string]interface{}{
+		"repositories":    map[string]interface{}{"totalCount": len(s.Repositories)},
+		"teams":           map[string]interface{}{"totalCount": len(s.Teams)},
+		"membersWithRole": map[string]interface{}{"totalCount": len(s.Members)},
+		"samlIdentityProvider": map[string]interface{}{
+			"externalIdentities": map[string]interface{}{"totalCount": 0},
+		},
+	})
+}
+
+func (s *Server) graphQLOrgMembers() map[string]interface{} {
+	edges := make([]interface{}, 0, len(s.Members))
+	for _, login := range sortedKeys(s.Members) {
+		edges = append(edges, map[string]interface{}{
+			"node": map[string]interface{}{"login": login},
+			"role": s.Members[login],
+		})
+	}
+	return organization(map[string]interface{}{
+		"membersWithRole": map[string]interface{}{
+			"edges":      edges,
+			"pageInfo":   lastPage,
+			"totalCount": len(edges),
+		},
+	})
+}
+
+func (s *Server) graphQLRepositories() map[string]interface{} {
+	nodes := make([]interface{}, 0, len(s.Repositories))
+	for _, name := range sortedKeys(s.Repositories) {
+		nodes = append(nodes, s.graphQLRepository(s.Repositories[name]))
+	}
+	return organization(map[string]interface{}{
+		"repositories": map[string]interface{}{
+			"nodes":      nodes,
+			"pageInfo":   lastPage,
+			"totalCount": len(nodes),
+		},
+	})
+}
+
+func (s *Server) graphQLRepository(r *Repository) map[string]interface{} {
+	// the organization members are direct collaborators, the others are outside collaborators
+	direct := make([]interface{}, 0)
+	outside := make([]interface{}, 0)
+	for _, login := range sortedKeys(r.Collaborators) {
+		edge := map[string]interface{}{
+			"node":       map[string]interface{}{"login": login},
+			"permission": graphQLPermission(r.Collaborators[login]),
+		}
+		if _, ok := s.Members[login]; ok {
+			direct = append(direct, edge)
+		} else {
+			outside = append(outside, edge)
+		}
+	}
+
+	rulesets := make([]interface{}, 0, len(r.Rulesets))
+	for _, id := range sortedKeys(r.Rulesets) {
+		rulesets = append(rulesets, s.graphQLRuleset(r.Rulesets[id]))
+	}
+
+	topics := make([]interface{}, 0, len(r.Topics))
+	for _, name := range r.Topics {
+		topics = append(topics, map[string]interface{}{"topic": map[string]interface{}{"name": name}})
+	}
+
+	// like on Github, an empty repository has no default branch
+	var defaultBranchRef interface{}
+	if branch := r.stringSetting("default_branch", ""); branch != "" {
+		defaultBranchRef = map[string]interface{}{"name": branch}
+	}
+
+	// internal repositories are private too
+	visibility := strings.ToUpper(r.stringSetting("visibility", ""))
+	if visibility == "" {
+		visibility = "PUBLIC"
+		if r.boolSetting("private") {
+			visibility = "PRIVATE"
+		}
+	}
+
+	return map[string]interface{}{
+		"name":                     r.Name,
+		"id":                       r.NodeId,
+		"databaseId":               r.Id,
+		"updatedAt":                formatTime(r.UpdatedAt),
+		"isArchived":               r.boolSetting("archived"),
+		"isPrivate":                r.boolSetting("private"),
+		"visibility":               visibility,
+		"autoMergeAllowed":         r.boolSetting("allow_auto_merge"),
+		"deleteBranchOnMerge":      r.boolSetting("delete_branch_on_merge"),
+		"allowUpdateBranch":        r.boolSetting("allow_update_branch"),
+		"mergeCommitAllowed":       r.boolSettingOr("allow_merge_commit", true),
+		"rebaseMergeAllowed":       r.boolSettingOr("allow_rebase_merge", true),
+		"squashMergeAllowed":       r.boolSettingOr("allow_squash_merge", true),
+		"forkingAllowed":           r.boolSetting("allow_forking"),
+		"webCommitSignoffRequired": r.boolSetting("web_commit_signoff_required"),
+		"hasIssuesEnabled":         r.boolSettingOr("has_issues", true),
+		"hasWikiEnabled":           r.boolSettingOr("has_wiki", true),
+		"hasProjectsEnabled":       r.boolSettingOr("has_projects", true),
+		"hasDiscussionsEnabled":    r.boolSetting("has_discussions"),
+		"description":              r.stringSetting("description", ""),
+		"homepageUrl":              r.stringSetting("homepage", ""),
+		"defaultBranchRef":         defaultBranchRef,
+		"squashMergeCommitTitle":   r.stringSetting("squash_merge_commit_title", "COMMIT_OR_PR_TITLE"),
+		"squashMergeCommitMessage": r.stringSetting("squash_merge_commit_message", "COMMIT_MESSAGES"),
+		"mergeCommitTitle":         r.stringSetting("merge_commit_title", "MERGE_MESSAGE"),
+		"mergeCommitMessage":       r.stringSetting("merge_commit_message", "PR_TITLE"),
+		"repositoryTopics":         map[string]interface{}{"nodes": topics},
+		"directCollaborators":      map[string]interface{}{"edges": direct},
+		"outsideCollaborators":     map[string]interface{}{"edges": outside},
+		"rulesets":                 map[string]interface{}{"nodes": rulesets},
+	}
+}
+
+func (r *Repository) boolSetting(name string) bool {
+	value, _ := r.Settings[name].(bool)
+	return value
+}
+
+func (r *Repository) boolSettingOr(name string, defaultValue bool) bool {
+	if value, ok := r.Settings[name].(bool); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func (r *Repository) stringSetting(name string, defaultValue string) string {
+	if value, ok := r.Settings[name].(string); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func (s *Server) graphQLTeams() map[string]interface{} {
+	nodes := make([]interface{}, 0, len(s.Teams))
+	for _, slug := range sortedKeys(s.Teams) {
+		nodes = append(nodes, s.graphQLTeam(s.Teams[slug]))
+	}
+	return organization(map[string]interface{}{
+		"teams": map[string]interface{}{
+			"nodes":      nodes,
+			"pageInfo":   lastPage,
+			"totalCount": len(nodes),
+		},
+	})
+}
+
+func (s *Server) graphQLTeam(t *Team) map[string]interface{} {
+	var parent interface{}
+	if p := s.teamById(t.ParentId); p != nil {
+		parent = map[string]interface{}{"databaseId": p.Id}
+	}
+	return map[string]interface{}{
+		"name":       t.Name,
+		"databaseId": t.Id,
+		"slug":       t.Slug,
+		"updatedAt":  formatTime(t.UpdatedAt),
+		"parentTeam": parent,
+	}
+}
+
+func (s *Server) graphQLTeamMembers(slug string) map[string]interface{} {
+	team, ok := s.Teams[slug]
+	if !ok {
+		return organization(map[string]interface{}{"team": nil})
+	}
+	edges := make([]interface{}, 0, len(team.Members))
+	for _, login := range sortedKeys(team.Members) {
+		edges = append(edges, map[string]interface{}{
+			"node": map[string]interface{}{"login": login},
+			"role": strings.ToUpper(team.Members[login]),
+		})
+	}
+	return organization(map[string]interface{}{
+		"team": map[string]interface{}{
+			"members": map[string]interface{}{
+				"edges":      edges,
+				"pageInfo":   lastPage,
+				"totalCount": len(edges),
+			},
+		},
+	})
+}
+
+func (s *Server) graphQLTeamsRepos() map[string]interface{} {
+	nodes := make([]interface{}, 0, len(s.Teams))
+	for _, slug := range sortedKeys(s.Teams) {
+		nodes = append(nodes, map[string]interface{}{
+			"slug":         slug,
+			"repositories": s.graphQLTeamRepositories(s.Teams[slug]),
+		})
+	}
+	return organization(map[string]interface{}{
+		"teams": map[string]interface{}{
+			"nodes":    nodes,
+			"pageInfo": lastPage,
+		},
+	})
+}
+
+func (s *Server) graphQLTeamRepositories(t *Team) map[string]interface{} {
+	edges := make([]interface{}, 0, len(t.Repositories))
+	for _, name := range sortedKeys(t.Repositories) {
+		edges = append(edges, map[string]interface{}{
+			"permission": graphQLPermission(t.Repositories[name]),
+			"node":       map[string]interface{}{"name": name},
+		})
+	}
+	return map[string]interface{}{
+		"edges":    edges,
+		"pageInfo": lastPage,
+	}
+}
+
+func (s *Server) graphQLRulesets() map[string]interface{} {
+	nodes := make([]interface{}, 0, len(s.Rulesets))
+	for _, id := range sortedKeys(s.Rulesets) {
+		nodes = append(nodes, s.graphQLRuleset(s.Rulesets[id]))
+	}
+	return organization(map[string]interface{}{
+		"rulesets": map[string]interface{}{
+			"nodes":      nodes,
+			"pageInfo":   lastPage,
+			"totalCount": len(nodes),
+		},
+	})
+}
+
+/*
+ * graphQLRuleset converts a ruleset (as sent to the REST API) to its GraphQL representation
+ */
+func (s *Server) graphQLRuleset(r *Ruleset) map[string]interface{} {
+	apps := make([]interface{}, 0)
+	for _, b := range r.BypassActors {
+		actor, _ := b.(map[string]interface{})
+		if actorType, _ := actor["actor_type"].(string); actorType != "Integration" {
+			continue
+		}
+		appId, _ := actor["actor_id"].(float64)
+		// Goliac knows the apps by their slug
+		name := ""
+		if installation := s.installationByAppId(int(appId)); installation != nil {
+			name = installation.AppSlug
+		}
+		mode, _ := actor["bypass_mode"].(string)
+		apps = append(apps, map[string]interface{}{
+			"actor":      map[string]interface{}{"databaseId": int(appId), "name": name},
+			"bypassMode": strings.ToUpper(mode),
+		})
+	}
+
+	refName := map[string]interface{}{"include": []interface{}{}, "exclude": []interface{}{}}
+	repositoryIds := make([]interface{}, 0)
+	if ref, ok := r.Conditions["ref_name"].(map[string]interface{}); ok {
+		refName = ref
+	}
+	if ids, ok := r.Conditions["repository_id"].(map[string]interface{}); ok {
+		list, _ := ids["repository_ids"].([]interface{})
+		for _, id := range list {
+			if databaseId, ok := id.(float64); ok {
+				if repo := s.repositoryById(int(databaseId)); repo != nil {
+					repositoryIds = append(repositoryIds, repo.NodeId)
+				}
+			}
+		}
+	}
+
+	rules := make([]interface{}, 0, len(r.Rules))
+	for _, rule := range r.Rules {
+		rule, _ := rule.(map[string]interface{})
+		ruleType, _ := rule["type"].(string)
+		parameters := map[string]interface{}{}
+		if params, ok := rule["parameters"].(map[string]interface{}); ok {
+			for k, v := range params {
+				if k == "required_status_checks" {
+					v = graphQLStatusChecks(v)
+				}
+				parameters[camelCase(k)] = v
+			}
+		}
+		rules = append(rules, map[string]interface{}{
+			"type":       strings.ToUpper(ruleType),
+			"parameters": parameters,
+		})
+	}
+
+	var source interface{}
+	if r.Source != "" {
+		source = map[string]interface{}{"name": r.Source}
+	} else {
+		source = map[string]interface{}{}
+	}
+
+	return map[string]interface{}{
+		"databaseId":   r.Id,
+		"name":         r.Name,
+		"source":       source,
+		"target":       strings.ToUpper(r.Target),
+		"enforcement":  strings.ToUpper(r.Enforcement),
+		"bypassActors": map[string]interface{}{"app": apps},
+		"conditions": map[string]interface{}{
+			"refName":        refName,
+			"repositoryName": nil,
+			"repositoryId":   map[string]interface{}{"repositoryIds": repositoryIds},
+		},
+		"rules": map[string]interface{}{"nodes": rules},
+	}
+}
+
+// graphQLStatusChecks accepts the status checks as names or as {context, integration_id}
+func graphQLStatusChecks(checks interface{}) []interface{} {
+	list, _ := checks.([]interface{})
+	result := make([]interface{}, 0, len(list))
+	for _, c := range list {
+		switch check := c.(type) {
+		case string:
+			result = append(result, map[string]interface{}{"context": check})
+		case map[string]interface{}:
+			result = append(result, map[string]interface{}{"context": check["context"], "integrationId": check["integration_id"]})
+		}
+	}
+	return result
+}
+
+// graphQLPermission converts a REST permission (pull, push, ...) to its GraphQL name (READ, WRITE, ...)
+func graphQLPermission(permission string) string {
+	switch permission {
+	case "pull":
+		return "READ"
+	case "push":
+		return "WRITE"
+	}
+	return strings.ToUpper(permission)
+}
+
+// camelCase converts a REST field (snake_case) to its GraphQL name
+func camelCase(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,653 @@
+package githubfake
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+ * handleRest dispatches the REST calls on the path segments
+ * (the calls not implemented answer a 404, like Github does for an unknown endpoint)
+ */
+func (s *Server) handleRest(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+	p := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	m := r.Method
+
+	switch {
+	// GHES meta
+	case len(p) == 2 && p[0] == "api" && p[1] == "v3" && m == "GET":
+		if s.GHESVersion == "" {
+			notFound(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"installed_version": s.GHESVersion})
+
+	// Github App authentication
+	case len(p) == 2 && p[0] == "app" && p[1] == "installations" && m == "GET":
+		installations := make([]map[string]interface{}, 0, len(s.Installations))
+		for _, i := range s.Installations {
+			installations = append(installations, s.installationToJSON(i))
+		}
+		writeJSON(w, http.StatusOK, installations)
+	case len(p) == 4 && p[0] == "app" && p[1] == "installations" && p[3] == "access_tokens" && m == "POST":
+		token := s.Token
+		if token == "" {
+			token = "ghs_fake"
+		}
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"token": token, "expires_at": formatTime(s.clock.AddDate(1, 0, 0))})
+
+	case len(p) >= 2 && p[0] == "orgs":
+		if p[1] != s.Org {
+			notFound(w)
+			return
+		}
+		s.handleOrg(w, m, p[2:], body)
+	case len(p) >= 3 && p[0] == "repos":
+		if p[1] != s.Org {
+			notFound(w)
+			return
+		}
+		s.handleRepository(w, m, p[2], p[3:], body)
+	default:
+		notFound(w)
+	}
+}
+
+/*
+ * handleOrg handles /orgs/{org}/...
+ */
+func (s *Server) handleOrg(w http.ResponseWriter, m string, p []string, body map[string]interface{}) {
+	switch {
+	case len(p) == 0 && m == "GET":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"login":                          s.Org,
+			"two_factor_requirement_enabled": true,
+			"plan":                           map[string]interface{}{"name": s.Plan},
+		})
+
+	case len(p) == 1 && p[0] == "installations" && m == "GET":
+		installations := make([]map[string]interface{}, 0, len(s.Installations))
+		for _, i := range s.Installations {
+			installations = append(installations, s.installationToJSON(i))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"total_count":   len(installations),
+			"installations": installations,
+		})
+
+	case len(p) == 1 && p[0] == "invitations" && m == "GET":
+		invitations := make([]map[string]interface{}, 0, len(s.Invitations))
+		for _, login := range sortedKeys(s.Invitations) {
+			invitations = append(invitations, map[string]interface{}{"login": login, "email": nil})
+		}
+		writeJSON(w, http.StatusOK, invitations)
+
+	case len(p) == 2 && p[0] == "memberships":
+		s.handleOrgMembership(w, m, p[1], body)
+
+	case len(p) >= 1 && p[0] == "teams":
+		s.handleTeams(w, m, p[1:], body)
+
+	case len(p) == 1 && p[0] == "repos" && m == "POST":
+		name, _ := body["name"].(string)
+		if name == "" {
+			validationFailed(w, "name is missing")
+			return
+		}
+		if _, ok := s.Repositories[name]; ok {
+			validationFailed(w, "name already exists on this account")
+			return
+		}
+		repo := s.addRepository(name, body)
+		writeJSON(w, http.StatusCreated, s.repositoryToJSON(repo))
+
+	case len(p) >= 1 && p[0] == "rulesets":
+		s.handleRulesets(w, m, p[1:], body, s.Rulesets, "")
+
+	case len(p) >= 2 && p[0] == "properties":
+		s.handleCustomProperties(w, m, p[1:], body)
+
+	default:
+		notFound(w)
+	}
+}
+
+/*
+ * handleOrgMembership handles /orgs/{org}/memberships/{login}
+ * A new member is invited: the invitation must be accepted (AcceptInvitation)
+ */
+func (s *Server) handleOrgMembership(w http.ResponseWriter, m string, login string, body map[string]interface{}) {
+	switch m {
+	case "GET":
+		if role, ok := s.Members[login]; ok {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"state": "active", "role": strings.ToLower(role)})
+		} else if role, ok := s.Invitations[login]; ok {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"state": "pending", "role": strings.ToLower(role)})
+		} else {
+			notFound(w)
+		}
+	case "PUT":
+		role := "MEMBER"
+		if r, _ := body["role"].(string); r == "admin" {
+			role = "ADMIN"
+		}
+		state := "active"
+		if _, ok := s.Members[login]; ok {
+			s.Members[login] = role
+		} else {
+			s.Invitations[login] = role
+			state = "pending"
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"state": state, "role": strings.ToLower(role)})
+	case "DELETE":
+		_, member := s.Members[login]
+		_, invited := s.Invitations[login]
+		if !member && !invited {
+			notFound(w)
+			return
+		}
+		delete(s.Members, login)
+		delete(s.Invitations, login)
+		// a former member loses its teams and repositories accesses
+		for _, t := range s.Teams {
+			if _, ok := t.Members[login]; ok {
+				delete(t.Members, login)
+				t.UpdatedAt = s.tick()
+			}
+		}
+		for _, r := range s.Repositories {
+			delete(r.Collaborators, login)
+		}
+		writeJSON(w, http.StatusNoContent, nil)
+	default:
+		notFound(w)
+	}
+}
+
+/*
+ * handleTeams handles /orgs/{org}/teams/...
+ */
+func (s *Server) handleTeams(w http.ResponseWriter, m string, p []string, body map[string]interface{}) {
+	if len(p) == 0 {
+		if m != "POST" {
+			notFound(w)
+			return
+		}
+		name, _ := body["name"].(string)
+		if name == "" {
+			validationFailed(w, "name is missing")
+			return
+		}
+		if _, ok := s.Teams[teamSlug(name)]; ok {
+			validationFailed(w, "Name must be unique for this org")
+			return
+		}
+		var parent *Team
+		if id, ok := body["parent_team_id"].(float64); ok {
+			if parent = s.teamById(int(id)); parent == nil {
+				validationFailed(w, "parent_team_id is not a valid team")
+				return
+			}
+		}
+		description, _ := body["description"].(string)
+		team := s.addTeam(name, description, parent)
+		if privacy, ok := body["privacy"].(string); ok {
+			team.Privacy = privacy
+		}
+		writeJSON(w, http.StatusCreated, s.teamToJSON(team))
+		return
+	}
+
+	team, ok := s.Teams[p[0]]
+	if !ok {
+		notFound(w)
+		return
+	}
+
+	switch {
+	case len(p) == 1 && m == "GET":
+		writeJSON(w, http.StatusOK, s.teamToJSON(team))
+	case len(p) == 1 && m == "PATCH":
+		if parentId, ok := body["parent_team_id"]; ok {
+			team.ParentId = 0
+			if id, ok := parentId.(float64); ok {
+				if s.teamById(int(id)) == nil {
+					validationFailed(w, "parent_team_id is not a valid team")
+					return
+				}
+				team.ParentId = int(id)
+			}
+		}
+		if description, ok := body["description"].(string); ok {
+			team.Description = description
+		}
+		if name, ok := body["name"].(string); ok && name != team.Name {
+			delete(s.Teams, team.Slug)
+			team.Name = name
+			team.Slug = teamSlug(name)
+			s.Teams[team.Slug] = team
+		}
+		team.UpdatedAt = s.tick()
+		writeJSON(w, http.StatusOK, s.teamToJSON(team))
+	case len(p) == 1 && m == "DELETE":
+		delete(s.Teams, team.Slug)
+		// the child teams are deleted with their parent
+		for _, child := range s.Teams {
+			if child.ParentId == team.Id {
+				delete(s.Teams, child.Slug)
+			}
+		}
+		writeJSON(w, http.StatusNoContent, nil)
+
+	case len(p) == 3 && p[1] == "memberships":
+		login := p[2]
+		switch m {
+		case "PUT":
+			if _, ok := s.Members[login]; !ok {
+				if _, invited := s.Invitations[login]; !invited {
+					validationFailed(w, fmt.Sprintf("%s is not a member of the organization", login))
+					return
+				}
+			}
+			role := "member"
+			if r, _ := body["role"].(string); r == "maintainer" {
+				role = "maintainer"
+			}
+			team.Members[login] = role
+			team.UpdatedAt = s.tick()
+			writeJSON(w, http.StatusOK, map[string]interface{}{"state": "active", "role": role})
+		case "DELETE":
+			if _, ok := team.Members[login]; !ok {
+				notFound(w)
+				return
+			}
+			delete(team.Members, login)
+			team.UpdatedAt = s.tick()
+			writeJSON(w, http.StatusNoContent, nil)
+		default:
+			notFound(w)
+		}
+
+	case len(p) == 4 && p[1] == "repos" && p[2] == s.Org:
+		repo, ok := s.Repositories[p[3]]
+		if !ok {
+			notFound(w)
+			return
+		}
+		switch m {
+		case "PUT":
+			permission, _ := body["permission"].(string)
+			if permission == "" {
+				permission = "push"
+			}
+			team.Repositories[repo.Name] = permission
+			repo.UpdatedAt = s.tick()
+			writeJSON(w, http.StatusNoContent, nil)
+		case "DELETE":
+			delete(team.Repositories, repo.Name)
+			repo.UpdatedAt = s.tick()
+			writeJSON(w, http.StatusNoContent, nil)
+		default:
+			notFound(w)
+		}
+
+	default:
+		notFound(w)
+	}
+}
+
+/*
+ * handleRepository handles /repos/{org}/{repo}/...
+ */
+func (s *Server) handleRepository(w http.ResponseWriter, m string, name string, p []string, body map[string]interface{}) {
+	repo, ok := s.Repositories[name]
+	if !ok {
+		notFound(w)
+		return
+	}
+
+	switch {
+	case len(p) == 0 && m == "GET":
+		writeJSON(w, http.StatusOK, s.repositoryToJSON(repo))
+	case len(p) == 0 && m == "PATCH":
+		if newname, ok := body["name"].(string); ok && newname != repo.Name {
+			if _, exists := s.Repositories[newname]; exists {
+				validationFailed(w, "name already exists on this account")
+				return
+			}
+			delete(s.Repositories, repo.Name)
+			for _, t := range s.Teams {
+				if permission, ok := t.Repositories[repo.Name]; ok {
+					delete(t.Repositories, repo.Name)
+					t.Repositories[newname] = permission
+				}
+			}
+			repo.Name = newname
+			s.Repositories[newname] = repo
+		}
+		repo.setSettings(body)
+		repo.UpdatedAt = s.tick()
+		writeJSON(w, http.StatusOK, s.repositoryToJSON(repo))
+	case len(p) == 0 && m == "DELETE":
+		delete(s.Repositories, repo.Name)
+		for _, t := range s.Teams {
+			delete(t.Repositories, repo.Name)
+		}
+		writeJSON(w, http.StatusNoContent, nil)
+
+	case len(p) == 1 && p[0] == "teams" && m == "GET":
+		teams := make([]map[string]interface{}, 0)
+		for _, slug := range sortedKeys(s.Teams) {
+			team := s.Teams[slug]
+			if permission, ok := team.Repositories[repo.Name]; ok {
+				t := s.teamToJSON(team)
+				t["permission"] = permission
+				teams = append(teams, t)
+			}
+		}
+		writeJSON(w, http.StatusOK, teams)
+
+	case len(p) == 2 && p[0] == "collaborators":
+		login := p[1]
+		switch m {
+		case "PUT":
+			permission, _ := body["permission"].(string)
+			if permission == "" {
+				permission = "push"
+			}
+			repo.Collaborators[login] = permission
+			repo.UpdatedAt = s.tick()
+			writeJSON(w, http.StatusNoContent, nil)
+		case "DELETE":
+			delete(repo.Collaborators, login)
+			repo.UpdatedAt = s.tick()
+			writeJSON(w, http.StatusNoContent, nil)
+		default:
+			notFound(w)
+		}
+
+	case len(p) == 1 && p[0] == "topics" && m == "PUT":
+		names := make([]string, 0)
+		if values, ok := body["names"].([]interface{}); ok {
+			for _, v := range values {
+				if name, ok := v.(string); ok {
+					names = append(names, name)
+				}
+			}
+		}
+		repo.Topics = names
+		repo.UpdatedAt = s.tick()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"names": names})
+
+	case len(p) == 2 && p[0] == "properties" && p[1] == "values" && m == "GET":
+		writeJSON(w, http.StatusOK, customPropertyValuesToJSON(repo))
+	case len(p) == 2 && p[0] == "properties" && p[1] == "values" && m == "PATCH":
+		values, _ := body["properties"].([]interface{})
+		for _, v := range values {
+			value, _ := v.(map[string]interface{})
+			name, _ := value["property_name"].(string)
+			if _, ok := s.Properties[name]; !ok {
+				validationFailed(w, fmt.Sprintf("custom property %s is not defined", name))
+				return
+			}
+			if value["value"] == nil {
+				delete(repo.Properties, name)
+			} else {
+				repo.Properties[name] = value["value"]
+			}
+		}
+		repo.UpdatedAt = s.tick()
+		writeJSON(w, http.StatusNoContent, nil)
+
+	case len(p) == 3 && p[0] == "branches" && p[2] == "protection" && m == "PUT":
+		repo.BranchProtections[p[1]] = body
+		writeJSON(w, http.StatusOK, body)
+
+	case len(p) >= 1 && p[0] == "rulesets":
+		s.handleRulesets(w, m, p[1:], body, repo.Rulesets, repo.Name)
+
+	case len(p) == 1 && p[0] == "check-runs" && m == "POST":
+		id, _ := s.newId("CR")
+		body["id"] = id
+		repo.CheckRuns = append(repo.CheckRuns, body)
+		writeJSON(w, http.StatusCreated, body)
+
+	case len(p) == 3 && p[0] == "issues" && p[2] == "comments":
+		issue, err := strconv.Atoi(p[1])
+		if err != nil {
+			notFound(w)
+			return
+		}
+		switch m {
+		case "GET":
+			comments := make([]map[string]interface{}, 0)
+			for _, id := range sortedKeys(repo.Comments) {
+				if c := repo.Comments[id]; c.Issue == issue {
+					comments = append(comments, map[string]interface{}{"id": c.Id, "body": c.Body})
+				}
+			}
+			writeJSON(w, http.StatusOK, comments)
+		case "POST":
+			id, _ := s.newId("IC")
+			text, _ := body["body"].(string)
+			repo.Comments[id] = &Comment{Id: id, Issue: issue, Body: text}
+			writeJSON(w, http.StatusCreated, map[string]interface{}{"id": id, "body": text})
+		default:
+			notFound(w)
+		}
+	case len(p) == 3 && p[0] == "issues" && p[1] == "comments" && m == "PATCH":
+		id, err := strconv.Atoi(p[2])
+		comment, ok := repo.Comments[id]
+		if err != nil || !ok {
+			notFound(w)
+			return
+		}
+		comment.Body, _ = body["body"].(string)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": comment.Id, "body": comment.Body})
+
+	default:
+		notFound(w)
+	}
+}
+
+/*
+ * handleCustomProperties handles /orgs/{org}/properties/...
+ * (the repositories values are returned in a single page)
+ */
+func (s *Server) handleCustomProperties(w http.ResponseWriter, m string, p []string, body map[string]interface{}) {
+	switch {
+	case len(p) == 1 && p[0] == "schema" && m == "GET":
+		properties := make([]map[string]interface{}, 0, len(s.Properties))
+		for _, name := range sortedKeys(s.Properties) {
+			properties = append(properties, s.Properties[name])
+		}
+		writeJSON(w, http.StatusOK, properties)
+	case len(p) == 2 && p[0] == "schema" && m == "GET":
+		property, ok := s.Properties[p[1]]
+		if !ok {
+			notFound(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, property)
+	case len(p) == 2 && p[0] == "schema" && m == "PUT":
+		if valueType, _ := body["value_type"].(string); valueType == "" {
+			validationFailed(w, "value_type is missing")
+			return
+		}
+		property := map[string]interface{}{}
+		for k, v := range body {
+			property[k] = v
+		}
+		property["property_name"] = p[1]
+		s.Properties[p[1]] = property
+		writeJSON(w, http.StatusOK, property)
+	case len(p) == 2 && p[0] == "schema" && m == "DELETE":
+		if _, ok := s.Properties[p[1]]; !ok {
+			notFound(w)
+			return
+		}
+		delete(s.Properties, p[1])
+		for _, r := range s.Repositories {
+			delete(r.Properties, p[1])
+		}
+		writeJSON(w, http.StatusNoContent, nil)
+
+	case len(p) == 1 && p[0] == "values" && m == "GET":
+		repositories := make([]map[string]interface{}, 0, len(s.Repositories))
+		for _, name := range sortedKeys(s.Repositories) {
+			repo := s.Repositories[name]
+			repositories = append(repositories, map[string]interface{}{
+				"repository_id":        repo.Id,
+				"repository_name":      repo.Name,
+				"repository_full_name": s.Org + "/" + repo.Name,
+				"properties":           customPropertyValuesToJSON(repo),
+			})
+		}
+		writeJSON(w, http.StatusOK, repositories)
+	default:
+		notFound(w)
+	}
+}
+
+func customPropertyValuesToJSON(r *Repository) []map[string]interface{} {
+	values := make([]map[string]interface{}, 0, len(r.Properties))
+	for _, name := range sortedKeys(r.Properties) {
+		values = append(values, map[string]interface{}{"property_name": name, "value": r.Properties[name]})
+	}
+	return values
+}
+
+/*
+ * handleRulesets handles the organization (source == "") or repository rulesets
+ */
+func (s *Server) handleRulesets(w http.ResponseWriter, m string, p []string, body map[string]interface{}, rulesets map[int]*Ruleset, source string) {
+	if len(p) == 0 {
+		if m != "POST" {
+			notFound(w)
+			return
+		}
+		name, _ := body["name"].(string)
+		for _, rs := range rulesets {
+			if rs.Name == name {
+				validationFailed(w, "Name must be unique")
+				return
+			}
+		}
+		id, _ := s.newId("RRS")
+		ruleset := &Ruleset{Id: id, Source: source}
+		ruleset.update(body)
+		rulesets[id] = ruleset
+		writeJSON(w, http.StatusCreated, ruleset.toJSON())
+		return
+	}
+
+	id, err := strconv.Atoi(p[0])
+	ruleset, ok := rulesets[id]
+	if err != nil || !ok || len(p) != 1 {
+		notFound(w)
+		return
+	}
+	switch m {
+	case "GET":
+		writeJSON(w, http.StatusOK, ruleset.toJSON())
+	case "PUT":
+		ruleset.update(body)
+		writeJSON(w, http.StatusOK, ruleset.toJSON())
+	case "DELETE":
+		delete(rulesets, id)
+		writeJSON(w, http.StatusNoContent, nil)
+	default:
+		notFound(w)
+	}
+}
+
+func (r *Ruleset) update(body map[string]interface{}) {
+	if name, ok := body["name"].(string); ok {
+		r.Name = name
+	}
+	if target, ok := body["target"].(string); ok {
+		r.Target = target
+	}
+	if r.Target == "" {
+		r.Target = "branch"
+	}
+	if enforcement, ok := body["enforcement"].(string); ok {
+		r.Enforcement = enforcement
+	}
+	if bypassActors, ok := body["bypass_actors"].([]interface{}); ok {
+		r.BypassActors = bypassActors
+	}
+	if conditions, ok := body["conditions"].(map[string]interface{}); ok {
+		r.Conditions = conditions
+	}
+	if rules, ok := body["rules"].([]interface{}); ok {
+		r.Rules = rules
+	}
+}
+
+func (r *Ruleset) toJSON() map[string]interface{} {
+	return map[string]interface{}{
+		"id":            r.Id,
+		"name":          r.Name,
+		"target":        r.Target,
+		"enforcement":   r.Enforcement,
+		"bypass_actors": r.BypassActors,
+		"conditions":    r.Conditions,
+		"rules":         r.Rules,
+	}
+}
+
+func (s *Server) installationToJSON(i *Installation) map[string]interface{} {
+	name := i.Name
+	if name == "" {
+		name = i.AppSlug
+	}
+	return map[string]interface{}{
+		"id":       i.Id,
+		"app_id":   i.AppId,
+		"app_slug": i.AppSlug,
+		"name":     name,
+		"account":  map[string]interface{}{"login": s.Org},
+	}
+}
+
+func (s *Server) teamToJSON(t *Team) map[string]interface{} {
+	team := map[string]interface{}{
+		"id":          t.Id,
+		"node_id":     t.NodeId,
+		"name":        t.Name,
+		"slug":        t.Slug,
+		"description": t.Description,
+		"privacy":     t.Privacy,
+		"parent":      nil,
+	}
+	if parent := s.teamById(t.ParentId); parent != nil {
+		team["parent"] = map[string]interface{}{"id": parent.Id, "slug": parent.Slug}
+	}
+	return team
+}
+
+func (s *Server) repositoryToJSON(r *Repository) map[string]interface{} {
+	repo := map[string]interface{}{}
+	for k, v := range r.Settings {
+		repo[k] = v
+	}
+	repo["id"] = r.Id
+	repo["node_id"] = r.NodeId
+	repo["name"] = r.Name
+	repo["full_name"] = s.Org + "/" + r.Name
+	repo["updated_at"] = formatTime(r.UpdatedAt)
+	return repo
+}
+
+func sortedKeys[K int | string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,358 @@
+package githubfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * Server is an in-memory Github, to run Goliac end to end (plan, apply)
+ * without Github. It implements the subset of the REST and GraphQL APIs
+ * used by Goliac:
+ * - organization members (and invitations)
+ * - teams, team members and team repositories
+ * - repositories, collaborators and branch protections
+ * - organization and repository rulesets
+ * - organization custom properties (and their repositories values)
+ * - app installations (and installation access tokens)
+ * - GHES meta (/api/v3)
+ *
+ * The state is kept in the exported fields: a test can seed it before
+ * running Goliac, and assert on it afterwards (Lock/Unlock around the accesses
+ * if the server is in use).
+ *
+ * The GraphQL queries are not parsed: the queries sent by Goliac are recognized
+ * (mostly by their operation name) and answered with (a superset of) the fields
+ * they select, in a single page.
+ *
+ * Example:
+ * fake := githubfake.NewServer("goliac-project")
+ * defer fake.Close()
+ * fake.AddMember("admin1", "ADMIN")
+ * client, _ := github.NewGitHubClientImpl(fake.URL, github.NewTokenAuthenticator("token", "", "fake"))
+ */
+type Server struct {
+	*httptest.Server
+
+	Org         string
+	GHESVersion string // if set, pretends to be a GHES (else github.com)
+	Plan        string // the organization plan (free, team, enterprise)
+	Token       string // if set, the calls must be authenticated with this token
+
+	mu            sync.Mutex
+	Members       map[string]string                 // [login]role (ADMIN, MEMBER)
+	Invitations   map[string]string                 // pending invitations [login]role
+	Teams         map[string]*Team                  // [slug]
+	Repositories  map[string]*Repository            // [name]
+	Rulesets      map[int]*Ruleset                  // organization rulesets [id]
+	Properties    map[string]map[string]interface{} // organization custom properties [name]definition (as sent to the REST API)
+	Installations []*Installation
+	Calls         []string // "METHOD path" of each call received
+	nextId        int
+	clock         time.Time // incremented at each change (to get distinct updatedAt)
+}
+
+type Team struct {
+	Id           int
+	NodeId       string
+	Name         string
+	Slug         string
+	Description  string
+	Privacy      string
+	ParentId     int               // 0 if no parent
+	Members      map[string]string // [login]role (member, maintainer)
+	Repositories map[string]string // [repository]permission (pull, triage, push, maintain, admin)
+	UpdatedAt    time.Time
+}
+
+type Repository struct {
+	Id                int
+	NodeId            string
+	Name              string
+	Settings          map[string]interface{} // as set with the REST API (description, private, archived, allow_auto_merge, ...)
+	Collaborators     map[string]string      // [login]permission (pull, triage, push, maintain, admin)
+	Topics            []string
+	Properties        map[string]interface{} // custom properties values [name]value (a string or a list of strings)
+	Rulesets          map[int]*Ruleset
+	BranchProtections map[string]map[string]interface{} // [branch]protection
+	CheckRuns         []map[string]interface{}
+	Comments          map[int]*Comment // issues and pull requests comments [id]
+	UpdatedAt         time.Time
+}
+
+type Comment struct {
+	Id    int
+	Issue int
+	Body  string
+}
+
+/*
+ * Ruleset is kept as sent to the REST API
+ */
+type Ruleset struct {
+	Id           int
+	Name         string
+	Target       string // branch, tag
+	Enforcement  string // disabled, active, evaluate
+	Source       string // the repository name, for a repository ruleset
+	BypassActors []interface{}
+	Conditions   map[string]interface{}
+	Rules        []interface{}
+}
+
+type Installation struct {
+	Id      int
+	AppId   int
+	AppSlug string
+	Name    string // the app name (the slug if empty)
+}
+
+/*
+ * NewServer starts an empty organization
+ */
+func NewServer(org string) *Server {
+	s := &Server{
+		Org:           org,
+		Plan:          "free",
+		Members:       make(map[string]string),
+		Invitations:   make(map[string]string),
+		Teams:         make(map[string]*Team),
+		Repositories:  make(map[string]*Repository),
+		Rulesets:      make(map[int]*Ruleset),
+		Properties:    make(map[string]map[string]interface{}),
+		Installations: make([]*Installation, 0),
+		Calls:         make([]string, 0),
+		nextId:        1000,
+		clock:         time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *Server) Lock() {
+	s.mu.Lock()
+}
+
+func (s *Server) Unlock() {
+	s.mu.Unlock()
+}
+
+// newId returns a new database id (and its node id)
+func (s *Server) newId(kind string) (int, string) {
+	s.nextId++
+	return s.nextId, fmt.Sprintf("%s_%d", kind, s.nextId)
+}
+
+// tick returns a new updatedAt
+func (s *Server) tick() time.Time {
+	s.clock = s.clock.Add(time.Second)
+	return s.clock
+}
+
+/*
+ * AddMember adds a member to the organization (role: ADMIN or MEMBER)
+ */
+func (s *Server) AddMember(login string, role string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Members[login] = role
+}
+
+/*
+ * AcceptInvitation turns a pending invitation into a membership
+ */
+func (s *Server) AcceptInvitation(login string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if role, ok := s.Invitations[login]; ok {
+		s.Members[login] = role
+		delete(s.Invitations, login)
+	}
+}
+
+/*
+ * AddTeam adds a team (and returns it, to add members or repositories)
+ */
+func (s *Server) AddTeam(name string, parent *Team) *Team {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addTeam(name, "", parent)
+}
+
+func (s *Server) addTeam(name string, description string, parent *Team) *Team {
+	id, nodeId := s.newId("T")
+	team := &Team{
+		Id:           id,
+		NodeId:       nodeId,
+		Name:         name,
+		Slug:         teamSlug(name),
+		Description:  description,
+		Privacy:      "closed",
+		Members:      make(map[string]string),
+		Repositories: make(map[string]string),
+		UpdatedAt:    s.tick(),
+	}
+	if parent != nil {
+		team.ParentId = parent.Id
+	}
+	s.Teams[team.Slug] = team
+	return team
+}
+
+/*
+ * AddRepository adds a repository (and returns it, to add collaborators or rulesets)
+ */
+func (s *Server) AddRepository(name string, settings map[string]interface{}) *Repository {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addRepository(name, settings)
+}
+
+func (s *Server) addRepository(name string, settings map[string]interface{}) *Repository {
+	id, nodeId := s.newId("R")
+	repo := &Repository{
+		Id:                id,
+		NodeId:            nodeId,
+		Name:              name,
+		Settings:          map[string]interface{}{"private": false, "archived": false},
+		Collaborators:     make(map[string]string),
+		Properties:        make(map[string]interface{}),
+		Rulesets:          make(map[int]*Ruleset),
+		BranchProtections: make(map[string]map[string]interface{}),
+		Comments:          make(map[int]*Comment),
+		UpdatedAt:         s.tick(),
+	}
+	repo.setSettings(settings)
+	s.Repositories[name] = repo
+	return repo
+}
+
+/*
+ * setSettings sets the repository settings (like with the REST API),
+ * keeping the private flag and the visibility consistent
+ */
+func (r *Repository) setSettings(settings map[string]interface{}) {
+	for k, v := range settings {
+		if k != "name" {
+			r.Settings[k] = v
+		}
+	}
+	if visibility, ok := settings["visibility"].(string); ok {
+		r.Settings["private"] = visibility != "public"
+	} else if _, ok := settings["private"]; ok {
+		delete(r.Settings, "visibility")
+	}
+}
+
+/*
+ * AddInstallation installs a Github App in the organization
+ */
+func (s *Server) AddInstallation(appId int, appSlug string) *Installation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, _ := s.newId("I")
+	installation := &Installation{
+		Id:      id,
+		AppId:   appId,
+		AppSlug: appSlug,
+	}
+	s.Installations = append(s.Installations, installation)
+	return installation
+}
+
+func (s *Server) teamById(id int) *Team {
+	for _, t := range s.Teams {
+		if t.Id == id {
+			return t
+		}
+	}
+	return nil
+}
+
+func (s *Server) repositoryById(id int) *Repository {
+	for _, r := range s.Repositories {
+		if r.Id == id {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *Server) installationByAppId(appId int) *Installation {
+	for _, i := range s.Installations {
+		if i.AppId == appId {
+			return i
+		}
+	}
+	return nil
+}
+
+// teamSlug mimics the Github team slug (lower case, non alphanumeric characters replaced by a dash)
+func teamSlug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_' {
+			b.WriteRune(c)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Calls = append(s.Calls, r.Method+" "+r.URL.Path)
+
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token && !strings.HasPrefix(r.URL.Path, "/app/") {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"message": "Bad credentials"})
+		return
+	}
+
+	var body map[string]interface{}
+	if r.Body != nil && (r.Method == "POST" || r.Method == "PUT" || r.Method == "PATCH") {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err.Error() != "EOF" {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "Problems parsing JSON"})
+			return
+		}
+	}
+	if body == nil {
+		body = make(map[string]interface{})
+	}
+
+	if r.URL.Path == "/graphql" && r.Method == "POST" {
+		s.handleGraphQL(w, body)
+		return
+	}
+	s.handleRest(w, r, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if payload != nil {
+		json.NewEncoder(w).Encode(payload)
+	}
+}
+
+func notFound(w http.ResponseWriter) {
+	writeJSON(w, http.StatusNotFound, map[string]interface{}{"message": "Not Found"})
+}
+
+func validationFailed(w http.ResponseWriter, message string) {
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"message": "Validation Failed", "errors": []string{message}})
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
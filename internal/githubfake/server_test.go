@@ -0,0 +1,154 @@
+package githubfake
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Alayacare/goliac/internal/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer(t *testing.T) {
+
+	t.Run("happy path: teams are created and listed", func(t *testing.T) {
+		fake := NewServer("myorg")
+		defer fake.Close()
+		fake.AddMember("user1", "ADMIN")
+
+		client, err := github.NewGitHubClientImpl(fake.URL, github.NewTokenAuthenticator("token", "", "test"))
+		assert.Nil(t, err)
+		ctx := context.TODO()
+
+		body, err := client.CallRestAPI(ctx, "/orgs/myorg/teams", "", "POST", map[string]interface{}{"name": "My Team", "privacy": "closed"})
+		assert.Nil(t, err)
+		var team struct {
+			Slug string `json:"slug"`
+		}
+		assert.Nil(t, json.Unmarshal(body, &team))
+		assert.Equal(t, "my-team", team.Slug)
+
+		_, err = client.CallRestAPI(ctx, "orgs/myorg/teams/my-team/memberships/user1", "", "PUT", map[string]interface{}{"role": "maintainer"})
+		assert.Nil(t, err)
+
+		data, err := client.QueryGraphQLAPI(ctx, "query listAllTeamMembersInOrg($orgLogin: String!, $teamSlug: String!) { }", map[string]interface{}{"orgLogin": "myorg", "teamSlug": "my-team"})
+		assert.Nil(t, err)
+		var members struct {
+			Data struct {
+				Organization struct {
+					Team struct {
+						Members struct {
+							Edges []struct {
+								Node struct {
+									Login string
+								}
+								Role string
+							}
+						}
+					}
+				}
+			}
+		}
+		assert.Nil(t, json.Unmarshal(data, &members))
+		assert.Equal(t, 1, len(members.Data.Organization.Team.Members.Edges))
+		assert.Equal(t, "user1", members.Data.Organization.Team.Members.Edges[0].Node.Login)
+		assert.Equal(t, "MAINTAINER", members.Data.Organization.Team.Members.Edges[0].Role)
+	})
+
+	t.Run("happy path: a ruleset is returned in its GraphQL form", func(t *testing.T) {
+		fake := NewServer("myorg")
+		defer fake.Close()
+		fake.AddInstallation(42, "my-app")
+		repo := fake.AddRepository("repo1", nil)
+
+		client, err := github.NewGitHubClientImpl(fake.URL, github.NewTokenAuthenticator("token", "", "test"))
+		assert.Nil(t, err)
+		ctx := context.TODO()
+
+		_, err = client.CallRestAPI(ctx, "/orgs/myorg/rulesets", "", "POST", map[string]interface{}{
+			"name":          "default",
+			"enforcement":   "active",
+			"bypass_actors": []interface{}{map[string]interface{}{"actor_id": 42, "actor_type": "Integration", "bypass_mode": "always"}},
+			"conditions": map[string]interface{}{
+				"ref_name":      map[string]interface{}{"include": []string{"~DEFAULT_BRANCH"}, "exclude": []string{}},
+				"repository_id": map[string]interface{}{"repository_ids": []int{repo.Id}},
+			},
+			"rules": []interface{}{map[string]interface{}{"type": "pull_request", "parameters": map[string]interface{}{"required_approving_review_count": 1}}},
+		})
+		assert.Nil(t, err)
+
+		data, err := client.QueryGraphQLAPI(ctx, "query listRulesets ($orgLogin: String!) { }", map[string]interface{}{"orgLogin": "myorg"})
+		assert.Nil(t, err)
+		var rulesets struct {
+			Data struct {
+				Organization struct {
+					Rulesets struct {
+						Nodes []struct {
+							Name         string
+							Enforcement  string
+							BypassActors struct {
+								App []struct {
+									Actor struct {
+										Name string
+									}
+									BypassMode string
+								}
+							}
+							Conditions struct {
+								RepositoryId struct {
+									RepositoryIds []string
+								}
+							}
+							Rules struct {
+								Nodes []struct {
+									Type       string
+									Parameters struct {
+										RequiredApprovingReviewCount int
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+		assert.Nil(t, json.Unmarshal(data, &rulesets))
+		assert.Equal(t, 1, len(rulesets.Data.Organization.Rulesets.Nodes))
+		ruleset := rulesets.Data.Organization.Rulesets.Nodes[0]
+		assert.Equal(t, "ACTIVE", ruleset.Enforcement)
+		assert.Equal(t, "my-app", ruleset.BypassActors.App[0].Actor.Name)
+		assert.Equal(t, "ALWAYS", ruleset.BypassActors.App[0].BypassMode)
+		assert.Equal(t, []string{repo.NodeId}, ruleset.Conditions.RepositoryId.RepositoryIds)
+		assert.Equal(t, "PULL_REQUEST", ruleset.Rules.Nodes[0].Type)
+		assert.Equal(t, 1, ruleset.Rules.Nodes[0].Parameters.RequiredApprovingReviewCount)
+	})
+
+	t.Run("not happy path: Github errors", func(t *testing.T) {
+		fake := NewServer("myorg")
+		defer fake.Close()
+		fake.Token = "good"
+
+		client, err := github.NewGitHubClientImpl(fake.URL, github.NewTokenAuthenticator("bad", "", "test"))
+		assert.Nil(t, err)
+		_, err = client.CallRestAPI(context.TODO(), "/orgs/myorg", "", "GET", nil)
+		assert.NotNil(t, err)
+
+		client, err = github.NewGitHubClientImpl(fake.URL, github.NewTokenAuthenticator("good", "", "test"))
+		assert.Nil(t, err)
+
+		// not a GHES
+		_, err = client.CallRestAPI(context.TODO(), "/api/v3", "", "GET", nil)
+		assert.NotNil(t, err)
+
+		// not a member of the organization
+		fake.AddTeam("team1", nil)
+		body, err := client.CallRestAPI(context.TODO(), "/orgs/myorg/teams/team1/memberships/unknown", "", "PUT", map[string]interface{}{"role": "member"})
+		assert.NotNil(t, err)
+		assert.Contains(t, string(body), "Validation Failed")
+
+		// unknown repository
+		body, err = client.CallRestAPI(context.TODO(), "/repos/myorg/unknown", "", "DELETE", nil)
+		assert.NotNil(t, err)
+		assert.Contains(t, string(body), "Not Found")
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/Alayacare/goliac/internal/config"
 	"github.com/Alayacare/goliac/internal/engine"
@@ -15,6 +16,8 @@ import (
 	"github.com/Alayacare/goliac/internal/observability"
 	"github.com/Alayacare/goliac/internal/usersync"
 	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/sirupsen/logrus"
 )
 
@@ -37,12 +40,35 @@ type Goliac interface {
 	// it returns an error if something went wrong, and a detailed list of errors and warnings
 	Apply(ctx context.Context, fs billy.Filesystem, dryrun bool, repositoryUrl, branch string) (error, []error, []entity.Warning, *engine.UnmanagedResources)
 
+	// will run the reconciliation in dryrun mode (without touching Github)
+	// and return the list of operations that Apply would do
+	Plan(ctx context.Context, fs billy.Filesystem, repositoryUrl, branch string) (*engine.Plan, error, []error, []entity.Warning)
+
+	// will validate and plan the head of a teams repo pull request,
+	// and publish the result as a check run and a PR comment
+	PlanPullRequest(ctx context.Context, fs billy.Filesystem, repositoryUrl string, pr PullRequest) error
+
+	// will refresh the entity changed directly on Github (from a webhook event),
+	// and revert the change if it drifts from the teams repo. It returns the number of reverted operations
+	ReconcileRemoteChange(ctx context.Context, repositoryUrl string, change RemoteChangeEvent) (int, error)
+
 	// will clone run the user-plugin to sync users, and will commit to the team repository, return true if a change was done
 	UsersUpdate(ctx context.Context, fs billy.Filesystem, repositoryUrl, branch string, dryrun bool, force bool) (bool, error)
 
 	// flush remote cache
 	FlushCache()
 
+	// returns the apply that was interrupted (if any) before Goliac was started, from the apply journal.
+	// The next Apply will reconcile from the current Github state (and apply what was not applied)
+	ResumeInterruptedApply() (*InterruptedApply, error)
+
+	// returns the audit (commit, author, PR, number of operations) of the teams repo commits
+	// replayed one by one by the last Apply (with GOLIAC_APPLY_COMMIT_BY_COMMIT)
+	GetLastAppliedCommits() []AppliedCommit
+
+	// returns the Github API budget left (as last reported by Github)
+	GetRateLimits() github.RateLimits
+
 	GetLocal() engine.GoliacLocalResources
 	GetRemote() engine.GoliacRemoteResources
 }
@@ -54,33 +80,54 @@ type GoliacImpl struct {
 	remoteGithubClient github.GitHubClient // github client for admin operations
 	repoconfig         *config.RepositoryConfig
 	feedback           observability.RemoteObservability // mostly used for UI progressbar
+	journal            *ApplyJournal                     // optional, to resume an interrupted apply
+	commit             string                            // optional, the teams repository commit to load (instead of the branch head)
+	teamsRepository    string                            // optional, the teams repository name when planning a local directory
+	lastAppliedCommits []AppliedCommit                   // audit of the commits replayed by the last Apply
+	remoteLogin        string                            // the login remoteGithubClient is authenticated as (resolved once)
+	remoteLoginMutex   sync.Mutex
 }
 
 func NewGoliacImpl() (Goliac, error) {
-	remoteGithubClient, err := github.NewGitHubClientImpl(
+	remoteAuthenticator, err := github.NewAuthenticatorFromConfig(
 		config.Config.GithubServer,
 		config.Config.GithubAppOrganization,
 		config.Config.GithubAppID,
 		config.Config.GithubAppPrivateKeyFile,
+		config.Config.GithubAppPrivateKey,
 	)
 	if err != nil {
 		return nil, err
 	}
+	remoteGithubClient, err := github.NewGitHubClientImpl(config.Config.GithubServer, remoteAuthenticator)
+	if err != nil {
+		return nil, err
+	}
 
-	localGithubClient, err := github.NewGitHubClientImpl(
+	localAuthenticator, err := github.NewAuthenticatorFromConfig(
 		config.Config.GithubServer,
 		config.Config.GithubAppOrganization,
 		config.Config.GithubTeamAppID,
 		config.Config.GithubTeamAppPrivateKeyFile,
+		config.Config.GithubTeamAppPrivateKey,
 	)
 	if err != nil {
 		return nil, err
 	}
+	localGithubClient, err := github.NewGitHubClientImpl(config.Config.GithubServer, localAuthenticator)
+	if err != nil {
+		return nil, err
+	}
 
 	remote := engine.NewGoliacRemoteImpl(remoteGithubClient)
 
 	usersync.InitPlugins(remoteGithubClient)
 
+	var journal *ApplyJournal
+	if config.Config.ApplyJournalFile != "" {
+		journal = NewApplyJournal(config.Config.ApplyJournalFile)
+	}
+
 	return &GoliacImpl{
 		local:              engine.NewGoliacLocalImpl(),
 		remoteGithubClient: remoteGithubClient,
@@ -88,6 +135,51 @@ func NewGoliacImpl() (Goliac, error) {
 		remote:             remote,
 		repoconfig:         &config.RepositoryConfig{},
 		feedback:           nil,
+		journal:            journal,
+	}, nil
+}
+
+/*
+ * NewGoliacOfflineImpl returns a Goliac that can only plan, against an
+ * organization snapshot (goliac snapshot export) instead of Github
+ */
+func NewGoliacOfflineImpl(snapshotPath string, teamsRepository string) (Goliac, error) {
+	remote, err := engine.NewFileGoliacRemoteImpl(snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+	if teamsRepository == "" {
+		teamsRepository = remote.TeamsRepository()
+	}
+
+	return &GoliacImpl{
+		local:           engine.NewGoliacLocalImpl(),
+		remote:          remote,
+		repoconfig:      &config.RepositoryConfig{},
+		teamsRepository: teamsRepository,
+	}, nil
+}
+
+/*
+ * NewGoliacReplayImpl returns a Goliac answering the Github calls from a
+ * cassette (recorded with GOLIAC_RECORD_DIR), to plan offline what a
+ * previous run did. commit (optional) is the teams repository commit to load
+ */
+func NewGoliacReplayImpl(cassettePath string, commit string) (Goliac, error) {
+	client, err := github.NewGitHubClientReplay(cassettePath)
+	if err != nil {
+		return nil, err
+	}
+
+	usersync.InitPlugins(client)
+
+	return &GoliacImpl{
+		local:              engine.NewGoliacLocalImpl(),
+		remoteGithubClient: client,
+		localGithubClient:  client,
+		remote:             engine.NewGoliacRemoteImpl(client),
+		repoconfig:         &config.RepositoryConfig{},
+		commit:             commit,
 	}, nil
 }
 
@@ -99,6 +191,10 @@ func (g *GoliacImpl) GetRemote() engine.GoliacRemoteResources {
 	return g.remote
 }
 
+func (g *GoliacImpl) GetRateLimits() github.RateLimits {
+	return g.remoteGithubClient.GetRateLimits()
+}
+
 func (g *GoliacImpl) SetRemoteObservability(feedback observability.RemoteObservability) error {
 	g.feedback = feedback
 	g.remote.SetRemoteObservability(feedback)
@@ -117,24 +213,43 @@ func (g *GoliacImpl) FlushCache() {
 	g.remote.FlushCache()
 }
 
+/*
+ * ResumeInterruptedApply reads the apply journal left behind by an interrupted apply (if any),
+ * with the operations that were not done (InterruptedApply.Pending).
+ * Github was partially changed, so the remote cache (that can come from a snapshot taken
+ * before the interruption) is flushed: the next Apply re-plans against the real Github state,
+ * and applies only what is still missing (the pending operations, if they are still needed).
+ */
+func (g *GoliacImpl) ResumeInterruptedApply() (*InterruptedApply, error) {
+	if g.journal == nil {
+		return nil, nil
+	}
+	interrupted, err := LoadApplyJournal(g.journal.path)
+	if err != nil || interrupted == nil {
+		return nil, err
+	}
+	logrus.Warnf("the apply of commit %s was interrupted after %d/%d operation(s), resuming it", interrupted.Commit, interrupted.Completed, len(interrupted.Planned))
+	for _, command := range interrupted.Pending {
+		logrus.Warnf("operation not done before the interruption: %s", command)
+	}
+	g.remote.FlushCache()
+	return interrupted, nil
+}
+
 func (g *GoliacImpl) Apply(ctx context.Context, fs billy.Filesystem, dryrun bool, repositoryUrl, branch string) (error, []error, []entity.Warning, *engine.UnmanagedResources) {
+	if g.remoteGithubClient == nil {
+		return fmt.Errorf("no Github access (offline mode): only plan is available"), nil, nil, nil
+	}
 	err, errs, warns := g.loadAndValidateGoliacOrganization(ctx, fs, repositoryUrl, branch)
 	defer g.local.Close(fs)
 	if err != nil {
 		return fmt.Errorf("failed to load and validate: %s", err), errs, warns, nil
 	}
-	if !strings.HasPrefix(repositoryUrl, "https://") &&
-		!strings.HasPrefix(repositoryUrl, "inmemory:///") { // <- only for testing purposes
-		return fmt.Errorf("local mode is not supported for plan/apply, you must specify the https url of the remote team git repository. Check the documentation"), errs, warns, nil
-	}
-
-	u, err := url.Parse(repositoryUrl)
+	teamreponame, err := teamsRepoName(repositoryUrl)
 	if err != nil {
-		return fmt.Errorf("failed to parse %s: %v", repositoryUrl, err), errs, warns, nil
+		return err, errs, warns, nil
 	}
 
-	teamreponame := strings.TrimSuffix(path.Base(u.Path), filepath.Ext(path.Base(u.Path)))
-
 	// ensure that the team repo is configured to only allow squash and merge
 	if !dryrun {
 		err := g.forceSquashMergeOnTeamsRepo(ctx, teamreponame, branch)
@@ -144,6 +259,11 @@ func (g *GoliacImpl) Apply(ctx context.Context, fs billy.Filesystem, dryrun bool
 	}
 
 	unmanaged, err := g.applyToGithub(ctx, dryrun, config.Config.GithubAppOrganization, teamreponame, branch, config.Config.SyncUsersBeforeApply)
+	for _, c := range g.lastAppliedCommits {
+		if c.Skipped != nil {
+			warns = append(warns, fmt.Errorf("commit %s was skipped: %v", c.String(), c.Skipped))
+		}
+	}
 	for _, warn := range warns {
 		logrus.Warn(warn)
 	}
@@ -154,13 +274,104 @@ func (g *GoliacImpl) Apply(ctx context.Context, fs billy.Filesystem, dryrun bool
 	return nil, errs, warns, unmanaged
 }
 
+func (g *GoliacImpl) Plan(ctx context.Context, fs billy.Filesystem, repositoryUrl, branch string) (*engine.Plan, error, []error, []entity.Warning) {
+	err, errs, warns := g.loadAndValidateGoliacOrganization(ctx, fs, repositoryUrl, branch)
+	defer g.local.Close(fs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load and validate: %s", err), errs, warns
+	}
+	// a local directory can be planned (but not applied): its name says nothing
+	// about the name of the teams repository on Github
+	var teamreponame string
+	if isTeamsRepoUrl(repositoryUrl) {
+		teamreponame, err = teamsRepoName(repositoryUrl)
+	} else {
+		teamreponame, err = g.localTeamsRepoName()
+	}
+	if err != nil {
+		return nil, err, errs, warns
+	}
+
+	err = g.remote.Load(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("error when fetching data from Github: %v", err), errs, warns
+	}
+
+	// like Apply in dryrun: the users are synced (but not pushed) before planning.
+	// A local directory is not a git clone: it is planned as is
+	if config.Config.SyncUsersBeforeApply && isTeamsRepoUrl(repositoryUrl) {
+		if err := g.syncUsers(ctx, true); err != nil {
+			return nil, err, errs, warns
+		}
+	}
+
+	// the plan recorder doesn't forward anything to Github (nor to the remote cache)
+	plan := engine.NewPlan()
+	reconciliator := engine.NewGoliacReconciliatorImpl(engine.NewPlanRecorder(g.remote, plan), g.repoconfig)
+
+	reposToArchive := make(map[string]*engine.GithubRepoComparable)
+	reposToRename := make(map[string]*entity.Repository)
+	_, err = reconciliator.Reconciliate(ctx, g.local, g.remote, teamreponame, true, g.repoconfig.AdminTeam, reposToArchive, reposToRename)
+	if err != nil {
+		return nil, fmt.Errorf("error when reconciliating: %v", err), errs, warns
+	}
+
+	return plan, nil, errs, warns
+}
+
+/*
+ * localTeamsRepoName returns the name of the teams repository when a local
+ * directory is planned: the given one (or the one recorded in the organization
+ * snapshot), else the one of GOLIAC_SERVER_GIT_REPOSITORY
+ */
+func (g *GoliacImpl) localTeamsRepoName() (string, error) {
+	if g.teamsRepository != "" {
+		return g.teamsRepository, nil
+	}
+	if isTeamsRepoUrl(config.Config.ServerGitRepository) {
+		return teamsRepoName(config.Config.ServerGitRepository)
+	}
+	return "", fmt.Errorf("the name of the teams repository is unknown: specify it with --teams-repository (or GOLIAC_SERVER_GIT_REPOSITORY)")
+}
+
+/*
+ * teamsRepoName returns the name of the teams repository from its url
+ */
+func teamsRepoName(repositoryUrl string) (string, error) {
+	if !strings.HasPrefix(repositoryUrl, "https://") &&
+		!strings.HasPrefix(repositoryUrl, "file://") && // <- a local clone, to replay a recorded plan offline
+		!strings.HasPrefix(repositoryUrl, "inmemory:///") { // <- only for testing purposes
+		return "", fmt.Errorf("local mode is not supported for plan/apply, you must specify the https url of the remote team git repository. Check the documentation")
+	}
+
+	u, err := url.Parse(repositoryUrl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s: %v", repositoryUrl, err)
+	}
+
+	return strings.TrimSuffix(path.Base(u.Path), filepath.Ext(path.Base(u.Path))), nil
+}
+
+/*
+ * isTeamsRepoUrl returns false if repositoryUrl is a local directory (not a git repository to clone)
+ */
+func isTeamsRepoUrl(repositoryUrl string) bool {
+	return strings.HasPrefix(repositoryUrl, "https://") ||
+		strings.HasPrefix(repositoryUrl, "git@") ||
+		strings.HasPrefix(repositoryUrl, "file://") ||
+		strings.HasPrefix(repositoryUrl, "inmemory:///")
+}
+
 func (g *GoliacImpl) loadAndValidateGoliacOrganization(ctx context.Context, fs billy.Filesystem, repositoryUrl, branch string) (error, []error, []entity.Warning) {
 	var errs []error
 	var warns []entity.Warning
-	if strings.HasPrefix(repositoryUrl, "https://") || strings.HasPrefix(repositoryUrl, "git@") || strings.HasPrefix(repositoryUrl, "inmemory:///") {
+	if isTeamsRepoUrl(repositoryUrl) {
 		accessToken := ""
 		var err error
 		if strings.HasPrefix(repositoryUrl, "https://") {
+			if g.localGithubClient == nil {
+				return fmt.Errorf("no Github access (offline mode): the teams repository must be a local directory"), nil, nil
+			}
 			accessToken, err = g.localGithubClient.GetAccessToken(ctx)
 			if err != nil {
 				return err, nil, nil
@@ -171,20 +382,35 @@ func (g *GoliacImpl) loadAndValidateGoliacOrganization(ctx context.Context, fs b
 		if err != nil {
 			return fmt.Errorf("unable to clone: %v", err), nil, nil
 		}
-		repoconfig, err := g.local.LoadRepoConfig()
+		if g.commit != "" {
+			if !plumbing.IsHash(g.commit) {
+				return fmt.Errorf("%s is not a full commit sha", g.commit), nil, nil
+			}
+			err = g.local.CheckoutCommit(&object.Commit{Hash: plumbing.NewHash(g.commit)})
+			if err != nil {
+				return fmt.Errorf("unable to checkout the commit %s: %v", g.commit, err), nil, nil
+			}
+		}
+		repoconfig, cerrs, cwarns, err := g.loadAndValidateCheckout()
 		if err != nil {
-			return fmt.Errorf("unable to read goliac.yaml config file: %v", err), nil, nil
+			return err, nil, nil
 		}
 		g.repoconfig = repoconfig
-
-		errs, warns = g.local.LoadAndValidate()
+		errs, warns = cerrs, cwarns
 	} else {
 		// Local
 		subfs, err := fs.Chroot(repositoryUrl)
 		if err != nil {
 			return fmt.Errorf("unable to chroot to %s: %v", repositoryUrl, err), nil, nil
 		}
+		repoconfig, err := engine.ReadRepoConfig(subfs)
+		if err != nil {
+			return fmt.Errorf("unable to read goliac.yaml config file: %v", err), nil, nil
+		}
+		g.repoconfig = repoconfig
+
 		errs, warns = g.local.LoadAndValidateLocal(subfs)
+		errs = append(errs, g.validateForOrganization()...)
 	}
 
 	for _, warn := range warns {
@@ -200,6 +426,35 @@ func (g *GoliacImpl) loadAndValidateGoliacOrganization(ctx context.Context, fs b
 	return nil, errs, warns
 }
 
+/*
+ * loadAndValidateCheckout loads the goliac.yaml config and the entities of the
+ * checked out teams repository commit, and validates them
+ */
+func (g *GoliacImpl) loadAndValidateCheckout() (*config.RepositoryConfig, []error, []entity.Warning, error) {
+	repoconfig, err := g.local.LoadRepoConfig()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("unable to read goliac.yaml config file: %v", err)
+	}
+	errs, warns := g.local.LoadAndValidate()
+	errs = append(errs, g.validateForOrganization()...)
+	return repoconfig, errs, warns, nil
+}
+
+/*
+ * validateForOrganization checks the (loaded) local entities against
+ * the features of the Github organization
+ */
+func (g *GoliacImpl) validateForOrganization() []error {
+	errs := []error{}
+	isEnterprise := g.remote.IsEnterprise()
+	for _, repo := range g.local.Repositories() {
+		if err := repo.ValidateVisibility(isEnterprise); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
 /*
  * To ensure we can parse teams git logs, commit by commit (for auditing purpose),
  * we must ensure that the "squqsh and merge" option is the only option.
@@ -272,21 +527,8 @@ func (g *GoliacImpl) applyToGithub(ctx context.Context, dryrun bool, githubOrgan
 
 	// we try to sync users before applying the changes
 	if syncusersbeforeapply {
-		userplugin, found := engine.GetUserSyncPlugin(g.repoconfig.UserSync.Plugin)
-		if !found {
-			logrus.Warnf("user sync plugin %s not found", g.repoconfig.UserSync.Plugin)
-		} else {
-			accessToken, err := g.localGithubClient.GetAccessToken(ctx)
-			if err != nil {
-				return nil, err
-			}
-			change, err := g.local.SyncUsersAndTeams(g.repoconfig, userplugin, accessToken, dryrun, false, g.feedback)
-			if err != nil {
-				return nil, err
-			}
-			if change {
-				g.remote.FlushCacheUsersTeamsOnly()
-			}
+		if err := g.syncUsers(ctx, dryrun); err != nil {
+			return nil, err
 		}
 	}
 
@@ -297,7 +539,7 @@ func (g *GoliacImpl) applyToGithub(ctx context.Context, dryrun bool, githubOrgan
 	// we apply the changes to the github team repository
 	unmanaged, err := g.applyCommitsToGithub(ctx, dryrun, teamreponame, branch)
 	if err != nil {
-		return unmanaged, fmt.Errorf("error when applying to github: %v", err)
+		return unmanaged, fmt.Errorf("error when applying to github: %w", err)
 	}
 
 	//
@@ -319,6 +561,35 @@ func (g *GoliacImpl) applyToGithub(ctx context.Context, dryrun bool, githubOrgan
 	return unmanaged, nil
 }
 
+/*
+ * syncUsers syncs the users (and adjusts the teams) of the teams repository
+ * with the user sync plugin (GOLIAC_SYNC_USERS_BEFORE_APPLY).
+ * In dryrun, the changes are committed locally but not pushed
+ */
+func (g *GoliacImpl) syncUsers(ctx context.Context, dryrun bool) error {
+	userplugin, found := engine.GetUserSyncPlugin(g.repoconfig.UserSync.Plugin)
+	if !found {
+		logrus.Warnf("user sync plugin %s not found", g.repoconfig.UserSync.Plugin)
+		return nil
+	}
+	accessToken := ""
+	if g.localGithubClient != nil {
+		var err error
+		accessToken, err = g.localGithubClient.GetAccessToken(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	change, err := g.local.SyncUsersAndTeams(g.repoconfig, userplugin, accessToken, dryrun, false, g.feedback)
+	if err != nil {
+		return err
+	}
+	if change {
+		g.remote.FlushCacheUsersTeamsOnly()
+	}
+	return nil
+}
+
 func (g *GoliacImpl) applyCommitsToGithub(ctx context.Context, dryrun bool, teamreponame string, branch string) (*engine.UnmanagedResources, error) {
 
 	// if the repo was just archived in a previous commit and we "resume it"
@@ -328,27 +599,46 @@ func (g *GoliacImpl) applyCommitsToGithub(ctx context.Context, dryrun bool, team
 	reposToRename := make(map[string]*entity.Repository)
 	var unmanaged *engine.UnmanagedResources
 
-	ga := NewGithubBatchExecutor(g.remote, g.repoconfig.MaxChangesets)
-	reconciliator := engine.NewGoliacReconciliatorImpl(ga, g.repoconfig)
+	ga := NewGithubBatchExecutor(g.remote, g.repoconfig.MaxChangesets, g.repoconfig.GithubConcurrentThreads, g.repoconfig.TransactionalApply)
+	g.lastAppliedCommits = nil
 
-	commit, err := g.local.GetHeadCommit()
-	if err != nil {
-		return unmanaged, fmt.Errorf("error when getting head commit: %v", err)
-	}
-
-	// the repo has already been cloned (to HEAD) and validated (see loadAndValidateGoliacOrganization)
-	// we can now apply the changes to the github team repository
-	unmanaged, err = reconciliator.Reconciliate(ctx, g.local, g.remote, teamreponame, dryrun, g.repoconfig.AdminTeam, reposToArchive, reposToRename)
-	if err != nil {
-		return unmanaged, fmt.Errorf("error when reconciliating: %v", err)
+	if g.journal != nil && !dryrun {
+		// the sync is over (even if it failed): there is nothing to resume
+		defer func() {
+			if err := g.journal.Remove(); err != nil {
+				logrus.Warn(err)
+			}
+		}()
 	}
 
-	if !dryrun {
-		accessToken, err := g.localGithubClient.GetAccessToken(ctx)
+	if config.Config.ApplyCommitByCommit {
+		var err error
+		unmanaged, err = g.applyEachCommitToGithub(ctx, ga, dryrun, teamreponame, reposToArchive, reposToRename)
 		if err != nil {
 			return unmanaged, err
 		}
-		g.local.PushTag(GOLIAC_GIT_TAG, commit.Hash, accessToken)
+	} else {
+		commit, err := g.local.GetHeadCommit()
+		if err != nil {
+			return unmanaged, fmt.Errorf("error when getting head commit: %v", err)
+		}
+		ga.SetJournal(g.journal, commit.Hash.String())
+
+		// the repo has already been cloned (to HEAD) and validated (see loadAndValidateGoliacOrganization)
+		// we can now apply the changes to the github team repository
+		reconciliator := engine.NewGoliacReconciliatorImpl(ga, g.repoconfig)
+		unmanaged, err = reconciliator.Reconciliate(ctx, g.local, g.remote, teamreponame, dryrun, g.repoconfig.AdminTeam, reposToArchive, reposToRename)
+		if err != nil {
+			return unmanaged, fmt.Errorf("error when reconciliating: %w", err)
+		}
+
+		if !dryrun {
+			accessToken, err := g.localGithubClient.GetAccessToken(ctx)
+			if err != nil {
+				return unmanaged, err
+			}
+			g.local.PushTag(GOLIAC_GIT_TAG, commit.Hash, accessToken)
+		}
 	}
 
 	accessToken, err := g.localGithubClient.GetAccessToken(ctx)
@@ -370,6 +660,101 @@ func (g *GoliacImpl) applyCommitsToGithub(ctx context.Context, dryrun bool, team
 	return unmanaged, nil
 }
 
+/*
+ * AppliedCommit is the audit of a teams repo commit replayed by Apply
+ * (with GOLIAC_APPLY_COMMIT_BY_COMMIT)
+ */
+type AppliedCommit struct {
+	engine.CommitAudit
+	Operations int   // Github operations done for this commit
+	Skipped    error // not nil if the commit was not applied (it doesn't validate)
+}
+
+func (c AppliedCommit) String() string {
+	s := fmt.Sprintf("%s by %s", c.CommitHash, c.Author)
+	if c.PullRequest != 0 {
+		s += fmt.Sprintf(" (PR #%d)", c.PullRequest)
+	}
+	return s
+}
+
+/*
+ * applyEachCommitToGithub replays the teams repo commits since the goliac tag, one by one.
+ * Each commit is checked out, validated (with its own goliac.yaml), reconciliated and tagged,
+ * so every Github mutation can be traced back to the commit (and PR author) that produced it.
+ * Commits that don't validate are skipped: the next commit will carry their changes
+ * (HEAD has already been validated, so we always end on the HEAD state).
+ * In dryrun, Github doesn't change between commits: only HEAD is reconciliated.
+ */
+func (g *GoliacImpl) applyEachCommitToGithub(ctx context.Context, ga *GithubBatchExecutor, dryrun bool, teamreponame string, reposToArchive map[string]*engine.GithubRepoComparable, reposToRename map[string]*entity.Repository) (*engine.UnmanagedResources, error) {
+	var unmanaged *engine.UnmanagedResources
+
+	commits, err := g.local.ListCommitsFromTag(GOLIAC_GIT_TAG)
+	if err != nil {
+		return unmanaged, fmt.Errorf("error when listing commits from the %s tag: %v", GOLIAC_GIT_TAG, err)
+	}
+
+	// nothing new since the last apply: we still reconciliate HEAD (to fix any drift)
+	if len(commits) == 0 || dryrun {
+		if head, err := g.local.GetHeadCommit(); err == nil {
+			ga.SetJournal(g.journal, head.Hash.String())
+		}
+		reconciliator := engine.NewGoliacReconciliatorImpl(ga, g.repoconfig)
+		unmanaged, err = reconciliator.Reconciliate(ctx, g.local, g.remote, teamreponame, dryrun, g.repoconfig.AdminTeam, reposToArchive, reposToRename)
+		if err != nil {
+			return unmanaged, fmt.Errorf("error when reconciliating: %w", err)
+		}
+		return unmanaged, nil
+	}
+
+	for _, commit := range commits {
+		audit := engine.NewCommitAudit(commit)
+		logger := logrus.WithFields(map[string]interface{}{"commit": audit.CommitHash, "author": audit.Author, "pr": audit.PullRequest})
+
+		if err := g.local.CheckoutCommit(commit); err != nil {
+			return unmanaged, fmt.Errorf("not able to checkout commit %s: %v", audit.CommitHash, err)
+		}
+		repoconfig, errs, _, err := g.loadAndValidateCheckout()
+		if err == nil && len(errs) != 0 {
+			err = errs[0]
+		}
+		if err != nil {
+			logger.Warnf("skipping commit %s: not able to load and validate it (%v)", audit.CommitHash, err)
+			g.lastAppliedCommits = append(g.lastAppliedCommits, AppliedCommit{CommitAudit: *audit, Skipped: err})
+			continue
+		}
+		logger.Infof("applying commit %s", audit.CommitHash)
+
+		ga.SetJournal(g.journal, audit.CommitHash)
+		applied := ga.Applied()
+		commitCtx := context.WithValue(ctx, engine.KeyCommitAudit, audit)
+		reconciliator := engine.NewGoliacReconciliatorImpl(ga, repoconfig)
+		unmanaged, err = reconciliator.Reconciliate(commitCtx, g.local, g.remote, teamreponame, dryrun, repoconfig.AdminTeam, reposToArchive, reposToRename)
+		g.lastAppliedCommits = append(g.lastAppliedCommits, AppliedCommit{CommitAudit: *audit, Operations: ga.Applied() - applied})
+		if err != nil {
+			return unmanaged, fmt.Errorf("error when reconciliating commit %s: %w", audit.CommitHash, err)
+		}
+
+		accessToken, err := g.localGithubClient.GetAccessToken(ctx)
+		if err != nil {
+			return unmanaged, err
+		}
+		if err := g.local.PushTag(GOLIAC_GIT_TAG, commit.Hash, accessToken); err != nil {
+			return unmanaged, fmt.Errorf("not able to tag commit %s: %v", audit.CommitHash, err)
+		}
+	}
+
+	return unmanaged, nil
+}
+
+/*
+ * GetLastAppliedCommits returns the audit of the commits replayed by the last Apply
+ * (empty if the commits are not applied one by one)
+ */
+func (g *GoliacImpl) GetLastAppliedCommits() []AppliedCommit {
+	return g.lastAppliedCommits
+}
+
 func (g *GoliacImpl) UsersUpdate(ctx context.Context, fs billy.Filesystem, repositoryUrl, branch string, dryrun bool, force bool) (bool, error) {
 	accessToken, err := g.localGithubClient.GetAccessToken(ctx)
 	if err != nil {
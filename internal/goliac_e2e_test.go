@@ -0,0 +1,326 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/Alayacare/goliac/internal/engine"
+	"github.com/Alayacare/goliac/internal/github"
+	"github.com/Alayacare/goliac/internal/githubfake"
+	"github.com/Alayacare/goliac/internal/usersync"
+	"github.com/Alayacare/goliac/internal/utils"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+ * end to end tests: Goliac plans and applies against an in-memory Github
+ */
+
+func helperNewFakeGithub(t *testing.T) *githubfake.Server {
+	previousOrg := config.Config.GithubAppOrganization
+	config.Config.GithubAppOrganization = "goliac-project"
+	t.Cleanup(func() {
+		config.Config.GithubAppOrganization = previousOrg
+	})
+
+	fake := githubfake.NewServer("goliac-project")
+	t.Cleanup(fake.Close)
+	fake.Token = "fake-token"
+	fake.Plan = "enterprise" // for the rulesets
+	fake.AddInstallation(1, "goliac-project-app")
+	fake.AddTeam("admin", nil)
+	fake.AddRepository("src", nil) // the teams repository
+	for _, login := range []string{"github1", "github2", "github3", "github4"} {
+		fake.AddMember(login, "MEMBER")
+	}
+	return fake
+}
+
+func helperNewGoliacOnFakeGithub(t *testing.T, fake *githubfake.Server) *GoliacImpl {
+	client, err := github.NewGitHubClientImpl(fake.URL, github.NewTokenAuthenticator(fake.Token, "goliac-project-app", "the fake token"))
+	assert.Nil(t, err)
+	usersync.InitPlugins(client)
+
+	return &GoliacImpl{
+		local:              engine.NewGoliacLocalImpl(),
+		remote:             engine.NewGoliacRemoteImpl(client),
+		remoteGithubClient: client,
+		localGithubClient:  client,
+		repoconfig:         &config.RepositoryConfig{},
+	}
+}
+
+func TestGoliacEndToEnd(t *testing.T) {
+
+	t.Run("happy path: plan and apply on an empty organization", func(t *testing.T) {
+		fake := helperNewFakeGithub(t)
+
+		fs := memfs.New()
+		fs.MkdirAll("src", 0755)        // create a fake bare repository
+		fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+		fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+		srcsFs, _ := fs.Chroot("src")
+		clonedFs, _ := fs.Chroot("teams")
+		_, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, repoFixture1)
+		assert.Nil(t, err)
+
+		// plan
+		goliac := helperNewGoliacOnFakeGithub(t, fake)
+		plan, err, errs, _ := goliac.Plan(context.Background(), fs, "inmemory:///src", "master")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(errs))
+		assert.NotNil(t, plan)
+		assert.Equal(t, 4, plan.Summary().ByGroup["teams"].Changes) // team1, team2 and their owners teams
+		created := []string{}
+		for _, record := range plan.Repositories {
+			if record.Operation == "create_repository" {
+				created = append(created, record.Resource)
+			}
+		}
+		assert.ElementsMatch(t, []string{"repo1", "repo2"}, created)
+		assert.Equal(t, 1, plan.Summary().ByGroup["rulesets"].Changes)
+		assert.Equal(t, 0, plan.Summary().Destructive)
+
+		// the plan didn't change anything
+		fake.Lock()
+		assert.Equal(t, 1, len(fake.Teams)) // admin
+		assert.Equal(t, 1, len(fake.Repositories))
+		fake.Unlock()
+
+		// apply
+		err, errs, _, _ = goliac.Apply(context.Background(), fs, false, "inmemory:///src", "master")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(errs))
+
+		fake.Lock()
+		assert.Equal(t, 5, len(fake.Teams))
+		team1 := fake.Teams["team1"]
+		assert.NotNil(t, team1)
+		assert.Equal(t, map[string]string{"github1": "member", "github2": "member"}, team1.Members)
+		assert.Equal(t, "push", team1.Repositories["repo1"])
+		assert.NotNil(t, fake.Teams["team1-goliac-owners"])
+		assert.Equal(t, "push", fake.Teams["team1-goliac-owners"].Repositories["src"])
+
+		assert.Equal(t, 3, len(fake.Repositories))
+		assert.NotNil(t, fake.Repositories["repo2"])
+		assert.Equal(t, "push", fake.Teams["team2"].Repositories["repo2"])
+
+		assert.Equal(t, 1, len(fake.Rulesets))
+		for _, ruleset := range fake.Rulesets {
+			assert.Equal(t, "default", ruleset.Name)
+			assert.Equal(t, "active", ruleset.Enforcement)
+			assert.Equal(t, 1, len(ruleset.BypassActors))
+		}
+
+		// the teams repository is protected
+		assert.Equal(t, false, fake.Repositories["src"].Settings["allow_merge_commit"])
+		assert.NotNil(t, fake.Repositories["src"].BranchProtections["master"])
+		fake.Unlock()
+
+		// a new Goliac (without cache) loads the organization back from Github: nothing left to do
+		goliac = helperNewGoliacOnFakeGithub(t, fake)
+		plan, err, errs, _ = goliac.Plan(context.Background(), fs, "inmemory:///src", "master")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(errs))
+		assert.Equal(t, 0, plan.Summary().Changes)
+	})
+
+	t.Run("happy path: apply removes a team member", func(t *testing.T) {
+		fake := helperNewFakeGithub(t)
+		fake.AddMember("github5", "MEMBER")
+
+		fs := memfs.New()
+		fs.MkdirAll("src", 0755)        // create a fake bare repository
+		fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+		fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+		srcsFs, _ := fs.Chroot("src")
+		clonedFs, _ := fs.Chroot("teams")
+		_, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, repoFixture1)
+		assert.Nil(t, err)
+
+		goliac := helperNewGoliacOnFakeGithub(t, fake)
+		err, _, _, _ = goliac.Apply(context.Background(), fs, false, "inmemory:///src", "master")
+		assert.Nil(t, err)
+
+		// someone adds github5 to team1 manually
+		fake.Lock()
+		fake.Teams["team1"].Members["github5"] = "member"
+		fake.Unlock()
+
+		goliac = helperNewGoliacOnFakeGithub(t, fake)
+		err, _, _, _ = goliac.Apply(context.Background(), fs, false, "inmemory:///src", "master")
+		assert.Nil(t, err)
+
+		fake.Lock()
+		defer fake.Unlock()
+		assert.Equal(t, map[string]string{"github1": "member", "github2": "member"}, fake.Teams["team1"].Members)
+	})
+
+	t.Run("happy path: a recorded plan is replayed offline", func(t *testing.T) {
+		fake := helperNewFakeGithub(t)
+		previousDir := config.Config.GithubRecordDir
+		config.Config.GithubRecordDir = t.TempDir()
+		t.Cleanup(func() {
+			config.Config.GithubRecordDir = previousDir
+		})
+
+		fs := memfs.New()
+		fs.MkdirAll("src", 0755)        // create a fake bare repository
+		fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+		fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+		srcsFs, _ := fs.Chroot("src")
+		clonedFs, _ := fs.Chroot("teams")
+		_, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, repoFixture1)
+		assert.Nil(t, err)
+
+		goliac := helperNewGoliacOnFakeGithub(t, fake)
+		recorded, err, _, _ := goliac.Plan(context.Background(), fs, "inmemory:///src", "master")
+		assert.Nil(t, err)
+
+		// Github is gone
+		fake.Close()
+		cassettes, _ := filepath.Glob(filepath.Join(config.Config.GithubRecordDir, "*.cassette"))
+		assert.Equal(t, 1, len(cassettes))
+
+		replay, err := NewGoliacReplayImpl(cassettes[0], "")
+		assert.Nil(t, err)
+		replayed, err, _, _ := replay.Plan(context.Background(), fs, "inmemory:///src", "master")
+		assert.Nil(t, err)
+		assert.Equal(t, recorded.Summary(), replayed.Summary())
+		assert.ElementsMatch(t, recorded.Repositories, replayed.Repositories) // the reconciliation order is not stable
+	})
+
+	t.Run("happy path: apply custom properties", func(t *testing.T) {
+		fake := helperNewFakeGithub(t)
+
+		fs := memfs.New()
+		fs.MkdirAll("src", 0755)        // create a fake bare repository
+		fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+		fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+		srcsFs, _ := fs.Chroot("src")
+		clonedFs, _ := fs.Chroot("teams")
+		_, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, func(fs billy.Filesystem) {
+			repoFixture1(fs)
+			fs.MkdirAll("custom_properties", 0755)
+			utils.WriteFile(fs, "custom_properties/tier.yaml", []byte(`apiVersion: v1
+kind: CustomProperty
+name: tier
+spec:
+  value_type: single_select
+  allowed_values:
+    - gold
+    - silver
+`), 0644)
+			utils.WriteFile(fs, "custom_properties/data-classification.yaml", []byte(`apiVersion: v1
+kind: CustomProperty
+name: data-classification
+spec:
+  value_type: multi_select
+  allowed_values:
+    - pii
+    - public
+`), 0644)
+			utils.WriteFile(fs, "teams/team1/repo1.yaml", []byte(`apiVersion: v1
+kind: Repository
+name: repo1
+spec:
+  properties:
+    tier: gold
+    data-classification:
+      - pii
+`), 0644)
+		})
+		assert.Nil(t, err)
+
+		goliac := helperNewGoliacOnFakeGithub(t, fake)
+		err, errs, _, _ := goliac.Apply(context.Background(), fs, false, "inmemory:///src", "master")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(errs))
+
+		fake.Lock()
+		assert.Equal(t, 2, len(fake.Properties))
+		assert.Equal(t, "gold", fake.Repositories["repo1"].Properties["tier"])
+		assert.Equal(t, []interface{}{"pii"}, fake.Repositories["repo1"].Properties["data-classification"])
+		assert.Equal(t, 0, len(fake.Repositories["repo2"].Properties))
+		fake.Unlock()
+
+		// a new Goliac (without cache) loads the custom properties back from Github: nothing left to do
+		goliac = helperNewGoliacOnFakeGithub(t, fake)
+		plan, err, errs, _ := goliac.Plan(context.Background(), fs, "inmemory:///src", "master")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(errs))
+		assert.Equal(t, 0, plan.Summary().Changes)
+	})
+
+	t.Run("happy path: plan offline against an exported snapshot", func(t *testing.T) {
+		fake := helperNewFakeGithub(t)
+		fake.AddMember("github5", "MEMBER")
+
+		fs := memfs.New()
+		fs.MkdirAll("src", 0755)        // create a fake bare repository
+		fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+		fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+		srcsFs, _ := fs.Chroot("src")
+		clonedFs, _ := fs.Chroot("teams")
+		_, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, repoFixture1)
+		assert.Nil(t, err)
+
+		goliac := helperNewGoliacOnFakeGithub(t, fake)
+		err, _, _, _ = goliac.Apply(context.Background(), fs, false, "inmemory:///src", "master")
+		assert.Nil(t, err)
+
+		// someone changes Github manually
+		fake.Lock()
+		fake.Teams["team1"].Members["github5"] = "member"
+		fake.Teams["team2"].Repositories["repo1"] = "admin"
+		fake.Unlock()
+
+		goliac = helperNewGoliacOnFakeGithub(t, fake)
+		online, err, _, _ := goliac.Plan(context.Background(), fs, "inmemory:///src", "master")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, online.Summary().Changes)
+
+		// export the organization, and plan the teams directory without Github
+		onlineRemote := goliac.remote
+		content, err := engine.NewOrgSnapshot(context.Background(), onlineRemote, "goliac-project").ToJSON()
+		assert.Nil(t, err)
+		snapshot := filepath.Join(t.TempDir(), "org.json")
+		assert.Nil(t, os.WriteFile(snapshot, content, 0644))
+		fake.Close()
+
+		// the name of the teams repository can't be guessed from the local directory
+		offline, err := NewGoliacOfflineImpl(snapshot, "")
+		assert.Nil(t, err)
+		_, err, _, _ = offline.Plan(context.Background(), fs, "src", "")
+		assert.NotNil(t, err)
+
+		offline, err = NewGoliacOfflineImpl(snapshot, "src")
+		assert.Nil(t, err)
+		plan, err, _, _ := offline.Plan(context.Background(), fs, "src", "")
+		assert.Nil(t, err)
+		assert.Equal(t, online.Summary(), plan.Summary())
+		assert.ElementsMatch(t, online.Teams, plan.Teams)
+		assert.ElementsMatch(t, online.Repositories, plan.Repositories)
+
+		// or recorded in the snapshot at export
+		recorded := engine.NewOrgSnapshot(context.Background(), onlineRemote, "goliac-project")
+		recorded.TeamsRepository = "src"
+		content, err = recorded.ToJSON()
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(snapshot, content, 0644))
+		withName, err := NewGoliacOfflineImpl(snapshot, "")
+		assert.Nil(t, err)
+		recordedPlan, err, _, _ := withName.Plan(context.Background(), fs, "src", "")
+		assert.Nil(t, err)
+		assert.Equal(t, online.Summary(), recordedPlan.Summary())
+
+		// but it can't apply
+		err, _, _, _ = offline.Apply(context.Background(), fs, false, "src", "")
+		assert.NotNil(t, err)
+	})
+}
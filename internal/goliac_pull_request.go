@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/Alayacare/goliac/internal/engine"
+	"github.com/go-git/go-billy/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// hidden marker used to find (and update) the goliac comment on a PR
+	PULL_REQUEST_COMMENT_MARKER = "<!-- goliac-plan -->"
+	// Github limits the check run summary to 65535 characters
+	CHECK_RUN_SUMMARY_MAX_LENGTH = 65000
+)
+
+/*
+ * PlanPullRequest clones the head commit of a teams repo PR, validates it and computes
+ * the changes it would do (without touching Github).
+ * The result is published as a check run (named after GOLIAC_SERVER_PR_REQUIRED_CHECK)
+ * and as a PR comment.
+ */
+func (g *GoliacImpl) PlanPullRequest(ctx context.Context, fs billy.Filesystem, repositoryUrl string, pr PullRequest) error {
+	// we work on a dedicated local clone (to not interfere with the main branch state),
+	// at the commit the check run is published on (the branch may have moved since the event)
+	prGoliac := &GoliacImpl{
+		local:              engine.NewGoliacLocalImpl(),
+		remote:             g.remote,
+		localGithubClient:  g.localGithubClient,
+		remoteGithubClient: g.remoteGithubClient,
+		repoconfig:         &config.RepositoryConfig{},
+		feedback:           nil,
+		commit:             pr.HeadSha,
+	}
+
+	var plan *engine.Plan
+	var err error
+	var errs []error
+	if pr.Fork {
+		// the head branch can't be cloned from the teams repository
+		err = fmt.Errorf("pull requests from a fork are not supported: push the branch to the teams repository")
+	} else {
+		plan, err, errs, _ = prGoliac.Plan(ctx, fs, repositoryUrl, pr.HeadRef)
+	}
+
+	var conclusion, title, report string
+	if err != nil {
+		conclusion = "failure"
+		title = "Goliac validation failed"
+		var sb strings.Builder
+		sb.WriteString("## Goliac validation failed\n\n")
+		if len(errs) == 0 {
+			errs = []error{err}
+		}
+		for _, e := range errs {
+			sb.WriteString(fmt.Sprintf("- %s\n", e.Error()))
+		}
+		report = sb.String()
+	} else {
+		summary := plan.Summary()
+		conclusion = "success"
+		title = fmt.Sprintf("%d change(s), %d destructive", summary.Changes, summary.Destructive)
+		report = plan.ToMarkdown()
+	}
+
+	if err := g.publishPullRequestCheckRun(ctx, pr, conclusion, title, report); err != nil {
+		return fmt.Errorf("not able to publish the check run on PR #%d: %v", pr.Number, err)
+	}
+	if err := g.publishPullRequestComment(ctx, pr, report); err != nil {
+		return fmt.Errorf("not able to comment PR #%d: %v", pr.Number, err)
+	}
+	return nil
+}
+
+func (g *GoliacImpl) publishPullRequestCheckRun(ctx context.Context, pr PullRequest, conclusion string, title string, report string) error {
+	if len(report) > CHECK_RUN_SUMMARY_MAX_LENGTH {
+		report = report[:CHECK_RUN_SUMMARY_MAX_LENGTH] + "\n\n(truncated)"
+	}
+
+	// https://docs.github.com/en/rest/checks/runs?apiVersion=2022-11-28#create-a-check-run
+	_, err := g.remoteGithubClient.CallRestAPI(ctx,
+		fmt.Sprintf("/repos/%s/%s/check-runs", config.Config.GithubAppOrganization, pr.Repository),
+		"",
+		"POST",
+		map[string]interface{}{
+			"name":       config.Config.ServerGitBranchProtectionRequiredCheck,
+			"head_sha":   pr.HeadSha,
+			"status":     "completed",
+			"conclusion": conclusion,
+			"output": map[string]interface{}{
+				"title":   title,
+				"summary": report,
+			},
+		})
+	return err
+}
+
+func (g *GoliacImpl) publishPullRequestComment(ctx context.Context, pr PullRequest, report string) error {
+	body := PULL_REQUEST_COMMENT_MARKER + "\n" + report
+
+	type comment struct {
+		Id   int    `json:"id"`
+		Body string `json:"body"`
+	}
+	comments := []comment{}
+	for page := 1; page <= engine.FORLOOP_STOP; page++ {
+		// https://docs.github.com/en/rest/issues/comments?apiVersion=2022-11-28#list-issue-comments
+		data, err := g.remoteGithubClient.CallRestAPI(ctx,
+			fmt.Sprintf("/repos/%s/%s/issues/%d/comments", config.Config.GithubAppOrganization, pr.Repository, pr.Number),
+			fmt.Sprintf("page=%d&per_page=100", page),
+			"GET",
+			nil)
+		if err != nil {
+			return err
+		}
+
+		var pageComments []comment
+		if err := json.Unmarshal(data, &pageComments); err != nil {
+			logrus.Debugf("not able to parse the PR #%d comments: %v", pr.Number, err)
+		}
+		comments = append(comments, pageComments...)
+		if len(pageComments) < 100 {
+			break
+		}
+	}
+
+	// we update our previous comment (if any) instead of adding a new one on each push
+	for _, c := range comments {
+		if strings.HasPrefix(c.Body, PULL_REQUEST_COMMENT_MARKER) {
+			// https://docs.github.com/en/rest/issues/comments?apiVersion=2022-11-28#update-an-issue-comment
+			_, err := g.remoteGithubClient.CallRestAPI(ctx,
+				fmt.Sprintf("/repos/%s/%s/issues/comments/%d", config.Config.GithubAppOrganization, pr.Repository, c.Id),
+				"",
+				"PATCH",
+				map[string]interface{}{"body": body})
+			return err
+		}
+	}
+
+	// https://docs.github.com/en/rest/issues/comments?apiVersion=2022-11-28#create-an-issue-comment
+	_, err := g.remoteGithubClient.CallRestAPI(ctx,
+		fmt.Sprintf("/repos/%s/%s/issues/%d/comments", config.Config.GithubAppOrganization, pr.Repository, pr.Number),
+		"",
+		"POST",
+		map[string]interface{}{"body": body})
+	return err
+}
@@ -0,0 +1,311 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/Alayacare/goliac/internal/engine"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+type restCall struct {
+	endpoint string
+	method   string
+	body     map[string]interface{}
+}
+
+// GitHubClientMock that records the REST calls
+type GitHubClientRecorderMock struct {
+	GitHubClientMock
+	calls        []restCall
+	comments     string            // json list of the existing PR comments
+	commentPages map[string]string // or the existing PR comments, by page parameters
+}
+
+func (c *GitHubClientRecorderMock) CallRestAPI(ctx context.Context, endpoint, parameters, method string, body map[string]interface{}) ([]byte, error) {
+	c.calls = append(c.calls, restCall{endpoint: endpoint, method: method, body: body})
+	if method == "GET" && strings.HasSuffix(endpoint, "/comments") {
+		if c.commentPages != nil {
+			return []byte(c.commentPages[parameters]), nil
+		}
+		return []byte(c.comments), nil
+	}
+	return nil, nil
+}
+
+// create a PR branch (on the src repository) with the content of repoFixtureRename
+func helperCreatePullRequestBranch(t *testing.T, repo *git.Repository, branch string) plumbing.Hash {
+	worktree, err := repo.Worktree()
+	assert.Nil(t, err)
+	repoFixtureRename(worktree.Filesystem)
+	_, err = worktree.Add(".")
+	assert.Nil(t, err)
+	hash, err := worktree.Commit("rename repo2", &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  "user1",
+			Email: "user1@example.com",
+			When:  time.Now(),
+		},
+	})
+	assert.Nil(t, err)
+	err = repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(branch), hash))
+	assert.Nil(t, err)
+	return hash
+}
+
+func TestGoliacPlanPullRequest(t *testing.T) {
+
+	t.Run("happy path: publish the plan of a PR", func(t *testing.T) {
+		fs := memfs.New()
+		fs.MkdirAll("src", 0755)        // create a fake bare repository
+		fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+		fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+		srcsFs, _ := fs.Chroot("src")
+		clonedFs, _ := fs.Chroot("teams")
+		repo, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, repoFixture1)
+		assert.Nil(t, err)
+		hash := helperCreatePullRequestBranch(t, repo, "pr-branch")
+
+		githubClient := &GitHubClientRecorderMock{comments: "[]"}
+		remote := NewGoliacRemoteExecutorMock().(*GoliacRemoteExecutorMock)
+		local := engine.NewGoliacLocalImpl()
+
+		goliac := GoliacImpl{
+			local:              local,
+			remote:             remote,
+			remoteGithubClient: githubClient,
+			localGithubClient:  githubClient,
+			repoconfig:         &config.RepositoryConfig{},
+		}
+
+		err = goliac.PlanPullRequest(context.Background(), fs, "inmemory:///src", PullRequest{
+			Repository: "src",
+			Number:     3,
+			HeadRef:    "pr-branch",
+			HeadSha:    hash.String(),
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, remote.nbChanges)          // nothing applied
+		assert.Equal(t, 0, len(local.Repositories())) // the main local state was not touched
+
+		assert.Equal(t, 3, len(githubClient.calls))
+		checkrun := githubClient.calls[0]
+		assert.Equal(t, "POST", checkrun.method)
+		assert.Equal(t, "/repos//src/check-runs", checkrun.endpoint)
+		assert.Equal(t, "success", checkrun.body["conclusion"])
+		assert.Equal(t, hash.String(), checkrun.body["head_sha"])
+		assert.Equal(t, "1 change(s), 0 destructive", checkrun.body["output"].(map[string]interface{})["title"])
+
+		comment := githubClient.calls[2]
+		assert.Equal(t, "POST", comment.method)
+		assert.Equal(t, "/repos//src/issues/3/comments", comment.endpoint)
+		assert.True(t, strings.Contains(comment.body["body"].(string), "rename_repository"))
+	})
+
+	t.Run("happy path: update the previous goliac comment", func(t *testing.T) {
+		fs := memfs.New()
+		fs.MkdirAll("src", 0755)        // create a fake bare repository
+		fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+		fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+		srcsFs, _ := fs.Chroot("src")
+		clonedFs, _ := fs.Chroot("teams")
+		repo, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, repoFixture1)
+		assert.Nil(t, err)
+		hash := helperCreatePullRequestBranch(t, repo, "pr-branch")
+
+		githubClient := &GitHubClientRecorderMock{comments: `[{"id": 1, "body": "LGTM"}, {"id": 42, "body": "<!-- goliac-plan -->\nold plan"}]`}
+
+		goliac := GoliacImpl{
+			local:              engine.NewGoliacLocalImpl(),
+			remote:             NewGoliacRemoteExecutorMock(),
+			remoteGithubClient: githubClient,
+			localGithubClient:  githubClient,
+			repoconfig:         &config.RepositoryConfig{},
+		}
+
+		err = goliac.PlanPullRequest(context.Background(), fs, "inmemory:///src", PullRequest{
+			Repository: "src",
+			Number:     3,
+			HeadRef:    "pr-branch",
+			HeadSha:    hash.String(),
+		})
+		assert.Nil(t, err)
+
+		assert.Equal(t, 3, len(githubClient.calls))
+		comment := githubClient.calls[2]
+		assert.Equal(t, "PATCH", comment.method)
+		assert.Equal(t, "/repos//src/issues/comments/42", comment.endpoint)
+	})
+
+	t.Run("happy path: find the previous goliac comment on a long PR", func(t *testing.T) {
+		fs := memfs.New()
+		fs.MkdirAll("src", 0755)        // create a fake bare repository
+		fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+		fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+		srcsFs, _ := fs.Chroot("src")
+		clonedFs, _ := fs.Chroot("teams")
+		repo, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, repoFixture1)
+		assert.Nil(t, err)
+		hash := helperCreatePullRequestBranch(t, repo, "pr-branch")
+
+		firstPage := make([]string, 0, 100)
+		for i := 1; i <= 100; i++ {
+			firstPage = append(firstPage, fmt.Sprintf(`{"id": %d, "body": "LGTM"}`, i))
+		}
+		githubClient := &GitHubClientRecorderMock{commentPages: map[string]string{
+			"page=1&per_page=100": "[" + strings.Join(firstPage, ",") + "]",
+			"page=2&per_page=100": `[{"id": 142, "body": "<!-- goliac-plan -->\nold plan"}]`,
+		}}
+
+		goliac := GoliacImpl{
+			local:              engine.NewGoliacLocalImpl(),
+			remote:             NewGoliacRemoteExecutorMock(),
+			remoteGithubClient: githubClient,
+			localGithubClient:  githubClient,
+			repoconfig:         &config.RepositoryConfig{},
+		}
+
+		err = goliac.PlanPullRequest(context.Background(), fs, "inmemory:///src", PullRequest{
+			Repository: "src",
+			Number:     3,
+			HeadRef:    "pr-branch",
+			HeadSha:    hash.String(),
+		})
+		assert.Nil(t, err)
+
+		assert.Equal(t, 4, len(githubClient.calls))
+		comment := githubClient.calls[3]
+		assert.Equal(t, "PATCH", comment.method)
+		assert.Equal(t, "/repos//src/issues/comments/142", comment.endpoint)
+	})
+
+	t.Run("happy path: the PR head commit is planned, even if the branch moved", func(t *testing.T) {
+		fs := memfs.New()
+		fs.MkdirAll("src", 0755)        // create a fake bare repository
+		fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+		fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+		srcsFs, _ := fs.Chroot("src")
+		clonedFs, _ := fs.Chroot("teams")
+		repo, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, repoFixture1)
+		assert.Nil(t, err)
+		hash := helperCreatePullRequestBranch(t, repo, "pr-branch")
+
+		// an (invalid) commit pushed after the event
+		worktree, err := repo.Worktree()
+		assert.Nil(t, err)
+		f, err := srcsFs.Create("teams/team2/repo3.yaml")
+		assert.Nil(t, err)
+		f.Write([]byte("apiVersion: v1\nkind: Repository\nname: repo3\nspec:\n  readers:\n    - unknownteam\n"))
+		f.Close()
+		_, err = worktree.Add(".")
+		assert.Nil(t, err)
+		newHash, err := worktree.Commit("add repo3", &git.CommitOptions{
+			Author: &object.Signature{Name: "user1", Email: "user1@example.com", When: time.Now()},
+		})
+		assert.Nil(t, err)
+		err = repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("pr-branch"), newHash))
+		assert.Nil(t, err)
+
+		githubClient := &GitHubClientRecorderMock{comments: "[]"}
+		goliac := GoliacImpl{
+			local:              engine.NewGoliacLocalImpl(),
+			remote:             NewGoliacRemoteExecutorMock(),
+			remoteGithubClient: githubClient,
+			localGithubClient:  githubClient,
+			repoconfig:         &config.RepositoryConfig{},
+		}
+
+		err = goliac.PlanPullRequest(context.Background(), fs, "inmemory:///src", PullRequest{
+			Repository: "src",
+			Number:     3,
+			HeadRef:    "pr-branch",
+			HeadSha:    hash.String(),
+		})
+		assert.Nil(t, err)
+
+		checkrun := githubClient.calls[0]
+		assert.Equal(t, "success", checkrun.body["conclusion"])
+		assert.Equal(t, hash.String(), checkrun.body["head_sha"])
+	})
+
+	t.Run("not happy path: PR from a fork", func(t *testing.T) {
+		githubClient := &GitHubClientRecorderMock{comments: "[]"}
+		goliac := GoliacImpl{
+			local:              engine.NewGoliacLocalImpl(),
+			remote:             NewGoliacRemoteExecutorMock(),
+			remoteGithubClient: githubClient,
+			localGithubClient:  githubClient,
+			repoconfig:         &config.RepositoryConfig{},
+		}
+
+		err := goliac.PlanPullRequest(context.Background(), memfs.New(), "inmemory:///src", PullRequest{
+			Repository: "src",
+			Number:     5,
+			HeadRef:    "main",
+			HeadSha:    "0123456789012345678901234567890123456789",
+			Fork:       true,
+		})
+		assert.Nil(t, err)
+
+		checkrun := githubClient.calls[0]
+		assert.Equal(t, "failure", checkrun.body["conclusion"])
+		assert.True(t, strings.Contains(checkrun.body["output"].(map[string]interface{})["summary"].(string), "fork"))
+	})
+
+	t.Run("not happy path: invalid PR", func(t *testing.T) {
+		fs := memfs.New()
+		fs.MkdirAll("src", 0755)        // create a fake bare repository
+		fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+		fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+		srcsFs, _ := fs.Chroot("src")
+		clonedFs, _ := fs.Chroot("teams")
+		repo, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, repoFixture1)
+		assert.Nil(t, err)
+
+		// a repository owned by an unknown team
+		worktree, err := repo.Worktree()
+		assert.Nil(t, err)
+		f, err := srcsFs.Create("teams/team2/repo3.yaml")
+		assert.Nil(t, err)
+		f.Write([]byte("apiVersion: v1\nkind: Repository\nname: repo3\nspec:\n  readers:\n    - unknownteam\n"))
+		f.Close()
+		_, err = worktree.Add(".")
+		assert.Nil(t, err)
+		hash, err := worktree.Commit("add repo3", &git.CommitOptions{
+			Author: &object.Signature{Name: "user1", Email: "user1@example.com", When: time.Now()},
+		})
+		assert.Nil(t, err)
+		err = repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("pr-branch"), hash))
+		assert.Nil(t, err)
+
+		githubClient := &GitHubClientRecorderMock{comments: "[]"}
+		goliac := GoliacImpl{
+			local:              engine.NewGoliacLocalImpl(),
+			remote:             NewGoliacRemoteExecutorMock(),
+			remoteGithubClient: githubClient,
+			localGithubClient:  githubClient,
+			repoconfig:         &config.RepositoryConfig{},
+		}
+
+		err = goliac.PlanPullRequest(context.Background(), fs, "inmemory:///src", PullRequest{
+			Repository: "src",
+			Number:     4,
+			HeadRef:    "pr-branch",
+			HeadSha:    hash.String(),
+		})
+		assert.Nil(t, err)
+
+		checkrun := githubClient.calls[0]
+		assert.Equal(t, "failure", checkrun.body["conclusion"])
+		assert.True(t, strings.Contains(checkrun.body["output"].(map[string]interface{})["summary"].(string), "unknownteam"))
+	})
+}
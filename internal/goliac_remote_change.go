@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Alayacare/goliac/internal/engine"
+	"github.com/Alayacare/goliac/internal/entity"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+ * ReconcileRemoteChange refreshes (in the remote cache) the entity changed directly on Github
+ * and reverts the change if it drifts from the teams repo.
+ * It relies on the local state loaded during the last Apply, and only touches
+ * the changed entity. It returns the number of operations done to revert the change.
+ */
+func (g *GoliacImpl) ReconcileRemoteChange(ctx context.Context, repositoryUrl string, change RemoteChangeEvent) (int, error) {
+	// we don't want to react to our own changes
+	login, err := g.authenticatedLogin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("not able to know who we are authenticated as: %v", err)
+	}
+	if change.Sender == login {
+		return 0, nil
+	}
+
+	teamreponame, err := teamsRepoName(repositoryUrl)
+	if err != nil {
+		return 0, err
+	}
+
+	scope, err := g.refreshRemoteChange(ctx, change)
+	if err != nil {
+		return 0, fmt.Errorf("not able to refresh the %s event entity: %v", change.Event, err)
+	}
+	if scope.IsEmpty() {
+		return 0, nil
+	}
+
+	ga := NewGithubBatchExecutor(g.remote, g.repoconfig.MaxChangesets, g.repoconfig.GithubConcurrentThreads, g.repoconfig.TransactionalApply)
+	executor := engine.NewScopedExecutor(ga, scope)
+	reconciliator := engine.NewGoliacReconciliatorImpl(executor, g.repoconfig)
+
+	// archiving/renaming repositories needs a commit on the teams repo: this is left to the next Apply
+	reposToArchive := make(map[string]*engine.GithubRepoComparable)
+	reposToRename := make(map[string]*entity.Repository)
+	_, err = reconciliator.Reconciliate(ctx, g.local, g.remote, teamreponame, false, g.repoconfig.AdminTeam, reposToArchive, reposToRename)
+	if err != nil {
+		return 0, fmt.Errorf("error when reconciliating the %s event: %w", change.Event, err)
+	}
+
+	return executor.Changes(), nil
+}
+
+/*
+ * authenticatedLogin returns the Github login of our own changes (the sender of
+ * the webhook events they trigger): the Github App bot, or the owner of the
+ * personal access token
+ */
+func (g *GoliacImpl) authenticatedLogin(ctx context.Context) (string, error) {
+	if slug := g.remoteGithubClient.GetAppSlug(); slug != "" {
+		return slug + "[bot]", nil
+	}
+
+	g.remoteLoginMutex.Lock()
+	defer g.remoteLoginMutex.Unlock()
+	if g.remoteLogin != "" {
+		return g.remoteLogin, nil
+	}
+
+	// https://docs.github.com/en/rest/users/users?apiVersion=2022-11-28#get-the-authenticated-user
+	body, err := g.remoteGithubClient.CallRestAPI(ctx, "/user", "", "GET", nil)
+	if err != nil {
+		return "", fmt.Errorf("not able to get the authenticated user: %v. %s", err, string(body))
+	}
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := json.Unmarshal(body, &user); err != nil {
+		return "", fmt.Errorf("not able to get the authenticated user: %v", err)
+	}
+	if user.Login == "" {
+		return "", fmt.Errorf("not able to get the authenticated user: no login returned")
+	}
+	g.remoteLogin = user.Login
+	return g.remoteLogin, nil
+}
+
+/*
+ * refreshRemoteChange updates the remote cache for the entity targeted by the event
+ * and returns the scope to reconcile
+ */
+func (g *GoliacImpl) refreshRemoteChange(ctx context.Context, change RemoteChangeEvent) (*engine.ReconcileScope, error) {
+	scope := engine.NewReconcileScope()
+
+	refreshRepository := func(reponame string) error {
+		if reponame == "" {
+			return nil
+		}
+		scope.Repositories[reponame] = true
+		return g.remote.RefreshRepository(ctx, reponame)
+	}
+	refreshTeam := func(teamslug string) error {
+		if teamslug == "" {
+			return nil
+		}
+		scope.Teams[teamslug] = true
+		return g.remote.RefreshTeam(ctx, teamslug)
+	}
+
+	// https://docs.github.com/en/webhooks/webhook-events-and-payloads
+	switch change.Event {
+	case "member":
+		// collaborator added/removed/changed on a repository
+		return scope, refreshRepository(change.Repository)
+	case "membership":
+		// user added/removed from a team
+		return scope, refreshTeam(change.Team)
+	case "team":
+		if err := refreshTeam(change.Team); err != nil {
+			return scope, err
+		}
+		// added_to_repository, removed_from_repository
+		return scope, refreshRepository(change.Repository)
+	case "team_add":
+		if change.Team != "" {
+			scope.Teams[change.Team] = true
+		}
+		return scope, refreshRepository(change.Repository)
+	case "repository":
+		if err := refreshRepository(change.PreviousName); err != nil {
+			return scope, err
+		}
+		return scope, refreshRepository(change.Repository)
+	case "organization":
+		// member_added, member_removed, member_invited
+		if change.User == "" {
+			return scope, nil
+		}
+		scope.Users[change.User] = true
+		return scope, g.remote.RefreshUser(ctx, change.User)
+	case "repository_ruleset":
+		if change.Repository != "" {
+			return scope, refreshRepository(change.Repository)
+		}
+		scope.Rulesets = true
+		return scope, g.remote.RefreshRulesets(ctx)
+	default:
+		logrus.Debugf("remote change event %s not supported", change.Event)
+	}
+	return scope, nil
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/Alayacare/goliac/internal/engine"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func helperRemoteChangeGoliac(t *testing.T) (*GoliacImpl, *GoliacRemoteExecutorMock) {
+	fs := memfs.New()
+	fs.MkdirAll("src", 0755)        // create a fake bare repository
+	fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+	fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+	srcsFs, _ := fs.Chroot("src")
+	clonedFs, _ := fs.Chroot("teams")
+	_, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, repoFixtureRename)
+	assert.Nil(t, err)
+
+	// the local state loaded by the last apply
+	local := engine.NewGoliacLocalImpl()
+	errs, warns := local.LoadAndValidateLocal(clonedFs)
+	assert.Equal(t, 0, len(errs))
+	assert.Equal(t, 0, len(warns))
+
+	githubClient := NewGitHubClientMock()
+	remote := NewGoliacRemoteExecutorMock().(*GoliacRemoteExecutorMock)
+
+	return &GoliacImpl{
+		local:              local,
+		remote:             remote,
+		remoteGithubClient: githubClient,
+		localGithubClient:  githubClient,
+		repoconfig:         &config.RepositoryConfig{MaxChangesets: 50},
+	}, remote
+}
+
+/*
+ * GitHubClientPATMock is authenticated with a personal access token (not as a Github App)
+ */
+type GitHubClientPATMock struct {
+	GitHubClientMock
+	userCalls int
+}
+
+func (c *GitHubClientPATMock) GetAppSlug() string {
+	return ""
+}
+
+func (c *GitHubClientPATMock) CallRestAPI(ctx context.Context, endpoint, parameters, method string, body map[string]interface{}) ([]byte, error) {
+	if endpoint == "/user" {
+		c.userCalls++
+		return []byte(`{"login":"goliac-admin-bot"}`), nil
+	}
+	return c.GitHubClientMock.CallRestAPI(ctx, endpoint, parameters, method, body)
+}
+
+func TestReconcileRemoteChange(t *testing.T) {
+
+	t.Run("happy path: repository event only reverts the repository", func(t *testing.T) {
+		goliac, remote := helperRemoteChangeGoliac(t)
+
+		// repo2 is expected to be renamed into repo3,
+		// but the event is about repo1 (which doesn't drift)
+		changes, err := goliac.ReconcileRemoteChange(context.Background(), "inmemory:///src", RemoteChangeEvent{
+			Event:      "repository",
+			Action:     "edited",
+			Sender:     "alice",
+			Repository: "repo1",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, changes)
+		assert.Equal(t, 0, remote.nbChanges)
+		assert.Equal(t, []string{"repository:repo1"}, remote.refreshed)
+
+		changes, err = goliac.ReconcileRemoteChange(context.Background(), "inmemory:///src", RemoteChangeEvent{
+			Event:      "repository",
+			Action:     "edited",
+			Sender:     "alice",
+			Repository: "repo2",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, changes)
+		assert.Equal(t, 1, remote.nbChanges)
+	})
+
+	t.Run("happy path: team_add event", func(t *testing.T) {
+		goliac, remote := helperRemoteChangeGoliac(t)
+
+		changes, err := goliac.ReconcileRemoteChange(context.Background(), "inmemory:///src", RemoteChangeEvent{
+			Event:      "team_add",
+			Sender:     "alice",
+			Repository: "repo1",
+			Team:       "team1",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, changes)
+		assert.Equal(t, []string{"repository:repo1"}, remote.refreshed)
+	})
+
+	t.Run("happy path: organization event refreshes the user", func(t *testing.T) {
+		goliac, remote := helperRemoteChangeGoliac(t)
+
+		_, err := goliac.ReconcileRemoteChange(context.Background(), "inmemory:///src", RemoteChangeEvent{
+			Event:  "organization",
+			Action: "member_added",
+			Sender: "alice",
+			User:   "github1",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"user:github1"}, remote.refreshed)
+	})
+
+	t.Run("happy path: our own changes are ignored", func(t *testing.T) {
+		goliac, remote := helperRemoteChangeGoliac(t)
+
+		changes, err := goliac.ReconcileRemoteChange(context.Background(), "inmemory:///src", RemoteChangeEvent{
+			Event:      "repository",
+			Action:     "edited",
+			Sender:     "goliac-project-app[bot]",
+			Repository: "repo2",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, changes)
+		assert.Equal(t, 0, len(remote.refreshed))
+		assert.Equal(t, 0, remote.nbChanges)
+	})
+
+	t.Run("happy path: our own changes are ignored with a personal access token", func(t *testing.T) {
+		goliac, remote := helperRemoteChangeGoliac(t)
+		githubClient := &GitHubClientPATMock{}
+		goliac.remoteGithubClient = githubClient
+
+		for i := 0; i < 2; i++ {
+			changes, err := goliac.ReconcileRemoteChange(context.Background(), "inmemory:///src", RemoteChangeEvent{
+				Event:      "repository",
+				Action:     "edited",
+				Sender:     "goliac-admin-bot",
+				Repository: "repo2",
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, 0, changes)
+		}
+		assert.Equal(t, 0, len(remote.refreshed))
+		// the authenticated user is only fetched once
+		assert.Equal(t, 1, githubClient.userCalls)
+	})
+}
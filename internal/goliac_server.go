@@ -2,9 +2,11 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -12,7 +14,9 @@ import (
 	"github.com/Alayacare/goliac/internal/config"
 	"github.com/Alayacare/goliac/internal/engine"
 	"github.com/Alayacare/goliac/internal/entity"
+	"github.com/Alayacare/goliac/internal/github"
 	"github.com/Alayacare/goliac/internal/notification"
+	"github.com/Alayacare/goliac/internal/utils"
 	"github.com/Alayacare/goliac/swagger_gen/models"
 	"github.com/Alayacare/goliac/swagger_gen/restapi"
 	"github.com/Alayacare/goliac/swagger_gen/restapi/operations"
@@ -52,13 +56,16 @@ type GoliacServer interface {
 
 type GoliacServerImpl struct {
 	goliac              Goliac
+	goliacMutex         sync.Mutex // to serialize the goliac operations (apply and pull requests plan)
 	applyLobbyMutex     sync.Mutex
 	applyLobbyCond      *sync.Cond
 	applyCurrent        bool
 	applyLobby          bool
-	ready               bool // when the server has finished to load the local configuration
+	ready               bool       // when the server has finished to load the local configuration
+	syncStatusMutex     sync.Mutex // guards lastSyncTime and lastSyncError (read by the webhook goroutines)
 	lastSyncTime        *time.Time
 	lastSyncError       error
+	lastApplyFailures   []GithubCommandFailure // operations that failed on Github during the last sync
 	detailedErrors      []error
 	detailedWarnings    []entity.Warning
 	syncInterval        int64 // in seconds time remaining between 2 sync
@@ -68,6 +75,9 @@ type GoliacServerImpl struct {
 	lastTimeToApply     time.Duration
 	maxTimeToApply      time.Duration
 	lastUnmanaged       *engine.UnmanagedResources
+	resumedApply        *InterruptedApply // the apply interrupted before the server started (if any)
+	resumedApplyTime    *time.Time
+	secretsWatcher      *utils.SecretsWatcher // reloads the rotated secret files
 }
 
 func NewGoliacServer(goliac Goliac, notificationService notification.NotificationService) GoliacServer {
@@ -76,6 +86,7 @@ func NewGoliacServer(goliac Goliac, notificationService notification.Notificatio
 		goliac:              goliac,
 		ready:               false,
 		notificationService: notificationService,
+		secretsWatcher:      utils.DefaultSecretsWatcher,
 	}
 	server.applyLobbyCond = sync.NewCond(&server.applyLobbyMutex)
 
@@ -117,16 +128,50 @@ func (g *GoliacServerImpl) GetUnmanaged(app.GetUnmanagedParams) middleware.Respo
 }
 
 func (g *GoliacServerImpl) GetStatistics(app.GetStatiticsParams) middleware.Responder {
+	entitiesFetched := make(map[string]int64)
+	for kind, nb := range g.lastStatistics.EntitiesFetched {
+		entitiesFetched[kind] = int64(nb)
+	}
+	rateLimits := g.goliac.GetRateLimits()
+	restRemaining, restReset := rateLimitStatistics(rateLimits, github.RATELIMIT_REST)
+	graphqlRemaining, graphqlReset := rateLimitStatistics(rateLimits, github.RATELIMIT_GRAPHQL)
 	return app.NewGetStatiticsOK().WithPayload(&models.Statistics{
-		LastTimeToApply:     g.lastTimeToApply.Truncate(time.Second).String(),
-		LastGithubAPICalls:  int64(g.lastStatistics.GithubApiCalls),
-		LastGithubThrottled: int64(g.lastStatistics.GithubThrottled),
-		MaxTimeToApply:      g.maxTimeToApply.Truncate(time.Second).String(),
-		MaxGithubAPICalls:   int64(g.maxStatistics.GithubApiCalls),
-		MaxGithubThrottled:  int64(g.maxStatistics.GithubThrottled),
+		GithubRestRemaining:     restRemaining,
+		GithubRestReset:         restReset,
+		GithubGraphqlRemaining:  graphqlRemaining,
+		GithubGraphqlReset:      graphqlReset,
+		LastTimeToApply:         g.lastTimeToApply.Truncate(time.Second).String(),
+		LastEntitiesFetched:     entitiesFetched,
+		LastGithubAPICalls:      int64(g.lastStatistics.GithubApiCalls),
+		LastGithubThrottled:     int64(g.lastStatistics.GithubThrottled),
+		LastGithubRetries:       int64(g.lastStatistics.GithubRetries),
+		LastGithubCacheHits:     int64(g.lastStatistics.GithubCacheHits),
+		LastGithubCacheHitRatio: cacheHitRatio(g.lastStatistics),
+		MaxTimeToApply:          g.maxTimeToApply.Truncate(time.Second).String(),
+		MaxGithubAPICalls:       int64(g.maxStatistics.GithubApiCalls),
+		MaxGithubThrottled:      int64(g.maxStatistics.GithubThrottled),
+		MaxGithubRetries:        int64(g.maxStatistics.GithubRetries),
 	})
 }
 
+// cacheHitRatio returns the percentage of the GET calls answered from the http cache (304)
+func cacheHitRatio(stats config.GoliacStatistics) int64 {
+	total := stats.GithubCacheHits + stats.GithubCacheMisses
+	if total == 0 {
+		return 0
+	}
+	return int64(stats.GithubCacheHits * 100 / total)
+}
+
+// rateLimitStatistics returns the budget left of a Github API, and when it is reset (-1 if unknown)
+func rateLimitStatistics(rateLimits github.RateLimits, api string) (int64, string) {
+	budget, known := rateLimits.Get(api)
+	if !known {
+		return -1, ""
+	}
+	return int64(budget.Remaining), budget.Reset.UTC().Format(time.RFC3339)
+}
+
 func (g *GoliacServerImpl) GetRepositories(app.GetRepositoriesParams) middleware.Responder {
 	local := g.goliac.GetLocal()
 	repositories := make(models.Repositories, 0, len(local.Repositories()))
@@ -134,7 +179,7 @@ func (g *GoliacServerImpl) GetRepositories(app.GetRepositoriesParams) middleware
 	for _, r := range local.Repositories() {
 		repo := models.Repository{
 			Name:     r.Name,
-			Public:   r.Spec.IsPublic,
+			Public:   r.Visibility() == "public",
 			Archived: r.Archived,
 		}
 		repositories = append(repositories, &repo)
@@ -197,7 +242,7 @@ func (g *GoliacServerImpl) GetRepository(params app.GetRepositoryParams) middlew
 
 	repositoryDetails := models.RepositoryDetails{
 		Name:                repository.Name,
-		Public:              repository.Spec.IsPublic,
+		Public:              repository.Visibility() == "public",
 		AutoMergeAllowed:    repository.Spec.AllowAutoMerge,
 		DeleteBranchOnMerge: repository.Spec.DeleteBranchOnMerge,
 		AllowUpdateBranch:   repository.Spec.AllowUpdateBranch,
@@ -294,7 +339,7 @@ func (g *GoliacServerImpl) GetTeam(params app.GetTeamParams) middleware.Responde
 		r := models.Repository{
 			Name:                reponame,
 			Archived:            repo.Archived,
-			Public:              repo.Spec.IsPublic,
+			Public:              repo.Visibility() == "public",
 			AutoMergeAllowed:    repo.Spec.AllowAutoMerge,
 			DeleteBranchOnMerge: repo.Spec.DeleteBranchOnMerge,
 			AllowUpdateBranch:   repo.Spec.AllowUpdateBranch,
@@ -432,7 +477,7 @@ func (g *GoliacServerImpl) GetCollaborator(params app.GetCollaboratorParams) mid
 			if r == params.CollaboratorID {
 				collaboratordetails.Repositories = append(collaboratordetails.Repositories, &models.Repository{
 					Name:     repo.Name,
-					Public:   repo.Spec.IsPublic,
+					Public:   repo.Visibility() == "public",
 					Archived: repo.Archived,
 				})
 			}
@@ -441,7 +486,7 @@ func (g *GoliacServerImpl) GetCollaborator(params app.GetCollaboratorParams) mid
 			if r == params.CollaboratorID {
 				collaboratordetails.Repositories = append(collaboratordetails.Repositories, &models.Repository{
 					Name:     repo.Name,
-					Public:   repo.Spec.IsPublic,
+					Public:   repo.Visibility() == "public",
 					Archived: repo.Archived,
 				})
 			}
@@ -547,7 +592,7 @@ func (g *GoliacServerImpl) GetUser(params app.GetUserParams) middleware.Responde
 	for _, r := range userRepos {
 		repo := models.Repository{
 			Name:     r.Name,
-			Public:   r.Spec.IsPublic,
+			Public:   r.Visibility() == "public",
 			Archived: r.Archived,
 		}
 		userdetails.Repositories = append(userdetails.Repositories, &repo)
@@ -567,9 +612,19 @@ func (g *GoliacServerImpl) GetStatus(app.GetStatusParams) middleware.Responder {
 		Version:          config.GoliacBuildVersion,
 		DetailedErrors:   make([]string, 0),
 		DetailedWarnings: make([]string, 0),
+		FailedOperations: make([]*models.StatusFailedOperationsItems0, 0),
+	}
+	g.syncStatusMutex.Lock()
+	lastSyncTime, lastSyncError := g.lastSyncTime, g.lastSyncError
+	g.syncStatusMutex.Unlock()
+	if lastSyncError != nil {
+		s.LastSyncError = lastSyncError.Error()
 	}
-	if g.lastSyncError != nil {
-		s.LastSyncError = g.lastSyncError.Error()
+	for _, f := range g.lastApplyFailures {
+		s.FailedOperations = append(s.FailedOperations, &models.StatusFailedOperationsItems0{
+			Operation: f.Command,
+			Error:     f.Err.Error(),
+		})
 	}
 	if g.detailedErrors != nil {
 		for _, err := range g.detailedErrors {
@@ -581,8 +636,22 @@ func (g *GoliacServerImpl) GetStatus(app.GetStatusParams) middleware.Responder {
 			s.DetailedWarnings = append(s.DetailedWarnings, warn.Error())
 		}
 	}
-	if g.lastSyncTime != nil {
-		s.LastSyncTime = g.lastSyncTime.UTC().Format("2006-01-02T15:04:05")
+	if lastSyncTime != nil {
+		s.LastSyncTime = lastSyncTime.UTC().Format("2006-01-02T15:04:05")
+	}
+	if g.resumedApply != nil && g.resumedApplyTime != nil {
+		s.ResumedRun = fmt.Sprintf("apply of commit %s interrupted after %d/%d operation(s) (started at %s), resumed at %s",
+			g.resumedApply.Commit,
+			g.resumedApply.Completed,
+			len(g.resumedApply.Planned),
+			g.resumedApply.StartedAt.UTC().Format("2006-01-02T15:04:05"),
+			g.resumedApplyTime.UTC().Format("2006-01-02T15:04:05"))
+		s.ResumedPendingOperations = g.resumedApply.Pending
+	}
+	if g.secretsWatcher != nil {
+		for _, rotation := range g.secretsWatcher.Rotations() {
+			s.SecretsRotations = append(s.SecretsRotations, fmt.Sprintf("%s rotated at %s", rotation.Secret, rotation.RotatedAt.UTC().Format("2006-01-02T15:04:05")))
+		}
 	}
 	return app.NewGetStatusOK().WithPayload(&s)
 }
@@ -632,22 +701,38 @@ func (g *GoliacServerImpl) Serve() {
 		logrus.Warn("Github webhook server port is the same as the Swagger port, the webhook server will not be started")
 	}
 
+	webhookSecret, err := loadWebhookSecret()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	g.secretsWatcher.Watch(webhookSecret)
+
 	var webhookserver GithubWebhookServer
 	if config.Config.GithubWebhookDedicatedHost != "" &&
 		config.Config.GithubWebhookDedicatedPort != 0 &&
 		config.Config.GithubWebhookPath != "" &&
-		config.Config.GithubWebhookSecret != "" &&
+		len(webhookSecret.Get()) > 0 &&
 		config.Config.GithubWebhookDedicatedPort != config.Config.SwaggerPort {
 		webhookserver = NewGithubWebhookServerImpl(
 			config.Config.GithubWebhookDedicatedHost,
 			config.Config.GithubWebhookDedicatedPort,
 			config.Config.GithubWebhookPath,
-			config.Config.GithubWebhookSecret,
+			webhookSecret,
 			config.Config.ServerGitBranch, func() {
 				// when receiving a Github webhook event
 				// let's start the apply process asynchronously
 				go g.triggerApply()
 			},
+			func(pr PullRequest) {
+				// when a teams repo PR is opened or updated
+				// let's validate and plan it asynchronously
+				go g.triggerPullRequestPlan(pr)
+			},
+			func(change RemoteChangeEvent) {
+				// when something is changed directly on Github
+				// let's revert it (if needed) asynchronously
+				go g.triggerRemoteChange(change)
+			},
 		)
 		go func() {
 			if err := webhookserver.Start(); err != nil {
@@ -657,7 +742,16 @@ func (g *GoliacServerImpl) Serve() {
 		}()
 	}
 
+	// reload the secret files (Github App private keys, webhook secret, slack token) when they are rotated
+	if config.Config.SecretsReloadInterval > 0 {
+		go g.secretsWatcher.Start(time.Duration(config.Config.SecretsReloadInterval)*time.Second, stopCh)
+	}
+
 	logrus.Info("Server started")
+
+	// if the previous server was stopped in the middle of an apply, the first sync will resume it
+	g.resumeInterruptedApply()
+
 	// Start the goroutine
 	wg.Add(1)
 	go func() {
@@ -701,6 +795,17 @@ inside serverApply, it will check if the lobby is free
 - if the lobby is free, it will start the apply process
 - if the lobby is busy, it will do nothing
 */
+/*
+loadWebhookSecret returns the secret to validate the Github webhook events:
+GOLIAC_GITHUB_WEBHOOK_SECRET_FILE (reloaded when rotated) takes precedence over GOLIAC_GITHUB_WEBHOOK_SECRET
+*/
+func loadWebhookSecret() (*utils.Secret, error) {
+	if config.Config.GithubWebhookSecretFile != "" {
+		return utils.NewSecretFile("GOLIAC_GITHUB_WEBHOOK_SECRET_FILE", config.Config.GithubWebhookSecretFile)
+	}
+	return utils.NewStaticSecret("GOLIAC_GITHUB_WEBHOOK_SECRET", []byte(config.Config.GithubWebhookSecret)), nil
+}
+
 func (g *GoliacServerImpl) triggerApply() {
 	err, errs, warns, applied := g.serveApply()
 	if !applied && err == nil {
@@ -708,15 +813,29 @@ func (g *GoliacServerImpl) triggerApply() {
 		g.syncInterval = config.Config.ServerApplyInterval
 	} else {
 		now := time.Now()
+		g.syncStatusMutex.Lock()
 		g.lastSyncTime = &now
 		previousError := g.lastSyncError
 		g.lastSyncError = err
+		g.syncStatusMutex.Unlock()
+		g.lastApplyFailures = nil
+		var applyErr *ApplyError
+		if errors.As(err, &applyErr) {
+			g.lastApplyFailures = applyErr.Failures
+			for _, f := range applyErr.RollbackFailures {
+				g.lastApplyFailures = append(g.lastApplyFailures, GithubCommandFailure{Command: "undo " + f.Command, Err: f.Err})
+			}
+		}
 		g.detailedErrors = errs
 		g.detailedWarnings = warns
 		// log the error only if it's a new one
 		if err != nil && (previousError == nil || err.Error() != previousError.Error()) {
 			logrus.Error(err)
-			if err := g.notificationService.SendNotification(fmt.Sprintf("Goliac error when syncing: %s", err)); err != nil {
+			message := fmt.Sprintf("Goliac error when syncing: %s", err)
+			if applyErr != nil {
+				message = applyFailuresMessage("Goliac failed to apply some changes on Github when syncing", applyErr)
+			}
+			if err := g.notificationService.SendNotification(message); err != nil {
 				logrus.Error(err)
 			}
 		}
@@ -724,6 +843,159 @@ func (g *GoliacServerImpl) triggerApply() {
 	}
 }
 
+/*
+applyFailuresMessage formats the failed operations of an apply (one per line)
+to be sent as a notification
+*/
+func applyFailuresMessage(title string, applyErr *ApplyError) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s (%d operation(s) failed, %d applied):\n", title, len(applyErr.Failures), applyErr.Applied))
+	for _, f := range applyErr.Failures {
+		sb.WriteString(fmt.Sprintf("- %s: %v\n", f.Command, f.Err))
+	}
+	if applyErr.RolledBack > 0 || len(applyErr.RollbackFailures) > 0 {
+		sb.WriteString(fmt.Sprintf("%d applied operation(s) rolled back, %d could not be undone:\n", applyErr.RolledBack, len(applyErr.RollbackFailures)))
+		for _, f := range applyErr.RollbackFailures {
+			sb.WriteString(fmt.Sprintf("- %s: %v\n", f.Command, f.Err))
+		}
+	}
+	return sb.String()
+}
+
+/*
+appliedCommitsMessage formats the audit of the teams repo commits applied one by one
+(one per line) to be sent as a notification. It returns "" if nothing was done
+*/
+func appliedCommitsMessage(commits []AppliedCommit) string {
+	var sb strings.Builder
+	for _, c := range commits {
+		if c.Skipped != nil {
+			sb.WriteString(fmt.Sprintf("- %s: skipped (%v)\n", c.String(), c.Skipped))
+		} else if c.Operations > 0 {
+			sb.WriteString(fmt.Sprintf("- %s: %d operation(s)\n", c.String(), c.Operations))
+		}
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "Goliac applied the teams repo commits:\n" + sb.String()
+}
+
+/*
+resumeInterruptedApply checks (from the apply journal) if the previous server was
+stopped in the middle of an apply. The first sync (at startup) reconciles Github
+from its current state, and so applies what was left.
+*/
+func (g *GoliacServerImpl) resumeInterruptedApply() {
+	interrupted, err := g.goliac.ResumeInterruptedApply()
+	if err != nil {
+		logrus.Warnf("not able to check for an interrupted apply: %v", err)
+		return
+	}
+	if interrupted == nil {
+		return
+	}
+	now := time.Now()
+	g.resumedApply = interrupted
+	g.resumedApplyTime = &now
+
+	message := interruptedApplyMessage(interrupted)
+	if err := g.notificationService.SendNotification(message); err != nil {
+		logrus.Error(err)
+	}
+}
+
+// the interrupted apply notification lists (up to) this number of operations not done
+const MAX_NOTIFIED_PENDING_OPERATIONS = 20
+
+/*
+interruptedApplyMessage describes the interrupted apply, with the operations
+that were not done (the first sync applies them, if they are still needed)
+*/
+func interruptedApplyMessage(interrupted *InterruptedApply) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Goliac was restarted in the middle of applying commit %s (%d/%d operation(s) done): resuming it", interrupted.Commit, interrupted.Completed, len(interrupted.Planned)))
+	if len(interrupted.Pending) > 0 {
+		sb.WriteString(". Operations not done:\n")
+		for i, command := range interrupted.Pending {
+			if i == MAX_NOTIFIED_PENDING_OPERATIONS {
+				sb.WriteString(fmt.Sprintf("- ... and %d more\n", len(interrupted.Pending)-i))
+				break
+			}
+			sb.WriteString("- " + command + "\n")
+		}
+	}
+	return sb.String()
+}
+
+/*
+triggerPullRequestPlan will validate and plan a teams repo pull request
+and publish the result (check run and PR comment) on the PR
+*/
+func (g *GoliacServerImpl) triggerPullRequestPlan(pr PullRequest) {
+	teamreponame, err := teamsRepoName(config.Config.ServerGitRepository)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	// the webhook can be configured at the organization level
+	if pr.Repository != teamreponame {
+		return
+	}
+
+	g.goliacMutex.Lock()
+	defer g.goliacMutex.Unlock()
+
+	logrus.Infof("planning pull request #%d (%s)", pr.Number, pr.HeadSha)
+	fs := osfs.New("/")
+	if err := g.goliac.PlanPullRequest(context.Background(), fs, config.Config.ServerGitRepository, pr); err != nil {
+		logrus.Errorf("failed to plan pull request #%d: %v", pr.Number, err)
+	}
+}
+
+/*
+triggerRemoteChange will refresh the entity changed directly on Github
+and revert the change (if it drifts from the teams repo)
+*/
+func (g *GoliacServerImpl) triggerRemoteChange(change RemoteChangeEvent) {
+	// we need a successful apply to know the expected (local) state
+	g.syncStatusMutex.Lock()
+	synced := g.lastSyncTime != nil && g.lastSyncError == nil
+	g.syncStatusMutex.Unlock()
+	if !synced {
+		logrus.Debugf("skipping %s event: no successful sync yet", change.Event)
+		return
+	}
+
+	g.goliacMutex.Lock()
+	defer g.goliacMutex.Unlock()
+
+	stats := config.GoliacStatistics{}
+	ctx := context.WithValue(context.Background(), config.ContextKeyStatistics, &stats)
+
+	changes, err := g.goliac.ReconcileRemoteChange(ctx, config.Config.ServerGitRepository, change)
+	if err != nil {
+		logrus.Errorf("failed to reconcile the %s event from %s: %v", change.Event, change.Sender, err)
+		var applyErr *ApplyError
+		if errors.As(err, &applyErr) {
+			message := applyFailuresMessage(fmt.Sprintf("Goliac failed to revert the change done directly on Github by %s (%s %s)", change.Sender, change.Event, change.Action), applyErr)
+			if err := g.notificationService.SendNotification(message); err != nil {
+				logrus.Error(err)
+			}
+		}
+		return
+	}
+	if changes == 0 {
+		return
+	}
+
+	message := fmt.Sprintf("Goliac reverted %d change(s) done directly on Github by %s (%s %s)", changes, change.Sender, change.Event, change.Action)
+	logrus.Info(message)
+	if err := g.notificationService.SendNotification(message); err != nil {
+		logrus.Error(err)
+	}
+}
+
 func (g *GoliacServerImpl) StartRESTApi() (*restapi.Server, error) {
 	swaggerSpec, err := loads.Embedded(restapi.SwaggerJSON, restapi.FlatSwaggerJSON)
 	if err != nil {
@@ -813,14 +1085,27 @@ func (g *GoliacServerImpl) serveApply() (error, []error, []entity.Warning, bool)
 	ctx := context.WithValue(context.Background(), config.ContextKeyStatistics, &stats)
 
 	fs := osfs.New("/")
+	g.goliacMutex.Lock()
 	err, errs, warns, unmanaged := g.goliac.Apply(ctx, fs, false, repo, branch)
+	appliedCommits := g.goliac.GetLastAppliedCommits()
+	g.goliacMutex.Unlock()
+	// the audit trail of the teams repo commits (even if the apply failed afterwards)
+	if message := appliedCommitsMessage(appliedCommits); message != "" {
+		if err := g.notificationService.SendNotification(message); err != nil {
+			logrus.Error(err)
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("failed to apply on branch %s: %s", branch, err), errs, warns, false
+		return fmt.Errorf("failed to apply on branch %s: %w", branch, err), errs, warns, false
 	}
 	endTime := time.Now()
 	g.lastTimeToApply = endTime.Sub(startTime)
 	g.lastStatistics.GithubApiCalls = stats.GithubApiCalls
 	g.lastStatistics.GithubThrottled = stats.GithubThrottled
+	g.lastStatistics.GithubRetries = stats.GithubRetries
+	g.lastStatistics.GithubCacheHits = stats.GithubCacheHits
+	g.lastStatistics.GithubCacheMisses = stats.GithubCacheMisses
+	g.lastStatistics.EntitiesFetched = stats.EntitiesFetched
 
 	if g.lastTimeToApply > g.maxTimeToApply {
 		g.maxTimeToApply = g.lastTimeToApply
@@ -834,6 +1119,10 @@ func (g *GoliacServerImpl) serveApply() (error, []error, []entity.Warning, bool)
 		g.maxStatistics.GithubThrottled = stats.GithubThrottled
 	}
 
+	if stats.GithubRetries > g.maxStatistics.GithubRetries {
+		g.maxStatistics.GithubRetries = stats.GithubRetries
+	}
+
 	if unmanaged != nil {
 		g.lastUnmanaged = unmanaged
 	}
@@ -2,6 +2,10 @@ package internal
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -9,9 +13,13 @@ import (
 	"github.com/gosimple/slug"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/Alayacare/goliac/internal/config"
 	"github.com/Alayacare/goliac/internal/engine"
 	"github.com/Alayacare/goliac/internal/entity"
+	"github.com/Alayacare/goliac/internal/github"
+	"github.com/Alayacare/goliac/internal/notification"
 	"github.com/Alayacare/goliac/internal/observability"
+	"github.com/Alayacare/goliac/internal/utils"
 	"github.com/Alayacare/goliac/swagger_gen/restapi/operations/app"
 )
 
@@ -21,6 +29,7 @@ type GoliacLocalMock struct {
 	users         map[string]*entity.User
 	externalUsers map[string]*entity.User
 	rulesets      map[string]*entity.RuleSet
+	properties    map[string]*entity.CustomProperty
 }
 
 func (g *GoliacLocalMock) Teams() map[string]*entity.Team {
@@ -38,6 +47,9 @@ func (g *GoliacLocalMock) ExternalUsers() map[string]*entity.User {
 func (g *GoliacLocalMock) RuleSets() map[string]*entity.RuleSet {
 	return g.rulesets
 }
+func (g *GoliacLocalMock) CustomProperties() map[string]*entity.CustomProperty {
+	return g.properties
+}
 
 func fixtureGoliacLocal() (*GoliacLocalMock, *GoliacRemoteMock) {
 	// local mock
@@ -135,8 +147,9 @@ func (g *GoliacRemoteMock) Teams(ctx context.Context, current bool) map[string]*
 }
 
 type GoliacMock struct {
-	local  engine.GoliacLocalResources
-	remote engine.GoliacRemoteResources
+	local      engine.GoliacLocalResources
+	remote     engine.GoliacRemoteResources
+	rateLimits github.RateLimits
 }
 
 func (g *GoliacMock) Apply(ctx context.Context, fs billy.Filesystem, dryrun bool, repo string, branch string) (error, []error, []entity.Warning, *engine.UnmanagedResources) {
@@ -149,11 +162,29 @@ func (g *GoliacMock) Apply(ctx context.Context, fs billy.Filesystem, dryrun bool
 	unmanaged.Users["unmanaged"] = true
 	return nil, nil, nil, unmanaged
 }
+func (g *GoliacMock) Plan(ctx context.Context, fs billy.Filesystem, repositoryUrl, branch string) (*engine.Plan, error, []error, []entity.Warning) {
+	return engine.NewPlan(), nil, nil, nil
+}
+func (g *GoliacMock) PlanPullRequest(ctx context.Context, fs billy.Filesystem, repositoryUrl string, pr PullRequest) error {
+	return nil
+}
+func (g *GoliacMock) ReconcileRemoteChange(ctx context.Context, repositoryUrl string, change RemoteChangeEvent) (int, error) {
+	return 0, nil
+}
 func (g *GoliacMock) UsersUpdate(ctx context.Context, fs billy.Filesystem, repositoryUrl, branch string, dryrun bool, force bool) (bool, error) {
 	return false, nil
 }
 func (g *GoliacMock) FlushCache() {
 }
+func (g *GoliacMock) ResumeInterruptedApply() (*InterruptedApply, error) {
+	return nil, nil
+}
+func (g *GoliacMock) GetLastAppliedCommits() []AppliedCommit {
+	return nil
+}
+func (g *GoliacMock) GetRateLimits() github.RateLimits {
+	return g.rateLimits
+}
 
 func (g *GoliacMock) GetLocal() engine.GoliacLocalResources {
 	return g.local
@@ -192,6 +223,28 @@ func TestAppGetUsers(t *testing.T) {
 		assert.Equal(t, int64(1), payload.Payload.NbUsersExternal)
 	})
 
+	t.Run("happy path: get status with a rotated secret", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "slack-token")
+		assert.Nil(t, os.WriteFile(path, []byte("token1"), 0600))
+		secret, err := utils.NewSecretFile("GOLIAC_SLACK_TOKEN_FILE", path)
+		assert.Nil(t, err)
+		server := GoliacServerImpl{
+			goliac:         goliac,
+			ready:          true,
+			secretsWatcher: utils.NewSecretsWatcher(),
+		}
+		server.secretsWatcher.Watch(secret)
+
+		payload := server.GetStatus(app.GetStatusParams{}).(*app.GetStatusOK)
+		assert.Equal(t, 0, len(payload.Payload.SecretsRotations))
+
+		assert.Nil(t, os.WriteFile(path, []byte("token2"), 0600))
+		server.secretsWatcher.Reload()
+		payload = server.GetStatus(app.GetStatusParams{}).(*app.GetStatusOK)
+		assert.Equal(t, 1, len(payload.Payload.SecretsRotations))
+		assert.True(t, strings.HasPrefix(payload.Payload.SecretsRotations[0], "GOLIAC_SLACK_TOKEN_FILE rotated at "))
+	})
+
 	t.Run("happy path: list users", func(t *testing.T) {
 		res := server.GetUsers(app.GetUsersParams{})
 		payload := res.(*app.GetUsersOK)
@@ -206,6 +259,31 @@ func TestAppGetUsers(t *testing.T) {
 		assert.Equal(t, 2, len(payload.Payload.Repositories))
 	})
 }
+func TestAppGetStatistics(t *testing.T) {
+	localfixture, remotefixture := fixtureGoliacLocal()
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	goliac := &GoliacMock{
+		local:  localfixture,
+		remote: remotefixture,
+		rateLimits: github.RateLimits{
+			Rest: &github.RateLimit{Limit: 5000, Remaining: 1234, Reset: reset},
+		},
+	}
+	server := GoliacServerImpl{
+		goliac: goliac,
+	}
+
+	t.Run("happy path: get the API budget", func(t *testing.T) {
+		res := server.GetStatistics(app.GetStatiticsParams{})
+		payload := res.(*app.GetStatiticsOK)
+		assert.Equal(t, int64(1234), payload.Payload.GithubRestRemaining)
+		assert.Equal(t, reset.UTC().Format(time.RFC3339), payload.Payload.GithubRestReset)
+		// no GraphQL call yet
+		assert.Equal(t, int64(-1), payload.Payload.GithubGraphqlRemaining)
+		assert.Equal(t, "", payload.Payload.GithubGraphqlReset)
+	})
+}
+
 func TestAppGetTeams(t *testing.T) {
 	localfixture, remotefixture := fixtureGoliacLocal()
 	goliac := NewGoliacMock(localfixture, remotefixture)
@@ -273,3 +351,45 @@ func TestAppGetRepositories(t *testing.T) {
 		assert.NotZero(t, res.(*app.GetRepositoryDefault))
 	})
 }
+
+/*
+ * to be run with -race: the remote change events (handled in their own goroutine)
+ * arrive while the server applies
+ */
+func TestRemoteChangeDuringApply(t *testing.T) {
+	repository := config.Config.ServerGitRepository
+	branch := config.Config.ServerGitBranch
+	config.Config.ServerGitRepository = "https://github.com/goliac-project/goliac-teams"
+	config.Config.ServerGitBranch = "main"
+	defer func() {
+		config.Config.ServerGitRepository = repository
+		config.Config.ServerGitBranch = branch
+	}()
+
+	localfixture, remotefixture := fixtureGoliacLocal()
+	server := NewGoliacServer(NewGoliacMock(localfixture, remotefixture), notification.NewNullNotificationService()).(*GoliacServerImpl)
+
+	t.Run("happy path: remote changes during an apply", func(t *testing.T) {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				server.triggerApply()
+			}
+		}()
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				server.triggerRemoteChange(RemoteChangeEvent{Event: "repository", Action: "edited", Sender: "user1", Repository: "repoA"})
+			}()
+		}
+		wg.Wait()
+
+		res := server.GetStatus(app.GetStatusParams{})
+		payload := res.(*app.GetStatusOK)
+		assert.Equal(t, "", payload.Payload.LastSyncError)
+		assert.NotEqual(t, "N/A", payload.Payload.LastSyncTime)
+	})
+}
@@ -6,12 +6,14 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/Alayacare/goliac/internal/config"
 	"github.com/Alayacare/goliac/internal/engine"
 	"github.com/Alayacare/goliac/internal/entity"
+	"github.com/Alayacare/goliac/internal/github"
 	"github.com/Alayacare/goliac/internal/observability"
 	"github.com/Alayacare/goliac/internal/usersync"
 	"github.com/Alayacare/goliac/internal/utils"
@@ -360,14 +362,27 @@ func (c *GitHubClientMock) GetAppSlug() string {
 	return "goliac-project-app"
 }
 
+func (c *GitHubClientMock) GetRateLimits() github.RateLimits {
+	return github.RateLimits{}
+}
+
 //
 // remote mock
 //
 
 type GoliacRemoteExecutorMock struct {
-	teams1Members []string
-	teams2Members []string
-	nbChanges     int
+	teams1Members   []string
+	teams2Members   []string
+	nbChanges       int
+	lastCommitAudit *engine.CommitAudit
+	refreshed       []string
+	mutex           sync.Mutex // commands can be applied concurrently
+}
+
+func (e *GoliacRemoteExecutorMock) changed() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.nbChanges++
 }
 
 // GoliacRemoteExecutorMock
@@ -386,6 +401,22 @@ func (e *GoliacRemoteExecutorMock) FlushCache() {
 }
 func (e *GoliacRemoteExecutorMock) FlushCacheUsersTeamsOnly() {
 }
+func (e *GoliacRemoteExecutorMock) RefreshUser(ctx context.Context, login string) error {
+	e.refreshed = append(e.refreshed, "user:"+login)
+	return nil
+}
+func (e *GoliacRemoteExecutorMock) RefreshTeam(ctx context.Context, teamslug string) error {
+	e.refreshed = append(e.refreshed, "team:"+teamslug)
+	return nil
+}
+func (e *GoliacRemoteExecutorMock) RefreshRepository(ctx context.Context, reponame string) error {
+	e.refreshed = append(e.refreshed, "repository:"+reponame)
+	return nil
+}
+func (e *GoliacRemoteExecutorMock) RefreshRulesets(ctx context.Context) error {
+	e.refreshed = append(e.refreshed, "rulesets")
+	return nil
+}
 func (e *GoliacRemoteExecutorMock) Users(ctx context.Context) map[string]string {
 	return map[string]string{
 		"github1": "member",
@@ -457,7 +488,9 @@ func (e *GoliacRemoteExecutorMock) Repositories(ctx context.Context) map[string]
 				"delete_branch_on_merge": false,
 				"allow_update_branch":    false,
 			},
-			ExternalUsers: map[string]string{},
+			Topics:           []string{"backend"},
+			CustomProperties: map[string][]string{"tier": {"gold"}},
+			ExternalUsers:    map[string]string{},
 		},
 		"repo2": {
 			Name:  "repo2",
@@ -532,6 +565,18 @@ func (e *GoliacRemoteExecutorMock) AppIds(ctx context.Context) map[string]int {
 		"goliac-project-app": 1,
 	}
 }
+func (e *GoliacRemoteExecutorMock) CustomProperties(ctx context.Context) map[string]*engine.GithubCustomProperty {
+	return map[string]*engine.GithubCustomProperty{
+		"tier": {
+			Name:          "tier",
+			ValueType:     "single_select",
+			AllowedValues: []string{"gold", "silver", "bronze"},
+		},
+	}
+}
+func (e *GoliacRemoteExecutorMock) CustomPropertiesError() error {
+	return nil
+}
 func (e *GoliacRemoteExecutorMock) IsEnterprise() bool {
 	return true
 }
@@ -541,103 +586,158 @@ func (m *GoliacRemoteExecutorMock) CountAssets(ctx context.Context) (int, error)
 func (g *GoliacRemoteExecutorMock) SetRemoteObservability(feedback observability.RemoteObservability) {
 }
 
-func (e *GoliacRemoteExecutorMock) AddUserToOrg(ctx context.Context, dryrun bool, ghuserid string) {
+func (e *GoliacRemoteExecutorMock) AddUserToOrg(ctx context.Context, dryrun bool, ghuserid string) error {
 	fmt.Println("*** AddUserToOrg", ghuserid)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) RemoveUserFromOrg(ctx context.Context, dryrun bool, ghuserid string) {
+func (e *GoliacRemoteExecutorMock) RemoveUserFromOrg(ctx context.Context, dryrun bool, ghuserid string) error {
 	fmt.Println("*** RemoveUserFromOrg", ghuserid)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
 
-func (e *GoliacRemoteExecutorMock) CreateTeam(ctx context.Context, dryrun bool, teamname string, description string, parentTeam *int, members []string) {
+func (e *GoliacRemoteExecutorMock) CreateTeam(ctx context.Context, dryrun bool, teamname string, description string, parentTeam *int, members []string) error {
 	fmt.Println("*** CreateTeam", teamname, description, parentTeam, members)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) UpdateTeamAddMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) {
+func (e *GoliacRemoteExecutorMock) UpdateTeamAddMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error {
 	fmt.Println("*** UpdateTeamAddMember", teamslug, username, role)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) UpdateTeamUpdateMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) {
+func (e *GoliacRemoteExecutorMock) UpdateTeamUpdateMember(ctx context.Context, dryrun bool, teamslug string, username string, role string) error {
 	fmt.Println("*** UpdateTeamUpdateMember", teamslug, username, role)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) UpdateTeamRemoveMember(ctx context.Context, dryrun bool, teamslug string, username string) {
+func (e *GoliacRemoteExecutorMock) UpdateTeamRemoveMember(ctx context.Context, dryrun bool, teamslug string, username string) error {
 	fmt.Println("*** UpdateTeamRemoveMember", teamslug, username)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) UpdateTeamSetParent(ctx context.Context, dryrun bool, teamslug string, parentTeam *int) {
+func (e *GoliacRemoteExecutorMock) UpdateTeamSetParent(ctx context.Context, dryrun bool, teamslug string, parentTeam *int) error {
 	fmt.Println("*** UpdateTeamSetParent", teamslug, parentTeam)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) DeleteTeam(ctx context.Context, dryrun bool, teamslug string) {
+func (e *GoliacRemoteExecutorMock) DeleteTeam(ctx context.Context, dryrun bool, teamslug string) error {
 	fmt.Println("*** DeleteTeam", teamslug)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
 
-func (e *GoliacRemoteExecutorMock) CreateRepository(ctx context.Context, dryrun bool, reponame string, descrition string, writers []string, readers []string, boolProperties map[string]bool) {
+func (e *GoliacRemoteExecutorMock) CreateRepository(ctx context.Context, dryrun bool, reponame string, descrition string, writers []string, readers []string, boolProperties map[string]bool) error {
 	fmt.Println("*** CreateRepository", reponame, descrition, writers, readers, boolProperties)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) UpdateRepositoryUpdateBoolProperty(ctx context.Context, dryrun bool, reponame string, propertyName string, propertyValue bool) {
+func (e *GoliacRemoteExecutorMock) UpdateRepositoryUpdateBoolProperty(ctx context.Context, dryrun bool, reponame string, propertyName string, propertyValue bool) error {
 	fmt.Println("*** UpdateRepositoryUpdateBoolProperty", reponame, propertyName, propertyValue)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) UpdateRepositoryAddTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) {
+func (e *GoliacRemoteExecutorMock) UpdateRepositoryUpdateStringProperties(ctx context.Context, dryrun bool, reponame string, properties map[string]string) error {
+	fmt.Println("*** UpdateRepositoryUpdateStringProperties", reponame, properties)
+	e.changed()
+	return nil
+}
+func (e *GoliacRemoteExecutorMock) UpdateRepositorySetTopics(ctx context.Context, dryrun bool, reponame string, topics []string) error {
+	fmt.Println("*** UpdateRepositorySetTopics", reponame, topics)
+	e.changed()
+	return nil
+}
+func (e *GoliacRemoteExecutorMock) UpdateRepositorySetCustomProperties(ctx context.Context, dryrun bool, reponame string, properties map[string][]string, valueTypes map[string]string) error {
+	fmt.Println("*** UpdateRepositorySetCustomProperties", reponame, properties)
+	e.changed()
+	return nil
+}
+func (e *GoliacRemoteExecutorMock) UpdateRepositoryAddTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
 	fmt.Println("*** UpdateRepositoryAddTeamAccess", reponame, teamslug, permission)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) UpdateRepositoryUpdateTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) {
+func (e *GoliacRemoteExecutorMock) UpdateRepositoryUpdateTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string, permission string) error {
 	fmt.Println("*** UpdateRepositoryUpdateTeamAccess", reponame, teamslug, permission)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) UpdateRepositoryRemoveTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string) {
+func (e *GoliacRemoteExecutorMock) UpdateRepositoryRemoveTeamAccess(ctx context.Context, dryrun bool, reponame string, teamslug string) error {
 	fmt.Println("*** UpdateRepositoryRemoveTeamAccess", reponame, teamslug)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) AddRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *engine.GithubRuleSet) {
+func (e *GoliacRemoteExecutorMock) AddRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *engine.GithubRuleSet) error {
 	fmt.Println("*** AddRepositoryRuleset", reponame, ruleset.Name)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) UpdateRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *engine.GithubRuleSet) {
+func (e *GoliacRemoteExecutorMock) UpdateRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, ruleset *engine.GithubRuleSet) error {
 	fmt.Println("*** UpdateRepositoryRuleset", reponame, ruleset.Name)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) DeleteRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, rulesetid int) {
+func (e *GoliacRemoteExecutorMock) DeleteRepositoryRuleset(ctx context.Context, dryrun bool, reponame string, rulesetid int) error {
 	fmt.Println("*** DeleteRepositoryRuleset", reponame, rulesetid)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) AddRuleset(ctx context.Context, dryrun bool, ruleset *engine.GithubRuleSet) {
+func (e *GoliacRemoteExecutorMock) AddRuleset(ctx context.Context, dryrun bool, ruleset *engine.GithubRuleSet) error {
 	fmt.Println("*** AddRuleset", ruleset.Name)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) UpdateRuleset(ctx context.Context, dryrun bool, ruleset *engine.GithubRuleSet) {
+func (e *GoliacRemoteExecutorMock) UpdateRuleset(ctx context.Context, dryrun bool, ruleset *engine.GithubRuleSet) error {
 	fmt.Println("*** UpdateRuleset", ruleset.Name)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) DeleteRuleset(ctx context.Context, dryrun bool, rulesetid int) {
+func (e *GoliacRemoteExecutorMock) DeleteRuleset(ctx context.Context, dryrun bool, rulesetid int) error {
 	fmt.Println("*** DeleteRuleset", rulesetid)
-	e.nbChanges++
+	e.changed()
+	return nil
+}
+func (e *GoliacRemoteExecutorMock) AddCustomProperty(ctx context.Context, dryrun bool, property *engine.GithubCustomProperty) error {
+	fmt.Println("*** AddCustomProperty", property.Name)
+	e.changed()
+	return nil
+}
+func (e *GoliacRemoteExecutorMock) UpdateCustomProperty(ctx context.Context, dryrun bool, property *engine.GithubCustomProperty) error {
+	fmt.Println("*** UpdateCustomProperty", property.Name)
+	e.changed()
+	return nil
+}
+func (e *GoliacRemoteExecutorMock) DeleteCustomProperty(ctx context.Context, dryrun bool, propertyname string) error {
+	fmt.Println("*** DeleteCustomProperty", propertyname)
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) UpdateRepositorySetExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string, permission string) {
+func (e *GoliacRemoteExecutorMock) UpdateRepositorySetExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string, permission string) error {
 	fmt.Println("*** UpdateRepositorySetExternalUser", reponame, githubid, permission)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) UpdateRepositoryRemoveExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) {
+func (e *GoliacRemoteExecutorMock) UpdateRepositoryRemoveExternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error {
 	fmt.Println("*** UpdateRepositoryRemoveExternalUser", reponame, githubid)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) UpdateRepositoryRemoveInternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) {
+func (e *GoliacRemoteExecutorMock) UpdateRepositoryRemoveInternalUser(ctx context.Context, dryrun bool, reponame string, githubid string) error {
 	fmt.Println("*** UpdateRepositoryRemoveInternalUser", reponame, githubid)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) DeleteRepository(ctx context.Context, dryrun bool, reponame string) {
+func (e *GoliacRemoteExecutorMock) DeleteRepository(ctx context.Context, dryrun bool, reponame string) error {
 	fmt.Println("*** DeleteRepository", reponame)
-	e.nbChanges++
+	e.changed()
+	return nil
 }
-func (e *GoliacRemoteExecutorMock) RenameRepository(ctx context.Context, dryrun bool, reponame string, newname string) {
+func (e *GoliacRemoteExecutorMock) RenameRepository(ctx context.Context, dryrun bool, reponame string, newname string) error {
 	fmt.Println("*** RenameRepository", reponame, newname)
-	e.nbChanges++
+	e.changed()
+	e.lastCommitAudit = engine.GetCommitAudit(ctx)
+	return nil
 }
 
 func (e *GoliacRemoteExecutorMock) Begin(dryrun bool) {
@@ -769,4 +869,288 @@ func TestGoliacApply(t *testing.T) {
 		assert.Equal(t, 2, remote.nbChanges)
 
 	})
+	t.Run("happy path: apply commit by commit", func(t *testing.T) {
+		config.Config.ApplyCommitByCommit = true
+		defer func() { config.Config.ApplyCommitByCommit = false }()
+
+		fs := memfs.New()
+		fs.MkdirAll("src", 0755)        // create a fake bare repository
+		fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+		fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+		srcsFs, _ := fs.Chroot("src")
+		clonedFs, _ := fs.Chroot("teams")
+		repo, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, repoFixture1)
+		assert.Nil(t, err)
+
+		// the initial commit was already applied
+		head, err := repo.Head()
+		assert.Nil(t, err)
+		_, err = repo.CreateTag(GOLIAC_GIT_TAG, head.Hash(), nil)
+		assert.Nil(t, err)
+
+		// a PR renaming repo2 was squashed and merged since
+		repoFixtureRename(srcsFs)
+		worktree, err := repo.Worktree()
+		assert.Nil(t, err)
+		_, err = worktree.Add(".")
+		assert.Nil(t, err)
+		hash, err := worktree.Commit("rename repo2 (#42)", &git.CommitOptions{
+			Author: &object.Signature{
+				Name:  "user1",
+				Email: "user1@example.com",
+				When:  time.Now(),
+			},
+		})
+		assert.Nil(t, err)
+		err = repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("master"), hash))
+		assert.Nil(t, err)
+
+		local := engine.NewGoliacLocalImpl()
+
+		githubClient := NewGitHubClientMock()
+		remote := NewGoliacRemoteExecutorMock().(*GoliacRemoteExecutorMock)
+
+		usersync.InitPlugins(githubClient)
+
+		goliac := GoliacImpl{
+			local:              local,
+			remote:             remote,
+			remoteGithubClient: githubClient,
+			localGithubClient:  githubClient,
+			repoconfig:         &config.RepositoryConfig{},
+		}
+
+		err, errs, warns, unmanaged := goliac.Apply(context.Background(), fs, false, "inmemory:///src", "master")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(errs))
+		assert.Equal(t, 0, len(warns))
+		assert.NotNil(t, unmanaged)
+		assert.Equal(t, 1, remote.nbChanges) // 1 repo renamed
+
+		// the mutation is attributed to the PR commit
+		assert.NotNil(t, remote.lastCommitAudit)
+		assert.Equal(t, hash.String(), remote.lastCommitAudit.CommitHash)
+		assert.Equal(t, "user1 <user1@example.com>", remote.lastCommitAudit.Author)
+		assert.Equal(t, 42, remote.lastCommitAudit.PullRequest)
+
+		// and the goliac tag was moved
+		tag, err := repo.Tag(GOLIAC_GIT_TAG)
+		assert.Nil(t, err)
+		assert.NotEqual(t, head.Hash(), tag.Hash())
+
+		assert.Equal(t, 1, len(goliac.GetLastAppliedCommits()))
+		assert.Equal(t, 1, goliac.GetLastAppliedCommits()[0].Operations)
+	})
+
+	t.Run("not happy path: apply commit by commit with an invalid commit", func(t *testing.T) {
+		config.Config.ApplyCommitByCommit = true
+		defer func() { config.Config.ApplyCommitByCommit = false }()
+
+		fs := memfs.New()
+		fs.MkdirAll("src", 0755)        // create a fake bare repository
+		fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+		fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+		srcsFs, _ := fs.Chroot("src")
+		clonedFs, _ := fs.Chroot("teams")
+		repo, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, repoFixture1)
+		assert.Nil(t, err)
+
+		head, err := repo.Head()
+		assert.Nil(t, err)
+		_, err = repo.CreateTag(GOLIAC_GIT_TAG, head.Hash(), nil)
+		assert.Nil(t, err)
+
+		worktree, err := repo.Worktree()
+		assert.Nil(t, err)
+		commit := func(message string) plumbing.Hash {
+			_, err = worktree.Add(".")
+			assert.Nil(t, err)
+			hash, err := worktree.Commit(message, &git.CommitOptions{
+				Author: &object.Signature{Name: "user1", Email: "user1@example.com", When: time.Now()},
+			})
+			assert.Nil(t, err)
+			return hash
+		}
+
+		// a repository owned by an unknown team
+		utils.WriteFile(srcsFs, "teams/team2/repo3.yaml", []byte("apiVersion: v1\nkind: Repository\nname: repo3\nspec:\n  readers:\n    - unknownteam\n"), 0644)
+		invalid := commit("add repo3 (#43)")
+		// fixed by the next commit
+		srcsFs.Remove("teams/team2/repo3.yaml")
+		repoFixtureRename(srcsFs)
+		hash := commit("rename repo2 (#44)")
+		err = repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("master"), hash))
+		assert.Nil(t, err)
+
+		githubClient := NewGitHubClientMock()
+		remote := NewGoliacRemoteExecutorMock().(*GoliacRemoteExecutorMock)
+		usersync.InitPlugins(githubClient)
+
+		goliac := GoliacImpl{
+			local:              engine.NewGoliacLocalImpl(),
+			remote:             remote,
+			remoteGithubClient: githubClient,
+			localGithubClient:  githubClient,
+			repoconfig:         &config.RepositoryConfig{},
+		}
+
+		err, errs, warns, _ := goliac.Apply(context.Background(), fs, false, "inmemory:///src", "master")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(errs))
+		assert.Equal(t, 1, remote.nbChanges)
+
+		// the invalid commit is reported (in the warnings, and in the audit)
+		assert.Equal(t, 1, len(warns))
+		assert.True(t, strings.Contains(warns[0].Error(), invalid.String()))
+		commits := goliac.GetLastAppliedCommits()
+		assert.Equal(t, 2, len(commits))
+		assert.NotNil(t, commits[0].Skipped)
+		assert.Equal(t, 43, commits[0].PullRequest)
+		assert.Nil(t, commits[1].Skipped)
+		assert.Equal(t, 1, commits[1].Operations)
+	})
+
+	t.Run("happy path: dryrun commit by commit only plans HEAD", func(t *testing.T) {
+		config.Config.ApplyCommitByCommit = true
+		defer func() { config.Config.ApplyCommitByCommit = false }()
+
+		fs := memfs.New()
+		fs.MkdirAll("src", 0755)        // create a fake bare repository
+		fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+		fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+		srcsFs, _ := fs.Chroot("src")
+		clonedFs, _ := fs.Chroot("teams")
+		repo, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, repoFixture1)
+		assert.Nil(t, err)
+
+		head, err := repo.Head()
+		assert.Nil(t, err)
+		_, err = repo.CreateTag(GOLIAC_GIT_TAG, head.Hash(), nil)
+		assert.Nil(t, err)
+
+		repoFixtureRename(srcsFs)
+		worktree, err := repo.Worktree()
+		assert.Nil(t, err)
+		_, err = worktree.Add(".")
+		assert.Nil(t, err)
+		hash, err := worktree.Commit("rename repo2 (#42)", &git.CommitOptions{
+			Author: &object.Signature{Name: "user1", Email: "user1@example.com", When: time.Now()},
+		})
+		assert.Nil(t, err)
+		err = repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("master"), hash))
+		assert.Nil(t, err)
+
+		githubClient := NewGitHubClientMock()
+		remote := NewGoliacRemoteExecutorMock().(*GoliacRemoteExecutorMock)
+		usersync.InitPlugins(githubClient)
+
+		goliac := GoliacImpl{
+			local:              engine.NewGoliacLocalImpl(),
+			remote:             remote,
+			remoteGithubClient: githubClient,
+			localGithubClient:  githubClient,
+			repoconfig:         &config.RepositoryConfig{},
+		}
+
+		err, _, _, _ = goliac.Apply(context.Background(), fs, true, "inmemory:///src", "master")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, remote.nbChanges)
+		assert.Equal(t, 0, len(goliac.GetLastAppliedCommits()))
+		// the goliac tag didn't move
+		tag, err := repo.Tag(GOLIAC_GIT_TAG)
+		assert.Nil(t, err)
+		assert.Equal(t, head.Hash(), tag.Hash())
+	})
+}
+
+/*
+ * UserSyncPluginCounter counts the user syncs (delegating to another plugin)
+ */
+type UserSyncPluginCounter struct {
+	plugin engine.UserSyncPlugin
+	nbSync int
+}
+
+func (p *UserSyncPluginCounter) UpdateUsers(repoconfig *config.RepositoryConfig, fs billy.Filesystem, orguserdirrectorypath string, feedback observability.RemoteObservability) (map[string]*entity.User, error) {
+	p.nbSync++
+	return p.plugin.UpdateUsers(repoconfig, fs, orguserdirrectorypath, feedback)
+}
+
+func TestGoliacPlan(t *testing.T) {
+
+	t.Run("happy path: rename a repo", func(t *testing.T) {
+
+		fs := memfs.New()
+		fs.MkdirAll("src", 0755)        // create a fake bare repository
+		fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+		fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+		srcsFs, _ := fs.Chroot("src")
+		clonedFs, _ := fs.Chroot("teams")
+		_, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, repoFixtureRename)
+		assert.Nil(t, err)
+
+		githubClient := NewGitHubClientMock()
+		remote := NewGoliacRemoteExecutorMock().(*GoliacRemoteExecutorMock)
+
+		goliac := GoliacImpl{
+			local:              engine.NewGoliacLocalImpl(),
+			remote:             remote,
+			remoteGithubClient: githubClient,
+			localGithubClient:  githubClient,
+			repoconfig:         &config.RepositoryConfig{},
+		}
+
+		plan, err, errs, warns := goliac.Plan(context.Background(), fs, "inmemory:///src", "master")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(errs))
+		assert.Equal(t, 0, len(warns))
+		assert.NotNil(t, plan)
+		assert.Equal(t, 0, remote.nbChanges) // nothing sent to Github
+
+		assert.Equal(t, 1, len(plan.Repositories))
+		assert.Equal(t, "rename_repository", plan.Repositories[0].Operation)
+		assert.Equal(t, "repo2", plan.Repositories[0].Before)
+		assert.Equal(t, "repo3", plan.Repositories[0].After)
+		assert.Equal(t, 0, plan.Summary().Destructive)
+	})
+
+	t.Run("happy path: the users are synced before planning, like a dryrun apply", func(t *testing.T) {
+
+		fs := memfs.New()
+		fs.MkdirAll("src", 0755)        // create a fake bare repository
+		fs.MkdirAll("teams", 0755)      // create a fake cloned repository
+		fs.MkdirAll(os.TempDir(), 0755) // need a tmp folder
+		srcsFs, _ := fs.Chroot("src")
+		clonedFs, _ := fs.Chroot("teams")
+		_, _, err := helperCreateAndClone(fs, srcsFs, clonedFs, repoFixtureRename)
+		assert.Nil(t, err)
+
+		githubClient := NewGitHubClientMock()
+		remote := NewGoliacRemoteExecutorMock().(*GoliacRemoteExecutorMock)
+
+		usersync.InitPlugins(githubClient)
+		noop, found := engine.GetUserSyncPlugin("noop")
+		assert.True(t, found)
+		counter := &UserSyncPluginCounter{plugin: noop}
+		engine.RegisterPlugin("noop", counter)
+		defer engine.RegisterPlugin("noop", noop)
+
+		syncUsers := config.Config.SyncUsersBeforeApply
+		config.Config.SyncUsersBeforeApply = true
+		defer func() { config.Config.SyncUsersBeforeApply = syncUsers }()
+
+		goliac := GoliacImpl{
+			local:              engine.NewGoliacLocalImpl(),
+			remote:             remote,
+			remoteGithubClient: githubClient,
+			localGithubClient:  githubClient,
+			repoconfig:         &config.RepositoryConfig{},
+		}
+
+		plan, err, _, _ := goliac.Plan(context.Background(), fs, "inmemory:///src", "master")
+		assert.Nil(t, err)
+		assert.NotNil(t, plan)
+		assert.Equal(t, 1, counter.nbSync)
+		assert.Equal(t, 0, remote.nbChanges) // nothing sent to Github
+	})
 }
@@ -5,14 +5,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/Alayacare/goliac/internal/utils"
 )
 
 type SlackNotificationService struct {
-	SlackToken string
+	SlackToken *utils.Secret // reloaded when rotated (if it comes from a file)
 	Channel    string
 }
 
-func NewSlackNotificationService(slackToken string, channel string) NotificationService {
+func NewSlackNotificationService(slackToken *utils.Secret, channel string) NotificationService {
 	return &SlackNotificationService{
 		SlackToken: slackToken,
 		Channel:    channel,
@@ -47,7 +49,7 @@ func (s *SlackNotificationService) SendNotification(message string) error {
 
 	// Set the required headers
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+s.SlackToken)
+	req.Header.Set("Authorization", "Bearer "+string(s.SlackToken.Get()))
 
 	// Make the HTTP request
 	client := &http.Client{}
@@ -30,12 +30,18 @@ type Scaffold struct {
 }
 
 func NewScaffold() (*Scaffold, error) {
-	githubClient, err := github.NewGitHubClientImpl(
+	authenticator, err := github.NewAuthenticatorFromConfig(
 		config.Config.GithubServer,
 		config.Config.GithubAppOrganization,
 		config.Config.GithubAppID,
 		config.Config.GithubAppPrivateKeyFile,
+		config.Config.GithubAppPrivateKey,
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	githubClient, err := github.NewGitHubClientImpl(config.Config.GithubServer, authenticator)
 
 	if err != nil {
 		return nil, err
@@ -505,6 +511,15 @@ usersync:
 }
 
 func (s *Scaffold) generateGithubAction(fs billy.Filesystem, rootpath string) error {
+	// if the Github webhook is configured, the goliac server will
+	// validate (and plan) each PR itself (and publish the check)
+	webhookSecret, err := loadWebhookSecret()
+	if err != nil {
+		logrus.Warnf("not able to read the Github webhook secret, the validate action is generated: %v", err)
+	} else if len(webhookSecret.Get()) > 0 {
+		return nil
+	}
+
 	fs.MkdirAll(filepath.Join(rootpath, ".github", "workflows"), 0755)
 
 	workflow := `
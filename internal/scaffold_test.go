@@ -3,8 +3,11 @@ package internal
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/Alayacare/goliac/internal/config"
 	"github.com/Alayacare/goliac/internal/engine"
 	"github.com/Alayacare/goliac/internal/entity"
 	"github.com/Alayacare/goliac/internal/observability"
@@ -29,6 +32,18 @@ func (s *ScaffoldGoliacRemoteMock) FlushCache() {
 }
 func (s *ScaffoldGoliacRemoteMock) FlushCacheUsersTeamsOnly() {
 }
+func (s *ScaffoldGoliacRemoteMock) RefreshUser(ctx context.Context, login string) error {
+	return nil
+}
+func (s *ScaffoldGoliacRemoteMock) RefreshTeam(ctx context.Context, teamslug string) error {
+	return nil
+}
+func (s *ScaffoldGoliacRemoteMock) RefreshRepository(ctx context.Context, reponame string) error {
+	return nil
+}
+func (s *ScaffoldGoliacRemoteMock) RefreshRulesets(ctx context.Context) error {
+	return nil
+}
 func (s *ScaffoldGoliacRemoteMock) Users(ctx context.Context) map[string]string {
 	return s.users
 }
@@ -54,6 +69,12 @@ func (s *ScaffoldGoliacRemoteMock) RuleSets(ctx context.Context) map[string]*eng
 func (s *ScaffoldGoliacRemoteMock) AppIds(ctx context.Context) map[string]int {
 	return nil
 }
+func (s *ScaffoldGoliacRemoteMock) CustomProperties(ctx context.Context) map[string]*engine.GithubCustomProperty {
+	return nil
+}
+func (s *ScaffoldGoliacRemoteMock) CustomPropertiesError() error {
+	return nil
+}
 func (s *ScaffoldGoliacRemoteMock) IsEnterprise() bool {
 	return true
 }
@@ -314,6 +335,44 @@ func TestScaffoldUnit(t *testing.T) {
 		assert.Nil(t, err)
 		assert.Equal(t, true, found)
 	})
+
+	t.Run("happy path: no github action when the webhook is configured", func(t *testing.T) {
+		fs := memfs.New()
+		config.Config.GithubWebhookSecret = "secret"
+		defer func() { config.Config.GithubWebhookSecret = "" }()
+
+		scaffold := &Scaffold{
+			remote:                     NewScaffoldGoliacRemoteMock(),
+			loadUsersFromGithubOrgSaml: LoadGithubSamlUsersMock,
+		}
+
+		err := scaffold.generateGithubAction(fs, "/")
+		assert.Nil(t, err)
+
+		found, err := utils.Exists(fs, "/.github/workflows/pr.yaml")
+		assert.Nil(t, err)
+		assert.Equal(t, false, found)
+	})
+
+	t.Run("happy path: no github action when the webhook secret is given as a file", func(t *testing.T) {
+		fs := memfs.New()
+		secretFile := filepath.Join(t.TempDir(), "webhook-secret")
+		assert.Nil(t, os.WriteFile(secretFile, []byte("secret\n"), 0600))
+		config.Config.GithubWebhookSecretFile = secretFile
+		defer func() { config.Config.GithubWebhookSecretFile = "" }()
+
+		scaffold := &Scaffold{
+			remote:                     NewScaffoldGoliacRemoteMock(),
+			loadUsersFromGithubOrgSaml: LoadGithubSamlUsersMock,
+		}
+
+		err := scaffold.generateGithubAction(fs, "/")
+		assert.Nil(t, err)
+
+		found, err := utils.Exists(fs, "/.github/workflows/pr.yaml")
+		assert.Nil(t, err)
+		assert.Equal(t, false, found)
+	})
 }
 func TestScaffoldFull(t *testing.T) {
 
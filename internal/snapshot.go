@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Alayacare/goliac/internal/config"
+	"github.com/Alayacare/goliac/internal/engine"
+	"github.com/Alayacare/goliac/internal/github"
+	"github.com/Alayacare/goliac/internal/observability"
+)
+
+/*
+ * ExportOrgSnapshot loads the Github organization and exports it
+ * (to be kept for audit purposes, and compared with engine.DiffOrgSnapshots)
+ */
+func ExportOrgSnapshot(ctx context.Context, feedback observability.RemoteObservability) (*engine.OrgSnapshot, error) {
+	authenticator, err := github.NewAuthenticatorFromConfig(
+		config.Config.GithubServer,
+		config.Config.GithubAppOrganization,
+		config.Config.GithubAppID,
+		config.Config.GithubAppPrivateKeyFile,
+		config.Config.GithubAppPrivateKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	githubClient, err := github.NewGitHubClientImpl(config.Config.GithubServer, authenticator)
+	if err != nil {
+		return nil, err
+	}
+
+	remote := engine.NewGoliacRemoteImpl(githubClient)
+	if feedback != nil {
+		remote.SetRemoteObservability(feedback)
+		nb, err := remote.CountAssets(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error when counting assets: %v", err)
+		}
+		feedback.Init(nb)
+	}
+
+	if err := remote.Load(ctx, false); err != nil {
+		return nil, fmt.Errorf("error when fetching data from Github: %v", err)
+	}
+
+	snapshot := engine.NewOrgSnapshot(ctx, remote, config.Config.GithubAppOrganization)
+	if isTeamsRepoUrl(config.Config.ServerGitRepository) {
+		// to plan a local teams directory against the snapshot
+		if name, err := teamsRepoName(config.Config.ServerGitRepository); err == nil {
+			snapshot.TeamsRepository = name
+		}
+	}
+	return snapshot, nil
+}
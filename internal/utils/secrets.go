@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+/*
+ * Secret is a secret value (private key, token, webhook secret) that is either
+ * static (given inline), or read from a file. A file secret can be reloaded
+ * (for example when a Kubernetes mounted secret is rotated): the new value
+ * replaces the old one atomically, and the previous value is kept to be accepted
+ * during a grace period
+ */
+type Secret struct {
+	name      string
+	path      string // "" for a static secret
+	validator SecretValidator
+	mu        sync.RWMutex
+	value     []byte
+	previous  []byte
+	rotatedAt time.Time
+	version   int // incremented at each rotation
+}
+
+/*
+ * SecretValidator checks a reloaded secret value (for example that a private key
+ * can be parsed) before it replaces the current one
+ */
+type SecretValidator func(value []byte) error
+
+func NewStaticSecret(name string, value []byte) *Secret {
+	return &Secret{
+		name:  name,
+		value: value,
+	}
+}
+
+/*
+ * NewSecretFile reads the secret from a file
+ * (the trailing newlines are removed)
+ */
+func NewSecretFile(name string, path string) (*Secret, error) {
+	value, err := readSecretFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Secret{
+		name:  name,
+		path:  path,
+		value: value,
+	}, nil
+}
+
+func readSecretFile(path string) ([]byte, error) {
+	value, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("not able to read the secret file %s: %v", path, err)
+	}
+	return bytes.TrimRight(value, "\r\n"), nil
+}
+
+/*
+ * SetValidator sets the check a reloaded value must pass to replace the current one
+ */
+func (s *Secret) SetValidator(validator SecretValidator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.validator = validator
+}
+
+func (s *Secret) Name() string {
+	return s.name
+}
+
+func (s *Secret) Get() []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.value
+}
+
+/*
+ * Version is incremented each time the secret is rotated
+ * (to know if something derived from the secret must be renewed)
+ */
+func (s *Secret) Version() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version
+}
+
+/*
+ * Previous returns the value before the last rotation,
+ * if the rotation happened less than gracePeriod ago (nil otherwise)
+ */
+func (s *Secret) Previous(gracePeriod time.Duration) []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.previous == nil || time.Since(s.rotatedAt) > gracePeriod {
+		return nil
+	}
+	return s.previous
+}
+
+/*
+ * Reload re-reads the secret file, and returns true if the secret was rotated.
+ * If the file cannot be read (for example in the middle of a Kubernetes secret update),
+ * or if the new value is not valid, the current value is kept
+ */
+func (s *Secret) Reload() (bool, error) {
+	if s.path == "" {
+		return false, nil
+	}
+	value, err := readSecretFile(s.path)
+	if err != nil {
+		return false, err
+	}
+	if len(value) == 0 {
+		return false, fmt.Errorf("the secret file %s is empty", s.path)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if bytes.Equal(value, s.value) {
+		return false, nil
+	}
+	if s.validator != nil {
+		if err := s.validator(value); err != nil {
+			return false, fmt.Errorf("the secret file %s is not valid (the current value is kept): %v", s.path, err)
+		}
+	}
+	s.previous = s.value
+	s.value = value
+	s.rotatedAt = time.Now()
+	s.version++
+	return true, nil
+}
+
+type SecretRotation struct {
+	Secret    string
+	RotatedAt time.Time
+}
+
+/*
+ * SecretsWatcher periodically reloads the secret files it watches
+ * and keeps track of the rotations
+ */
+type SecretsWatcher struct {
+	mu        sync.Mutex
+	secrets   []*Secret
+	rotations map[string]time.Time // last rotation per secret name
+}
+
+func NewSecretsWatcher() *SecretsWatcher {
+	return &SecretsWatcher{
+		secrets:   make([]*Secret, 0),
+		rotations: make(map[string]time.Time),
+	}
+}
+
+// the secrets watched by the Goliac server
+var DefaultSecretsWatcher = NewSecretsWatcher()
+
+/*
+ * Watch adds the secret to the watched secrets (if it comes from a file)
+ */
+func (w *SecretsWatcher) Watch(secret *Secret) {
+	if secret == nil || secret.path == "" {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.secrets = append(w.secrets, secret)
+}
+
+/*
+ * Reload reloads all the watched secrets, and returns the ones that were rotated
+ */
+func (w *SecretsWatcher) Reload() []*Secret {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	rotated := make([]*Secret, 0)
+	for _, secret := range w.secrets {
+		changed, err := secret.Reload()
+		if err != nil {
+			logrus.Warnf("not able to reload the secret %s: %v", secret.name, err)
+			continue
+		}
+		if changed {
+			logrus.Infof("secret %s rotated (reloaded from %s)", secret.name, secret.path)
+			w.rotations[secret.name] = time.Now()
+			rotated = append(rotated, secret)
+		}
+	}
+	return rotated
+}
+
+/*
+ * Start reloads the watched secrets every interval, until stopCh is closed
+ */
+func (w *SecretsWatcher) Start(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			w.Reload()
+		}
+	}
+}
+
+/*
+ * Rotations returns the last rotation of each rotated secret
+ */
+func (w *SecretsWatcher) Rotations() []SecretRotation {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	rotations := make([]SecretRotation, 0, len(w.rotations))
+	for name, rotatedAt := range w.rotations {
+		rotations = append(rotations, SecretRotation{Secret: name, RotatedAt: rotatedAt})
+	}
+	sort.Slice(rotations, func(i, j int) bool {
+		return rotations[i].Secret < rotations[j].Secret
+	})
+	return rotations
+}
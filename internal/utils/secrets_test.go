@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecrets(t *testing.T) {
+	t.Run("happy path: a static secret is never reloaded", func(t *testing.T) {
+		secret := NewStaticSecret("token", []byte("value"))
+		rotated, err := secret.Reload()
+		assert.Nil(t, err)
+		assert.False(t, rotated)
+		assert.Equal(t, "value", string(secret.Get()))
+	})
+
+	t.Run("happy path: a secret file is rotated", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "token")
+		assert.Nil(t, os.WriteFile(path, []byte("old\n"), 0600))
+
+		secret, err := NewSecretFile("token", path)
+		assert.Nil(t, err)
+		assert.Equal(t, "old", string(secret.Get()))
+		assert.Equal(t, 0, secret.Version())
+
+		// not changed
+		rotated, err := secret.Reload()
+		assert.Nil(t, err)
+		assert.False(t, rotated)
+
+		assert.Nil(t, os.WriteFile(path, []byte("new\n"), 0600))
+		rotated, err = secret.Reload()
+		assert.Nil(t, err)
+		assert.True(t, rotated)
+		assert.Equal(t, "new", string(secret.Get()))
+		assert.Equal(t, 1, secret.Version())
+		assert.Equal(t, "old", string(secret.Previous(time.Hour)))
+		assert.Nil(t, secret.Previous(0))
+	})
+
+	t.Run("not happy path: the secret file is missing or empty", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "token")
+		_, err := NewSecretFile("token", path)
+		assert.NotNil(t, err)
+
+		assert.Nil(t, os.WriteFile(path, []byte("value"), 0600))
+		secret, err := NewSecretFile("token", path)
+		assert.Nil(t, err)
+
+		// in the middle of an update: we keep the current value
+		assert.Nil(t, os.WriteFile(path, []byte(""), 0600))
+		_, err = secret.Reload()
+		assert.NotNil(t, err)
+		assert.Nil(t, os.Remove(path))
+		_, err = secret.Reload()
+		assert.NotNil(t, err)
+		assert.Equal(t, "value", string(secret.Get()))
+	})
+
+	t.Run("not happy path: the new value is not valid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "key")
+		assert.Nil(t, os.WriteFile(path, []byte("valid1"), 0600))
+		secret, err := NewSecretFile("key", path)
+		assert.Nil(t, err)
+		secret.SetValidator(func(value []byte) error {
+			if !strings.HasPrefix(string(value), "valid") {
+				return fmt.Errorf("not a key")
+			}
+			return nil
+		})
+
+		// a truncated (or garbage) file: we keep the current value
+		assert.Nil(t, os.WriteFile(path, []byte("garbage"), 0600))
+		rotated, err := secret.Reload()
+		assert.NotNil(t, err)
+		assert.False(t, rotated)
+		assert.Equal(t, "valid1", string(secret.Get()))
+		assert.Equal(t, 0, secret.Version())
+
+		assert.Nil(t, os.WriteFile(path, []byte("valid2"), 0600))
+		rotated, err = secret.Reload()
+		assert.Nil(t, err)
+		assert.True(t, rotated)
+		assert.Equal(t, "valid2", string(secret.Get()))
+		assert.Equal(t, "valid1", string(secret.Previous(time.Hour)))
+	})
+
+	t.Run("happy path: the watcher keeps track of the rotations", func(t *testing.T) {
+		dir := t.TempDir()
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "key"), []byte("key1"), 0600))
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "token"), []byte("token1"), 0600))
+		key, err := NewSecretFile("key", filepath.Join(dir, "key"))
+		assert.Nil(t, err)
+		token, err := NewSecretFile("token", filepath.Join(dir, "token"))
+		assert.Nil(t, err)
+
+		watcher := NewSecretsWatcher()
+		watcher.Watch(key)
+		watcher.Watch(token)
+		watcher.Watch(NewStaticSecret("static", []byte("value")))
+
+		assert.Equal(t, 0, len(watcher.Reload()))
+		assert.Equal(t, 0, len(watcher.Rotations()))
+
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "token"), []byte("token2"), 0600))
+		rotated := watcher.Reload()
+		assert.Equal(t, 1, len(rotated))
+		assert.Equal(t, "token", rotated[0].Name())
+		assert.Equal(t, "token2", string(token.Get()))
+
+		rotations := watcher.Rotations()
+		assert.Equal(t, 1, len(rotations))
+		assert.Equal(t, "token", rotations[0].Secret)
+	})
+}
@@ -17,9 +17,33 @@ import (
 // swagger:model statistics
 type Statistics struct {
 
+	// GraphQL API points left until githubGraphqlReset, as reported by Github (-1 if unknown)
+	GithubGraphqlRemaining int64 `json:"githubGraphqlRemaining"`
+
+	// when Github resets the GraphQL API budget
+	GithubGraphqlReset string `json:"githubGraphqlReset"`
+
+	// REST API calls left until githubRestReset, as reported by Github (-1 if unknown)
+	GithubRestRemaining int64 `json:"githubRestRemaining"`
+
+	// when Github resets the REST API budget
+	GithubRestReset string `json:"githubRestReset"`
+
+	// last entities fetched
+	LastEntitiesFetched map[string]int64 `json:"lastEntitiesFetched"`
+
 	// last github Api calls
 	LastGithubAPICalls int64 `json:"lastGithubApiCalls"`
 
+	// percentage of the REST GET calls answered from the http cache during the last sync
+	LastGithubCacheHitRatio int64 `json:"lastGithubCacheHitRatio"`
+
+	// REST GET calls answered with a 304 (from the http cache, not counted in the rate limit) during the last sync
+	LastGithubCacheHits int64 `json:"lastGithubCacheHits"`
+
+	// last github retries
+	LastGithubRetries int64 `json:"lastGithubRetries"`
+
 	// last github throttled
 	LastGithubThrottled int64 `json:"lastGithubThrottled"`
 
@@ -29,6 +53,9 @@ type Statistics struct {
 	// max github Api calls
 	MaxGithubAPICalls int64 `json:"maxGithubApiCalls"`
 
+	// max github retries
+	MaxGithubRetries int64 `json:"maxGithubRetries"`
+
 	// max github throttled
 	MaxGithubThrottled int64 `json:"maxGithubThrottled"`
 
@@ -7,6 +7,7 @@ package models
 
 import (
 	"context"
+	"strconv"
 
 	"github.com/go-openapi/errors"
 	"github.com/go-openapi/strfmt"
@@ -25,6 +26,9 @@ type Status struct {
 	// detailed warnings
 	DetailedWarnings []string `json:"detailedWarnings"`
 
+	// failed operations
+	FailedOperations []*StatusFailedOperationsItems0 `json:"failedOperations"`
+
 	// last sync error
 	LastSyncError string `json:"lastSyncError,omitempty"`
 
@@ -44,6 +48,15 @@ type Status struct {
 	// nb users external
 	NbUsersExternal int64 `json:"nbUsersExternal"`
 
+	// operations of the interrupted apply that were not done before the restart
+	ResumedPendingOperations []string `json:"resumedPendingOperations"`
+
+	// resumed run
+	ResumedRun string `json:"resumedRun,omitempty"`
+
+	// last rotation of each secret reloaded from its file
+	SecretsRotations []string `json:"secretsRotations"`
+
 	// version
 	Version string `json:"version,omitempty"`
 }
@@ -52,6 +65,10 @@ type Status struct {
 func (m *Status) Validate(formats strfmt.Registry) error {
 	var res []error
 
+	if err := m.validateFailedOperations(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if err := m.validateLastSyncTime(formats); err != nil {
 		res = append(res, err)
 	}
@@ -62,6 +79,32 @@ func (m *Status) Validate(formats strfmt.Registry) error {
 	return nil
 }
 
+func (m *Status) validateFailedOperations(formats strfmt.Registry) error {
+	if swag.IsZero(m.FailedOperations) { // not required
+		return nil
+	}
+
+	for i := 0; i < len(m.FailedOperations); i++ {
+		if swag.IsZero(m.FailedOperations[i]) { // not required
+			continue
+		}
+
+		if m.FailedOperations[i] != nil {
+			if err := m.FailedOperations[i].Validate(formats); err != nil {
+				if ve, ok := err.(*errors.Validation); ok {
+					return ve.ValidateName("failedOperations" + "." + strconv.Itoa(i))
+				} else if ce, ok := err.(*errors.CompositeError); ok {
+					return ce.ValidateName("failedOperations" + "." + strconv.Itoa(i))
+				}
+				return err
+			}
+		}
+
+	}
+
+	return nil
+}
+
 func (m *Status) validateLastSyncTime(formats strfmt.Registry) error {
 	if swag.IsZero(m.LastSyncTime) { // not required
 		return nil
@@ -74,8 +117,42 @@ func (m *Status) validateLastSyncTime(formats strfmt.Registry) error {
 	return nil
 }
 
-// ContextValidate validates this status based on context it is used
+// ContextValidate validate this status based on the context it is used
 func (m *Status) ContextValidate(ctx context.Context, formats strfmt.Registry) error {
+	var res []error
+
+	if err := m.contextValidateFailedOperations(ctx, formats); err != nil {
+		res = append(res, err)
+	}
+
+	if len(res) > 0 {
+		return errors.CompositeValidationError(res...)
+	}
+	return nil
+}
+
+func (m *Status) contextValidateFailedOperations(ctx context.Context, formats strfmt.Registry) error {
+
+	for i := 0; i < len(m.FailedOperations); i++ {
+
+		if m.FailedOperations[i] != nil {
+
+			if swag.IsZero(m.FailedOperations[i]) { // not required
+				return nil
+			}
+
+			if err := m.FailedOperations[i].ContextValidate(ctx, formats); err != nil {
+				if ve, ok := err.(*errors.Validation); ok {
+					return ve.ValidateName("failedOperations" + "." + strconv.Itoa(i))
+				} else if ce, ok := err.(*errors.CompositeError); ok {
+					return ce.ValidateName("failedOperations" + "." + strconv.Itoa(i))
+				}
+				return err
+			}
+		}
+
+	}
+
 	return nil
 }
 
@@ -96,3 +173,43 @@ func (m *Status) UnmarshalBinary(b []byte) error {
 	*m = res
 	return nil
 }
+
+// StatusFailedOperationsItems0 status failed operations items0
+//
+// swagger:model StatusFailedOperationsItems0
+type StatusFailedOperationsItems0 struct {
+
+	// error
+	Error string `json:"error,omitempty"`
+
+	// operation
+	Operation string `json:"operation,omitempty"`
+}
+
+// Validate validates this status failed operations items0
+func (m *StatusFailedOperationsItems0) Validate(formats strfmt.Registry) error {
+	return nil
+}
+
+// ContextValidate validates this status failed operations items0 based on context it is used
+func (m *StatusFailedOperationsItems0) ContextValidate(ctx context.Context, formats strfmt.Registry) error {
+	return nil
+}
+
+// MarshalBinary interface implementation
+func (m *StatusFailedOperationsItems0) MarshalBinary() ([]byte, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return swag.WriteJSON(m)
+}
+
+// UnmarshalBinary interface implementation
+func (m *StatusFailedOperationsItems0) UnmarshalBinary(b []byte) error {
+	var res StatusFailedOperationsItems0
+	if err := swag.ReadJSON(b, &res); err != nil {
+		return err
+	}
+	*m = res
+	return nil
+}
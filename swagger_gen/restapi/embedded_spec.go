@@ -559,10 +559,52 @@ func init() {
     },
     "statistics": {
       "properties": {
+        "githubGraphqlRemaining": {
+          "description": "GraphQL API points left until githubGraphqlReset, as reported by Github (-1 if unknown)",
+          "type": "integer",
+          "x-omitempty": false
+        },
+        "githubGraphqlReset": {
+          "description": "when Github resets the GraphQL API budget",
+          "type": "string",
+          "x-omitempty": false
+        },
+        "githubRestRemaining": {
+          "description": "REST API calls left until githubRestReset, as reported by Github (-1 if unknown)",
+          "type": "integer",
+          "x-omitempty": false
+        },
+        "githubRestReset": {
+          "description": "when Github resets the REST API budget",
+          "type": "string",
+          "x-omitempty": false
+        },
+        "lastEntitiesFetched": {
+          "description": "number of entities fetched from Github during the last sync, per kind",
+          "type": "object",
+          "additionalProperties": {
+            "type": "integer"
+          },
+          "x-omitempty": false
+        },
         "lastGithubApiCalls": {
           "type": "integer",
           "x-omitempty": false
         },
+        "lastGithubCacheHitRatio": {
+          "description": "percentage of the REST GET calls answered from the http cache during the last sync",
+          "type": "integer",
+          "x-omitempty": false
+        },
+        "lastGithubCacheHits": {
+          "description": "REST GET calls answered with a 304 (from the http cache, not counted in the rate limit) during the last sync",
+          "type": "integer",
+          "x-omitempty": false
+        },
+        "lastGithubRetries": {
+          "type": "integer",
+          "x-omitempty": false
+        },
         "lastGithubThrottled": {
           "type": "integer",
           "x-omitempty": false
@@ -575,6 +617,10 @@ func init() {
           "type": "integer",
           "x-omitempty": false
         },
+        "maxGithubRetries": {
+          "type": "integer",
+          "x-omitempty": false
+        },
         "maxGithubThrottled": {
           "type": "integer",
           "x-omitempty": false
@@ -600,6 +646,20 @@ func init() {
             "type": "string"
           }
         },
+        "failedOperations": {
+          "type": "array",
+          "items": {
+            "type": "object",
+            "properties": {
+              "error": {
+                "type": "string"
+              },
+              "operation": {
+                "type": "string"
+              }
+            }
+          }
+        },
         "lastSyncError": {
           "type": "string"
         },
@@ -623,6 +683,23 @@ func init() {
           "type": "integer",
           "x-omitempty": false
         },
+        "resumedPendingOperations": {
+          "description": "operations of the interrupted apply that were not done before the restart",
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "resumedRun": {
+          "type": "string"
+        },
+        "secretsRotations": {
+          "description": "last rotation of each secret reloaded from its file",
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
         "version": {
           "type": "string"
         }
@@ -1248,6 +1325,17 @@ func init() {
         }
       }
     },
+    "StatusFailedOperationsItems0": {
+      "type": "object",
+      "properties": {
+        "error": {
+          "type": "string"
+        },
+        "operation": {
+          "type": "string"
+        }
+      }
+    },
     "TeamDetailsMembersItems0": {
       "type": "object",
       "properties": {
@@ -1407,10 +1495,52 @@ func init() {
     },
     "statistics": {
       "properties": {
+        "githubGraphqlRemaining": {
+          "description": "GraphQL API points left until githubGraphqlReset, as reported by Github (-1 if unknown)",
+          "type": "integer",
+          "x-omitempty": false
+        },
+        "githubGraphqlReset": {
+          "description": "when Github resets the GraphQL API budget",
+          "type": "string",
+          "x-omitempty": false
+        },
+        "githubRestRemaining": {
+          "description": "REST API calls left until githubRestReset, as reported by Github (-1 if unknown)",
+          "type": "integer",
+          "x-omitempty": false
+        },
+        "githubRestReset": {
+          "description": "when Github resets the REST API budget",
+          "type": "string",
+          "x-omitempty": false
+        },
+        "lastEntitiesFetched": {
+          "description": "number of entities fetched from Github during the last sync, per kind",
+          "type": "object",
+          "additionalProperties": {
+            "type": "integer"
+          },
+          "x-omitempty": false
+        },
         "lastGithubApiCalls": {
           "type": "integer",
           "x-omitempty": false
         },
+        "lastGithubCacheHitRatio": {
+          "description": "percentage of the REST GET calls answered from the http cache during the last sync",
+          "type": "integer",
+          "x-omitempty": false
+        },
+        "lastGithubCacheHits": {
+          "description": "REST GET calls answered with a 304 (from the http cache, not counted in the rate limit) during the last sync",
+          "type": "integer",
+          "x-omitempty": false
+        },
+        "lastGithubRetries": {
+          "type": "integer",
+          "x-omitempty": false
+        },
         "lastGithubThrottled": {
           "type": "integer",
           "x-omitempty": false
@@ -1423,6 +1553,10 @@ func init() {
           "type": "integer",
           "x-omitempty": false
         },
+        "maxGithubRetries": {
+          "type": "integer",
+          "x-omitempty": false
+        },
         "maxGithubThrottled": {
           "type": "integer",
           "x-omitempty": false
@@ -1448,6 +1582,12 @@ func init() {
             "type": "string"
           }
         },
+        "failedOperations": {
+          "type": "array",
+          "items": {
+            "$ref": "#/definitions/StatusFailedOperationsItems0"
+          }
+        },
         "lastSyncError": {
           "type": "string"
         },
@@ -1471,6 +1611,23 @@ func init() {
           "type": "integer",
           "x-omitempty": false
         },
+        "resumedPendingOperations": {
+          "description": "operations of the interrupted apply that were not done before the restart",
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "resumedRun": {
+          "type": "string"
+        },
+        "secretsRotations": {
+          "description": "last rotation of each secret reloaded from its file",
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
         "version": {
           "type": "string"
         }